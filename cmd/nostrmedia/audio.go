@@ -0,0 +1,119 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runAudio uploads or downloads an audio file and publishes its NIP-94
+// event, with its duration, bitrate and cover art.
+func runAudio(args []string) error {
+	fs := flag.NewFlagSet("audio", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	publish := addPublishFlags(fs, common)
+	audioURL := fs.String("url", "", "URL of the audio file")
+	expectedHash := fs.String("expected-hash", "", "Hex sha256 the file must have, refusing it before publishing when it differs")
+	audioPath := fs.String("file", "", "Path to the audio file")
+	description := fs.String("description", "", "Description of the episode or song")
+	descriptionTemplate := fs.String("description-template", "", descriptionTemplateUsage)
+	summary := fs.String("summary", "", "Short excerpt of the description")
+	alt := fs.String("alt", "", "Accessibility description of the audio")
+	cover := fs.String("cover", "", "Path or URL of the cover image, instead of the cover art embedded in the file")
+	showNotes := addShowNotesFlags(fs)
+	series := addSeriesFlags(fs)
+	lang := addLanguageFlags(fs)
+	attribution := addSourceFlags(fs)
+	args, err := resumeArgs("audio", args)
+	if err != nil {
+		return err
+	}
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	checks := newFlagChecks(fs)
+	checks.required("give a local -file or the -url of a hosted audio", "file", "url")
+	checks.exclusive("file", "-file uploads a local audio, -url publishes a hosted one", "url")
+	publish.check(checks)
+	showNotes.check(checks)
+	series.check(checks)
+	if err := checks.err(); err != nil {
+		return err
+	}
+	coverMedia := nip71uploader.Media{Path: *cover}
+	if strings.HasPrefix(*cover, "http://") || strings.HasPrefix(*cover, "https://") {
+		coverMedia = nip71uploader.Media{URL: *cover}
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	createdAt, err := publish.eventCreatedAt()
+	if err != nil {
+		return err
+	}
+	template, err := publish.eventTemplate()
+	if err != nil {
+		return err
+	}
+	languages, err := lang.languages(uploader)
+	if err != nil {
+		return err
+	}
+	source, err := attribution.source()
+	if err != nil {
+		return err
+	}
+	showNotesAddress, err := showNotes.address(ctx, uploader, "")
+	if err != nil {
+		return err
+	}
+	references, err := series.references(ctx, uploader)
+	if err != nil {
+		return err
+	}
+	event, err := publish.startJob("audio", args, uploader)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		event, err = uploader.BuildAudioEvent(ctx, nip71uploader.AudioOptions{
+			Media:               nip71uploader.Media{Path: *audioPath, URL: *audioURL, SHA256: *expectedHash},
+			Description:         *description,
+			DescriptionTemplate: *descriptionTemplate,
+			Summary:             *summary,
+			Alt:                 *alt,
+			Cover:               coverMedia,
+			ShowNotes:           showNotesAddress,
+			References:          references,
+			Languages:           languages,
+			Source:              source,
+			CreatedAt:           createdAt,
+			Template:            template,
+		})
+		if err != nil {
+			printUnfinished(event)
+			return fmt.Errorf("creating NIP-94 event: %v", err)
+		}
+	}
+
+	if err := publish.finish(ctx, uploader, event); err != nil {
+		return err
+	}
+	if err := showNotes.publish(ctx, common, uploader, event, publish.relayHints(uploader), "", *summary); err != nil {
+		return err
+	}
+	return series.publish(ctx, common, uploader, event, publish.relayHints(uploader))
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/girino/nip71-video-uploader/internal/batch"
+	"github.com/girino/nip71-video-uploader/internal/mediamanifest"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runBatch publishes every entry of a manifest, skipping the entries a
+// previous run already published.
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	manifestPath := fs.String("manifest", "", "Path to the .csv or .json manifest (required)")
+	progressPath := fs.String("progress", "", "Progress file used to resume the batch (defaults to <manifest>.progress.json)")
+	jobs := fs.Int("jobs", 2, "Number of entries processed at the same time")
+	kind := fs.String("kind", "video", "Kind of the entries without a kind column: video, picture, file or audio")
+	kinds := addVideoKindFlags(fs, "video-kind", "Use long/horizontal video event kind")
+	templates := entryTemplates{
+		title:       fs.String("title-template", "", "Go template for the title of the videos without a title column"),
+		description: fs.String("description-template", "", descriptionTemplateUsage),
+	}
+	exportPath := fs.String("export-manifest", "", "Add the published events and the checksums and URLs of their media to this JSON manifest")
+	showDashboard := fs.Bool("dashboard", true, "Show the progress of every entry in place instead of log lines, when stderr is a terminal")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+	if err := kinds.validate(); err != nil {
+		return err
+	}
+
+	if *manifestPath == "" {
+		return errors.New("-manifest must be provided")
+	}
+	if *progressPath == "" {
+		*progressPath = *manifestPath + ".progress.json"
+	}
+	entries, err := batch.LoadManifest(*manifestPath)
+	if err != nil {
+		return fmt.Errorf("loading manifest: %v", err)
+	}
+	progress, err := batch.LoadProgress(*progressPath)
+	if err != nil {
+		return fmt.Errorf("loading progress: %v", err)
+	}
+
+	var export *mediamanifest.Writer
+	if *exportPath != "" {
+		if export, err = mediamanifest.Open(*exportPath); err != nil {
+			return fmt.Errorf("opening manifest to export: %v", err)
+		}
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the batch to")
+	}
+	uploader.Pool = nip71uploader.NewRelayPool(uploader.Signer)
+	defer uploader.Pool.Close()
+
+	var board *dashboard
+	if *showDashboard && common.textOutput() && isTerminal(os.Stderr) {
+		board = newDashboard()
+	}
+
+	results := make([]batch.Result, len(entries))
+	sem := make(chan struct{}, max(*jobs, 1))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		if entry.Kind == "" {
+			entry.Kind = *kind
+		}
+		row := board.row(entry.Key())
+		if done, ok := progress.Done(entry.Key()); ok {
+			log.Printf("Skipping %s, already published", entry.Key())
+			row.finish("skipped", "already published", false)
+			results[i] = done
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = batch.Result{Key: entry.Key(), Error: ctx.Err().Error()}
+				row.finish("failed", ctx.Err().Error(), true)
+				return
+			}
+
+			log.Printf("Processing %s", entry.Key())
+			result := publishEntry(ctx, common, uploader, entry, templates, row, export, kinds.isLegacy(), kinds.horizontal(0, 0))
+			results[i] = result
+			if result.Error != "" {
+				log.Printf("Error processing %s: %s", entry.Key(), result.Error)
+				row.finish("failed", result.Error, true)
+				return
+			}
+			row.finish("published", "", false)
+			if err := progress.Complete(result); err != nil {
+				log.Printf("Error saving progress: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	board.close()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if common.jsonOutput() {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	} else if common.textOutput() {
+		printBatchReport(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d entries failed, run the command again to retry them", failed, len(results))
+	}
+	return nil
+}
+
+// entryTemplates fill the titles and descriptions missing from the manifest.
+type entryTemplates struct {
+	title       *string
+	description *string
+}
+
+// publishEntry builds, signs and publishes the event of one entry, showing
+// its progress on the dashboard row and adding it to the exported manifest,
+// which may both be nil.
+func publishEntry(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, entry batch.Entry, templates entryTemplates, row *dashboardRow, export *mediamanifest.Writer, legacy, horizontal bool) batch.Result {
+	result := batch.Result{Key: entry.Key()}
+	var event *nostr.Event
+	var results []nip71uploader.PublishResult
+	defer func() {
+		var err error
+		if result.Error != "" {
+			err = errors.New(result.Error)
+		}
+		common.notify(entry.Key(), event, results, err)
+	}()
+
+	// every entry adds its own hashtags to the configured ones
+	entryUploader := *uploader
+	entryUploader.Hashtags = append(slices.Clone(uploader.Hashtags), entry.Tags...)
+	row.track(&entryUploader)
+
+	media := nip71uploader.Media{Path: entry.File, URL: entry.URL}
+	var publishedAt string
+	if entry.PublishedAt > 0 {
+		publishedAt = strconv.FormatInt(entry.PublishedAt, 10)
+	}
+
+	var err error
+	switch entry.Kind {
+	case "video":
+		event, err = entryUploader.BuildVideoEvent(ctx, nip71uploader.VideoOptions{
+			Media:               media,
+			Title:               entry.Title,
+			TitleTemplate:       *templates.title,
+			Description:         entry.Description,
+			DescriptionTemplate: *templates.description,
+			PublishedAt:         publishedAt,
+			Legacy:              legacy,
+			Horizontal:          horizontal,
+		})
+	case "picture":
+		event, err = entryUploader.BuildPictureEvent(ctx, nip71uploader.PictureOptions{
+			Pictures:    []nip71uploader.Media{media},
+			Title:       entry.Title,
+			Description: entry.Description,
+			PublishedAt: publishedAt,
+		})
+	case "file":
+		event, err = entryUploader.BuildFileEvent(ctx, nip71uploader.FileOptions{
+			Media:               media,
+			Description:         entry.Description,
+			DescriptionTemplate: *templates.description,
+		})
+	case "audio":
+		event, err = entryUploader.BuildAudioEvent(ctx, nip71uploader.AudioOptions{
+			Media:               media,
+			Description:         entry.Description,
+			DescriptionTemplate: *templates.description,
+		})
+	default:
+		err = fmt.Errorf("unknown kind %q", entry.Kind)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := entryUploader.Sign(ctx, event); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.EventID = event.ID
+
+	row.set("publishing", fmt.Sprintf("%d relays", len(entryUploader.Relays)))
+	results = entryUploader.Publish(ctx, event)
+	if err := common.emitEvent(event); err != nil {
+		log.Printf("Error emitting event: %v", err)
+	}
+	common.confirmStored(ctx, event, results)
+	common.archiveEvent(event, results)
+	accepted := common.storedRelays(results)
+	if len(accepted) < *common.minSuccess {
+		outcome := "accepted"
+		if *common.confirm {
+			outcome = "stored"
+		}
+		result.Error = fmt.Sprintf("%s by %d relays, %d required", outcome, len(accepted), *common.minSuccess)
+		return result
+	}
+	row.set("published", fmt.Sprintf("%d of %d relays OK", len(accepted), len(entryUploader.Relays)))
+	common.notifyCollaborators(ctx, &entryUploader, event, nip71uploader.AcceptedRelays(results))
+	if err := export.Add(mediamanifest.NewEntry(event, accepted)); err != nil {
+		log.Printf("Error exporting manifest: %v", err)
+	}
+	result.Nevent, _, err = nip71uploader.EncodeEvent(event, accepted)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+	}
+	return result
+}
+
+// printBatchReport prints one line per manifest entry.
+func printBatchReport(results []batch.Result) {
+	fmt.Println("Batch results:")
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Printf("  FAILED %s: %s\n", result.Key, result.Error)
+		} else {
+			fmt.Printf("  OK     %s: %s\n", result.Key, result.Nevent)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runBoost reposts a video or another event with NIP-18, or quotes it in a
+// note when -quote is given.
+func runBoost(args []string) error {
+	fs := flag.NewFlagSet("boost", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	ref := fs.String("nevent", "", "nevent, naddr, note or event id of the event to boost (required)")
+	quote := fs.String("quote", "", "Text of a kind 1 note quoting the event, instead of a repost")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *ref == "" {
+		return errors.New("-nevent must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	original, seen, err := nip71uploader.FetchEventSeen(ctx, *ref, uploader.Relays)
+	if err != nil {
+		return fmt.Errorf("fetching event: %v", err)
+	}
+	relay := nip71uploader.RelayHint(seen)
+	var event *nostr.Event
+	if *quote != "" {
+		event, err = uploader.BuildQuoteEvent(ctx, original, *quote, relay)
+	} else {
+		event, err = uploader.BuildRepostEvent(ctx, original, relay)
+	}
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("creating boost: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	results := common.publish(ctx, uploader, event)
+	return common.report(event, results, "")
+}
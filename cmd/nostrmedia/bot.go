@@ -0,0 +1,78 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"sync"
+
+	"github.com/girino/nip71-video-uploader/internal/bot"
+	"github.com/girino/nip71-video-uploader/internal/server"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runBot publishes the media posted to Telegram chats or Matrix rooms until
+// interrupted, replying with the nevent of each event.
+func runBot(args []string) error {
+	fs := flag.NewFlagSet("bot", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	telegramToken := fs.String("telegram-token", "", "Token of the Telegram bot, given by @BotFather")
+	var telegramChats, matrixRooms stringSlice
+	fs.Var(&telegramChats, "telegram-chat", "Id of a Telegram chat whose media is published (can be specified multiple times)")
+	matrixHomeserver := fs.String("matrix-homeserver", "", "Base URL of the homeserver of the Matrix bot account, such as https://matrix.org")
+	matrixToken := fs.String("matrix-token", "", "Access token of the Matrix bot account")
+	fs.Var(&matrixRooms, "matrix-room", "Id of a Matrix room whose media is published, such as !abc:matrix.org (can be specified multiple times)")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	var chats []bot.Chat
+	if *telegramToken != "" {
+		// anyone can message a bot, which publishes with your key
+		if len(telegramChats) == 0 {
+			return errors.New("-telegram-chat must list the chats allowed to publish")
+		}
+		chats = append(chats, bot.NewTelegram(*telegramToken, telegramChats))
+	}
+	if *matrixToken != "" {
+		if *matrixHomeserver == "" || len(matrixRooms) == 0 {
+			return errors.New("-matrix-token requires -matrix-homeserver and -matrix-room")
+		}
+		chats = append(chats, bot.NewMatrix(*matrixHomeserver, *matrixToken, matrixRooms))
+	}
+	if len(chats) == 0 {
+		return errors.New("either -telegram-token or -matrix-token must be provided")
+	}
+
+	ctx, stop := interruptContext(0)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the events to")
+	}
+	// the progress of proof of work would interleave between jobs
+	uploader.PowProgress = nil
+	uploader.Pool = nip71uploader.NewRelayPool(uploader.Signer)
+	defer uploader.Pool.Close()
+
+	srv := server.New(ctx, uploader)
+	srv.JobTimeout = *common.timeout
+	srv.Webhook = *common.webhook
+	var wg sync.WaitGroup
+	for _, chat := range chats {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.Run(ctx, chat, srv)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
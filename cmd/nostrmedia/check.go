@@ -0,0 +1,127 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// checkResult is the outcome of checking the links of one event.
+type checkResult struct {
+	EventID  string                   `json:"event_id"`
+	Kind     int                      `json:"kind"`
+	Dead     []nip71uploader.DeadLink `json:"dead"`
+	Repaired string                   `json:"repaired,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// runCheck looks for dead media links in the events published by -key and,
+// with -local, re-uploads the dead media from local copies and publishes
+// corrected events.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	localDir := fs.String("local", "", "Directory with local copies of the media, re-uploaded when their links are dead")
+	keepURL := fs.Bool("keep-url", false, "Keep the dead URLs and add the re-uploaded ones as fallbacks")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to look the events up on")
+	}
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+
+	var files map[string]string
+	if *localDir != "" {
+		files, err = nip71uploader.IndexLocalFiles(ctx, *localDir)
+		if err != nil {
+			return fmt.Errorf("reading local copies: %v", err)
+		}
+	}
+
+	found := nip71uploader.FetchMediaEvents(ctx, pubKey, uploader.Relays)
+	log.Printf("Checking the links of %d events", len(found))
+	var results []checkResult
+	unrepaired := 0
+	for _, event := range found {
+		dead := nip71uploader.CheckLinks(ctx, event)
+		if len(dead) == 0 {
+			continue
+		}
+		result := checkResult{EventID: event.ID, Kind: event.Kind, Dead: dead}
+		if files != nil {
+			repaired, err := uploader.Repair(ctx, event, dead, files, *keepURL)
+			if err == nil && repaired != nil {
+				err = uploader.Sign(ctx, repaired)
+			}
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case repaired != nil:
+				accepted := nip71uploader.AcceptedRelays(uploader.Publish(ctx, repaired))
+				if err := common.emitEvent(repaired); err != nil {
+					log.Printf("Error emitting event: %v", err)
+				}
+				if len(accepted) < *common.minSuccess {
+					result.Error = fmt.Sprintf("accepted by %d relays, %d required", len(accepted), *common.minSuccess)
+				} else {
+					result.Repaired = repaired.ID
+				}
+			}
+		}
+		if result.Repaired == "" {
+			unrepaired++
+		}
+		results = append(results, result)
+	}
+
+	if common.jsonOutput() {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	} else if common.textOutput() {
+		printCheckReport(results)
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("%d events still have dead links", unrepaired)
+	}
+	return nil
+}
+
+// printCheckReport prints the dead links of every event that has some.
+func printCheckReport(results []checkResult) {
+	if len(results) == 0 {
+		fmt.Println("No dead links found")
+		return
+	}
+	for _, result := range results {
+		fmt.Printf("Event %s (kind %d):\n", result.EventID, result.Kind)
+		for _, link := range result.Dead {
+			fmt.Printf("  DEAD %s: %s\n", link.URL, link.Error)
+		}
+		switch {
+		case result.Error != "":
+			fmt.Printf("  repair failed: %s\n", result.Error)
+		case result.Repaired != "":
+			fmt.Printf("  repaired as %s\n", result.Repaired)
+		}
+	}
+}
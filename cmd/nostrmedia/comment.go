@@ -0,0 +1,55 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runComment publishes a NIP-22 comment under a video or another event, such
+// as a note or links pinned under one's own upload.
+func runComment(args []string) error {
+	fs := flag.NewFlagSet("comment", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	ref := fs.String("nevent", "", "nevent, naddr, note or event id of the event to comment on (required)")
+	content := fs.String("content", "", "Text of the comment (required)")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *ref == "" || *content == "" {
+		return errors.New("-nevent and -content must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	root, seen, err := nip71uploader.FetchEventSeen(ctx, *ref, uploader.Relays)
+	if err != nil {
+		return fmt.Errorf("fetching event: %v", err)
+	}
+	relay := nip71uploader.RelayHint(seen)
+	event, err := uploader.BuildCommentEvent(ctx, root, *content, relay)
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("creating comment: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	results := common.publish(ctx, uploader, event)
+	return common.report(event, results, "")
+}
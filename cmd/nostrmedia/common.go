@@ -0,0 +1,998 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/archive"
+	"github.com/girino/nip71-video-uploader/internal/config"
+	"github.com/girino/nip71-video-uploader/internal/jobs"
+	"github.com/girino/nip71-video-uploader/internal/mediadb"
+	"github.com/girino/nip71-video-uploader/internal/mediamanifest"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+	"github.com/girino/nip71-video-uploader/pkg/nwc"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// descriptionTemplateUsage documents the -description-template flags.
+const descriptionTemplateUsage = "Go template for the description when -description is missing, over .Title, .Filename, .Name, " +
+	".Date, .Duration, .Width, .Height, .URL, .SHA256, .MIME, .Size and .UploadDate"
+
+// timestampUsage documents the formats of the flags taking a date.
+const timestampUsage = "unix seconds, RFC 3339, YYYY-MM-DD HH:MM, 'yesterday 20:00' or relative to now such as -2h"
+
+// commonFlags are the flags shared by every subcommand. Flags that are not
+// given on the command line fall back to the configuration file.
+type commonFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	key        *string
+	// otherKeys are the -key flags after the first, cross-posting the
+	// event.
+	otherKeys       stringSlice
+	relay           *string
+	r               *string
+	blossom         *string
+	diff            *int
+	hashtags        stringSlice
+	collaborators   stringSlice
+	notifyNIP04     *bool
+	extraTags       stringSlice
+	emojis          stringSlice
+	tagJSON         *string
+	client          *string
+	output          *string
+	out             *string
+	minSuccess      *int
+	outbox          *bool
+	nip11           *bool
+	broadcast       *bool
+	broadcastList   *string
+	timeout         *time.Duration
+	powTimeout      *time.Duration
+	relayTimeout    *time.Duration
+	publishTimeout  *time.Duration
+	signTimeout     *time.Duration
+	downloadTimeout *time.Duration
+	uploadTimeout   *time.Duration
+	powDVMFlag      *string
+	blake3          *bool
+	noLocalCopy     *bool
+	force           *bool
+	updateExisting  *bool
+	ffmpeg          *string
+	ffprobe         *string
+	ffmpegDL        *bool
+	relayRate       *float64
+	tmpdir          *string
+	imetaFields     *string
+	noBlurhash      *bool
+	thumbhash       *bool
+	classifyCmd     *string
+	maxUploadSize   *string
+	authExpiration  *time.Duration
+	nwc             *string
+	confirm         *bool
+	archiveDir      *string
+	maxSpend        *int64
+	webhook         *string
+	proxy           *string
+	userAgent       *string
+	config          *config.Config
+	// archive is the -archive-dir archive, nil without it.
+	archive *archive.Archive
+	// budget pays through -nwc, keeping the total spent in the run.
+	budget *nwc.Budget
+	// closers are closed by close once the command is done.
+	closers []io.Closer
+	// emitMu serializes emitEvent, and outFile is the -out file it opened.
+	emitMu  sync.Mutex
+	outFile *os.File
+	// notified is set once a job was reported to -webhook, so that the
+	// failure of the command is not reported again.
+	notified atomic.Bool
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	c := &commonFlags{
+		fs:              fs,
+		configPath:      fs.String("config", config.DefaultPath(), "Path to the configuration file"),
+		key:             new(string),
+		relay:           fs.String("relay", "", "Relay address, nrelay or path to relays.json file"),
+		r:               fs.String("r", "", "Relay address or path to relays.json file (short flag)"),
+		blossom:         fs.String("blossom", nip71uploader.DefaultBlossomServer, "Base URL for the blossom server"),
+		diff:            fs.Int("diff", 16, "Proof of work difficulty"),
+		client:          fs.String("client", "", "Client name published in a 'client' tag"),
+		output:          fs.String("output", "text", "Output format: text, json (JSON on stdout, logs on stderr) or event-only (the signed event on one line, for nak)"),
+		out:             fs.String("out", "", "Also write the signed events to this file, one JSON event per line"),
+		minSuccess:      fs.Int("min-success", 1, "Exit with an error unless at least this many relays accept the event"),
+		outbox:          fs.Bool("outbox", true, "Without -relay, publish to the write relays of your NIP-65 relay list"),
+		nip11:           fs.Bool("nip11", true, "Check the NIP-11 limits of the relays before mining proof of work"),
+		broadcast:       fs.Bool("broadcast", false, "Also publish the event to a list of large public relays"),
+		timeout:         fs.Duration("timeout", 0, "Give up the whole command after this long (e.g. 30m, 0 for no limit); bounds each job with serve"),
+		powTimeout:      fs.Duration("pow-timeout", 0, "Give up mining proof of work after this long (e.g. 10m, 0 for no limit)"),
+		relayTimeout:    fs.Duration("relay-timeout", nip71uploader.RelayTimeout, "Timeout of connecting to a relay and of each query or publish"),
+		publishTimeout:  fs.Duration("publish-timeout", nip71uploader.PublishDeadline, "Timeout of publishing an event to all the relays"),
+		signTimeout:     fs.Duration("sign-timeout", nip71uploader.SignTimeout, "Timeout of signing an event, longer for remote signers"),
+		downloadTimeout: fs.Duration("download-timeout", 0, "Timeout of downloading each media file (0 for no limit)"),
+		uploadTimeout:   fs.Duration("upload-timeout", 0, "Timeout of uploading each media file (0 for no limit)"),
+		authExpiration:  fs.Duration("auth-expiration", nip71uploader.AuthExpiration, "How long the authorizations sent to Blossom servers stay valid, and can be reused"),
+		powDVMFlag:      fs.String("pow-dvm", "", "Pubkey of a NIP-90 DVM to delegate proof of work to, or 'any'"),
+		broadcastList:   fs.String("broadcast-list", "", "URL of a JSON array of relays to use with -broadcast instead of the built-in list"),
+		blake3:          fs.Bool("blake3", false, "Also compute the BLAKE3 digest of local files for the media database"),
+		noLocalCopy:     fs.Bool("no-local-copy", false, "Measure and hash remote videos and audio files in place with Range requests, instead of downloading them to a temporary file"),
+		force:           fs.Bool("force", false, "Publish media even if the media database knows you published it already"),
+		updateExisting:  fs.Bool("update-existing", false, "Update the event that already published the media, keeping its title, description, published_at and hashtags and adding the new URLs"),
+		ffmpeg:          fs.String("ffmpeg-path", "ffmpeg", "Path of the ffmpeg executable, when it is not in the PATH"),
+		ffprobe:         fs.String("ffprobe-path", "ffprobe", "Path of the ffprobe executable, when it is not in the PATH"),
+		ffmpegDL:        fs.Bool("ffmpeg-download", false, "Download static ffmpeg and ffprobe builds to the cache directory when they are not installed"),
+		relayRate:       fs.Float64("relay-rate", 0, "Most events sent to each relay per minute, for bulk publishing (0 for no limit)"),
+		tmpdir:          fs.String("tmpdir", "", "Directory of the temporary files, such as downloads and conversions (defaults to the system one)"),
+		maxUploadSize:   fs.String("max-upload-size", "", "Refuse uploading files larger than this, such as 500MB or 2GB"),
+		archiveDir:      fs.String("archive-dir", "", "Keep every published event and a copy of its media in this directory"),
+		confirm:         fs.Bool("confirm", false, "After publishing, query the relays until they return the event; -min-success then counts the relays storing it"),
+		nwc:             fs.String("nwc", "", "Nostr Wallet Connect URI (nostr+walletconnect://...) paying Blossom servers and DVMs that require payment"),
+		maxSpend:        fs.Int64("max-spend", 1000, "Most sats paid through -nwc in one run (0 for no limit)"),
+		imetaFields:     fs.String("imeta-fields", "", "Comma separated media fields to publish, such as url,m,x,size,dim (defaults depend on the kind)"),
+		noBlurhash:      fs.Bool("no-blurhash", false, "Do not compute blurhash placeholders, which saves extracting a frame of videos"),
+		thumbhash:       fs.Bool("thumbhash", false, "Also publish a ThumbHash placeholder of images and videos"),
+		classifyCmd:     fs.String("classify-cmd", "", "Command classifying every media file, given as last argument, printing sfw, nsfw [reason] or reject [reason]"),
+		webhook:         fs.String("webhook", "", "URL receiving a JSON POST with the event id, nevent, relays, media URLs or error after each job"),
+		proxy:           fs.String("proxy", "", "HTTP or SOCKS5 proxy of every connection to servers and relays, such as socks5://127.0.0.1:9050 for Tor"),
+		userAgent:       fs.String("user-agent", userAgent(), "User-Agent sent to servers and relays, empty to send none"),
+	}
+	fs.Var(&keyFlag{key: c.key, others: &c.otherKeys}, "key", "Private key for signing the event; given again, the event is also published from the other keys")
+	fs.Var(&c.hashtags, "hashtag", "Hashtag added to the event (can be specified multiple times)")
+	fs.Var(&c.extraTags, "extra-tag", "Tag added to the event as key=value (can be specified multiple times)")
+	fs.Var(&c.emojis, "emoji", "Custom emoji used as :shortcode: in the title or description, given as shortcode=url (can be specified multiple times)")
+	fs.Var(&c.collaborators, "notify", "npub of a collaborator sent a direct message with the nevent once the event is published (can be specified multiple times)")
+	c.notifyNIP04 = fs.Bool("notify-nip04", false, "Send the -notify messages as NIP-04 instead of NIP-17 direct messages, for older clients")
+	c.tagJSON = fs.String("tag-json", "", "JSON file with an array of tags added to the event, such as [[\"k\", \"v\", \"x\"]]")
+	return c
+}
+
+// parse parses the command line and fills the flags that were not given
+// from the configuration file.
+func (c *commonFlags) parse(args []string) error {
+	c.fs.Parse(args)
+	if *c.output != "text" && *c.output != "json" && *c.output != "event-only" {
+		return fmt.Errorf("invalid -output %q, must be text, json or event-only", *c.output)
+	}
+
+	cfg, err := config.Load(*c.configPath)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %v", err)
+	}
+	c.config = cfg
+
+	set := make(map[string]bool)
+	c.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["key"] && cfg.Key != "" {
+		*c.key = cfg.Key
+	}
+	if !set["blossom"] && cfg.Blossom != "" {
+		*c.blossom = cfg.Blossom
+	}
+	if !set["diff"] && cfg.Diff != nil {
+		*c.diff = *cfg.Diff
+	}
+	if !set["client"] && cfg.Client != "" {
+		*c.client = cfg.Client
+	}
+	if !set["hashtag"] {
+		c.hashtags = cfg.Hashtags
+	}
+	if !set["ffmpeg-path"] && cfg.FFmpeg != "" {
+		*c.ffmpeg = cfg.FFmpeg
+	}
+	if !set["ffprobe-path"] && cfg.FFprobe != "" {
+		*c.ffprobe = cfg.FFprobe
+	}
+	if !set["tmpdir"] && cfg.TempDir != "" {
+		*c.tmpdir = cfg.TempDir
+	}
+	if !set["archive-dir"] && cfg.ArchiveDir != "" {
+		*c.archiveDir = cfg.ArchiveDir
+	}
+	if !set["classify-cmd"] && cfg.ClassifyCmd != "" {
+		*c.classifyCmd = cfg.ClassifyCmd
+	}
+	if !set["nwc"] && cfg.NWC != "" {
+		*c.nwc = cfg.NWC
+	}
+	if !set["max-spend"] && cfg.MaxSpend != nil {
+		*c.maxSpend = *cfg.MaxSpend
+	}
+	if *c.maxSpend < 0 {
+		return errors.New("-max-spend cannot be negative")
+	}
+	// the cap is counted in millisatoshis
+	if *c.maxSpend > math.MaxInt64/1000 {
+		return fmt.Errorf("-max-spend cannot exceed %d sats", int64(math.MaxInt64/1000))
+	}
+	if !set["webhook"] && cfg.Webhook != "" {
+		*c.webhook = cfg.Webhook
+	}
+	if !set["proxy"] && cfg.Proxy != "" {
+		*c.proxy = cfg.Proxy
+	}
+	if !set["user-agent"] && cfg.UserAgent != "" {
+		*c.userAgent = cfg.UserAgent
+	}
+	if err := setupNetwork(*c.proxy, *c.userAgent); err != nil {
+		return err
+	}
+	if *c.webhook != "" {
+		failureHooks = append(failureHooks, c.notifyFailure)
+	}
+	nip71uploader.FFmpeg = *c.ffmpeg
+	nip71uploader.FFprobe = *c.ffprobe
+	nip71uploader.DownloadFFmpeg = *c.ffmpegDL
+	nip71uploader.TempDir = *c.tmpdir
+	if *c.relayRate < 0 {
+		return errors.New("-relay-rate cannot be negative")
+	}
+	nip71uploader.RelayRate = *c.relayRate
+	// the files of a failed cleanup are only left for the next run
+	if removed, err := nip71uploader.RemoveOrphanedTemp(nip71uploader.OrphanedTempAge); err != nil {
+		log.Printf("Error removing the temporary files of earlier runs: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d temporary files left behind by earlier runs", removed)
+	}
+	nip71uploader.RelayTimeout = *c.relayTimeout
+	nip71uploader.PublishDeadline = *c.publishTimeout
+	nip71uploader.SignTimeout = *c.signTimeout
+	nip71uploader.DownloadTimeout = *c.downloadTimeout
+	nip71uploader.UploadTimeout = *c.uploadTimeout
+	if *c.authExpiration <= 0 {
+		return errors.New("-auth-expiration must be positive")
+	}
+	nip71uploader.AuthExpiration = *c.authExpiration
+	for server, auth := range cfg.BlossomAuth {
+		nip71uploader.ServerAuths[strings.TrimRight(server, "/")] = nip71uploader.ServerAuth{
+			Content:    auth.Content,
+			Expiration: auth.Expiration,
+			Scoped:     auth.Scoped,
+			Nonce:      auth.Nonce,
+		}
+	}
+	return nil
+}
+
+// setupNetwork sends every connection through the proxy, if any, with the
+// User-Agent agent.
+func setupNetwork(proxy, agent string) error {
+	if proxy != "" {
+		proxyURL, err := nip71uploader.ParseProxy(proxy)
+		if err != nil {
+			return flagError("proxy", err, "give a URL such as socks5://127.0.0.1:9050 or http://proxy.example.com:3128")
+		}
+		nip71uploader.UseProxy(proxyURL)
+	}
+	nip71uploader.UserAgent = agent
+	return nil
+}
+
+// signer creates the signer for -key.
+func (c *commonFlags) signer() (nostr.Keyer, error) {
+	signer, err := nip71uploader.NewSigner(*c.key)
+	if err != nil {
+		return nil, fmt.Errorf("creating signer: %v", err)
+	}
+	return signer, nil
+}
+
+// keyFlag is the -key flag: its first value signs the events, and the other
+// ones cross-post them.
+type keyFlag struct {
+	key    *string
+	others *stringSlice
+}
+
+func (k *keyFlag) String() string {
+	if k.key == nil {
+		return ""
+	}
+	return *k.key
+}
+
+func (k *keyFlag) Set(value string) error {
+	if *k.key == "" {
+		*k.key = value
+		return nil
+	}
+	return k.others.Set(value)
+}
+
+// otherSigners creates the signers of the -key flags after the first.
+func (c *commonFlags) otherSigners() ([]nostr.Keyer, error) {
+	var signers []nostr.Keyer
+	for _, key := range c.otherKeys {
+		signer, err := nip71uploader.NewSigner(key)
+		if err != nil {
+			return nil, fmt.Errorf("creating signer: %v", err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// relays loads the relays from -relay, falling back to -r, to the relays of
+// the configuration file and finally to the write relays of the signer's
+// NIP-65 relay list.
+func (c *commonFlags) relays(ctx context.Context, signer nostr.Keyer) ([]string, error) {
+	relays, err := c.givenRelays()
+	if err != nil {
+		return nil, err
+	}
+	if len(relays) == 0 && *c.outbox {
+		return c.outboxRelays(ctx, signer)
+	}
+	return relays, nil
+}
+
+// givenRelays loads the relays from -relay, falling back to -r and to the
+// relays of the configuration file, for commands that need no signer.
+func (c *commonFlags) givenRelays() ([]string, error) {
+	relays, err := loadRelays(*c.relay)
+	if err == nil && len(relays) == 0 {
+		relays, err = loadRelays(*c.r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(relays) == 0 && (*c.relay != "" || *c.r != "") {
+		return nil, fmt.Errorf("no relays found to publish the event. Relay parameter: %s%s", *c.relay, *c.r)
+	}
+	if len(relays) == 0 && c.config != nil {
+		relays = c.config.Relays
+	}
+	return relays, nil
+}
+
+// outboxRelays fetches the signer's write relays from the indexer relays.
+func (c *commonFlags) outboxRelays(ctx context.Context, signer nostr.Keyer) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, nip71uploader.RequestTimeout)
+	defer cancel()
+	pubKey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	var indexers []string
+	if c.config != nil {
+		indexers = c.config.Indexers
+	}
+	relays := nip71uploader.FetchWriteRelays(ctx, pubKey, indexers)
+	if len(relays) > 0 {
+		log.Printf("Using %d write relays from the NIP-65 relay list", len(relays))
+	}
+	return relays, nil
+}
+
+// uploader returns an Uploader configured from the common flags. The media
+// database it opens is closed by close.
+func (c *commonFlags) uploader(ctx context.Context) (*nip71uploader.Uploader, error) {
+	signer, err := c.signer()
+	if err != nil {
+		return nil, err
+	}
+	relays, err := c.relays(ctx, signer)
+	if err != nil {
+		return nil, err
+	}
+	powDVM, err := c.powDVM()
+	if err != nil {
+		return nil, err
+	}
+	var imetaFields []string
+	if *c.imetaFields != "" {
+		imetaFields = strings.Split(strings.ReplaceAll(*c.imetaFields, " ", ""), ",")
+		if err := nip71uploader.CheckImetaFields(imetaFields); err != nil {
+			return nil, fmt.Errorf("invalid -imeta-fields: %v", err)
+		}
+	}
+	extraTags, err := c.extraEventTags()
+	if err != nil {
+		return nil, err
+	}
+	var emojis nostr.Tags
+	for _, value := range c.emojis {
+		emoji, err := nip71uploader.ParseEmoji(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -emoji: %v", err)
+		}
+		emojis = append(emojis, emoji)
+	}
+	for _, npub := range c.collaborators {
+		if _, err := nip71uploader.DecodePubKey(npub); err != nil {
+			return nil, fmt.Errorf("invalid -notify %s: %v", npub, err)
+		}
+	}
+	if _, err := c.otherSigners(); err != nil {
+		return nil, fmt.Errorf("invalid -key: %v", err)
+	}
+	var maxUploadSize int64
+	if *c.maxUploadSize != "" {
+		if maxUploadSize, err = nip71uploader.ParseSize(*c.maxUploadSize); err != nil {
+			return nil, fmt.Errorf("invalid -max-upload-size: %v", err)
+		}
+	}
+	uploader := &nip71uploader.Uploader{
+		Signer:     signer,
+		Blossom:    *c.blossom,
+		Relays:     relays,
+		Difficulty: *c.diff,
+		Hashtags:   c.hashtags,
+		ExtraTags:  extraTags,
+		Emojis:     emojis,
+		Client:     *c.client,
+
+		CheckRelayInfo: *c.nip11,
+		PowTimeout:     *c.powTimeout,
+		PowProgress:    logPowProgress,
+		PowDVM:         powDVM,
+		HashProgress:   logHashProgress,
+		BLAKE3:         *c.blake3,
+		NoLocalCopy:    *c.noLocalCopy,
+		Force:          *c.force,
+		UpdateExisting: *c.updateExisting,
+		ImetaFields:    imetaFields,
+		MaxUploadSize:  maxUploadSize,
+		Previews:       nip71uploader.Previews{NoBlurhash: *c.noBlurhash, Thumbhash: *c.thumbhash},
+	}
+	// the version of nostrmedia says nothing about another client
+	if strings.EqualFold(*c.client, "nostrmedia") {
+		uploader.ClientVersion = currentVersion()
+	}
+	if *c.classifyCmd != "" {
+		if uploader.Classify, err = nip71uploader.ClassifyCommand(*c.classifyCmd); err != nil {
+			return nil, fmt.Errorf("invalid -classify-cmd: %v", err)
+		}
+	}
+	if *c.nwc != "" {
+		wallet, err := nwc.Parse(*c.nwc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -nwc: %v", err)
+		}
+		c.budget = nwc.NewBudget(wallet, *c.maxSpend*1000)
+		uploader.PayInvoice = c.budget.PayInvoice
+	}
+	if *c.archiveDir != "" {
+		if c.archive, err = archive.Open(*c.archiveDir); err != nil {
+			return nil, err
+		}
+		uploader.Archive = c.archive
+	}
+	// without the database, files are simply hashed and uploaded again
+	if db, err := mediadb.Open(mediadb.DefaultPath()); err != nil {
+		log.Printf("Not using the media database: %v", err)
+	} else {
+		uploader.HashCache = db
+		uploader.MediaIndex = db
+		c.closers = append(c.closers, db)
+	}
+	return uploader, nil
+}
+
+// extraEventTags parses the -extra-tag tags, followed by the -tag-json ones.
+func (c *commonFlags) extraEventTags() (nostr.Tags, error) {
+	var tags nostr.Tags
+	for _, value := range c.extraTags {
+		tag, err := nip71uploader.ParseTag(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -extra-tag: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	if *c.tagJSON != "" {
+		loaded, err := nip71uploader.LoadTags(*c.tagJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -tag-json: %v", err)
+		}
+		tags = append(tags, loaded...)
+	}
+	return tags, nil
+}
+
+// close closes the databases opened for the command, logging the errors as
+// the command is done anyway.
+func (c *commonFlags) close() {
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing: %v", err)
+		}
+	}
+	c.closers = nil
+	if c.budget != nil && c.budget.Spent() > 0 {
+		log.Printf("Paid %d sats through the wallet", c.budget.Spent()/1000)
+	}
+}
+
+// notify posts the outcome of a job to -webhook, logging the errors as the
+// job is done anyway. job names it, such as the key of a batch entry, and
+// event is nil when the job failed before building it.
+func (c *commonFlags) notify(job string, event *nostr.Event, results []nip71uploader.PublishResult, err error) {
+	if *c.webhook == "" {
+		return
+	}
+	c.notified.Store(true)
+	// the webhook is still told when the command was interrupted
+	ctx := context.Background()
+	if err := nip71uploader.PostWebhook(ctx, *c.webhook, nip71uploader.NewWebhookPayload(job, event, results, err)); err != nil {
+		log.Printf("Error posting to -webhook: %v", err)
+	}
+}
+
+// notifyCollaborators sends the -notify collaborators a direct message with
+// the published event, logging the errors as the event is published anyway.
+func (c *commonFlags) notifyCollaborators(ctx context.Context, uploader *nip71uploader.Uploader, event *nostr.Event, accepted []string) {
+	if len(c.collaborators) == 0 || len(accepted) == 0 {
+		return
+	}
+	message, err := nip71uploader.PublishedMessage(event, accepted)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+		return
+	}
+	var indexers []string
+	if c.config != nil {
+		indexers = c.config.Indexers
+	}
+	for _, npub := range c.collaborators {
+		recipient, _ := nip71uploader.DecodePubKey(npub)
+		if *c.notifyNIP04 {
+			err = nip71uploader.SendLegacyDirectMessage(ctx, *c.key, recipient, message, uploader.Relays)
+		} else {
+			err = nip71uploader.SendDirectMessage(ctx, uploader.Signer, recipient, message, uploader.Relays, indexers)
+		}
+		if err != nil {
+			log.Printf("Error notifying %s: %v", npub, err)
+		} else {
+			log.Printf("Notified %s", npub)
+		}
+	}
+}
+
+// notifyFailure posts the error of a command that failed before any job was
+// reported to -webhook.
+func (c *commonFlags) notifyFailure(err error) {
+	if !c.notified.Load() {
+		c.notify(c.fs.Name(), nil, nil, err)
+	}
+}
+
+// powDVM decodes -pow-dvm, keeping "any" as is.
+func (c *commonFlags) powDVM() (string, error) {
+	return decodeDVM("pow-dvm", *c.powDVMFlag)
+}
+
+// decodeDVM decodes the pubkey of a DVM given to the named flag, keeping
+// "any" as is.
+func decodeDVM(name, value string) (string, error) {
+	if value == "" || value == "any" {
+		return value, nil
+	}
+	pubKey, err := nip71uploader.DecodePubKey(value)
+	if err != nil {
+		return "", flagError(name, err, "give the npub or hex pubkey of the DVM, or any")
+	}
+	return pubKey, nil
+}
+
+// logPowProgress logs the progress of long proof of work computations.
+func logPowProgress(status nip71uploader.PowStatus) {
+	log.Printf("Mining proof of work: %.0f kH/s, best difficulty %d of %d, %s elapsed",
+		status.Hashrate()/1000, status.Best, status.Target, status.Elapsed.Round(time.Second))
+}
+
+// logHashProgress logs the progress of hashing large files.
+func logHashProgress(status nip71uploader.HashStatus) {
+	log.Printf("Hashing %s: %d%%, %.0f MB/s", status.Path,
+		100*status.Done/max(status.Total, 1), status.Rate()/1e6)
+}
+
+// printUnfinished logs an event whose proof of work could not be mined, so
+// the work done building it is not lost.
+func printUnfinished(event *nostr.Event) {
+	if event != nil {
+		log.Printf("Event built without proof of work: %v", event)
+	}
+}
+
+// interruptContext returns a context cancelled by Ctrl-C or SIGTERM, or
+// once timeout elapsed when it is not zero, which interrupts uploads,
+// downloads and the proof of work computation so that the command returns
+// its error and its deferred cleanups run. A second signal removes the
+// temporary files and exits right away, in case something does not stop.
+func interruptContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	signals := make(chan os.Signal, 2)
+	stopped := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("Received %v, stopping (send it again to exit right away)", sig)
+			cancel()
+		case <-stopped:
+			return
+		}
+		select {
+		case <-signals:
+			nip71uploader.RemoveTempFiles()
+			os.Exit(1)
+		case <-stopped:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(stopped)
+		cancel()
+	}
+}
+
+// publish sends the event to the uploader's relays and, with -broadcast, to
+// the broadcast relays.
+func (c *commonFlags) publish(ctx context.Context, uploader *nip71uploader.Uploader, event *nostr.Event) []nip71uploader.PublishResult {
+	results := uploader.Publish(ctx, event)
+	if !*c.broadcast {
+		c.confirmStored(ctx, event, results)
+		c.archiveEvent(event, results)
+		return results
+	}
+
+	relays := nip71uploader.BroadcastRelays
+	if *c.broadcastList != "" {
+		fetched, err := nip71uploader.FetchBroadcastRelays(ctx, *c.broadcastList)
+		if err != nil {
+			log.Printf("Error fetching broadcast relays, using the built-in list: %v", err)
+		} else {
+			relays = fetched
+		}
+	}
+	log.Printf("Broadcasting event to %d relays", len(relays))
+	results = append(results, nip71uploader.Broadcast(ctx, event, uploader.Signer, relays, uploader.Relays)...)
+	c.confirmStored(ctx, event, results)
+	c.archiveEvent(event, results)
+	return results
+}
+
+// archiveEvent adds the event to -archive-dir once a relay accepted it.
+func (c *commonFlags) archiveEvent(event *nostr.Event, results []nip71uploader.PublishResult) {
+	if c.archive == nil || len(nip71uploader.AcceptedRelays(results)) == 0 {
+		return
+	}
+	if dir, err := c.archive.Add(event); err != nil {
+		log.Printf("Error archiving event: %v", err)
+	} else {
+		log.Printf("Archived event in %s", dir)
+	}
+}
+
+// confirmStored checks with -confirm that the relays that accepted the event
+// return it.
+func (c *commonFlags) confirmStored(ctx context.Context, event *nostr.Event, results []nip71uploader.PublishResult) {
+	if !*c.confirm || len(nip71uploader.AcceptedRelays(results)) == 0 {
+		return
+	}
+	log.Printf("Confirming the relays store the event")
+	nip71uploader.ConfirmStored(ctx, event, results)
+}
+
+// storedRelays returns the relays that stored the event: the ones that
+// returned it with -confirm, and the ones that accepted it otherwise.
+func (c *commonFlags) storedRelays(results []nip71uploader.PublishResult) []string {
+	if *c.confirm {
+		return nip71uploader.ConfirmedRelays(results)
+	}
+	return nip71uploader.AcceptedRelays(results)
+}
+
+func loadRelays(relayParam string) ([]string, error) {
+	relays, err := nip71uploader.LoadRelays(relayParam)
+	if err != nil {
+		return nil, fmt.Errorf("loading relays: %v", err)
+	}
+	return relays, nil
+}
+
+// publishFlags control what happens to an event once it has been built:
+// saving it as a draft, publishing it now, or scheduling it.
+type publishFlags struct {
+	common      *commonFlags
+	draft       *string
+	unsigned    *bool
+	publishAt   *string
+	createdAt   *string
+	scheduleDVM *string
+	resume      *string
+	preview     *bool
+	replace     *bool
+	export      *string
+	template    *string
+	tracker     *jobs.Tracker
+	// loaded is the -template event, read once.
+	loaded *nostr.Event
+	// accepted are the relays that accepted the published event.
+	accepted []string
+}
+
+func addPublishFlags(fs *flag.FlagSet, common *commonFlags) *publishFlags {
+	return &publishFlags{
+		common:      common,
+		draft:       fs.String("draft", "", "Write the event to this file instead of publishing it"),
+		unsigned:    fs.Bool("unsigned", false, "Leave the draft event unsigned (only with -draft)"),
+		publishAt:   fs.String("publish-at", "", "Time when the event should be published ("+timestampUsage+")"),
+		createdAt:   fs.String("created-at", "", "Backdate the event created_at to this time ("+timestampUsage+")"),
+		scheduleDVM: fs.String("schedule-dvm", "", "Pubkey of a NIP-90 DVM to schedule publishing with, instead of waiting locally"),
+		resume:      fs.String("resume", "", "Resume an interrupted job from its last completed stage"),
+		export:      fs.String("export-manifest", "", "Add the published event and the checksums and URLs of its media to this JSON manifest"),
+		preview:     fs.Bool("preview", false, "Show a summary of the built event and ask for confirmation before mining and publishing it"),
+		replace:     fs.Bool("replace", false, "Replace an addressable event with the same d tag found on the relays without asking"),
+		template:    fs.String("template", "", "Partial event JSON file, or - for stdin, whose content and tags are merged into the built event"),
+	}
+}
+
+// check reports the problems with the publish flags, and with several -key
+// that cannot be combined with them.
+func (p *publishFlags) check(checks *flagChecks) {
+	checks.requires("unsigned", "draft", "only drafts are saved unsigned, to be signed and published later with the publish command")
+	checks.exclusive("draft", "a draft is saved instead of being published or scheduled", "schedule-dvm")
+	checks.requires("schedule-dvm", "publish-at", "the DVM publishes the event at the -publish-at time")
+	if len(p.common.otherKeys) > 0 && (checks.given("draft") || checks.given("schedule-dvm")) {
+		checks.add("key", "several -key cannot be used with -draft or -schedule-dvm", "the copies are published from the other keys right after the event, give them when publishing it")
+	}
+	for _, name := range []string{"publish-at", "created-at"} {
+		if value := checks.fs.Lookup(name).Value.String(); value != "" {
+			if _, err := nip71uploader.ParseTimestamp(value); err != nil {
+				checks.check(flagError(name, err, ""))
+			}
+		}
+	}
+	if *p.scheduleDVM != "" {
+		if _, err := nip71uploader.DecodePubKey(*p.scheduleDVM); err != nil {
+			checks.check(flagError("schedule-dvm", err, "give the npub or hex pubkey of the DVM"))
+		}
+	}
+	if _, err := p.eventTemplate(); err != nil {
+		checks.check(err)
+	}
+}
+
+// scheduledAt returns the -publish-at time, or 0 when publishing right away.
+func (p *publishFlags) scheduledAt() (nostr.Timestamp, error) {
+	if *p.publishAt == "" {
+		return 0, nil
+	}
+	scheduledAt, err := nip71uploader.ParseTimestamp(*p.publishAt)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -publish-at: %v", err)
+	}
+	return nostr.Timestamp(scheduledAt), nil
+}
+
+// eventTemplate reads the -template event, nil without it.
+func (p *publishFlags) eventTemplate() (*nostr.Event, error) {
+	if *p.template == "" || p.loaded != nil {
+		return p.loaded, nil
+	}
+	template, err := nip71uploader.LoadEventTemplate(*p.template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -template: %v", err)
+	}
+	p.loaded = template
+	return template, nil
+}
+
+// eventCreatedAt returns the created_at of the built event: the -created-at
+// time, else the -publish-at time, else the created_at of the -template, or
+// 0 for the current time.
+func (p *publishFlags) eventCreatedAt() (nostr.Timestamp, error) {
+	if *p.createdAt == "" && *p.publishAt == "" {
+		template, err := p.eventTemplate()
+		if err != nil || template == nil {
+			return 0, err
+		}
+		return template.CreatedAt, nil
+	}
+	if *p.createdAt == "" {
+		return p.scheduledAt()
+	}
+	createdAt, err := nip71uploader.ParseTimestamp(*p.createdAt)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -created-at: %v", err)
+	}
+	return nostr.Timestamp(createdAt), nil
+}
+
+// timestampFlag converts the date given to the flag name to unix seconds,
+// leaving it empty when not given.
+func timestampFlag(name, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	timestamp, err := nip71uploader.ParseTimestamp(value)
+	if err != nil {
+		return "", flagError(name, err, "")
+	}
+	return strconv.FormatInt(timestamp, 10), nil
+}
+
+// finish signs the built event and then saves, publishes or schedules it.
+func (p *publishFlags) finish(ctx context.Context, uploader *nip71uploader.Uploader, event *nostr.Event) error {
+	if len(p.common.otherKeys) > 0 && (*p.draft != "" || *p.scheduleDVM != "") {
+		return errors.New("events cannot be cross-posted from several -key with -draft or -schedule-dvm")
+	}
+	otherSigners, err := p.common.otherSigners()
+	if err != nil {
+		return err
+	}
+	if event.Sig == "" {
+		p.advanceJob(jobs.StageBuilt, event)
+	}
+
+	// Sign the event with the provided private key
+	if event.Sig == "" && !(*p.draft != "" && *p.unsigned) {
+		if err := uploader.Sign(ctx, event); err != nil {
+			return fmt.Errorf("signing event: %v", err)
+		}
+		p.advanceJob(jobs.StageSigned, event)
+	}
+
+	// Save drafts to disk instead of publishing them
+	if *p.draft != "" {
+		if err := nip71uploader.SaveEvent(*p.draft, event); err != nil {
+			return fmt.Errorf("saving draft: %v", err)
+		}
+		if p.common.textOutput() {
+			fmt.Printf("Draft saved to %s\n", *p.draft)
+		}
+		return p.common.report(event, nil, *p.draft)
+	}
+
+	p.common.printEvent(event)
+
+	if len(uploader.Relays) == 0 && !*p.common.broadcast {
+		return p.common.report(event, nil, "")
+	}
+	if err := p.checkReplaced(ctx, uploader, event); err != nil {
+		return err
+	}
+
+	scheduledAt, err := p.scheduledAt()
+	if err != nil {
+		return err
+	}
+	if scheduledAt > 0 && *p.scheduleDVM != "" {
+		dvmPubKey, err := nip71uploader.DecodePubKey(*p.scheduleDVM)
+		if err != nil {
+			return fmt.Errorf("invalid -schedule-dvm: %v", err)
+		}
+		results, err := nip71uploader.PublishScheduleRequest(ctx, event, uploader.Signer, uploader.Relays, dvmPubKey)
+		if err != nil {
+			return fmt.Errorf("scheduling event: %v", err)
+		}
+		p.advanceJob(jobs.StagePublished, event)
+		return p.common.report(event, results, "")
+	}
+	if scheduledAt > 0 {
+		if err := nip71uploader.WaitUntil(ctx, int64(scheduledAt)); err != nil {
+			return fmt.Errorf("waiting for -publish-at: %v", err)
+		}
+	}
+	// relays that accepted the event before the job was interrupted are
+	// not contacted again
+	pending, done := p.pendingRelays(uploader.Relays)
+	relayUploader := *uploader
+	relayUploader.Relays = pending
+	results := p.common.publish(ctx, &relayUploader, event)
+	p.finishJob(event, results)
+	results = append(done, results...)
+	p.accepted = nip71uploader.AcceptedRelays(results)
+	if p.common.checkSuccess(results) == nil {
+		p.common.notifyCollaborators(ctx, uploader, event, nip71uploader.AcceptedRelays(results))
+	}
+	if err := p.exportManifest(event, results); err != nil {
+		return err
+	}
+	err = p.common.report(event, results, "")
+	for _, signer := range otherSigners {
+		if crossErr := p.crossPost(ctx, uploader.ForSigner(signer), event); crossErr != nil {
+			err = errors.Join(err, crossErr)
+		}
+	}
+	return err
+}
+
+// crossPost publishes a copy of the event from the signer of uploader, with
+// the same media.
+func (p *publishFlags) crossPost(ctx context.Context, uploader *nip71uploader.Uploader, event *nostr.Event) error {
+	copied, err := uploader.CrossPost(ctx, event)
+	if err != nil {
+		return fmt.Errorf("cross-posting: %v", err)
+	}
+	npub, _ := nip19.EncodePublicKey(copied.PubKey)
+	log.Printf("Cross-posting the event from %s", npub)
+	results := p.common.publish(ctx, uploader, copied)
+	return p.common.report(copied, results, "")
+}
+
+// checkReplaced looks for an event the addressable event would replace on
+// the relays, which may have been edited in another client since. When it
+// differs, the changes are shown and confirmation is asked for, unless
+// -replace or -update-existing is given.
+func (p *publishFlags) checkReplaced(ctx context.Context, uploader *nip71uploader.Uploader, event *nostr.Event) error {
+	if *p.replace || uploader.UpdateExisting || !nostr.IsAddressableKind(event.Kind) {
+		return nil
+	}
+	previous := nip71uploader.FetchReplaced(ctx, event, uploader.Relays)
+	if previous == nil {
+		return nil
+	}
+	changes := nip71uploader.EventChanges(previous, event)
+	if len(changes) == 0 {
+		log.Printf("Replacing event %s, which has the same metadata", previous.ID)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "An event with the d tag %q, published %s, is on the relays. Publishing replaces it:\n",
+		event.Tags.GetD(), previous.CreatedAt.Time().Format(time.DateTime))
+	for _, change := range changes {
+		fmt.Fprintln(os.Stderr, "  "+change)
+	}
+	if !isTerminal(os.Stdin) {
+		return errors.New("not replacing the event without confirmation, give -replace to replace it")
+	}
+	return ask(ctx, "Replace it?")
+}
+
+// relayHints returns the relays the events referencing the published event
+// give as hints: the ones that accepted it, or the relays of the uploader
+// when it was not published, such as with -draft.
+func (p *publishFlags) relayHints(uploader *nip71uploader.Uploader) []string {
+	if len(p.accepted) > 0 {
+		return p.accepted
+	}
+	return uploader.Relays
+}
+
+// exportManifest adds the event to the -export-manifest file once a relay
+// accepted it.
+func (p *publishFlags) exportManifest(event *nostr.Event, results []nip71uploader.PublishResult) error {
+	accepted := nip71uploader.AcceptedRelays(results)
+	if *p.export == "" || len(accepted) == 0 {
+		return nil
+	}
+	writer, err := mediamanifest.Open(*p.export)
+	if err == nil {
+		err = writer.Add(mediamanifest.NewEntry(event, accepted))
+	}
+	if err != nil {
+		return fmt.Errorf("exporting manifest: %v", err)
+	}
+	return nil
+}
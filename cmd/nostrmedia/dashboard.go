@@ -0,0 +1,257 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+const (
+	// dashboardInterval is how often the dashboard is redrawn.
+	dashboardInterval = 250 * time.Millisecond
+	// dashboardFinished is how many finished entries stay on screen.
+	dashboardFinished = 5
+	// dashboardMessages is how many log lines are shown under the entries.
+	dashboardMessages = 3
+)
+
+// dashboard draws the stage of every batch entry on the terminal, in place,
+// instead of interleaving their log lines. Log lines are shown under the
+// entries and written out in full once the batch is done.
+type dashboard struct {
+	mu       sync.Mutex
+	out      io.Writer
+	width    int
+	rows     []*dashboardRow
+	finished []*dashboardRow
+	logs     bytes.Buffer
+	messages []string
+	drawn    int
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// dashboardRow is the line of one entry.
+type dashboardRow struct {
+	d      *dashboard
+	key    string
+	stage  string
+	detail string
+	failed bool
+	done   bool
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newDashboard starts drawing on stderr and captures the log output until
+// close.
+func newDashboard() *dashboard {
+	d := &dashboard{
+		out:     os.Stderr,
+		width:   terminalWidth(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	log.SetOutput(dashboardLog{d})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.draw()
+			case <-d.stop:
+				d.draw()
+				return
+			}
+		}
+	}()
+	return d
+}
+
+// terminalWidth returns $COLUMNS, which most shells export, or 100.
+func terminalWidth() int {
+	var width int
+	if _, err := fmt.Sscan(os.Getenv("COLUMNS"), &width); err != nil || width < 40 {
+		return 100
+	}
+	return width
+}
+
+// row adds the line of an entry, queued until its stage changes.
+func (d *dashboard) row(key string) *dashboardRow {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row := &dashboardRow{d: d, key: key, stage: "queued"}
+	d.rows = append(d.rows, row)
+	return row
+}
+
+// close draws the final state, restores the log output and writes out the
+// captured log lines.
+func (d *dashboard) close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+	log.SetOutput(os.Stderr)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	os.Stderr.Write(d.logs.Bytes())
+}
+
+// draw replaces the previously drawn lines with the current state.
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	total, done, failed, running := len(d.rows), 0, 0, 0
+	var active []*dashboardRow
+	for _, row := range d.rows {
+		switch {
+		case row.done && row.failed:
+			done++
+			failed++
+		case row.done:
+			done++
+		case row.stage != "queued":
+			running++
+			active = append(active, row)
+		}
+	}
+	lines := []string{fmt.Sprintf("Batch: %d of %d done, %d failed, %d running", done, total, failed, running)}
+	for _, row := range d.finished {
+		lines = append(lines, row.line())
+	}
+	for _, row := range active {
+		lines = append(lines, row.line())
+	}
+	for _, message := range d.messages {
+		lines = append(lines, "  "+message)
+	}
+
+	var screen strings.Builder
+	if d.drawn > 0 {
+		fmt.Fprintf(&screen, "\x1b[%dA", d.drawn)
+	}
+	for _, line := range lines {
+		screen.WriteString("\x1b[2K" + truncate(line, d.width-1) + "\n")
+	}
+	// clear what is left of a longer previous drawing
+	for i := len(lines); i < d.drawn; i++ {
+		screen.WriteString("\x1b[2K\n")
+	}
+	if extra := d.drawn - len(lines); extra > 0 {
+		fmt.Fprintf(&screen, "\x1b[%dA", extra)
+	}
+	io.WriteString(d.out, screen.String())
+	d.drawn = len(lines)
+}
+
+func (r *dashboardRow) line() string {
+	status := "  "
+	switch {
+	case r.done && r.failed:
+		status = "✗ "
+	case r.done:
+		status = "✓ "
+	}
+	line := fmt.Sprintf("%s%-12s %s", status, r.stage, r.key)
+	if r.detail != "" {
+		line += "  " + r.detail
+	}
+	return line
+}
+
+func truncate(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:width-1]) + "…"
+}
+
+// set changes the stage of the entry.
+func (r *dashboardRow) set(stage, detail string) {
+	if r == nil {
+		return
+	}
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.stage, r.detail = stage, detail
+}
+
+// finish marks the entry as done, keeping it among the last finished ones.
+// An empty detail keeps the current one.
+func (r *dashboardRow) finish(stage, detail string, failed bool) {
+	if r == nil {
+		return
+	}
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	if detail != "" {
+		r.detail = detail
+	}
+	r.stage, r.failed, r.done = stage, failed, true
+	r.d.finished = append(r.d.finished, r)
+	if len(r.d.finished) > dashboardFinished {
+		r.d.finished = r.d.finished[1:]
+	}
+}
+
+// track reports the hashing, upload and proof of work progress of the
+// uploader to the entry.
+func (r *dashboardRow) track(uploader *nip71uploader.Uploader) {
+	if r == nil {
+		return
+	}
+	r.set("processing", "")
+	uploader.HashProgress = func(status nip71uploader.HashStatus) {
+		r.set("hashing", fmt.Sprintf("%d%%", 100*status.Done/max(status.Total, 1)))
+	}
+	uploader.UploadProgress = func(status nip71uploader.UploadStatus) {
+		r.set("uploading", fmt.Sprintf("%d%%", 100*status.Done/max(status.Total, 1)))
+	}
+	uploader.PowProgress = func(status nip71uploader.PowStatus) {
+		r.set("mining", fmt.Sprintf("difficulty %d of %d, %.0f kH/s", status.Best, status.Target, status.Hashrate()/1000))
+	}
+}
+
+// dashboardLog keeps the log output for close and its last lines for draw.
+type dashboardLog struct {
+	d *dashboard
+}
+
+func (l dashboardLog) Write(p []byte) (int, error) {
+	l.d.mu.Lock()
+	defer l.d.mu.Unlock()
+	l.d.logs.Write(p)
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.d.messages = append(l.d.messages, line)
+	}
+	if len(l.d.messages) > dashboardMessages {
+		l.d.messages = l.d.messages[len(l.d.messages)-dashboardMessages:]
+	}
+	return len(p), nil
+}
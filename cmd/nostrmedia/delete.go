@@ -0,0 +1,79 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runDelete publishes a NIP-09 deletion request for the given events and
+// removes the given blobs from the Blossom server.
+func runDelete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	var eventRefs, blobs stringSlice
+	fs.Var(&eventRefs, "event", "nevent, naddr, note or event id to delete (can be specified multiple times)")
+	fs.Var(&blobs, "blob", "sha256 of a blob to delete from the blossom server (can be specified multiple times)")
+	reason := fs.String("reason", "", "Reason for the deletion")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if len(eventRefs) == 0 && len(blobs) == 0 {
+		return errors.New("at least one -event or -blob must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	for _, blob := range blobs {
+		if err := nip71uploader.DeleteBlob(ctx, uploader.Blossom, blob, uploader.Signer); err != nil {
+			log.Printf("Error deleting blob %s: %v", blob, err)
+			continue
+		}
+		log.Printf("Deleted blob %s from %s", blob, uploader.Blossom)
+	}
+
+	if len(eventRefs) == 0 {
+		return nil
+	}
+	if len(uploader.Relays) == 0 {
+		return errors.New("-relay must be provided to delete events")
+	}
+
+	var references nostr.Tags
+	for _, ref := range eventRefs {
+		tag, err := nip71uploader.ReferenceTag(ctx, ref, uploader.Relays)
+		if err != nil {
+			return fmt.Errorf("parsing event reference %s: %v", ref, err)
+		}
+		references = append(references, tag)
+	}
+
+	event, err := uploader.BuildDeletionEvent(ctx, references, *reason)
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("creating deletion event: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	results := common.publish(ctx, uploader, event)
+	return common.report(event, results, "")
+}
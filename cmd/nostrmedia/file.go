@@ -0,0 +1,91 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runFile uploads or downloads any file and publishes its NIP-94 event.
+func runFile(args []string) error {
+	fs := flag.NewFlagSet("file", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	publish := addPublishFlags(fs, common)
+	fileURL := fs.String("url", "", "URL of the file")
+	expectedHash := fs.String("expected-hash", "", "Hex sha256 the file must have, refusing it before publishing when it differs")
+	filePath := fs.String("file", "", "Path to the file")
+	description := fs.String("description", "", "Description of the file")
+	descriptionTemplate := fs.String("description-template", "", descriptionTemplateUsage)
+	summary := fs.String("summary", "", "Short excerpt of the file content")
+	alt := fs.String("alt", "", "Accessibility description of the file")
+	lang := addLanguageFlags(fs)
+	attribution := addSourceFlags(fs)
+	args, err := resumeArgs("file", args)
+	if err != nil {
+		return err
+	}
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	checks := newFlagChecks(fs)
+	checks.required("give a local -file or the -url of a hosted file", "file", "url")
+	checks.exclusive("file", "-file uploads a local file, -url publishes a hosted one", "url")
+	publish.check(checks)
+	if err := checks.err(); err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	createdAt, err := publish.eventCreatedAt()
+	if err != nil {
+		return err
+	}
+	template, err := publish.eventTemplate()
+	if err != nil {
+		return err
+	}
+	languages, err := lang.languages(uploader)
+	if err != nil {
+		return err
+	}
+	source, err := attribution.source()
+	if err != nil {
+		return err
+	}
+	event, err := publish.startJob("file", args, uploader)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		event, err = uploader.BuildFileEvent(ctx, nip71uploader.FileOptions{
+			Media:               nip71uploader.Media{Path: *filePath, URL: *fileURL, SHA256: *expectedHash},
+			Description:         *description,
+			DescriptionTemplate: *descriptionTemplate,
+			Summary:             *summary,
+			Alt:                 *alt,
+			Languages:           languages,
+			Source:              source,
+			CreatedAt:           createdAt,
+			Template:            template,
+		})
+		if err != nil {
+			printUnfinished(event)
+			return fmt.Errorf("creating NIP-94 event: %v", err)
+		}
+	}
+
+	return publish.finish(ctx, uploader, event)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// flagChecks collects the problems with the flags of a command, each with
+// the flag at fault and a hint on how to fix it, so they are all reported at
+// once before any file is uploaded or relay contacted.
+type flagChecks struct {
+	fs       *flag.FlagSet
+	set      map[string]bool
+	problems nip71uploader.InputErrors
+}
+
+// newFlagChecks starts checking the flags of fs, once parsed.
+func newFlagChecks(fs *flag.FlagSet) *flagChecks {
+	c := &flagChecks{fs: fs, set: make(map[string]bool)}
+	fs.Visit(func(f *flag.Flag) { c.set[f.Name] = true })
+	return c
+}
+
+// given reports whether the flag was given on the command line with a value
+// other than empty or false.
+func (c *flagChecks) given(name string) bool {
+	if !c.set[name] {
+		return false
+	}
+	value := c.fs.Lookup(name).Value.String()
+	return value != "" && value != "false"
+}
+
+// add reports a problem with the flag name.
+func (c *flagChecks) add(name, message, hint string) {
+	c.problems = append(c.problems, &nip71uploader.InputError{Field: "-" + name, Message: message, Hint: hint})
+}
+
+// check reports err, the result of checking or parsing a flag value, which
+// is kept as it is when it already is an InputError.
+func (c *flagChecks) check(err error) {
+	var problem *nip71uploader.InputError
+	var problems nip71uploader.InputErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &problems):
+		c.problems = append(c.problems, problems...)
+	case errors.As(err, &problem):
+		c.problems = append(c.problems, problem)
+	default:
+		c.problems = append(c.problems, &nip71uploader.InputError{Message: err.Error()})
+	}
+}
+
+// required reports that one of the flags must be given when none is.
+func (c *flagChecks) required(hint string, names ...string) {
+	for _, name := range names {
+		if c.given(name) {
+			return
+		}
+	}
+	if len(names) == 1 {
+		c.add(names[0], "is required", hint)
+		return
+	}
+	c.problems = append(c.problems, &nip71uploader.InputError{Message: fmt.Sprintf("one of %s must be given", flagList(names)), Hint: hint})
+}
+
+// exclusive reports name given with any of others, which cannot be used
+// with it.
+func (c *flagChecks) exclusive(name, hint string, others ...string) {
+	if !c.given(name) {
+		return
+	}
+	var given []string
+	for _, other := range others {
+		if c.given(other) {
+			given = append(given, other)
+		}
+	}
+	if len(given) > 0 {
+		c.add(name, fmt.Sprintf("cannot be used with %s", flagList(given)), hint)
+	}
+}
+
+// requires reports name given without other, which it only works with.
+func (c *flagChecks) requires(name, other, hint string) {
+	if c.given(name) && !c.given(other) {
+		c.add(name, fmt.Sprintf("only works with -%s", other), hint)
+	}
+}
+
+// err returns the problems found, or nil when the flags are fine.
+func (c *flagChecks) err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return c.problems
+}
+
+// flagList joins flag names as "-a, -b or -c".
+func flagList(names []string) string {
+	flags := make([]string, len(names))
+	for i, name := range names {
+		flags[i] = "-" + name
+	}
+	if len(flags) == 1 {
+		return flags[0]
+	}
+	return strings.Join(flags[:len(flags)-1], ", ") + " or " + flags[len(flags)-1]
+}
+
+// flagError is the InputError of an invalid value given to the flag name.
+func flagError(name string, err error, hint string) error {
+	return &nip71uploader.InputError{Field: "-" + name, Message: err.Error(), Hint: hint}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/batch"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runImportFeed publishes the video episodes of an RSS or Atom feed that
+// are not on the relays yet.
+func runImportFeed(args []string) error {
+	fs := flag.NewFlagSet("import-feed", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	feedURL := fs.String("feed", "", "URL of the RSS or Atom feed (required)")
+	limit := fs.Int("limit", 0, "Maximum number of new episodes to publish, 0 for all")
+	kinds := addVideoKindFlags(fs, "kind", "Use long/horizontal video event kind, instead of the one of the resolution of the episodes")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+	if err := kinds.validate(); err != nil {
+		return err
+	}
+
+	if *feedURL == "" {
+		return errors.New("-feed must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the feed to")
+	}
+
+	items, err := nip71uploader.FetchFeed(ctx, *feedURL)
+	if err != nil {
+		return fmt.Errorf("fetching feed: %v", err)
+	}
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+	identifiers := make([]string, len(items))
+	for i, item := range items {
+		identifiers[i] = item.ID
+	}
+	published := nip71uploader.PublishedIdentifiers(ctx, pubKey, identifiers, uploader.Relays)
+
+	var results []batch.Result
+	for _, item := range items {
+		if published[item.ID] {
+			log.Printf("Skipping %s, already published", item.ID)
+			continue
+		}
+		if *limit > 0 && len(results) >= *limit {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		log.Printf("Importing %s", item.ID)
+		result := publishFeedItem(ctx, common, uploader, item, kinds.isLegacy(), kinds.horizontal(item.Width, item.Height))
+		if result.Error != "" {
+			log.Printf("Error importing %s: %s", item.ID, result.Error)
+		}
+		results = append(results, result)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if common.jsonOutput() {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	} else if common.textOutput() {
+		printBatchReport(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d episodes failed, run the command again to retry them", failed, len(results))
+	}
+	return nil
+}
+
+// publishFeedItem builds, signs and publishes the event of one episode, with
+// the episode id as its "d" tag so later runs can tell it was published.
+func publishFeedItem(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, item nip71uploader.FeedItem, legacy, horizontal bool) batch.Result {
+	result := batch.Result{Key: item.ID}
+
+	publishedAt := item.PublishedAt
+	if publishedAt == 0 {
+		publishedAt = time.Now().Unix()
+	}
+	event, err := uploader.BuildVideoEvent(ctx, nip71uploader.VideoOptions{
+		Media:       nip71uploader.Media{URL: item.URL},
+		Title:       item.Title,
+		Description: item.Description,
+		PublishedAt: strconv.FormatInt(publishedAt, 10),
+		Identifier:  item.ID,
+		Legacy:      legacy,
+		Horizontal:  horizontal,
+		Thumbnail:   nip71uploader.Media{URL: item.Thumbnail},
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.EventID = event.ID
+
+	accepted := nip71uploader.AcceptedRelays(uploader.Publish(ctx, event))
+	if err := common.emitEvent(event); err != nil {
+		log.Printf("Error emitting event: %v", err)
+	}
+	if len(accepted) < *common.minSuccess {
+		result.Error = fmt.Sprintf("accepted by %d relays, %d required", len(accepted), *common.minSuccess)
+		return result
+	}
+	result.Nevent, _, err = nip71uploader.EncodeEvent(event, accepted)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+	}
+	return result
+}
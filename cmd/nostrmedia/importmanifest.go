@@ -0,0 +1,116 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/girino/nip71-video-uploader/internal/batch"
+	"github.com/girino/nip71-video-uploader/internal/mediamanifest"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runImportManifest publishes again the events of a manifest written with
+// -export-manifest, for instance to new relays.
+func runImportManifest(args []string) error {
+	fs := flag.NewFlagSet("import-manifest", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	manifestPath := fs.String("manifest", "", "Path to the JSON manifest written with -export-manifest (required)")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *manifestPath == "" {
+		return errors.New("-manifest must be provided")
+	}
+	manifest, err := mediamanifest.Load(*manifestPath)
+	if err != nil {
+		return fmt.Errorf("loading manifest: %v", err)
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the events to")
+	}
+	uploader.Pool = nip71uploader.NewRelayPool(uploader.Signer)
+	defer uploader.Pool.Close()
+
+	var results []batch.Result
+	failed := 0
+	for _, entry := range manifest.Entries {
+		result := batch.Result{Key: entry.EventID, EventID: entry.EventID}
+		switch {
+		case ctx.Err() != nil:
+			result.Error = ctx.Err().Error()
+		case entry.Event == nil:
+			result.Error = "the entry has no event"
+		case entry.Event.ID != entry.EventID:
+			result.Error = fmt.Sprintf("the event id is %s", entry.Event.ID)
+		default:
+			result = republish(ctx, common, uploader, entry.Event)
+		}
+		if result.Error != "" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if common.jsonOutput() {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	} else if common.textOutput() {
+		printBatchReport(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, len(results))
+	}
+	return nil
+}
+
+// republish publishes again an event signed before, after checking its id
+// and signature, and reports the outcome as a batch result.
+func republish(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, event *nostr.Event) batch.Result {
+	result := batch.Result{Key: event.ID, EventID: event.ID}
+	if event.ID != event.GetID() {
+		result.Error = "the id does not match the event"
+		return result
+	}
+	if ok, err := event.CheckSignature(); !ok {
+		result.Error = fmt.Sprintf("invalid signature: %v", err)
+		return result
+	}
+	log.Printf("Publishing %s", event.ID)
+	results := uploader.Publish(ctx, event)
+	// mining the event again for relays requiring proof of work changes its id
+	result.EventID = event.ID
+	if err := common.emitEvent(event); err != nil {
+		log.Printf("Error emitting event: %v", err)
+	}
+	common.confirmStored(ctx, event, results)
+	accepted := common.storedRelays(results)
+	if len(accepted) < *common.minSuccess {
+		result.Error = fmt.Sprintf("accepted by %d relays, %d required", len(accepted), *common.minSuccess)
+		return result
+	}
+	nevent, _, err := nip71uploader.EncodeEvent(event, accepted)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+	}
+	result.Nevent = nevent
+	return result
+}
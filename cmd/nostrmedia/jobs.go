@@ -0,0 +1,192 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/internal/jobs"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// resumeArgs puts the arguments of the job given with -resume before the
+// current ones, so that the resumed run parses the same flags as the original
+// one plus those given now, such as -key. Arguments without -resume are
+// returned unchanged.
+func resumeArgs(command string, args []string) ([]string, error) {
+	id := ""
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "resume" {
+			continue
+		}
+		if hasValue {
+			id = value
+		} else if i+1 < len(args) {
+			id = args[i+1]
+		}
+	}
+	if id == "" {
+		return args, nil
+	}
+
+	store, err := jobs.Open(jobs.DefaultPath())
+	if err != nil {
+		return nil, fmt.Errorf("opening job store: %v", err)
+	}
+	defer store.Close()
+	job, err := store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("loading job %s: %v", id, err)
+	}
+	if job.Command != command {
+		return nil, fmt.Errorf("job %s is a %s job, resume it with 'nostrmedia %s -resume %s'", id, job.Command, job.Command, id)
+	}
+	return append(append([]string{}, job.Args...), args...), nil
+}
+
+// secretFlags are the flags whose values are never written to the job
+// store: the private key, the wallet connection with its spending secret, and
+// the URLs and tokens granting access to other services.
+var secretFlags = map[string]bool{
+	"key":            true,
+	"nwc":            true,
+	"webhook":        true,
+	"telegram-token": true,
+	"matrix-token":   true,
+}
+
+// withoutSecrets removes the secretFlags and their values from args, and the
+// credentials from -proxy, so that they are never written to the job store.
+// The proxy itself is kept, as a resumed run must not connect without it.
+func withoutSecrets(args []string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") {
+			kept = append(kept, args[i])
+			continue
+		}
+		switch {
+		case secretFlags[name]:
+			if !hasValue {
+				i++
+			}
+		case name == "proxy" && hasValue:
+			kept = append(kept, "-proxy="+withoutCredentials(value))
+		case name == "proxy" && i+1 < len(args):
+			kept = append(kept, args[i], withoutCredentials(args[i+1]))
+			i++
+		default:
+			kept = append(kept, args[i])
+		}
+	}
+	return kept
+}
+
+// withoutCredentials removes the user and password of a proxy URL.
+func withoutCredentials(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.Contains(rawURL, "://") {
+		// a bare host:port has no credentials, anything else is dropped
+		if strings.Contains(rawURL, "@") {
+			return ""
+		}
+		return rawURL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// startJob records the run in the job store, or with -resume picks up the
+// resumed job, and has the uploader skip the files the job already uploaded.
+// It returns the event of a resumed job that got past building it. Without a
+// usable job store the run goes on untracked. The store is closed by the
+// close method of the common flags. With -preview, the uploader asks for
+// confirmation of the event it builds.
+func (p *publishFlags) startJob(command string, args []string, uploader *nip71uploader.Uploader) (*nostr.Event, error) {
+	if *p.preview {
+		uploader.Confirm = confirmEvent(uploader)
+	}
+	store, err := jobs.Open(jobs.DefaultPath())
+	if err != nil {
+		if *p.resume != "" {
+			return nil, fmt.Errorf("opening job store: %v", err)
+		}
+		log.Printf("Not tracking the job: %v", err)
+		return nil, nil
+	}
+
+	var job *jobs.Job
+	if *p.resume != "" {
+		job, err = store.Load(*p.resume)
+		if err == nil && job.Stage == jobs.StagePublished {
+			err = fmt.Errorf("job %s was already published", job.ID)
+		}
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("resuming job %s: %v", *p.resume, err)
+		}
+		log.Printf("Resuming job %s from stage %s", job.ID, job.Stage)
+	} else {
+		job, err = store.Create(command, withoutSecrets(args))
+		if err != nil {
+			log.Printf("Not tracking the job: %v", err)
+			store.Close()
+			return nil, nil
+		}
+		log.Printf("Job %s, resume it with -resume %s if interrupted", job.ID, job.ID)
+	}
+
+	p.tracker = jobs.NewTracker(store, job)
+	p.common.closers = append(p.common.closers, p.tracker)
+	uploader.Cache = p.tracker
+	if job.Stage == jobs.StageCreated {
+		return nil, nil
+	}
+	return job.Event, nil
+}
+
+// advanceJob records that the job reached stage with the event.
+func (p *publishFlags) advanceJob(stage string, event *nostr.Event) {
+	if p.tracker != nil {
+		p.tracker.Advance(stage, event)
+	}
+}
+
+// pendingRelays returns the relays that did not accept the event in a
+// previous run of the job, and the results of those that did.
+func (p *publishFlags) pendingRelays(relays []string) ([]string, []nip71uploader.PublishResult) {
+	if p.tracker == nil {
+		return relays, nil
+	}
+	var pending []string
+	var done []nip71uploader.PublishResult
+	for _, relay := range relays {
+		if p.tracker.HasAccepted(relay) {
+			done = append(done, nip71uploader.PublishResult{Relay: relay, OK: true})
+		} else {
+			pending = append(pending, relay)
+		}
+	}
+	return pending, done
+}
+
+// finishJob records the relays that accepted the event, and marks the job
+// published once -min-success of them did.
+func (p *publishFlags) finishJob(event *nostr.Event, results []nip71uploader.PublishResult) {
+	if p.tracker == nil {
+		return
+	}
+	p.tracker.Accepted(nip71uploader.AcceptedRelays(results))
+	if len(p.tracker.Job.Relays) >= *p.common.minSuccess {
+		p.advanceJob(jobs.StagePublished, event)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// languageFlags label the language of an event and add its title and
+// summary in other languages.
+type languageFlags struct {
+	language  *string
+	titles    stringSlice
+	summaries stringSlice
+}
+
+func addLanguageFlags(fs *flag.FlagSet) *languageFlags {
+	l := &languageFlags{
+		language: fs.String("lang", "", "ISO 639-1 code of the language of the event, such as en, or 'auto' to detect it"),
+	}
+	fs.Var(&l.titles, "title-lang", "Title in another language as code:title, such as 'pt:Meu vídeo' (can be specified multiple times)")
+	fs.Var(&l.summaries, "summary-lang", "Summary in another language as code:summary (can be specified multiple times)")
+	return l
+}
+
+// languages groups the translated titles and summaries by language, in the
+// order the languages were first given. With -lang auto, the uploader
+// detects the language instead.
+func (l *languageFlags) languages(uploader *nip71uploader.Uploader) (events.Languages, error) {
+	languages := events.Languages{Language: strings.ToLower(*l.language)}
+	if languages.Language == "auto" {
+		languages.Language = ""
+		uploader.DetectLanguage = true
+	}
+	translation := func(code string) *events.Translation {
+		for i := range languages.Translations {
+			if languages.Translations[i].Language == code {
+				return &languages.Translations[i]
+			}
+		}
+		languages.Translations = append(languages.Translations, events.Translation{Language: code})
+		return &languages.Translations[len(languages.Translations)-1]
+	}
+	for _, value := range l.titles {
+		code, title, ok := strings.Cut(value, ":")
+		if !ok || title == "" {
+			return languages, fmt.Errorf("invalid -title-lang %q, expected code:title", value)
+		}
+		translation(strings.ToLower(code)).Title = title
+	}
+	for _, value := range l.summaries {
+		code, summary, ok := strings.Cut(value, ":")
+		if !ok || summary == "" {
+			return languages, fmt.Errorf("invalid -summary-lang %q, expected code:summary", value)
+		}
+		translation(strings.ToLower(code)).Summary = summary
+	}
+	return languages, nil
+}
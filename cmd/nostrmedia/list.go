@@ -0,0 +1,71 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runList prints the blobs uploaded to the Blossom server by -key, or by
+// -pubkey when given.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	pubKey := fs.String("pubkey", "", "List the blobs of this pubkey, npub or nprofile instead of the one of -key")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *common.key == "" && *pubKey == "" {
+		return errors.New("either -key or -pubkey must be provided")
+	}
+	if common.eventOnly() {
+		return errors.New("-output event-only is not supported by list, which publishes no events")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	var signer nostr.Keyer
+	var err error
+	if *common.key != "" {
+		signer, err = common.signer()
+		if err != nil {
+			return err
+		}
+	}
+
+	var owner string
+	if *pubKey != "" {
+		owner, err = nip71uploader.DecodePubKey(*pubKey)
+		if err != nil {
+			return fmt.Errorf("invalid -pubkey: %v", err)
+		}
+	} else {
+		owner, err = signer.GetPublicKey(ctx)
+		if err != nil {
+			return fmt.Errorf("getting public key: %v", err)
+		}
+	}
+
+	blobs, err := nip71uploader.ListBlobs(ctx, *common.blossom, owner, signer)
+	if err != nil {
+		return fmt.Errorf("listing blobs: %v", err)
+	}
+	if common.jsonOutput() {
+		return writeJSON(blobs)
+	}
+	for _, blob := range blobs {
+		fmt.Printf("%s  %10d  %-20s  %s  %s\n", blob.SHA256, blob.Size, blob.Type,
+			time.Unix(blob.Uploaded, 0).Format(time.DateTime), blob.URL)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Event kind for NIP-53 live events
+const liveEventKind = 30311
+
+// liveMetadata are the single-valued tags of a live event, in the order they
+// are published.
+var liveMetadata = []string{"title", "summary", "image", "streaming", "recording",
+	"starts", "ends", "status", "current_participants", "total_participants"}
+
+// runLive announces a live stream with a kind 30311 event, or updates the one
+// published under the same "d" tag, keeping the values that are not given.
+func runLive(args []string) error {
+	fs := flag.NewFlagSet("live", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	var participants stringSlice
+	fs.Var(&participants, "participant", "Participant as pubkey, npub or nprofile, optionally followed by :role (can be specified multiple times)")
+	descriptor := fs.String("descriptor", "", "Descriptor for the 'd' tag of the live event (required)")
+	title := fs.String("title", "", "Title of the live event")
+	summary := fs.String("summary", "", "Description of the live event")
+	image := fs.String("image", "", "URL of the preview image")
+	streaming := fs.String("streaming", "", "URL of the stream, such as an HLS playlist")
+	recording := fs.String("recording", "", "URL of the recording, once the live event ended")
+	status := fs.String("status", "", "Status of the live event: planned, live or ended")
+	starts := fs.String("starts", "", "Start of the live event ("+timestampUsage+"), defaults to now when going live")
+	ends := fs.String("ends", "", "End of the live event ("+timestampUsage+"), defaults to now when ending")
+	current := fs.Int("current-participants", -1, "Number of people watching now")
+	total := fs.Int("total-participants", -1, "Number of people who watched")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *descriptor == "" {
+		return errors.New("-descriptor must be provided")
+	}
+	switch *status {
+	case "", "planned", "live", "ended":
+	default:
+		return fmt.Errorf("invalid -status %q, must be planned, live or ended", *status)
+	}
+	var err error
+	if *starts, err = timestampFlag("starts", *starts); err != nil {
+		return err
+	}
+	if *ends, err = timestampFlag("ends", *ends); err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+	relays := uploader.Relays
+
+	// start from the existing announcement, if any relay has it
+	var existing *nostr.Event
+	if len(relays) > 0 {
+		existing = nip71uploader.FetchLatestEvent(ctx, nostr.Filter{
+			Kinds:   []int{liveEventKind},
+			Authors: []string{pubKey},
+			Tags:    nostr.TagMap{"d": []string{*descriptor}},
+		}, relays)
+	}
+
+	values := make(map[string]string)
+	var people, hashtags nostr.Tags
+	if existing != nil {
+		for _, name := range liveMetadata {
+			values[name] = tagValue(existing.Tags, name)
+		}
+		for _, tag := range existing.Tags {
+			if len(tag) >= 2 && tag[0] == "p" {
+				people = append(people, tag)
+			}
+			if len(tag) >= 2 && tag[0] == "t" {
+				hashtags = append(hashtags, tag)
+			}
+		}
+	}
+
+	given := map[string]string{
+		"title":     *title,
+		"summary":   *summary,
+		"image":     *image,
+		"streaming": *streaming,
+		"recording": *recording,
+		"status":    *status,
+		"starts":    *starts,
+		"ends":      *ends,
+	}
+	if *current >= 0 {
+		given["current_participants"] = strconv.Itoa(*current)
+	}
+	if *total >= 0 {
+		given["total_participants"] = strconv.Itoa(*total)
+	}
+	for name, value := range given {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	if values["status"] == "" {
+		values["status"] = "planned"
+	}
+	now := strconv.FormatInt(int64(nostr.Now()), 10)
+	if values["status"] == "live" && values["starts"] == "" {
+		values["starts"] = now
+	}
+	if values["status"] == "ended" && values["ends"] == "" {
+		values["ends"] = now
+	}
+
+	for _, participant := range participants {
+		tag, err := parseParticipant(participant)
+		if err != nil {
+			return fmt.Errorf("parsing participant %s: %v", participant, err)
+		}
+		// a participant given again replaces its previous role
+		replaced := false
+		for i, person := range people {
+			if person[1] == tag[1] {
+				people[i] = tag
+				replaced = true
+			}
+		}
+		if !replaced {
+			people = append(people, tag)
+		}
+	}
+
+	event := nostr.Event{
+		Kind:      liveEventKind,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", *descriptor}},
+	}
+	for _, name := range liveMetadata {
+		if values[name] != "" {
+			event.Tags = append(event.Tags, nostr.Tag{name, values[name]})
+		}
+	}
+	event.Tags = append(event.Tags, people...)
+	event.Tags = append(event.Tags, hashtags...)
+	for _, hashtag := range common.hashtags {
+		hashtag = strings.TrimPrefix(hashtag, "#")
+		if !event.Tags.ContainsAny("t", []string{hashtag}) {
+			event.Tags = append(event.Tags, nostr.Tag{"t", hashtag})
+		}
+	}
+	if *common.client != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"client", *common.client})
+	}
+
+	if err := uploader.Pow(ctx, &event); err != nil {
+		printUnfinished(&event)
+		return fmt.Errorf("calculating proof of work: %v", err)
+	}
+	if err := uploader.Sign(ctx, &event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(&event)
+
+	var results []nip71uploader.PublishResult
+	if len(relays) > 0 || *common.broadcast {
+		results = common.publish(ctx, uploader, &event)
+	}
+	return common.report(&event, results, "")
+}
+
+// parseParticipant turns "pubkey[:role]" into the "p" tag of a participant,
+// with the first relay hint of an nprofile.
+func parseParticipant(participant string) (nostr.Tag, error) {
+	key, role, _ := strings.Cut(strings.TrimPrefix(participant, "nostr:"), ":")
+	profile, err := nip71uploader.DecodeProfile(key)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = "Participant"
+	}
+	relay := ""
+	if len(profile.Relays) > 0 {
+		relay = profile.Relays[0]
+	}
+	return nostr.Tag{"p", profile.PublicKey, relay, role}, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Command nostrmedia uploads media to Blossom servers and publishes the
+// matching NIP-71, NIP-68 and NIP-94 events to nostr relays.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// command is a nostrmedia subcommand. run receives the arguments following
+// the subcommand name and parses them with its own flag set. It returns
+// instead of exiting, so that the deferred cleanups run, and its error makes
+// nostrmedia exit with status 1.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []*command{
+	{"video", "Upload a video and publish a NIP-71 video event", runVideo},
+	{"picture", "Upload pictures and publish a NIP-68 picture event", runPicture},
+	{"file", "Upload any file and publish a NIP-94 file metadata event", runFile},
+	{"audio", "Upload a podcast or song and publish a NIP-94 audio event", runAudio},
+	{"batch", "Publish every entry of a CSV or JSON manifest", runBatch},
+	{"import-feed", "Publish the new video episodes of an RSS or Atom feed", runImportFeed},
+	{"import-manifest", "Publish again the events of a manifest written with -export-manifest", runImportManifest},
+	{"rebroadcast", "Publish your archived or relay-hosted video and picture events to new relays", runRebroadcast},
+	{"serve", "Expose the upload pipeline as an HTTP API", runServe},
+	{"bot", "Publish the media posted to Telegram chats or Matrix rooms", runBot},
+	{"rehost", "Copy the media of a video or file event to Blossom and republish it", runRehost},
+	{"check", "Find dead media links in your events and repair them", runCheck},
+	{"validate", "Check an event against the NIP-71, NIP-68 and NIP-94 schemas", runValidate},
+	{"comment", "Comment on a video or another event with NIP-22", runComment},
+	{"boost", "Repost or quote a video or another event with NIP-18", runBoost},
+	{"playlist", "Create or update a NIP-51 video set", runPlaylist},
+	{"live", "Announce or update a NIP-53 live stream", runLive},
+	{"publish", "Publish an event saved with -draft", runPublish},
+	{"delete", "Request deletion of events and remove blobs from Blossom", runDelete},
+	{"list", "List the blobs uploaded to a Blossom server", runList},
+	{"self-update", "Replace nostrmedia with the binary of the latest release", runSelfUpdate},
+}
+
+// failureHooks are called with the error of a failed command, see
+// commonFlags.notifyFailure.
+var failureHooks []func(error)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: nostrmedia <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'nostrmedia <command> -h' for the flags of a command, and 'nostrmedia -version' for the version.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+	if name == "version" || name == "-version" || name == "--version" {
+		fmt.Println(versionInfo())
+		return
+	}
+	nip71uploader.UserAgent = userAgent()
+	nip71uploader.SendUserAgent()
+	for _, cmd := range commands {
+		if cmd.name == name {
+			err := cmd.run(os.Args[2:])
+			nip71uploader.RemoveTempFiles()
+			if err != nil {
+				for _, hook := range failureHooks {
+					hook(err)
+				}
+				log.Printf("Error: %v", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// mediaResult describes a media file referenced by the published event.
+type mediaResult struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256,omitempty"`
+	MIME   string `json:"mime,omitempty"`
+	Size   string `json:"size,omitempty"`
+}
+
+// result is printed by -output json once a command is done with its event.
+type result struct {
+	Event  *nostr.Event                  `json:"event"`
+	Nevent string                        `json:"nevent,omitempty"`
+	Naddr  string                        `json:"naddr,omitempty"`
+	Njump  string                        `json:"njump,omitempty"`
+	Media  []mediaResult                 `json:"media,omitempty"`
+	Relays []nip71uploader.PublishResult `json:"relays,omitempty"`
+	Draft  string                        `json:"draft,omitempty"`
+}
+
+func (c *commonFlags) jsonOutput() bool {
+	return *c.output == "json"
+}
+
+func (c *commonFlags) textOutput() bool {
+	return *c.output == "text"
+}
+
+// eventOnly reports whether -output event-only prints nothing but the
+// events, see emitEvent.
+func (c *commonFlags) eventOnly() bool {
+	return *c.output == "event-only"
+}
+
+// emitEvent prints the event as a single line of JSON with -output
+// event-only, for piping into nak or other tools, and appends it to the -out
+// file, created on the first event. Commands publishing several events emit
+// one line for each.
+func (c *commonFlags) emitEvent(event *nostr.Event) error {
+	if !c.eventOnly() && *c.out == "" {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %v", err)
+	}
+	data = append(data, '\n')
+
+	c.emitMu.Lock()
+	defer c.emitMu.Unlock()
+	if c.eventOnly() {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("writing event: %v", err)
+		}
+	}
+	if *c.out == "" {
+		return nil
+	}
+	if c.outFile == nil {
+		if c.outFile, err = os.Create(*c.out); err != nil {
+			return fmt.Errorf("creating -out file: %v", err)
+		}
+		c.closers = append(c.closers, c.outFile)
+	}
+	if _, err := c.outFile.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %v", *c.out, err)
+	}
+	return nil
+}
+
+// printEvent shows the event before it is published. In JSON mode nothing is
+// printed until printResult.
+func (c *commonFlags) printEvent(event *nostr.Event) {
+	if !c.textOutput() {
+		return
+	}
+	// Output the event data (for demonstration purposes)
+	fmt.Println("Generated Event Data:", event)
+}
+
+// report writes the final result of a command that produced an event: a
+// per-relay summary and the NIP-19 references in text mode, the result
+// document in JSON mode, or the event alone with event-only. When the event was published it returns an error
+// unless at least -min-success relays accepted it.
+func (c *commonFlags) report(event *nostr.Event, results []nip71uploader.PublishResult, draft string) error {
+	res := result{
+		Event:  event,
+		Media:  eventMedia(event),
+		Relays: results,
+		Draft:  draft,
+	}
+	accepted := nip71uploader.AcceptedRelays(results)
+	if event.Sig != "" {
+		nevent, naddr, err := nip71uploader.EncodeEvent(event, accepted)
+		if err != nil {
+			log.Printf("Error encoding event: %v", err)
+		}
+		res.Nevent, res.Naddr = nevent, naddr
+		res.Njump = njumpURL(nevent, naddr)
+	}
+
+	if err := c.emitEvent(event); err != nil {
+		return err
+	}
+	if c.jsonOutput() {
+		if err := writeJSON(res); err != nil {
+			return err
+		}
+	} else if c.textOutput() {
+		printSummary(results)
+		if len(accepted) > 0 && res.Nevent != "" {
+			fmt.Println("nevent:", res.Nevent)
+			if res.Naddr != "" {
+				fmt.Println("naddr:", res.Naddr)
+			}
+			fmt.Println("link:", res.Njump)
+		}
+	}
+
+	if len(results) == 0 {
+		return nil
+	}
+	err := c.checkSuccess(results)
+	c.notify("", event, results, err)
+	return err
+}
+
+// checkSuccess returns an error unless at least -min-success relays
+// accepted the event, or stored it with -confirm.
+func (c *commonFlags) checkSuccess(results []nip71uploader.PublishResult) error {
+	if *c.confirm {
+		if stored := c.storedRelays(results); len(stored) < *c.minSuccess {
+			return fmt.Errorf("event stored by %d of %d relays, %d required", len(stored), len(results), *c.minSuccess)
+		}
+	}
+	if accepted := nip71uploader.AcceptedRelays(results); len(accepted) < *c.minSuccess {
+		return fmt.Errorf("event accepted by %d of %d relays, %d required", len(accepted), len(results), *c.minSuccess)
+	}
+	return nil
+}
+
+// printSummary prints one line per relay with the outcome of the publish.
+func printSummary(results []nip71uploader.PublishResult) {
+	if len(results) == 0 {
+		return
+	}
+	width := 0
+	for _, result := range results {
+		width = max(width, len(result.Relay))
+	}
+	fmt.Println("Relay results:")
+	for _, result := range results {
+		status := "OK"
+		if !result.OK {
+			status = "FAILED " + result.Error
+		} else if result.Confirmed != nil && *result.Confirmed {
+			status = "OK, stored"
+		} else if result.Confirmed != nil {
+			status = "OK, but not returned when queried"
+		}
+		fmt.Printf("  %-*s  %s\n", width, result.Relay, status)
+	}
+	fmt.Printf("Accepted by %d of %d relays\n", len(nip71uploader.AcceptedRelays(results)), len(results))
+	for _, result := range results {
+		if result.Confirmed != nil {
+			fmt.Printf("Stored by %d of %d relays\n", len(nip71uploader.ConfirmedRelays(results)), len(results))
+			break
+		}
+	}
+}
+
+// njumpURL links to the naddr of addressable events, so the link follows
+// replacements, and to the nevent otherwise.
+func njumpURL(nevent, naddr string) string {
+	if naddr != "" {
+		return "https://njump.me/" + naddr
+	}
+	if nevent != "" {
+		return "https://njump.me/" + nevent
+	}
+	return ""
+}
+
+func writeJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("encoding output: %v", err)
+	}
+	return nil
+}
+
+// eventMedia collects the files described by the imeta tags of the event, or
+// by the top level tags of a NIP-94 file event.
+func eventMedia(event *nostr.Event) []mediaResult {
+	var media []mediaResult
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+		media = append(media, mediaResult{
+			URL:    imeta.Field(tag, "url"),
+			SHA256: imeta.Field(tag, "x"),
+			MIME:   imeta.Field(tag, "m"),
+			Size:   imeta.Field(tag, "size"),
+		})
+	}
+	if event.Kind == 1063 {
+		media = append(media, mediaResult{
+			URL:    tagValue(event.Tags, "url"),
+			SHA256: tagValue(event.Tags, "x"),
+			MIME:   tagValue(event.Tags, "m"),
+			Size:   tagValue(event.Tags, "size"),
+		})
+	}
+	return media
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runPicture uploads or downloads pictures and publishes a NIP-68 event
+// holding all of them.
+func runPicture(args []string) error {
+	fs := flag.NewFlagSet("picture", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	publish := addPublishFlags(fs, common)
+	var imageURLs, imageFiles stringSlice
+	fs.Var(&imageURLs, "url", "URL of the image file (can be specified multiple times)")
+	fs.Var(&imageFiles, "file", "Path to the image file (can be specified multiple times)")
+	title := fs.String("title", "", "Title of the image")
+	description := fs.String("description", "", "Description of the image")
+	publishedAt := fs.String("published_at", "", "Time when the image was published ("+timestampUsage+"), defaults to the upload time")
+	stripExif := fs.Bool("strip-exif", true, "Remove EXIF, XMP and other metadata (GPS position, camera serial...) from local images before uploading")
+	keepExif := fs.Bool("keep-exif", false, "Upload local images with their metadata, same as -strip-exif=false")
+	maxDimension := fs.Int("max-dimension", 0, "Downscale local JPEG and WebP images so neither side exceeds this many pixels (0 keeps the size)")
+	quality := fs.Int("quality", nip71uploader.DefaultJPEGQuality, "JPEG quality (1-100) of images recompressed by -max-dimension, or of all local JPEG and WebP images when given explicitly")
+	lang := addLanguageFlags(fs)
+	attribution := addSourceFlags(fs)
+	animatedAs := fs.String("animated-as", "picture", "Publish an animated GIF or WebP as a picture, or convert it to a short video (video, needs ffmpeg)")
+	args, err := resumeArgs("picture", args)
+	if err != nil {
+		return err
+	}
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	checks := newFlagChecks(fs)
+	checks.required("give local images with -file or hosted ones with -url, as many as needed", "file", "url")
+	if *animatedAs != "picture" && *animatedAs != "video" {
+		checks.add("animated-as", fmt.Sprintf("invalid value %q", *animatedAs), "give picture or video")
+	}
+	if *animatedAs == "video" && len(imageURLs)+len(imageFiles) > 1 {
+		checks.add("animated-as", "a video is made of a single animated image", "give a single -url or -file")
+	}
+	publish.check(checks)
+	*publishedAt, err = timestampFlag("published_at", *publishedAt)
+	checks.check(err)
+	if err := checks.err(); err != nil {
+		return err
+	}
+
+	var pictures []nip71uploader.Media
+	for _, imageFile := range imageFiles {
+		pictures = append(pictures, nip71uploader.Media{Path: imageFile})
+	}
+	for _, imageURL := range imageURLs {
+		pictures = append(pictures, nip71uploader.Media{URL: imageURL})
+	}
+
+	resize := nip71uploader.ResizeOptions{MaxDimension: *maxDimension}
+	// an explicit -quality recompresses even without -max-dimension
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "quality" {
+			resize.Quality = *quality
+		}
+	})
+	if *maxDimension > 0 {
+		resize.Quality = *quality
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	createdAt, err := publish.eventCreatedAt()
+	if err != nil {
+		return err
+	}
+	template, err := publish.eventTemplate()
+	if err != nil {
+		return err
+	}
+	languages, err := lang.languages(uploader)
+	if err != nil {
+		return err
+	}
+	source, err := attribution.source()
+	if err != nil {
+		return err
+	}
+	event, err := publish.startJob("picture", args, uploader)
+	if err != nil {
+		return err
+	}
+	if event == nil && *animatedAs == "video" {
+		video, cleanup, err := animationToVideo(ctx, pictures[0])
+		defer cleanup()
+		if err != nil {
+			return err
+		}
+		if video != "" {
+			event, err = uploader.BuildVideoEvent(ctx, nip71uploader.VideoOptions{
+				Media:       nip71uploader.Media{Path: video},
+				Title:       *title,
+				Description: *description,
+				PublishedAt: *publishedAt,
+				Languages:   languages,
+				Source:      source,
+				CreatedAt:   createdAt,
+				Template:    template,
+			})
+			if err != nil {
+				printUnfinished(event)
+				return fmt.Errorf("creating NIP-71 event: %v", err)
+			}
+		}
+	}
+	if event == nil {
+		// Create the NIP-68 event with the extracted image information
+		event, err = uploader.BuildPictureEvent(ctx, nip71uploader.PictureOptions{
+			Pictures:     pictures,
+			Title:        *title,
+			Description:  *description,
+			PublishedAt:  *publishedAt,
+			KeepMetadata: *keepExif || !*stripExif,
+			Resize:       resize,
+			Languages:    languages,
+			Source:       source,
+			CreatedAt:    createdAt,
+			Template:     template,
+		})
+		if err != nil {
+			printUnfinished(event)
+			return fmt.Errorf("creating NIP-68 event: %v", err)
+		}
+	}
+
+	return publish.finish(ctx, uploader, event)
+}
+
+// animationToVideo converts the picture to an MP4 video when it is an
+// animated GIF or WebP, downloading it first when it is remote. It returns
+// "" for still pictures, and a function removing the temporary files, which
+// is never nil.
+func animationToVideo(ctx context.Context, picture nip71uploader.Media) (string, func(), error) {
+	var temporary []string
+	cleanup := func() {
+		for _, path := range temporary {
+			nip71uploader.RemoveTemp(path)
+		}
+	}
+	path := picture.Path
+	if path == "" {
+		downloaded, err := nip71uploader.DownloadFile(ctx, picture.URL)
+		if err != nil {
+			return "", cleanup, fmt.Errorf("downloading %s: %v", picture.URL, err)
+		}
+		temporary = append(temporary, downloaded)
+		path = downloaded
+	}
+
+	animation, err := nip71uploader.ReadAnimation(path)
+	if err != nil {
+		return "", cleanup, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if animation == nil {
+		return "", cleanup, nil
+	}
+	log.Printf("Converting the %d frames animation to a %.1fs video", animation.Frames, animation.Duration)
+	video, err := nip71uploader.ConvertAnimation(ctx, path)
+	if err != nil {
+		return "", cleanup, fmt.Errorf("converting animation: %v", err)
+	}
+	temporary = append(temporary, video)
+	return video, cleanup, nil
+}
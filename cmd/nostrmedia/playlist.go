@@ -0,0 +1,138 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Event kind for NIP-51 video curation sets
+const videoSetKind = 30005
+
+// runPlaylist creates or updates a kind 30005 video set, appending the given
+// videos to the references already published under the same "d" tag.
+func runPlaylist(args []string) error {
+	fs := flag.NewFlagSet("playlist", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	var videos stringSlice
+	fs.Var(&videos, "video", "nevent, naddr, note or event id of a video to add (can be specified multiple times)")
+	descriptor := fs.String("descriptor", "", "Descriptor for the 'd' tag of the playlist (required)")
+	title := fs.String("title", "", "Title of the playlist")
+	image := fs.String("image", "", "URL of the playlist cover image")
+	description := fs.String("description", "", "Description of the playlist")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *descriptor == "" {
+		return errors.New("-descriptor must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+	relays := uploader.Relays
+
+	// start from the existing set, if any relay has it
+	var existing *nostr.Event
+	if len(relays) > 0 {
+		existing = nip71uploader.FetchLatestEvent(ctx, nostr.Filter{
+			Kinds:   []int{videoSetKind},
+			Authors: []string{pubKey},
+			Tags:    nostr.TagMap{"d": []string{*descriptor}},
+		}, relays)
+	}
+
+	var references nostr.Tags
+	if existing != nil {
+		if *title == "" {
+			*title = tagValue(existing.Tags, "title")
+		}
+		if *image == "" {
+			*image = tagValue(existing.Tags, "image")
+		}
+		if *description == "" {
+			*description = tagValue(existing.Tags, "description")
+		}
+		for _, tag := range existing.Tags {
+			if len(tag) >= 2 && (tag[0] == "a" || tag[0] == "e") {
+				references = append(references, tag)
+			}
+		}
+	}
+
+	for _, video := range videos {
+		tag, err := nip71uploader.ReferenceTag(ctx, video, relays)
+		if err != nil {
+			return fmt.Errorf("parsing video reference %s: %v", video, err)
+		}
+		if !hasReference(references, tag) {
+			references = append(references, tag)
+		}
+	}
+
+	event := nostr.Event{
+		Kind:      videoSetKind,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", *descriptor}},
+	}
+	if *title != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"title", *title})
+	}
+	if *image != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"image", *image})
+	}
+	if *description != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"description", *description})
+	}
+	event.Tags = append(event.Tags, references...)
+
+	if err := uploader.Pow(ctx, &event); err != nil {
+		printUnfinished(&event)
+		return fmt.Errorf("calculating proof of work: %v", err)
+	}
+	if err := uploader.Sign(ctx, &event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(&event)
+
+	var results []nip71uploader.PublishResult
+	if len(relays) > 0 || *common.broadcast {
+		results = common.publish(ctx, uploader, &event)
+	}
+	return common.report(&event, results, "")
+}
+
+func hasReference(tags nostr.Tags, ref nostr.Tag) bool {
+	for _, tag := range tags {
+		if tag[0] == ref[0] && tag[1] == ref[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func tagValue(tags nostr.Tags, name string) string {
+	if tag := tags.GetFirst([]string{name, ""}); tag != nil && len(*tag) > 1 {
+		return (*tag)[1]
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// kindNames describe the kinds of the media events in previews.
+var kindNames = map[int]string{
+	events.KindPicture:          "NIP-68 picture",
+	events.KindVideo:            "NIP-71 video",
+	events.KindShortVideo:       "NIP-71 short video",
+	events.KindLegacyVideo:      "NIP-71 addressable video",
+	events.KindLegacyShortVideo: "NIP-71 addressable short video",
+	events.KindFileMetadata:     "NIP-94 file",
+}
+
+// errNotConfirmed is returned when the event shown by -preview is declined.
+var errNotConfirmed = errors.New("publishing cancelled")
+
+// confirmEvent returns the Confirm hook of -preview, which describes the
+// built event on stderr and asks whether to go on.
+func confirmEvent(uploader *nip71uploader.Uploader) func(context.Context, *nostr.Event) error {
+	return func(ctx context.Context, event *nostr.Event) error {
+		if !isTerminal(os.Stdin) {
+			return errors.New("-preview needs a terminal to ask for confirmation")
+		}
+		writePreview(os.Stderr, event, uploader)
+		if event.Kind >= 30000 && event.Kind < 40000 {
+			fmt.Fprintf(os.Stderr, "This replaces your previous event with the d tag %q.\n", event.Tags.GetD())
+		}
+		return ask(ctx, "Publish this event?")
+	}
+}
+
+// ask asks the yes or no question on stderr and returns errNotConfirmed
+// unless answered yes.
+func ask(ctx context.Context, question string) error {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answers <- answer
+	}()
+	select {
+	case answer := <-answers:
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return nil
+		}
+		return errNotConfirmed
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return ctx.Err()
+	}
+}
+
+// writePreview writes a readable summary of the event: its kind, title,
+// media, tags, the relays it goes to and the proof of work to mine.
+func writePreview(w io.Writer, event *nostr.Event, uploader *nip71uploader.Uploader) {
+	kind := strconv.Itoa(event.Kind)
+	if name, ok := kindNames[event.Kind]; ok {
+		kind += " (" + name + ")"
+	}
+	fmt.Fprintln(w, "Kind:     ", kind)
+	if title := tagValue(event.Tags, "title"); title != "" {
+		fmt.Fprintln(w, "Title:    ", title)
+	}
+	if event.Content != "" {
+		fmt.Fprintln(w, "Content:  ", truncate(strings.ReplaceAll(event.Content, "\n", " "), 72))
+	}
+	for _, media := range previewMedia(event) {
+		fmt.Fprintln(w, "Media:    ", media)
+	}
+
+	var hashtags, others []string
+	for _, tag := range event.Tags {
+		switch {
+		case len(tag) < 2:
+		case tag[0] == "t":
+			hashtags = append(hashtags, "#"+tag[1])
+		case tag[0] != "imeta" && tag[0] != "title":
+			others = append(others, tag[0])
+		}
+	}
+	if len(hashtags) > 0 {
+		fmt.Fprintln(w, "Hashtags: ", strings.Join(hashtags, " "))
+	}
+	if len(others) > 0 {
+		fmt.Fprintln(w, "Tags:     ", strings.Join(others, ", "))
+	}
+
+	relays := strings.Join(uploader.Relays, ", ")
+	if relays == "" {
+		relays = "none"
+	}
+	fmt.Fprintln(w, "Relays:   ", relays)
+
+	difficulty := uploader.EffectiveDifficulty()
+	switch {
+	case difficulty <= 0:
+		fmt.Fprintln(w, "Pow:       none")
+	case uploader.PowDVM != "":
+		fmt.Fprintf(w, "Pow:       difficulty %d, delegated to a DVM\n", difficulty)
+	default:
+		estimate := nip71uploader.EstimatePow(event, difficulty)
+		fmt.Fprintf(w, "Pow:       difficulty %d, about %s\n", difficulty, estimate.Round(time.Second))
+	}
+}
+
+// previewMedia describes each file of the event with its URL, dimensions,
+// duration and size.
+func previewMedia(event *nostr.Event) []string {
+	var fields []map[string]string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+		values := make(map[string]string)
+		for _, name := range []string{"url", "dim", "duration", "size"} {
+			values[name] = imeta.Field(tag, name)
+		}
+		fields = append(fields, values)
+	}
+	if event.Kind == events.KindFileMetadata {
+		values := make(map[string]string)
+		for _, name := range []string{"url", "dim", "duration", "size"} {
+			values[name] = tagValue(event.Tags, name)
+		}
+		fields = append(fields, values)
+	}
+
+	var media []string
+	for _, values := range fields {
+		details := []string{values["url"]}
+		if values["dim"] != "" {
+			details = append(details, values["dim"])
+		}
+		if seconds, err := strconv.ParseFloat(values["duration"], 64); err == nil {
+			details = append(details, time.Duration(seconds*float64(time.Second)).Round(time.Second).String())
+		}
+		if size, err := strconv.ParseInt(values["size"], 10, 64); err == nil {
+			details = append(details, fmt.Sprintf("%.1f MB", float64(size)/1e6))
+		}
+		media = append(media, strings.Join(details, ", "))
+	}
+	return media
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runPublish loads an event saved with -draft, signs it if it was saved
+// unsigned, and broadcasts it to the relays.
+func runPublish(args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	eventFile := fs.String("event", "", "Path to the event JSON file written by -draft (required)")
+	wait := fs.Bool("wait", false, "Wait until the event's created_at before publishing it")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *eventFile == "" {
+		return errors.New("-event must be provided")
+	}
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("-relay must be provided")
+	}
+
+	event, err := nip71uploader.LoadEvent(*eventFile)
+	if err != nil {
+		return fmt.Errorf("loading event: %v", err)
+	}
+
+	if event.Sig == "" {
+		pubKey, err := uploader.Signer.GetPublicKey(ctx)
+		if err != nil {
+			return fmt.Errorf("getting public key: %v", err)
+		}
+		if event.PubKey != pubKey {
+			return fmt.Errorf("draft was created for pubkey %s, but -key belongs to %s", event.PubKey, pubKey)
+		}
+		if err := uploader.Sign(ctx, event); err != nil {
+			return fmt.Errorf("signing event: %v", err)
+		}
+	} else if ok, err := event.CheckSignature(); !ok {
+		return fmt.Errorf("invalid event signature: %v", err)
+	}
+
+	if common.textOutput() {
+		fmt.Println("Loaded Event Data:", event)
+	}
+
+	if *wait {
+		if err := nip71uploader.WaitUntil(ctx, int64(event.CreatedAt)); err != nil {
+			return fmt.Errorf("waiting for created_at: %v", err)
+		}
+	}
+	results := common.publish(ctx, uploader, event)
+	return common.report(event, results, "")
+}
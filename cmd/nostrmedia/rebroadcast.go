@@ -0,0 +1,126 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/archive"
+	"github.com/girino/nip71-video-uploader/internal/batch"
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// rebroadcastKinds are the kinds of the events rebroadcast publishes again.
+var rebroadcastKinds = []int{
+	events.KindPicture,
+	events.KindVideo, events.KindShortVideo,
+	events.KindLegacyVideo, events.KindLegacyShortVideo,
+}
+
+// runRebroadcast publishes again your past video and picture events, read
+// from a local archive or from a relay, to the configured relays, for
+// moving to new relays.
+func runRebroadcast(args []string) error {
+	fs := flag.NewFlagSet("rebroadcast", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	archiveDir := fs.String("archive", "", "Archive directory written with -archive-dir to read the events from")
+	from := fs.String("from", "", "Relay address or nrelay to read the events from, instead of an archive")
+	interval := fs.Duration("interval", time.Second, "Time to wait between events, to stay within the rate limits of the relays")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if (*archiveDir == "") == (*from == "") {
+		return errors.New("exactly one of -archive and -from must be provided")
+	}
+	fromRelay := ""
+	if *from != "" {
+		var err error
+		if fromRelay, err = nip71uploader.DecodeRelay(*from); err != nil {
+			return fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+	if *interval < 0 {
+		return errors.New("-interval cannot be negative")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the events to")
+	}
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+
+	var found []*nostr.Event
+	if *archiveDir != "" {
+		found, err = archive.Events(*archiveDir)
+		if err != nil {
+			return err
+		}
+	} else {
+		found = nip71uploader.FetchMediaEvents(ctx, pubKey, []string{fromRelay})
+		// oldest first, as they were first published
+		slices.Reverse(found)
+	}
+	found = slices.DeleteFunc(found, func(event *nostr.Event) bool {
+		return event.PubKey != pubKey || !slices.Contains(rebroadcastKinds, event.Kind)
+	})
+	if len(found) == 0 {
+		return errors.New("no video or picture events of yours found")
+	}
+	log.Printf("Rebroadcasting %d events", len(found))
+
+	uploader.Pool = nip71uploader.NewRelayPool(uploader.Signer)
+	defer uploader.Pool.Close()
+
+	var results []batch.Result
+	failed := 0
+	for i, event := range found {
+		if i > 0 && ctx.Err() == nil {
+			select {
+			case <-time.After(*interval):
+			case <-ctx.Done():
+			}
+		}
+		result := batch.Result{Key: event.ID, EventID: event.ID}
+		if ctx.Err() != nil {
+			result.Error = ctx.Err().Error()
+		} else {
+			result = republish(ctx, common, uploader, event)
+		}
+		if result.Error != "" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if common.jsonOutput() {
+		if err := writeJSON(results); err != nil {
+			return err
+		}
+	} else if common.textOutput() {
+		printBatchReport(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, len(results))
+	}
+	return nil
+}
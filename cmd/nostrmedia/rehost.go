@@ -0,0 +1,54 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runRehost copies the media of an existing video or file event to the
+// Blossom server and republishes the event pointing at them.
+func runRehost(args []string) error {
+	fs := flag.NewFlagSet("rehost", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	ref := fs.String("nevent", "", "nevent, naddr, note or event id of the event to rehost (required)")
+	keepURL := fs.Bool("keep-url", false, "Keep the original URLs primary and add the rehosted ones as fallbacks")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *ref == "" {
+		return errors.New("-nevent must be provided")
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+
+	original, err := nip71uploader.FetchEvent(ctx, *ref, uploader.Relays)
+	if err != nil {
+		return fmt.Errorf("fetching event: %v", err)
+	}
+	event, err := uploader.Rehost(ctx, original, *keepURL)
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("rehosting event: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	results := common.publish(ctx, uploader, event)
+	return common.report(event, results, "")
+}
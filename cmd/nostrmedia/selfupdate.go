@@ -0,0 +1,125 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/config"
+	"github.com/girino/nip71-video-uploader/internal/selfupdate"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// runSelfUpdate replaces the running executable with the binary of the
+// latest release for the platform, once its checksum is verified against
+// the checksums signed with the release key.
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath(), "Path to the configuration file")
+	releaseKey := fs.String("release-key", "", "npub or hex pubkey the release checksums must be signed with, defaults to release_key in the configuration file")
+	repository := fs.String("repo", selfupdate.DefaultRepository, "GitHub repository the releases are published in")
+	check := fs.Bool("check", false, "Only report whether a newer release is available")
+	force := fs.Bool("force", false, "Install the latest release even when it is not newer, or the running version is unknown")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Give up after this long")
+	proxy := fs.String("proxy", "", "HTTP or SOCKS5 proxy of the downloads, defaults to proxy in the configuration file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %v", err)
+	}
+	if *releaseKey == "" {
+		*releaseKey = cfg.ReleaseKey
+	}
+	if *proxy == "" {
+		*proxy = cfg.Proxy
+	}
+	agent := userAgent()
+	if cfg.UserAgent != "" {
+		agent = cfg.UserAgent
+	}
+	if err := setupNetwork(*proxy, agent); err != nil {
+		return err
+	}
+	if *releaseKey == "" && !*check {
+		return errors.New("-release-key or release_key in the configuration file must be provided, to verify the downloaded binary")
+	}
+	var pubKey string
+	if *releaseKey != "" {
+		if pubKey, err = nip71uploader.DecodePubKey(*releaseKey); err != nil {
+			return fmt.Errorf("invalid -release-key: %v", err)
+		}
+	}
+
+	ctx, stop := interruptContext(*timeout)
+	defer stop()
+	client := selfupdate.Client()
+	release, err := selfupdate.Latest(ctx, client, *repository)
+	if err != nil {
+		return err
+	}
+	current := currentVersion()
+	newer, ok := selfupdate.Newer(release.Tag, current)
+	switch {
+	case *force:
+	case !ok:
+		return fmt.Errorf("cannot tell whether %s is newer than the running version %s, give -force to install it anyway", release.Tag, current)
+	case !newer:
+		fmt.Printf("nostrmedia %s is up to date\n", current)
+		return nil
+	}
+	if *check {
+		fmt.Printf("nostrmedia %s is available, running %s\n", release.Tag, current)
+		return nil
+	}
+
+	name := selfupdate.AssetName(runtime.GOOS, runtime.GOARCH)
+	binaryURL, sumsURL, signatureURL := release.Assets[name], release.Assets[selfupdate.ChecksumsAsset], release.Assets[selfupdate.SignatureAsset]
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no binary for %s/%s", release.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	if sumsURL == "" || signatureURL == "" {
+		return fmt.Errorf("release %s has no signed checksums, not installing it", release.Tag)
+	}
+	sums, err := selfupdate.Fetch(ctx, client, sumsURL)
+	if err != nil {
+		return err
+	}
+	signature, err := selfupdate.Fetch(ctx, client, signatureURL)
+	if err != nil {
+		return err
+	}
+	sha256Hash, err := selfupdate.Checksum(sums, signature, pubKey, release.Tag, name)
+	if err != nil {
+		return fmt.Errorf("verifying release %s: %v", release.Tag, err)
+	}
+
+	executable, err := selfupdate.Executable()
+	if err != nil {
+		return fmt.Errorf("locating the executable: %v", err)
+	}
+	// the new binary is written next to the executable, so the rename
+	// replacing it stays on the same file system
+	log.Printf("Downloading %s %s", name, release.Tag)
+	downloaded, err := selfupdate.Download(ctx, client, binaryURL, filepath.Dir(executable), sha256Hash)
+	if err != nil {
+		return err
+	}
+	if err := selfupdate.Replace(executable, downloaded); err != nil {
+		os.Remove(downloaded)
+		return fmt.Errorf("replacing %s: %v", executable, err)
+	}
+	fmt.Printf("Updated nostrmedia from %s to %s\n", current, release.Tag)
+	return nil
+}
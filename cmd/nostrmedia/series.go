@@ -0,0 +1,106 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// seriesFlags link an episode of a show to the NIP-51 set of the series and
+// to the previous episode, appending the episode to the set once published so
+// clients can navigate between episodes.
+type seriesFlags struct {
+	series   *string
+	previous *string
+	set      *nostr.Event
+}
+
+func addSeriesFlags(fs *flag.FlagSet) *seriesFlags {
+	return &seriesFlags{
+		series:   fs.String("series", "", "naddr of the NIP-51 set of the series the episode is appended to"),
+		previous: fs.String("previous-episode", "", "nevent or naddr of the previous episode of the series"),
+	}
+}
+
+// check refuses saving or scheduling the episode alone, as the set is
+// updated after it.
+func (s *seriesFlags) check(checks *flagChecks) {
+	checks.exclusive("series", "the series is updated right after the episode, give -series when publishing it", "draft", "schedule-dvm")
+}
+
+// references returns the tags linking the episode to the series and to the
+// previous episode. The set is looked up now, so an unknown series or one
+// published by another key fails before anything is uploaded.
+func (s *seriesFlags) references(ctx context.Context, uploader *nip71uploader.Uploader) (nostr.Tags, error) {
+	var references nostr.Tags
+	if *s.series != "" {
+		tag, err := nip71uploader.ReferenceTag(ctx, *s.series, uploader.Relays)
+		if err != nil {
+			return nil, fmt.Errorf("parsing series reference %s: %v", *s.series, err)
+		}
+		if tag[0] != "a" {
+			return nil, errors.New("-series must be the naddr of a NIP-51 set")
+		}
+		s.set, err = nip71uploader.FetchEvent(ctx, *s.series, uploader.Relays)
+		if err != nil {
+			return nil, fmt.Errorf("fetching series: %v", err)
+		}
+		pubKey, err := uploader.Signer.GetPublicKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting public key: %v", err)
+		}
+		if s.set.PubKey != pubKey {
+			return nil, fmt.Errorf("series %s is published by another key", *s.series)
+		}
+		references = append(references, tag)
+	}
+	if *s.previous != "" {
+		tag, err := nip71uploader.ReferenceTag(ctx, *s.previous, uploader.Relays)
+		if err != nil {
+			return nil, fmt.Errorf("parsing previous episode reference %s: %v", *s.previous, err)
+		}
+		references = append(references, tag)
+	}
+	return references, nil
+}
+
+// publish appends the signed episode, which is found on the hints relays, to
+// the series set and publishes the new version of the set.
+func (s *seriesFlags) publish(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, episode *nostr.Event, hints []string) error {
+	if s.set == nil || episode.Sig == "" {
+		return nil
+	}
+	var relay string
+	if len(hints) > 0 {
+		relay = hints[0]
+	}
+	event, err := uploader.AddEpisode(ctx, s.set, episode, relay)
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("updating series: %v", err)
+	}
+	if event == nil {
+		log.Printf("Series %s already has the episode", *s.series)
+		return nil
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	var results []nip71uploader.PublishResult
+	if len(uploader.Relays) > 0 || *common.broadcast {
+		results = common.publish(ctx, uploader, event)
+	}
+	return common.report(event, results, "")
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/server"
+	"github.com/girino/nip71-video-uploader/internal/telemetry"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"google.golang.org/grpc"
+)
+
+// runServe exposes the upload pipeline as an HTTP API until interrupted.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address the HTTP API listens on")
+	grpcListen := fs.String("grpc-listen", "", "Address the gRPC service listens on (disabled when empty)")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "OpenTelemetry collector receiving the traces of the jobs over OTLP/HTTP, such as http://localhost:4318")
+	var allowHosts stringSlice
+	fs.Var(&allowHosts, "allow-url-host", "Host name, IP address or CIDR range that media URLs may be downloaded from although it is not public (can be repeated)")
+	maxDownloadSize := fs.String("max-download-size", "4G", "Largest media file downloaded from a URL, such as 500M (0 for no limit)")
+	maxDownloadTime := fs.Duration("max-download-time", 30*time.Minute, "Timeout of downloading media from a URL (0 for no limit)")
+	maxRequestSize := fs.String("max-request-size", "4G", "Largest upload accepted by the API, all the files of a request together, such as 500M (0 for no limit)")
+	workers := fs.Int("workers", server.DefaultWorkers, "Number of jobs processed at once, the others waiting for their turn")
+	maxQueued := fs.Int("max-queued", server.DefaultMaxQueued, "Number of jobs that may wait for their turn before uploads are refused (0 for no limit)")
+	jobTTL := fs.Duration("job-ttl", server.DefaultJobTTL, "How long the status of a finished job can be polled (0 to keep it until the server stops)")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	maxSize, err := nip71uploader.ParseSize(*maxDownloadSize)
+	if err != nil {
+		return fmt.Errorf("invalid -max-download-size: %v", err)
+	}
+	requestSize, err := nip71uploader.ParseSize(*maxRequestSize)
+	if err != nil {
+		return fmt.Errorf("invalid -max-request-size: %v", err)
+	}
+	if *workers < 1 {
+		return fmt.Errorf("invalid -workers: %d, at least one job must run", *workers)
+	}
+
+	ctx, stop := interruptContext(0)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	// the URLs come from the clients of the API, which must not reach the
+	// internal network through it
+	uploader.URLGuard = &nip71uploader.URLGuard{
+		Allow:   allowHosts,
+		MaxSize: maxSize,
+		Timeout: *maxDownloadTime,
+	}
+	if *common.proxy != "" {
+		log.Printf("Jobs giving a media URL are refused, as -proxy would connect to addresses that cannot be checked")
+	}
+	defer common.close()
+	if len(uploader.Relays) == 0 {
+		return errors.New("no relays found to publish the events to")
+	}
+	// the progress of proof of work would interleave between jobs
+	uploader.PowProgress = nil
+	uploader.Pool = nip71uploader.NewRelayPool(uploader.Signer)
+	defer uploader.Pool.Close()
+
+	srv := server.New(ctx, uploader)
+	srv.JobTimeout = *common.timeout
+	srv.Webhook = *common.webhook
+	srv.Workers = *workers
+	srv.MaxQueued = *maxQueued
+	srv.JobTTL = *jobTTL
+	srv.MaxRequestSize = requestSize
+	srv.Telemetry = telemetry.New(*otlpEndpoint)
+	defer srv.Telemetry.Close()
+	uploader.Observer = srv.Telemetry
+	httpServer := &http.Server{
+		Addr:    *listen,
+		Handler: srv.Handler(),
+	}
+	if *grpcListen != "" {
+		listener, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			return fmt.Errorf("listening for gRPC: %v", err)
+		}
+		grpcServer := grpc.NewServer()
+		srv.RegisterGRPC(grpcServer)
+		go func() {
+			<-ctx.Done()
+			grpcServer.GracefulStop()
+		}()
+		go func() {
+			log.Printf("gRPC service listening on %s", *grpcListen)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("Error serving gRPC: %v", err)
+			}
+		}()
+	}
+	// the requests in flight finish before the relay pool and the
+	// databases are closed
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening on http://%s", *listen)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving HTTP API: %v", err)
+	}
+	<-shutdown
+	return nil
+}
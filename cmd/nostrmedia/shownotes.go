@@ -0,0 +1,101 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// showNotesFlags cross-post the show notes of a video or audio event as a
+// NIP-23 long-form article, the media event and the article linking to each
+// other.
+type showNotesFlags struct {
+	path       *string
+	identifier *string
+	notes      string
+}
+
+func addShowNotesFlags(fs *flag.FlagSet) *showNotesFlags {
+	return &showNotesFlags{
+		path:       fs.String("shownotes", "", "Markdown file with show notes to publish as a NIP-23 article linked to the event"),
+		identifier: fs.String("shownotes-id", "", "Descriptor for the 'd' tag of the show notes article, defaults to the -descriptor or the notes file name"),
+	}
+}
+
+// check refuses saving or scheduling the media event alone, as the article
+// is published after it.
+func (s *showNotesFlags) check(checks *flagChecks) {
+	checks.exclusive("shownotes", "the article is published right after the event, give -shownotes when publishing it", "draft", "schedule-dvm")
+	checks.requires("shownotes-id", "shownotes", "it is the d tag of the show notes article")
+}
+
+// address reads the notes and returns the coordinate of the article, or ""
+// without -shownotes.
+func (s *showNotesFlags) address(ctx context.Context, uploader *nip71uploader.Uploader, descriptor string) (string, error) {
+	if *s.path == "" {
+		return "", nil
+	}
+	notes, err := os.ReadFile(*s.path)
+	if err != nil {
+		return "", fmt.Errorf("reading show notes: %v", err)
+	}
+	s.notes = string(notes)
+
+	if *s.identifier == "" {
+		*s.identifier = descriptor
+	}
+	if *s.identifier == "" {
+		*s.identifier = strings.TrimSuffix(filepath.Base(*s.path), filepath.Ext(*s.path))
+	}
+	pubKey, err := uploader.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting public key: %v", err)
+	}
+	return nip71uploader.ShowNotesAddress(pubKey, *s.identifier), nil
+}
+
+// publish builds, signs and publishes the article for the signed media event,
+// which is found on the hints relays.
+func (s *showNotesFlags) publish(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, media *nostr.Event, hints []string, title, summary string) error {
+	if *s.path == "" || media.Sig == "" {
+		return nil
+	}
+	if title == "" {
+		title = tagValue(media.Tags, "title")
+	}
+	if summary == "" {
+		summary = media.Content
+	}
+	event, err := uploader.BuildShowNotesEvent(ctx, media, nip71uploader.ShowNotesOptions{
+		Identifier: *s.identifier,
+		Title:      title,
+		Summary:    summary,
+		Notes:      s.notes,
+		Relays:     hints,
+	})
+	if err != nil {
+		printUnfinished(event)
+		return fmt.Errorf("creating show notes article: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	var results []nip71uploader.PublishResult
+	if len(uploader.Relays) > 0 || *common.broadcast {
+		results = common.publish(ctx, uploader, event)
+	}
+	return common.report(event, results, "")
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// sourceFlags attribute mirrored media to where it was first published.
+type sourceFlags struct {
+	url    *string
+	author *string
+}
+
+func addSourceFlags(fs *flag.FlagSet) *sourceFlags {
+	return &sourceFlags{
+		url:    fs.String("canonical-url", "", "URL of the original of mirrored media, published as 'r' and 'proxy' tags"),
+		author: fs.String("original-author", "", "Name, npub, nprofile or pubkey of the original author of mirrored media"),
+	}
+}
+
+// source returns the attribution given on the command line. An author that
+// is a nostr public key is mentioned with a "p" tag instead of named.
+func (s *sourceFlags) source() (events.Source, error) {
+	source := events.Source{URL: *s.url}
+	if *s.author == "" {
+		return source, nil
+	}
+	pubKey, err := nip71uploader.DecodePubKey(*s.author)
+	switch {
+	case err == nil:
+		source.AuthorPubKey = pubKey
+	case strings.HasPrefix(*s.author, "npub1") || strings.HasPrefix(*s.author, "nprofile1") ||
+		strings.HasPrefix(*s.author, "nostr:"):
+		return source, fmt.Errorf("invalid -original-author: %v", err)
+	default:
+		source.Author = *s.author
+	}
+	return source, nil
+}
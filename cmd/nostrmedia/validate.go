@@ -0,0 +1,90 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// validateResult is printed by validate with -output json.
+type validateResult struct {
+	EventID  string           `json:"event_id"`
+	Kind     int              `json:"kind"`
+	Problems []events.Problem `json:"problems"`
+}
+
+// runValidate checks an event saved to a file or found on the relays against
+// the NIP-71, NIP-68 and NIP-94 schemas, and that its media can be fetched.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	ref := fs.String("event", "", "Event JSON file, or nevent, naddr, note or event id to look up on the relays (required)")
+	offline := fs.Bool("offline", false, "Only check the event itself, without fetching its media URLs")
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	if *ref == "" {
+		return errors.New("-event must be provided")
+	}
+	if common.eventOnly() {
+		return errors.New("-output event-only is not supported by validate, which publishes no events")
+	}
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+
+	var event *nostr.Event
+	if _, err := os.Stat(*ref); err == nil {
+		event, err = nip71uploader.LoadEvent(*ref)
+		if err != nil {
+			return fmt.Errorf("loading event: %v", err)
+		}
+	} else {
+		relays, err := common.givenRelays()
+		if err != nil {
+			return err
+		}
+		event, err = nip71uploader.FetchEvent(ctx, *ref, relays)
+		if err != nil {
+			return fmt.Errorf("fetching event: %v", err)
+		}
+	}
+
+	problems := events.Validate(event)
+	if !*offline {
+		for _, link := range nip71uploader.CheckLinks(ctx, event) {
+			problems = append(problems, events.Problem{
+				Tag:     "url",
+				Message: fmt.Sprintf("%s cannot be fetched: %s", link.URL, link.Error),
+				Hint:    "upload the file again, or repair the event with 'nostrmedia check -local'",
+			})
+		}
+	}
+
+	if common.jsonOutput() {
+		if err := writeJSON(validateResult{EventID: event.ID, Kind: event.Kind, Problems: problems}); err != nil {
+			return err
+		}
+	} else if len(problems) == 0 {
+		fmt.Printf("Event %s (kind %d) is valid\n", event.ID, event.Kind)
+	} else {
+		fmt.Printf("Event %s (kind %d):\n", event.ID, event.Kind)
+		for _, problem := range problems {
+			fmt.Println("  " + problem.String())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	return nil
+}
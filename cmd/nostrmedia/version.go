@@ -0,0 +1,82 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build information, set when building releases with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.date=2024-06-01T12:00:00Z".
+// Builds without them fall back to what the Go toolchain records.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// currentVersion returns version, else the module version of binaries built
+// with go install, or "dev" for development builds.
+func currentVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// buildCommit returns commit and date, else the revision and commit time
+// the Go toolchain records when building from a git checkout.
+func buildCommit() (string, string) {
+	revision, built := commit, date
+	dirty := false
+	if info, ok := debug.ReadBuildInfo(); ok && revision == "" {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			case "vcs.modified":
+				dirty = setting.Value == "true"
+			}
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision, built
+}
+
+// versionInfo is the line printed by -version, such as
+// "nostrmedia v1.2.3 (commit abc1234, built 2024-06-01T12:00:00Z, go1.23.3 linux/amd64)".
+func versionInfo() string {
+	var details []string
+	revision, built := buildCommit()
+	if revision != "" {
+		details = append(details, "commit "+revision)
+	}
+	if built != "" {
+		details = append(details, "built "+built)
+	}
+	details = append(details, runtime.Version()+" "+runtime.GOOS+"/"+runtime.GOARCH)
+	return fmt.Sprintf("nostrmedia %s (%s)", currentVersion(), strings.Join(details, ", "))
+}
+
+// userAgent is the User-Agent of the HTTP requests, such as
+// "nostrmedia/1.2.3".
+func userAgent() string {
+	return "nostrmedia/" + strings.TrimPrefix(currentVersion(), "v")
+}
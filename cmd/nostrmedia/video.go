@@ -0,0 +1,232 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runVideo uploads or downloads a video and publishes its NIP-71 event.
+func runVideo(args []string) error {
+	fs := flag.NewFlagSet("video", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	publish := addPublishFlags(fs, common)
+	var videoURLs stringSlice
+	fs.Var(&videoURLs, "url", "URL of the video file, repeated for mirrors of the same file published as fallbacks")
+	videoFile := fs.String("file", "", "Path to the video file")
+	expectedHash := fs.String("expected-hash", "", "Hex sha256 the file must have, refusing it before publishing when it differs")
+	importURL := fs.String("import-url", "", "Page of a YouTube, Vimeo, PeerTube or other video to import with yt-dlp")
+	title := fs.String("title", "", "Title of the video")
+	titleTemplate := fs.String("title-template", "", "Go template for the title when -title is missing, over .Title, .Name, .Filename, .Date, .Duration, .Width and .Height")
+	description := fs.String("description", "", "Description of the video")
+	descriptionTemplate := fs.String("description-template", "", descriptionTemplateUsage)
+	publishedAt := fs.String("published_at", "", "Time when the video was published ("+timestampUsage+"), defaults to the upload time")
+	descriptor := fs.String("descriptor", "", "Descriptor for the 'd' tag")
+	kinds := addVideoKindFlags(fs, "kind", "Use long/horizontal video event kind")
+	bothKinds := fs.Bool("both-kinds", false, "Also publish the video as a legacy 34235/34236 event, each event referencing the other")
+	thumbnailAt := fs.String("thumbnail-at", "", "Time of the frame used as the poster (seconds, MM:SS or HH:MM:SS), extracted with ffmpeg")
+	thumbnailFile := fs.String("thumbnail-file", "", "Image file to upload as the poster of the video")
+	showNotes := addShowNotesFlags(fs)
+	series := addSeriesFlags(fs)
+	lang := addLanguageFlags(fs)
+	attribution := addSourceFlags(fs)
+	transcodeDVM := fs.String("dvm-transcode", "", "Pubkey of a NIP-90 DVM transcoding the uploaded video into renditions and a poster, or 'any'")
+	transcodeTimeout := fs.Duration("dvm-transcode-timeout", 30*time.Minute, "Give up waiting for the transcoding DVM after this long (0 for no limit)")
+	args, err := resumeArgs("video", args)
+	if err != nil {
+		return err
+	}
+	if err := common.parse(args); err != nil {
+		return err
+	}
+
+	checks := newFlagChecks(fs)
+	checks.required("give a local -file, the -url of a hosted video or the -import-url of a video page", "file", "url", "import-url")
+	checks.exclusive("import-url", "the video of the page is downloaded and uploaded, leave out -file and -url", "file", "url")
+	checks.exclusive("thumbnail-at", "the poster is either extracted from the video or uploaded from a file", "thumbnail-file")
+	checks.exclusive("both-kinds", "-both-kinds publishes the legacy event next to the new one", "legacy")
+	checks.exclusive("both-kinds", "the legacy copy is published right after the event, give -both-kinds when publishing it", "draft", "schedule-dvm")
+	checks.check(kinds.validate())
+	// the d tag only makes legacy events replaceable, or names show notes
+	if checks.given("descriptor") && !kinds.isLegacy() && !*bothKinds && !checks.given("shownotes") {
+		checks.add("descriptor", "only legacy video events are replaced by the event with the same d tag", "add -legacy or -both-kinds for a replaceable event, or leave -descriptor out")
+	}
+	publish.check(checks)
+	showNotes.check(checks)
+	series.check(checks)
+	*publishedAt, err = timestampFlag("published_at", *publishedAt)
+	checks.check(err)
+	*transcodeDVM, err = decodeDVM("dvm-transcode", *transcodeDVM)
+	checks.check(err)
+	var posterAt time.Duration
+	if *thumbnailAt != "" {
+		if posterAt, err = nip71uploader.ParseTimecode(*thumbnailAt); err != nil {
+			checks.check(flagError("thumbnail-at", err, ""))
+		} else if posterAt == 0 {
+			checks.add("thumbnail-at", "the poster frame must be after the start of the video", "give the time of a frame, such as 5 or 01:30")
+		}
+	}
+	if err := checks.err(); err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext(*common.timeout)
+	defer stop()
+	uploader, err := common.uploader(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.close()
+	uploader.TranscodeDVM = *transcodeDVM
+	uploader.TranscodeTimeout = *transcodeTimeout
+
+	createdAt, err := publish.eventCreatedAt()
+	if err != nil {
+		return err
+	}
+	template, err := publish.eventTemplate()
+	if err != nil {
+		return err
+	}
+	languages, err := lang.languages(uploader)
+	if err != nil {
+		return err
+	}
+	showNotesAddress, err := showNotes.address(ctx, uploader, *descriptor)
+	if err != nil {
+		return err
+	}
+	references, err := series.references(ctx, uploader)
+	if err != nil {
+		return err
+	}
+	event, err := publish.startJob("video", args, uploader)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		thumbnail := *thumbnailFile
+		var width, height int
+		if *importURL != "" && *videoFile == "" && len(videoURLs) == 0 {
+			imported, err := nip71uploader.ImportVideo(ctx, *importURL)
+			if err != nil {
+				return fmt.Errorf("importing %s: %v", *importURL, err)
+			}
+			defer imported.Cleanup()
+
+			// the command line wins over the metadata of the original video
+			*videoFile = imported.Path
+			if thumbnail == "" && posterAt == 0 {
+				thumbnail = imported.Thumbnail
+			}
+			if *title == "" {
+				*title = imported.Title
+			}
+			if *description == "" {
+				*description = imported.Description
+			}
+			if *attribution.url == "" {
+				*attribution.url = imported.URL
+			}
+			if *attribution.author == "" {
+				*attribution.author = imported.Author
+			}
+			if *publishedAt == "" && imported.PublishedAt != 0 {
+				*publishedAt = fmt.Sprintf("%d", imported.PublishedAt)
+			}
+			width, height = imported.Width, imported.Height
+			uploader.Hashtags = append(uploader.Hashtags, imported.Tags...)
+		}
+
+		source, err := attribution.source()
+		if err != nil {
+			return err
+		}
+		// the first URL is the video unless it is uploaded from -file
+		media, fallbacks := nip71uploader.Media{Path: *videoFile, SHA256: *expectedHash}, []string(videoURLs)
+		if media.Path == "" && len(fallbacks) > 0 {
+			media.URL, fallbacks = fallbacks[0], fallbacks[1:]
+		}
+
+		// the measured file knows about rotation, the site of an imported
+		// video may not
+		orientation := func(measuredWidth, measuredHeight int) bool {
+			if measuredWidth > 0 && measuredHeight > 0 {
+				width, height = measuredWidth, measuredHeight
+			}
+			return kinds.horizontal(width, height)
+		}
+
+		// Create the NIP-71 event with the extracted video information
+		event, err = uploader.BuildVideoEvent(ctx, nip71uploader.VideoOptions{
+			Media:               media,
+			Fallbacks:           fallbacks,
+			Title:               *title,
+			TitleTemplate:       *titleTemplate,
+			Description:         *description,
+			DescriptionTemplate: *descriptionTemplate,
+			PublishedAt:         *publishedAt,
+			Identifier:          *descriptor,
+			Legacy:              kinds.isLegacy(),
+			Orientation:         orientation,
+			BothKinds:           *bothKinds,
+			Thumbnail:           nip71uploader.Media{Path: thumbnail},
+			ThumbnailAt:         posterAt,
+			ShowNotes:           showNotesAddress,
+			References:          references,
+			Languages:           languages,
+			Source:              source,
+			CreatedAt:           createdAt,
+			Template:            template,
+		})
+		if err != nil {
+			printUnfinished(event)
+			return fmt.Errorf("creating NIP-71 event: %v", err)
+		}
+	}
+
+	if err := publish.finish(ctx, uploader, event); err != nil {
+		return err
+	}
+	if *bothKinds {
+		if err := publishLegacyCopy(ctx, common, uploader, event, publish.relayHints(uploader)); err != nil {
+			return err
+		}
+	}
+	if err := showNotes.publish(ctx, common, uploader, event, publish.relayHints(uploader), *title, *description); err != nil {
+		return err
+	}
+	return series.publish(ctx, common, uploader, event, publish.relayHints(uploader))
+}
+
+// publishLegacyCopy builds, signs and publishes the legacy copy of the signed
+// video event for -both-kinds, referencing it with the hints of where it was
+// published.
+func publishLegacyCopy(ctx context.Context, common *commonFlags, uploader *nip71uploader.Uploader, video *nostr.Event, hints []string) error {
+	if video.Sig == "" {
+		return nil
+	}
+	event, err := uploader.BuildLegacyCopy(ctx, video, hints)
+	if err != nil {
+		return fmt.Errorf("creating legacy copy: %v", err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+
+	common.printEvent(event)
+	var results []nip71uploader.PublishResult
+	if len(uploader.Relays) > 0 || *common.broadcast {
+		results = common.publish(ctx, uploader, event)
+	}
+	return common.report(event, results, "")
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+)
+
+// videoKindFlags select the kind of video events: legacy or not, and
+// horizontal (21/34235) or vertical (22/34236), either detected from the
+// video or forced with -orientation or an explicit kind.
+type videoKindFlags struct {
+	fs          *flag.FlagSet
+	kindName    string
+	legacy      *bool
+	long        *bool
+	orientation *string
+	kind        *int
+}
+
+// addVideoKindFlags registers -legacy, -long, -orientation and the explicit
+// kind flag, called kindName.
+func addVideoKindFlags(fs *flag.FlagSet, kindName, longUsage string) *videoKindFlags {
+	return &videoKindFlags{
+		fs:          fs,
+		kindName:    kindName,
+		legacy:      fs.Bool("legacy", false, "Use legacy event kinds"),
+		long:        fs.Bool("long", false, longUsage),
+		orientation: fs.String("orientation", "", "Force the video kind for 'vertical' (22/34236) or 'horizontal' (21/34235) videos, whatever their dimensions"),
+		kind:        fs.Int(kindName, 0, "Video event kind: 21, 22, 34235 or 34236, instead of -legacy, -long and -orientation"),
+	}
+}
+
+// validate checks the flags once parsed, returning InputErrors naming the
+// flags at fault.
+func (v *videoKindFlags) validate() error {
+	checks := newFlagChecks(v.fs)
+	switch *v.kind {
+	case 0:
+	case events.KindVideo, events.KindShortVideo, events.KindLegacyVideo, events.KindLegacyShortVideo:
+		checks.exclusive(v.kindName, "the kind already says whether the event is legacy and vertical", "legacy", "long", "orientation")
+	default:
+		checks.add(v.kindName, fmt.Sprintf("invalid kind %d", *v.kind), "give 21, 22, 34235 or 34236")
+	}
+	switch *v.orientation {
+	case "", "vertical", "horizontal":
+	default:
+		checks.add("orientation", fmt.Sprintf("invalid orientation %q", *v.orientation), "give vertical or horizontal")
+	}
+	checks.exclusive("orientation", "-long is the same as -orientation horizontal", "long")
+	return checks.err()
+}
+
+// isLegacy reports whether the legacy addressable kinds are selected.
+func (v *videoKindFlags) isLegacy() bool {
+	if *v.kind != 0 {
+		return *v.kind == events.KindLegacyVideo || *v.kind == events.KindLegacyShortVideo
+	}
+	return *v.legacy
+}
+
+// horizontal reports whether the video gets a horizontal kind. The explicit
+// kind and -orientation win, then -long when given, then the display size
+// of the video when known (width and height above 0), which makes square
+// videos vertical.
+func (v *videoKindFlags) horizontal(width, height int) bool {
+	switch {
+	case *v.kind != 0:
+		return *v.kind == events.KindVideo || *v.kind == events.KindLegacyVideo
+	case *v.orientation != "":
+		return *v.orientation == "horizontal"
+	}
+	longSet := false
+	v.fs.Visit(func(f *flag.Flag) { longSet = longSet || f.Name == "long" })
+	if !longSet && width > 0 && height > 0 {
+		return width > height
+	}
+	return *v.long
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package archive keeps a local copy of every published event and of its
+// media, so that presence on new relays and servers can be rebuilt later.
+//
+// The archive directory holds the media files by sha256 under blobs/, and
+// every event under <date>/<pubkey>/<kind>/<event id>/, with event.json and
+// links to the blobs of its media.
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// EventFile is the name of the event in its directory.
+const EventFile = "event.json"
+
+// Archive is an archive directory. It is safe for concurrent use, and a nil
+// Archive archives nothing.
+type Archive struct {
+	dir string
+
+	mu sync.Mutex
+	// blobs are the files of the blobs staged by this run, by sha256.
+	blobs map[string]string
+	// hashes are the sha256 of the staged blobs, by URL.
+	hashes map[string]string
+}
+
+// Open creates the archive directory if needed.
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, fmt.Errorf("creating archive %s: %v", dir, err)
+	}
+	return &Archive{dir: dir, blobs: make(map[string]string), hashes: make(map[string]string)}, nil
+}
+
+// Stage keeps a copy of a media file, hard linked when possible, before the
+// event using it is published and its temporary files are removed.
+func (a *Archive) Stage(sha256Hash, path, url string) error {
+	if a == nil {
+		return nil
+	}
+	blob := filepath.Join(a.dir, "blobs", sha256Hash+strings.ToLower(filepath.Ext(path)))
+	if _, err := os.Stat(blob); err != nil {
+		if err := linkOrCopy(path, blob); err != nil {
+			return fmt.Errorf("archiving %s: %v", path, err)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.blobs[sha256Hash] = blob
+	if url != "" {
+		a.hashes[url] = sha256Hash
+	}
+	return nil
+}
+
+// Add writes the event and links the blobs of its media, those staged by
+// this run, next to it. It returns the directory of the event.
+func (a *Archive) Add(event *nostr.Event) (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	dir := filepath.Join(a.dir, time.Unix(int64(event.CreatedAt), 0).UTC().Format("2006-01-02"),
+		event.PubKey, strconv.Itoa(event.Kind), event.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating %s: %v", dir, err)
+	}
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, EventFile), data, 0644); err != nil {
+		return "", fmt.Errorf("writing %s: %v", dir, err)
+	}
+
+	for _, blob := range a.eventBlobs(event) {
+		target := filepath.Join(dir, filepath.Base(blob))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		if err := linkOrCopy(blob, target); err != nil {
+			return "", fmt.Errorf("archiving %s: %v", blob, err)
+		}
+	}
+	return dir, nil
+}
+
+// eventBlobs returns the staged blobs of the media of the event, found by
+// their sha256 or, for thumbnails and posters, by their URL.
+func (a *Archive) eventBlobs(event *nostr.Event) []string {
+	var files []imeta.Imeta
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "imeta" {
+			if file, err := imeta.Parse(tag); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	if event.Kind == events.KindFileMetadata {
+		if file, err := imeta.FromTags(event.Tags); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var blobs []string
+	add := func(sha256Hash string) {
+		if blob, ok := a.blobs[sha256Hash]; ok {
+			blobs = append(blobs, blob)
+		}
+	}
+	for _, file := range files {
+		if file.Hash != "" {
+			add(file.Hash)
+		} else {
+			add(a.hashes[file.URL])
+		}
+		for _, url := range []string{file.Image, file.Thumb} {
+			if url != "" {
+				add(a.hashes[url])
+			}
+		}
+	}
+	return blobs
+}
+
+// Events reads the events of the archive at dir, oldest first.
+func Events(dir string) ([]*nostr.Event, error) {
+	var found []*nostr.Event
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path == filepath.Join(dir, "blobs") {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || entry.Name() != EventFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var event nostr.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("decoding %s: %v", path, err)
+		}
+		found = append(found, &event)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading archive %s: %v", dir, err)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].CreatedAt < found[j].CreatedAt
+	})
+	return found, nil
+}
+
+// linkOrCopy hard links src to dst, or copies it when they are on different
+// file systems.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package batch reads the manifests of the batch command and keeps track of
+// which of their entries were already published.
+package batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// Entry is one row of a manifest.
+type Entry struct {
+	// Kind is video, picture, file or audio. Empty means the batch default.
+	Kind        string   `json:"kind,omitempty"`
+	File        string   `json:"file,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// PublishedAt is the published_at of the entry in unix seconds.
+	PublishedAt int64 `json:"published_at,omitempty"`
+}
+
+// Key identifies the entry in the progress file.
+func (e Entry) Key() string {
+	if e.File != "" {
+		return e.File
+	}
+	return e.URL
+}
+
+// LoadManifest reads a .json manifest (an array of entries) or a .csv
+// manifest whose header names the columns kind, file, url, title,
+// description, tags (comma separated) and published_at.
+func LoadManifest(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", path, err)
+		}
+	case ".csv":
+		entries, err = readCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported manifest %s, must be .json or .csv", path)
+	}
+
+	for i, entry := range entries {
+		if entry.File == "" && entry.URL == "" {
+			return nil, fmt.Errorf("entry %d of %s has neither file nor url", i+1, path)
+		}
+	}
+	return entries, nil
+}
+
+func readCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	var entries []Entry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := Entry{
+			Kind:        field("kind"),
+			File:        field("file"),
+			URL:         field("url"),
+			Title:       field("title"),
+			Description: field("description"),
+		}
+		for _, tag := range strings.Split(field("tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		if publishedAt := field("published_at"); publishedAt != "" {
+			entry.PublishedAt, err = nip71uploader.ParseTimestamp(publishedAt)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid published_at: %v", line, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Result is the outcome of one manifest entry.
+type Result struct {
+	Key     string `json:"key"`
+	EventID string `json:"event_id,omitempty"`
+	Nevent  string `json:"nevent,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Progress records the entries already published, so an interrupted batch
+// can be run again without publishing them twice. It is saved after every
+// update and is safe for concurrent use.
+type Progress struct {
+	path string
+
+	mu   sync.Mutex
+	done map[string]Result
+}
+
+// LoadProgress reads the progress file at path. A missing file means no
+// entry was published yet.
+func LoadProgress(path string) (*Progress, error) {
+	p := &Progress{path: path, done: make(map[string]Result)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	for _, result := range results {
+		p.done[result.Key] = result
+	}
+	return p, nil
+}
+
+// Done returns the recorded result of a published entry.
+func (p *Progress) Done(key string) (Result, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result, ok := p.done[key]
+	return result, ok
+}
+
+// Complete records a published entry and saves the progress file.
+func (p *Progress) Complete(result Result) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[result.Key] = result
+
+	results := make([]Result, 0, len(p.done))
+	for _, result := range p.done {
+		results = append(results, result)
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves it truncated
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, p.path)
+}
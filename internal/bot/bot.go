@@ -0,0 +1,173 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package bot bridges chats to the upload pipeline of the bot command: media
+// posted to a Telegram chat or a Matrix room is published as a job of a
+// server.Server, and the bot replies with the nevent of the event.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/server"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// PollInterval is how often the bot checks whether a job is done.
+var PollInterval = time.Second
+
+// retryDelay is the wait before receiving again after a chat error.
+const retryDelay = 10 * time.Second
+
+// Message is a media message received from a chat.
+type Message struct {
+	// Chat is the chat or room the message was posted to.
+	Chat string
+	// ID is the id of the message, which the reply refers to.
+	ID string
+	// Caption is the text posted with the media. Its first line is the
+	// title of the event and the rest its description.
+	Caption  string
+	Filename string
+	MIME     string
+	// Media identifies the file for Chat.Download.
+	Media string
+}
+
+// Chat is a chat network the bot listens to.
+type Chat interface {
+	// Name names the network in logs, such as "telegram".
+	Name() string
+	// Receive waits for the next media messages posted to the allowed chats.
+	Receive(ctx context.Context) ([]Message, error)
+	// Download opens the media of a message.
+	Download(ctx context.Context, msg Message) (io.ReadCloser, error)
+	// Reply answers the message with text.
+	Reply(ctx context.Context, msg Message, text string) error
+}
+
+// Run receives media messages from chat until ctx is done, publishes each
+// through srv and replies with the outcome.
+func Run(ctx context.Context, chat Chat, srv *server.Server) error {
+	log.Printf("Listening to %s", chat.Name())
+	for ctx.Err() == nil {
+		messages, err := chat.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error receiving from %s, retrying in %v: %v", chat.Name(), retryDelay, err)
+			sleep(ctx, retryDelay)
+			continue
+		}
+		for _, msg := range messages {
+			go handle(ctx, chat, srv, msg)
+		}
+	}
+	return nil
+}
+
+// handle publishes the media of a message and replies with the nevent of
+// the event, or the error.
+func handle(ctx context.Context, chat Chat, srv *server.Server, msg Message) {
+	log.Printf("Publishing %s from %s chat %s", msg.Filename, chat.Name(), msg.Chat)
+	job, err := submit(ctx, chat, srv, msg)
+	if err == nil {
+		job, err = wait(ctx, srv, job.ID)
+	}
+	reply := ""
+	switch {
+	case err != nil:
+		reply = fmt.Sprintf("Failed to publish: %v", err)
+	case job.Status == server.StatusFailed:
+		reply = fmt.Sprintf("Failed to publish: %s", job.Error)
+	case job.Naddr != "":
+		reply = "Published: nostr:" + job.Naddr
+	default:
+		reply = "Published: nostr:" + job.Nevent
+	}
+	if err := chat.Reply(ctx, msg, reply); err != nil {
+		log.Printf("Error replying on %s: %v", chat.Name(), err)
+	}
+}
+
+// submit downloads the media and starts a job publishing it.
+func submit(ctx context.Context, chat Chat, srv *server.Server, msg Message) (server.Job, error) {
+	path, err := download(ctx, chat, msg)
+	if err != nil {
+		return server.Job{}, fmt.Errorf("downloading %s: %v", msg.Filename, err)
+	}
+	title, description, _ := strings.Cut(strings.TrimSpace(msg.Caption), "\n")
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = strings.TrimSuffix(msg.Filename, filepath.Ext(msg.Filename))
+	}
+	return srv.Submit([]string{path}, server.Request{
+		Kind:        Kind(msg.MIME),
+		Title:       title,
+		Description: strings.TrimSpace(description),
+	})
+}
+
+// download copies the media of the message to a temporary file, which the
+// job removes once done.
+func download(ctx context.Context, chat Chat, msg Message) (string, error) {
+	body, err := chat.Download(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	file, err := os.CreateTemp(nip71uploader.TempDir, "bot-*"+filepath.Ext(msg.Filename))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// wait polls the job until it is done or failed.
+func wait(ctx context.Context, srv *server.Server, id string) (server.Job, error) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		job, _ := srv.Job(id)
+		if job.Status == server.StatusDone || job.Status == server.StatusFailed {
+			return job, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return job, ctx.Err()
+		}
+	}
+}
+
+// Kind returns the kind of job for a MIME type: video, picture or file.
+func Kind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "image/"):
+		return "picture"
+	}
+	return "file"
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// matrixSyncTimeout is how long /sync waits for new events.
+const matrixSyncTimeout = 30 * time.Second
+
+// Matrix receives media posted to Matrix rooms the bot account joined,
+// through the client-server API. Messages posted before the bot started are
+// ignored.
+type Matrix struct {
+	homeserver string
+	token      string
+	// rooms are the ids of the rooms accepted, others are ignored.
+	rooms  []string
+	since  string
+	client *http.Client
+	txn    atomic.Int64
+}
+
+// NewMatrix returns a Matrix bot logged in to homeserver, such as
+// https://matrix.org, with the access token of its account, accepting media
+// from the rooms with the given ids.
+func NewMatrix(homeserver, token string, rooms []string) *Matrix {
+	return &Matrix{
+		homeserver: strings.TrimRight(homeserver, "/"),
+		token:      token,
+		rooms:      rooms,
+		client:     &http.Client{Transport: http.DefaultClient.Transport, Timeout: matrixSyncTimeout + 30*time.Second},
+	}
+}
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType  string `json:"msgtype"`
+		Body     string `json:"body"`
+		Filename string `json:"filename"`
+		URL      string `json:"url"`
+		Info     struct {
+			MIMEType string `json:"mimetype"`
+		} `json:"info"`
+	} `json:"content"`
+}
+
+// Name implements Chat.
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+// Receive implements Chat.
+func (m *Matrix) Receive(ctx context.Context) ([]Message, error) {
+	filter, _ := json.Marshal(map[string]any{
+		"room": map[string]any{
+			"rooms":    m.rooms,
+			"timeline": map[string]any{"types": []string{"m.room.message"}},
+		},
+		"presence":     map[string]any{"types": []string{}},
+		"account_data": map[string]any{"types": []string{}},
+	})
+	params := url.Values{"filter": {string(filter)}}
+	first := m.since == ""
+	if first {
+		// the first sync only finds where the timelines end
+		params.Set("timeout", "0")
+	} else {
+		params.Set("since", m.since)
+		params.Set("timeout", strconv.FormatInt(matrixSyncTimeout.Milliseconds(), 10))
+	}
+	var sync struct {
+		NextBatch string `json:"next_batch"`
+		Rooms     struct {
+			Join map[string]struct {
+				Timeline struct {
+					Events []matrixEvent `json:"events"`
+				} `json:"timeline"`
+			} `json:"join"`
+		} `json:"rooms"`
+	}
+	if err := m.call(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+params.Encode(), nil, &sync); err != nil {
+		return nil, err
+	}
+	m.since = sync.NextBatch
+	if first {
+		return nil, nil
+	}
+
+	var messages []Message
+	for _, room := range m.rooms {
+		for _, event := range sync.Rooms.Join[room].Timeline.Events {
+			content := event.Content
+			if event.Type != "m.room.message" || content.URL == "" {
+				continue
+			}
+			if content.MsgType != "m.video" && content.MsgType != "m.image" && content.MsgType != "m.file" && content.MsgType != "m.audio" {
+				continue
+			}
+			// the body is a caption when a filename is given apart
+			filename, caption := content.Body, ""
+			if content.Filename != "" && content.Filename != content.Body {
+				filename, caption = content.Filename, content.Body
+			}
+			messages = append(messages, Message{
+				Chat:     room,
+				ID:       event.EventID,
+				Caption:  caption,
+				Filename: filename,
+				MIME:     content.Info.MIMEType,
+				Media:    content.URL,
+			})
+		}
+	}
+	return messages, nil
+}
+
+// Download implements Chat.
+func (m *Matrix) Download(ctx context.Context, msg Message) (io.ReadCloser, error) {
+	serverName, mediaID, ok := strings.Cut(strings.TrimPrefix(msg.Media, "mxc://"), "/")
+	if !ok || !strings.HasPrefix(msg.Media, "mxc://") {
+		return nil, fmt.Errorf("invalid media URI %q", msg.Media)
+	}
+	path := "/_matrix/client/v1/media/download/" + url.PathEscape(serverName) + "/" + url.PathEscape(mediaID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.homeserver+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	// the download is not bounded by the timeout of the API calls
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", msg.Media, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Reply implements Chat.
+func (m *Matrix) Reply(ctx context.Context, msg Message, text string) error {
+	content := map[string]any{
+		"msgtype": "m.notice",
+		"body":    text,
+		"m.relates_to": map[string]any{
+			"m.in_reply_to": map[string]string{"event_id": msg.ID},
+		},
+	}
+	txn := fmt.Sprintf("nostrmedia-%d-%d", time.Now().UnixNano(), m.txn.Add(1))
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(msg.Chat) + "/send/m.room.message/" + txn
+	return m.call(ctx, http.MethodPut, path, content, nil)
+}
+
+// call sends a request to the client-server API and decodes the response
+// into result.
+func (m *Matrix) call(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.homeserver+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var matrixErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&matrixErr)
+		return fmt.Errorf("%s %s: %s %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, matrixErr.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TelegramAPI is the base URL of the Telegram Bot API.
+var TelegramAPI = "https://api.telegram.org"
+
+// telegramPollTimeout is how long getUpdates waits for new messages.
+const telegramPollTimeout = 30 * time.Second
+
+// Telegram receives media posted to Telegram chats through the Bot API,
+// with long polling. The Bot API only lets bots download files of up to
+// 20 MB.
+type Telegram struct {
+	token string
+	// chats are the ids of the chats accepted, others are ignored.
+	chats  []string
+	offset int64
+	client *http.Client
+}
+
+// NewTelegram returns a Telegram bot with the token given by @BotFather,
+// accepting media from the chats with the given ids.
+func NewTelegram(token string, chats []string) *Telegram {
+	return &Telegram{
+		token:  token,
+		chats:  chats,
+		client: &http.Client{Transport: http.DefaultClient.Transport, Timeout: telegramPollTimeout + 30*time.Second},
+	}
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MIMEType string `json:"mime_type"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Caption   string         `json:"caption"`
+	Video     *telegramFile  `json:"video"`
+	Animation *telegramFile  `json:"animation"`
+	Audio     *telegramFile  `json:"audio"`
+	Document  *telegramFile  `json:"document"`
+	Photo     []telegramFile `json:"photo"`
+}
+
+// Name implements Chat.
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+// Receive implements Chat.
+func (t *Telegram) Receive(ctx context.Context) ([]Message, error) {
+	params := url.Values{
+		"offset":          {strconv.FormatInt(t.offset, 10)},
+		"timeout":         {strconv.Itoa(int(telegramPollTimeout.Seconds()))},
+		"allowed_updates": {`["message","channel_post"]`},
+	}
+	var updates []struct {
+		UpdateID    int64            `json:"update_id"`
+		Message     *telegramMessage `json:"message"`
+		ChannelPost *telegramMessage `json:"channel_post"`
+	}
+	if err := t.call(ctx, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+	var messages []Message
+	for _, update := range updates {
+		t.offset = max(t.offset, update.UpdateID+1)
+		msg := update.Message
+		if msg == nil {
+			msg = update.ChannelPost
+		}
+		if msg == nil {
+			continue
+		}
+		chat := strconv.FormatInt(msg.Chat.ID, 10)
+		if !slices.Contains(t.chats, chat) {
+			continue
+		}
+		file, mimeType := msg.media()
+		if file == nil {
+			continue
+		}
+		messages = append(messages, Message{
+			Chat:     chat,
+			ID:       strconv.FormatInt(msg.MessageID, 10),
+			Caption:  msg.Caption,
+			Filename: file.FileName,
+			MIME:     mimeType,
+			Media:    file.FileID,
+		})
+	}
+	return messages, nil
+}
+
+// media returns the file of the message and its MIME type, or nil when it
+// has none. Photos come in several sizes, the largest being the last.
+func (m *telegramMessage) media() (*telegramFile, string) {
+	for _, file := range []*telegramFile{m.Video, m.Animation, m.Audio, m.Document} {
+		if file != nil {
+			return file, file.MIMEType
+		}
+	}
+	if len(m.Photo) > 0 {
+		photo := m.Photo[len(m.Photo)-1]
+		photo.FileName = "photo.jpg"
+		return &photo, "image/jpeg"
+	}
+	return nil, ""
+}
+
+// Download implements Chat.
+func (t *Telegram) Download(ctx context.Context, msg Message) (io.ReadCloser, error) {
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := t.call(ctx, "getFile", url.Values{"file_id": {msg.Media}}, &file); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, TelegramAPI+"/file/bot"+t.token+"/"+file.FilePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the download is not bounded by the timeout of the API calls
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, redact(err, t.token)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading file: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Reply implements Chat.
+func (t *Telegram) Reply(ctx context.Context, msg Message, text string) error {
+	params := url.Values{
+		"chat_id":             {msg.Chat},
+		"text":                {text},
+		"reply_to_message_id": {msg.ID},
+	}
+	return t.call(ctx, "sendMessage", params, nil)
+}
+
+// call calls a method of the Bot API and decodes its result into result.
+func (t *Telegram) call(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, TelegramAPI+"/bot"+t.token+"/"+method, bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// the token is part of the URL of the request
+		return redact(err, t.token)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: decoding response: %v", method, err)
+	}
+	if !response.OK {
+		return fmt.Errorf("%s: %s", method, response.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// redact removes the secret from an error message.
+func redact(err error, secret string) error {
+	return errors.New(strings.ReplaceAll(err.Error(), secret, "<token>"))
+}
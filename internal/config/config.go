@@ -0,0 +1,106 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package config loads the nostrmedia configuration file, which provides
+// defaults for the command line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the defaults read from the configuration file. Zero values
+// mean "not configured" and leave the built-in flag defaults in place.
+type Config struct {
+	// Key is the private key used for signing, hex or nsec.
+	Key string `yaml:"key"`
+	// Blossom is the base URL of the Blossom server used for uploads.
+	Blossom string `yaml:"blossom"`
+	// Relays receive the published events.
+	Relays []string `yaml:"relays"`
+	// Indexers are queried for the NIP-65 relay list when no relays are
+	// configured.
+	Indexers []string `yaml:"indexers"`
+	// Diff is the proof of work difficulty.
+	Diff *int `yaml:"diff"`
+	// Hashtags are added as "t" tags to every media event.
+	Hashtags []string `yaml:"hashtags"`
+	// Client is published in a "client" tag.
+	Client string `yaml:"client"`
+	// FFmpeg and FFprobe are the paths of the executables, when they are
+	// not in the PATH.
+	FFmpeg  string `yaml:"ffmpeg"`
+	FFprobe string `yaml:"ffprobe"`
+	// TempDir is the directory of the temporary files.
+	TempDir string `yaml:"tmpdir"`
+	// ArchiveDir keeps every published event and a copy of its media.
+	ArchiveDir string `yaml:"archive_dir"`
+	// ClassifyCmd classifies every media file before publishing it.
+	ClassifyCmd string `yaml:"classify_cmd"`
+	// NWC is the nostr+walletconnect:// URI of the wallet paying the
+	// Blossom servers and DVMs that require payment.
+	NWC string `yaml:"nwc"`
+	// MaxSpend is the most sats paid through the wallet in one run.
+	MaxSpend *int64 `yaml:"max_spend"`
+	// Webhook receives the outcome of every job.
+	Webhook string `yaml:"webhook"`
+	// Proxy is the HTTP or SOCKS5 proxy of every connection.
+	Proxy string `yaml:"proxy"`
+	// UserAgent replaces the User-Agent sent to servers and relays.
+	UserAgent string `yaml:"user_agent"`
+	// ReleaseKey is the pubkey, hex or npub, the checksums of the
+	// releases installed by self-update must be signed with.
+	ReleaseKey string `yaml:"release_key"`
+	// BlossomAuth customizes the authorizations sent to some Blossom
+	// servers, by base URL.
+	BlossomAuth map[string]BlossomAuth `yaml:"blossom_auth"`
+}
+
+// BlossomAuth customizes the authorizations sent to a Blossom server.
+type BlossomAuth struct {
+	// Content replaces the description of the authorized actions.
+	Content string `yaml:"content"`
+	// Expiration is how long the authorizations stay valid.
+	Expiration time.Duration `yaml:"expiration"`
+	// Scoped limits the authorizations to the server.
+	Scoped bool `yaml:"scoped"`
+	// Nonce makes every authorization unique.
+	Nonce bool `yaml:"nonce"`
+}
+
+// DefaultPath returns ~/.config/nip71/config.yaml, or the platform
+// equivalent.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "nip71", "config.yaml")
+}
+
+// Load reads the configuration file at path. A missing file is not an error
+// and yields an empty configuration.
+func Load(path string) (*Config, error) {
+	var cfg Config
+	if path == "" {
+		return &cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package jobs records the progress of the upload pipeline in a local bolt
+// database, so that an interrupted run can be resumed from its last
+// completed stage.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/config"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Stages of a job, in pipeline order.
+const (
+	// StageCreated jobs have not finished uploading their media.
+	StageCreated = "created"
+	// StageBuilt jobs have their event built, with proof of work mined.
+	StageBuilt = "built"
+	// StageSigned jobs have their event signed.
+	StageSigned = "signed"
+	// StagePublished jobs were accepted by enough relays.
+	StagePublished = "published"
+)
+
+var jobsBucket = []byte("jobs")
+
+// ErrNotFound is returned when resuming an unknown job.
+var ErrNotFound = errors.New("job not found")
+
+// Job is one run of a media command.
+type Job struct {
+	ID string `json:"id"`
+	// Command and Args are the subcommand and arguments of the run, replayed
+	// when it is resumed.
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Stage   string   `json:"stage"`
+	// Uploads maps the local files already uploaded to their blobs.
+	Uploads map[string]*nip71uploader.BlobDescriptor `json:"uploads,omitempty"`
+	Event   *nostr.Event                             `json:"event,omitempty"`
+	// Relays holds the relays that accepted the event.
+	Relays    []string  `json:"relays,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store is the job database.
+type Store struct {
+	db *bolt.DB
+}
+
+// DefaultPath returns jobs.db next to the configuration file.
+func DefaultPath() string {
+	return filepath.Join(filepath.Dir(config.DefaultPath()), "jobs.db")
+}
+
+// Open opens or creates the job database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating %s: %v", filepath.Dir(path), err)
+	}
+	// another run holding the database must not block this one forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create records a new job for a run of command with args.
+func (s *Store) Create(command string, args []string) (*Job, error) {
+	var id [8]byte
+	rand.Read(id[:])
+	job := &Job{
+		ID:      hex.EncodeToString(id[:]),
+		Command: command,
+		Args:    args,
+		Stage:   StageCreated,
+		Uploads: make(map[string]*nip71uploader.BlobDescriptor),
+	}
+	return job, s.Save(job)
+}
+
+// Load returns the job with the given id.
+func (s *Store) Load(id string) (*Job, error) {
+	var job Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if job.Uploads == nil {
+		job.Uploads = make(map[string]*nip71uploader.BlobDescriptor)
+	}
+	return &job, nil
+}
+
+// Save writes the job to the database.
+func (s *Store) Save(job *Job) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+// Tracker saves a job every time the pipeline completes a stage. It
+// implements nip71uploader.UploadCache, so resumed jobs skip the uploads that
+// were already done. Saving errors are logged, as losing the progress of a
+// job must not fail the run.
+type Tracker struct {
+	store *Store
+	Job   *Job
+}
+
+// NewTracker returns a Tracker saving job to store.
+func NewTracker(store *Store, job *Job) *Tracker {
+	return &Tracker{store: store, Job: job}
+}
+
+// Uploaded implements nip71uploader.UploadCache.
+func (t *Tracker) Uploaded(path string) (*nip71uploader.BlobDescriptor, bool) {
+	blob, ok := t.Job.Uploads[path]
+	return blob, ok
+}
+
+// SaveUploaded implements nip71uploader.UploadCache.
+func (t *Tracker) SaveUploaded(path string, blob *nip71uploader.BlobDescriptor) {
+	t.Job.Uploads[path] = blob
+	t.save()
+}
+
+// Advance records the event at the given stage.
+func (t *Tracker) Advance(stage string, event *nostr.Event) {
+	t.Job.Stage = stage
+	t.Job.Event = event
+	t.save()
+}
+
+// Accepted records the relays that accepted the event.
+func (t *Tracker) Accepted(relays []string) {
+	for _, relay := range relays {
+		if !t.HasAccepted(relay) {
+			t.Job.Relays = append(t.Job.Relays, relay)
+		}
+	}
+	t.save()
+}
+
+// HasAccepted reports whether the relay already accepted the event.
+func (t *Tracker) HasAccepted(relay string) bool {
+	for _, accepted := range t.Job.Relays {
+		if nostr.NormalizeURL(accepted) == nostr.NormalizeURL(relay) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the store the job is saved to.
+func (t *Tracker) Close() error {
+	return t.store.Close()
+}
+
+func (t *Tracker) save() {
+	if err := t.store.Save(t.Job); err != nil {
+		log.Printf("Error saving job %s: %v", t.Job.ID, err)
+	}
+}
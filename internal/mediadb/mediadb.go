@@ -0,0 +1,183 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package mediadb keeps a local bolt database about the media files handled
+// by nostrmedia, so that large files are not hashed again on every run and
+// files already uploaded or published are recognized by their sha256.
+package mediadb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/config"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	hashesBucket = []byte("hashes")
+	mediaBucket  = []byte("media")
+)
+
+// hashEntry is the hashes of a file as it was when hashed.
+type hashEntry struct {
+	Size    int64                     `json:"size"`
+	ModTime time.Time                 `json:"mod_time"`
+	Hashes  *nip71uploader.FileHashes `json:"hashes"`
+}
+
+// DB is the media database. It implements nip71uploader.HashCache and
+// nip71uploader.MediaIndex.
+type DB struct {
+	db *bolt.DB
+}
+
+// DefaultPath returns media.db next to the configuration file.
+func DefaultPath() string {
+	return filepath.Join(filepath.Dir(config.DefaultPath()), "media.db")
+}
+
+// Open opens or creates the media database at path.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating %s: %v", filepath.Dir(path), err)
+	}
+	// another run holding the database must not block this one forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(hashesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(mediaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing %s: %v", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Hashes implements nip71uploader.HashCache.
+func (d *DB) Hashes(path string, size int64, modTime time.Time) (*nip71uploader.FileHashes, bool) {
+	var entry hashEntry
+	err := d.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(hashesBucket).Get([]byte(path))
+		if data == nil {
+			return os.ErrNotExist
+		}
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil || entry.Hashes == nil || entry.Size != size || !entry.ModTime.Equal(modTime) {
+		return nil, false
+	}
+	return entry.Hashes, true
+}
+
+// SaveHashes implements nip71uploader.HashCache. Errors are logged, as a
+// missing entry only costs hashing the file again.
+func (d *DB) SaveHashes(path string, size int64, modTime time.Time, hashes *nip71uploader.FileHashes) {
+	data, err := json.Marshal(hashEntry{Size: size, ModTime: modTime, Hashes: hashes})
+	if err == nil {
+		err = d.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(hashesBucket).Put([]byte(path), data)
+		})
+	}
+	if err != nil {
+		log.Printf("Error saving the hashes of %s: %v", path, err)
+	}
+}
+
+// Media implements nip71uploader.MediaIndex.
+func (d *DB) Media(sha256 string) (*nip71uploader.MediaRecord, bool) {
+	var record *nip71uploader.MediaRecord
+	err := d.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getMedia(tx, sha256)
+		return err
+	})
+	if err != nil || record == nil {
+		return nil, false
+	}
+	return record, true
+}
+
+// SaveUpload implements nip71uploader.MediaIndex. Errors are logged, as a
+// missing entry only costs uploading the file again.
+func (d *DB) SaveUpload(sha256, url string) {
+	err := d.updateMedia(sha256, func(record *nip71uploader.MediaRecord) {
+		if !slices.Contains(record.URLs, url) {
+			record.URLs = append(record.URLs, url)
+		}
+	})
+	if err != nil {
+		log.Printf("Error recording the upload of %s: %v", sha256, err)
+	}
+}
+
+// SavePublished implements nip71uploader.MediaIndex. Errors are logged, as
+// a missing entry only means the duplicate is not detected.
+func (d *DB) SavePublished(hashes []string, event nip71uploader.PublishedMedia) {
+	for _, sha256 := range hashes {
+		err := d.updateMedia(sha256, func(record *nip71uploader.MediaRecord) {
+			for i, published := range record.Events {
+				if published.ID == event.ID {
+					record.Events[i] = event
+					return
+				}
+			}
+			record.Events = append(record.Events, event)
+		})
+		if err != nil {
+			log.Printf("Error recording event %s: %v", event.ID, err)
+		}
+	}
+}
+
+// updateMedia applies update to the record of a blob, creating it if needed.
+func (d *DB) updateMedia(sha256 string, update func(*nip71uploader.MediaRecord)) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		record, err := getMedia(tx, sha256)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			record = &nip71uploader.MediaRecord{SHA256: sha256}
+		}
+		update(record)
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(mediaBucket).Put([]byte(sha256), data)
+	})
+}
+
+// getMedia returns the record of a blob, or nil when there is none.
+func getMedia(tx *bolt.Tx, sha256 string) (*nip71uploader.MediaRecord, error) {
+	data := tx.Bucket(mediaBucket).Get([]byte(sha256))
+	if data == nil {
+		return nil, nil
+	}
+	var record nip71uploader.MediaRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
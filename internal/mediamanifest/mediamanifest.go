@@ -0,0 +1,147 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package mediamanifest writes and reads the checksum manifests listing the
+// published events and the blobs of their media, for archival and backup
+// tools, and for publishing the events again.
+package mediamanifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Version is the version of the manifest format.
+const Version = 1
+
+// Blob is a media file of a published event.
+type Blob struct {
+	SHA256 string   `json:"sha256"`
+	Size   int64    `json:"size,omitempty"`
+	MIME   string   `json:"mime,omitempty"`
+	URLs   []string `json:"urls"`
+}
+
+// Entry is a published event with its media.
+type Entry struct {
+	EventID string `json:"event_id"`
+	Kind    int    `json:"kind"`
+	// Relays are the relays that accepted the event.
+	Relays []string `json:"relays,omitempty"`
+	Blobs  []Blob   `json:"blobs"`
+	// Event is the signed event, so it can be published again as is.
+	Event *nostr.Event `json:"event"`
+}
+
+// Manifest is the document written to the manifest file.
+type Manifest struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// NewEntry describes the event and the blobs of its imeta tags, or of its
+// top level tags for NIP-94 file events.
+func NewEntry(event *nostr.Event, relays []string) Entry {
+	entry := Entry{EventID: event.ID, Kind: event.Kind, Relays: relays, Blobs: []Blob{}, Event: event}
+	var files []imeta.Imeta
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "imeta" {
+			if file, err := imeta.Parse(tag); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	if event.Kind == events.KindFileMetadata {
+		if file, err := imeta.FromTags(event.Tags); err == nil {
+			files = append(files, file)
+		}
+	}
+	for _, file := range files {
+		entry.Blobs = append(entry.Blobs, Blob{
+			SHA256: file.Hash,
+			Size:   file.Size,
+			MIME:   file.MIME,
+			URLs:   append([]string{file.URL}, file.Fallbacks...),
+		})
+	}
+	return entry
+}
+
+// Load reads the manifest at path.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	if manifest.Version > Version {
+		return nil, fmt.Errorf("%s is a version %d manifest, this version reads up to %d", path, manifest.Version, Version)
+	}
+	return &manifest, nil
+}
+
+// Writer adds entries to a manifest file, keeping the entries written by
+// previous runs. It saves the file after every entry and is safe for
+// concurrent use. A nil Writer discards the entries.
+type Writer struct {
+	path string
+
+	mu       sync.Mutex
+	manifest *Manifest
+}
+
+// Open reads the manifest at path, if it exists, to add entries to it.
+func Open(path string) (*Writer, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return &Writer{path: path, manifest: &Manifest{Version: Version}}, nil
+	}
+	manifest, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, manifest: manifest}, nil
+}
+
+// Add records the entry, replacing the entry of an event with the same id,
+// and saves the manifest.
+func (w *Writer) Add(entry Entry) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	replaced := false
+	for i, known := range w.manifest.Entries {
+		if known.EventID == entry.EventID {
+			w.manifest.Entries[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		w.manifest.Entries = append(w.manifest.Entries, entry)
+	}
+	w.manifest.Version = Version
+
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves it truncated
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, w.path)
+}
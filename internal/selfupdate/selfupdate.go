@@ -0,0 +1,299 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package selfupdate replaces the running nostrmedia executable with the
+// binary of the latest release. Releases ship a SHA256SUMS file with the
+// checksums of their binaries, and SHA256SUMS.event, a nostr event signed
+// by the release key whose "x" tag is the sha256 of SHA256SUMS and whose
+// "version" tag is the tag of the release.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultRepository is the GitHub repository releases are looked up in.
+const DefaultRepository = "girino/nip71-video-uploader"
+
+// Names of the assets listing and signing the checksums of a release.
+const (
+	ChecksumsAsset = "SHA256SUMS"
+	SignatureAsset = "SHA256SUMS.event"
+)
+
+// Limits of the downloads, far above the size of the real files.
+const (
+	maxMetadataSize = 1 << 20
+	maxBinarySize   = 512 << 20
+)
+
+// Release is a published release and the download URLs of its assets, by
+// name.
+type Release struct {
+	Tag    string
+	Assets map[string]string
+}
+
+// Client returns an HTTP client following redirects, such as those of
+// GitHub to its download servers, to HTTPS URLs only. It sends the requests
+// with the transport of http.DefaultClient.
+func Client() *http.Client {
+	return &http.Client{
+		Transport: http.DefaultClient.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing redirect to %s", req.URL)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// Latest fetches the latest release of the GitHub repository, such as
+// "owner/name".
+func Latest(ctx context.Context, client *http.Client, repository string) (*Release, error) {
+	body, err := get(ctx, client, "https://api.github.com/repos/"+repository+"/releases/latest", maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the latest release: %v", err)
+	}
+	var latest struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(body, &latest); err != nil {
+		return nil, fmt.Errorf("decoding the latest release: %v", err)
+	}
+	if latest.TagName == "" {
+		return nil, errors.New("the latest release has no tag")
+	}
+	release := &Release{Tag: latest.TagName, Assets: make(map[string]string)}
+	for _, asset := range latest.Assets {
+		release.Assets[asset.Name] = asset.URL
+	}
+	return release, nil
+}
+
+// AssetName returns the name of the binary of a platform, such as
+// "nostrmedia_linux_arm64" or "nostrmedia_windows_amd64.exe".
+func AssetName(goos, goarch string) string {
+	name := "nostrmedia_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Newer reports whether the latest version is newer than the current one,
+// both given as vMAJOR.MINOR.PATCH. ok is false when either is not such a
+// version, as development builds are not.
+func Newer(latest, current string) (newer, ok bool) {
+	l, lok := parseVersion(latest)
+	c, cok := parseVersion(current)
+	if !lok || !cok {
+		return false, false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i], true
+		}
+	}
+	return false, true
+}
+
+// parseVersion parses vMAJOR.MINOR.PATCH, ignoring any pre-release or build
+// suffix.
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	version, _, _ = strings.Cut(version, "+")
+	fields := strings.Split(version, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// Checksum verifies that the signature event, signed by releaseKey, vouches
+// for the checksums file of the release tagged release, and returns the hex
+// sha256 it lists for the asset name. The release tag keeps the checksums
+// of an older release, validly signed, from being passed off as the latest.
+func Checksum(sums, signature []byte, releaseKey, release, name string) (string, error) {
+	var event nostr.Event
+	if err := json.Unmarshal(signature, &event); err != nil {
+		return "", fmt.Errorf("decoding %s: %v", SignatureAsset, err)
+	}
+	if event.PubKey != releaseKey {
+		return "", fmt.Errorf("%s is signed by %s, not by the release key", SignatureAsset, event.PubKey)
+	}
+	if event.ID != event.GetID() {
+		return "", fmt.Errorf("%s does not match its id", SignatureAsset)
+	}
+	if ok, err := event.CheckSignature(); !ok {
+		return "", fmt.Errorf("invalid signature in %s: %v", SignatureAsset, err)
+	}
+	digest := sha256.Sum256(sums)
+	if !hasTag(event.Tags, "x", hex.EncodeToString(digest[:])) {
+		return "", fmt.Errorf("%s does not vouch for this %s", SignatureAsset, ChecksumsAsset)
+	}
+	if !hasTag(event.Tags, "version", release) {
+		return "", fmt.Errorf("%s is not signed for release %s", SignatureAsset, release)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		// sha256sum writes "<hash>  <name>", or "<hash> *<name>" in binary mode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+}
+
+// hasTag reports whether tags has a tag with exactly the name and value.
+// Tags.GetFirst would also match values merely starting with value.
+func hasTag(tags nostr.Tags, name, value string) bool {
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == name && tag[1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch downloads a small release asset, such as the checksums.
+func Fetch(ctx context.Context, client *http.Client, assetURL string) ([]byte, error) {
+	return get(ctx, client, assetURL, maxMetadataSize)
+}
+
+// Download downloads the binary at assetURL to a new executable file in dir,
+// which must be on the same file system as the executable it replaces, and
+// checks that its sha256 is sha256Hash.
+func Download(ctx context.Context, client *http.Client, assetURL, dir, sha256Hash string) (string, error) {
+	resp, err := open(ctx, client, assetURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	file, err := os.CreateTemp(dir, ".nostrmedia-update-*")
+	if err != nil {
+		return "", fmt.Errorf("creating the new executable: %v", err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, maxBinarySize))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != sha256Hash {
+		err = fmt.Errorf("the downloaded binary has sha256 %x, not %s", hash.Sum(nil), sha256Hash)
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0755)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("downloading %s: %v", assetURL, err)
+	}
+	return file.Name(), nil
+}
+
+// Executable returns the path of the running executable, with symbolic
+// links resolved so the real file is replaced.
+func Executable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// Replace replaces the executable at path with the one at newPath, in the
+// same directory, with a rename, so the executable is never seen half
+// written. Windows does not rename over a running executable, which is
+// moved aside to path.old first.
+func Replace(path, newPath string) error {
+	if runtime.GOOS != "windows" {
+		return os.Rename(newPath, path)
+	}
+	old := path + ".old"
+	os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		// put the running executable back
+		os.Rename(old, path)
+		return err
+	}
+	return nil
+}
+
+// get downloads a response body of up to limit bytes.
+func get(ctx context.Context, client *http.Client, rawURL string, limit int64) ([]byte, error) {
+	resp, err := open(ctx, client, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", rawURL, err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", rawURL, limit)
+	}
+	return body, nil
+}
+
+// open requests rawURL, which must be HTTPS, checking the status.
+func open(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" {
+		return nil, fmt.Errorf("refusing to download %q over anything but HTTPS", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: HTTP status %s", rawURL, resp.Status)
+	}
+	return resp, nil
+}
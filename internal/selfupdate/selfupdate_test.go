@@ -0,0 +1,150 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	testBinary = "nostrmedia_linux_amd64"
+	testHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var testSums = []byte(testHash + "  " + testBinary + "\n" +
+	strings.Repeat("a", 64) + " *nostrmedia_windows_amd64.exe\n")
+
+// signSums returns SHA256SUMS.event for sums, signed with secret.
+func signSums(t *testing.T, secret string, sums []byte, tags ...nostr.Tag) []byte {
+	t.Helper()
+	digest := sha256.Sum256(sums)
+	event := nostr.Event{
+		Kind:      1063,
+		CreatedAt: nostr.Now(),
+		Tags:      append(nostr.Tags{{"x", hex.EncodeToString(digest[:])}}, tags...),
+	}
+	if err := event.Sign(secret); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChecksum(t *testing.T) {
+	secret := nostr.GeneratePrivateKey()
+	releaseKey, _ := nostr.GetPublicKey(secret)
+	other, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	signature := signSums(t, secret, testSums, nostr.Tag{"version", "v1.2.3"})
+
+	got, err := Checksum(testSums, signature, releaseKey, "v1.2.3", testBinary)
+	if err != nil || got != testHash {
+		t.Fatalf("Checksum = %s, %v, want %s", got, err, testHash)
+	}
+	if got, err := Checksum(testSums, signature, releaseKey, "v1.2.3", "nostrmedia_windows_amd64.exe"); err != nil || got != strings.Repeat("a", 64) {
+		t.Errorf("binary mode entry: %s, %v", got, err)
+	}
+
+	var event nostr.Event
+	json.Unmarshal(signature, &event)
+	event.Sig = strings.Repeat("0", 128)
+	badSignature, _ := json.Marshal(event)
+	json.Unmarshal(signature, &event)
+	event.Content = "changed after signing"
+	badID, _ := json.Marshal(event)
+
+	tests := []struct {
+		name      string
+		sums      []byte
+		signature []byte
+		key       string
+		release   string
+		asset     string
+	}{
+		{"wrong key", testSums, signature, other, "v1.2.3", testBinary},
+		{"bad signature", testSums, badSignature, releaseKey, "v1.2.3", testBinary},
+		{"changed event", testSums, badID, releaseKey, "v1.2.3", testBinary},
+		{"x mismatch", append([]byte("0000  evil\n"), testSums...), signature, releaseKey, "v1.2.3", testBinary},
+		{"missing asset", testSums, signature, releaseKey, "v1.2.3", "nostrmedia_plan9_386"},
+		{"older release replayed", testSums, signature, releaseKey, "v1.3.0", testBinary},
+		{"release prefix", testSums, signSums(t, secret, testSums, nostr.Tag{"version", "v1.2.3-rc1"}), releaseKey, "v1.2.3", testBinary},
+		{"no version", testSums, signSums(t, secret, testSums), releaseKey, "v1.2.3", testBinary},
+		{"not an event", testSums, []byte("not json"), releaseKey, "v1.2.3", testBinary},
+	}
+	for _, test := range tests {
+		if got, err := Checksum(test.sums, test.signature, test.key, test.release, test.asset); err == nil {
+			t.Errorf("%s: Checksum = %s, want an error", test.name, got)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		newer, ok       bool
+	}{
+		{"v1.2.4", "v1.2.3", true, true},
+		{"v1.10.0", "v1.9.9", true, true},
+		{"v2.0.0", "v1.99.99", true, true},
+		{"v1.2.3", "v1.2.3", false, true},
+		{"v1.2.2", "v1.2.3", false, true},
+		{"1.2.4", "v1.2.3", true, true},
+		{"v1.2.4-rc1", "v1.2.3", true, true},
+		{"v1.2.3", "v1.2.3+dirty", false, true},
+		{"v1.2.4", "v0.0.0-20261016124625-351cabfb1e45+dirty", true, true},
+		{"v1.2.4", "(devel)", false, false},
+		{"v1.2", "v1.2.3", false, false},
+		{"v1.2.x", "v1.2.3", false, false},
+		{"v1.-2.3", "v1.2.3", false, false},
+	}
+	for _, test := range tests {
+		newer, ok := Newer(test.latest, test.current)
+		if newer != test.newer || ok != test.ok {
+			t.Errorf("Newer(%s, %s) = %v, %v, want %v, %v", test.latest, test.current, newer, ok, test.newer, test.ok)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ctx := context.Background()
+	binary := []byte("#!/bin/sh\necho new\n")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+	digest := sha256.Sum256(binary)
+
+	dir := t.TempDir()
+	if _, err := Download(ctx, server.Client(), server.URL+"/bin", dir, testHash); err == nil {
+		t.Error("downloaded a binary with the wrong sha256")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left behind by the failed download", len(entries))
+	}
+
+	path, err := Download(ctx, server.Client(), server.URL+"/bin", dir, hex.EncodeToString(digest[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(binary) {
+		t.Errorf("downloaded %q", got)
+	}
+
+	if _, err := Download(ctx, server.Client(), "http"+strings.TrimPrefix(server.URL, "https")+"/bin", dir, testHash); err == nil {
+		t.Error("downloaded over plain HTTP")
+	}
+}
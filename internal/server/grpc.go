@@ -0,0 +1,249 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+	"github.com/girino/nip71-video-uploader/pkg/nostrmediapb"
+
+	"github.com/nbd-wtf/go-nostr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService implements nostrmediapb.UploaderServer on top of a Server.
+type grpcService struct {
+	nostrmediapb.UnimplementedUploaderServer
+	server *Server
+}
+
+// RegisterGRPC registers the gRPC service of the server.
+func (s *Server) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	nostrmediapb.RegisterUploaderServer(registrar, &grpcService{server: s})
+}
+
+func (g *grpcService) UploadVideo(stream nostrmediapb.Uploader_UploadVideoServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	metadata := first.GetMetadata()
+	if metadata == nil {
+		return status.Error(codes.InvalidArgument, "the first message must hold the metadata")
+	}
+
+	var paths []string
+	if metadata.GetUrl() == "" {
+		path, err := receiveFile(metadata.GetFilename(), g.server.MaxRequestSize, func() ([]byte, error) {
+			req, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			chunk, ok := req.GetData().(*nostrmediapb.UploadVideoRequest_Chunk)
+			if !ok {
+				return nil, status.Error(codes.InvalidArgument, "expected a chunk")
+			}
+			return chunk.Chunk, nil
+		})
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	job, err := g.server.Submit(paths, Request{
+		Kind:        "video",
+		Title:       metadata.GetTitle(),
+		Description: metadata.GetDescription(),
+		PublishedAt: metadata.GetPublishedAt(),
+		Identifier:  metadata.GetIdentifier(),
+		Legacy:      metadata.GetLegacy(),
+		Horizontal:  metadata.GetHorizontal(),
+		URL:         metadata.GetUrl(),
+	})
+	if err != nil {
+		return submitError(err)
+	}
+	return stream.SendAndClose(jobMessage(job))
+}
+
+func (g *grpcService) UploadPictures(stream nostrmediapb.Uploader_UploadPicturesServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	metadata := first.GetMetadata()
+	if metadata == nil {
+		return status.Error(codes.InvalidArgument, "the first message must hold the metadata")
+	}
+
+	// every PictureFile message starts a new file, written by the chunks
+	// that follow it
+	var paths []string
+	var current *os.File
+	var received int64
+	fail := func(err error) error {
+		if current != nil {
+			current.Close()
+		}
+		removeAll(paths)
+		return err
+	}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		switch data := req.GetData().(type) {
+		case *nostrmediapb.UploadPicturesRequest_Picture:
+			if current != nil {
+				current.Close()
+			}
+			current, err = createTemp(data.Picture.GetFilename())
+			if err != nil {
+				return fail(status.Error(codes.Internal, err.Error()))
+			}
+			paths = append(paths, current.Name())
+		case *nostrmediapb.UploadPicturesRequest_Chunk:
+			if current == nil {
+				return fail(status.Error(codes.InvalidArgument, "chunk before the first picture"))
+			}
+			received += int64(len(data.Chunk))
+			if limit := g.server.MaxRequestSize; limit > 0 && received > limit {
+				return fail(tooLarge(limit))
+			}
+			if _, err := current.Write(data.Chunk); err != nil {
+				return fail(status.Error(codes.Internal, err.Error()))
+			}
+		default:
+			return fail(status.Error(codes.InvalidArgument, "unexpected message"))
+		}
+	}
+	if current != nil {
+		current.Close()
+	}
+
+	job, err := g.server.Submit(paths, Request{
+		Kind:        "picture",
+		Title:       metadata.GetTitle(),
+		Description: metadata.GetDescription(),
+		PublishedAt: metadata.GetPublishedAt(),
+	})
+	if err != nil {
+		return submitError(err)
+	}
+	return stream.SendAndClose(jobMessage(job))
+}
+
+func (g *grpcService) PublishEvent(ctx context.Context, req *nostrmediapb.PublishEventRequest) (*nostrmediapb.PublishEventResponse, error) {
+	var event nostr.Event
+	if err := json.Unmarshal([]byte(req.GetEventJson()), &event); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "decoding event: %v", err)
+	}
+	if ok, err := event.CheckSignature(); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid event signature: %v", err)
+	}
+
+	results, err := g.server.PublishEvent(ctx, &event)
+	resp := &nostrmediapb.PublishEventResponse{Relays: relayMessages(results)}
+	if err != nil {
+		return resp, status.Error(codes.Unavailable, err.Error())
+	}
+	resp.Nevent, resp.Naddr, err = nip71uploader.EncodeEvent(&event, nip71uploader.AcceptedRelays(results))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "encoding event: %v", err)
+	}
+	return resp, nil
+}
+
+func (g *grpcService) GetJobStatus(ctx context.Context, req *nostrmediapb.GetJobStatusRequest) (*nostrmediapb.Job, error) {
+	job, ok := g.server.Job(req.GetId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown job")
+	}
+	return jobMessage(job), nil
+}
+
+// receiveFile writes the chunks returned by next to a temporary file until
+// the stream ends, and returns its path. It fails once more than limit bytes
+// are received, when limit is positive.
+func receiveFile(filename string, limit int64, next func() ([]byte, error)) (string, error) {
+	file, err := createTemp(filename)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	defer file.Close()
+	var received int64
+	for {
+		chunk, err := next()
+		if errors.Is(err, io.EOF) {
+			return file.Name(), nil
+		}
+		received += int64(len(chunk))
+		if err == nil && limit > 0 && received > limit {
+			err = tooLarge(limit)
+		}
+		if err == nil {
+			_, err = file.Write(chunk)
+		}
+		if err != nil {
+			os.Remove(file.Name())
+			return "", err
+		}
+	}
+}
+
+// tooLarge is the error of an upload larger than limit bytes.
+func tooLarge(limit int64) error {
+	return status.Errorf(codes.ResourceExhausted, "upload larger than %d bytes", limit)
+}
+
+// submitError converts an error of Submit to a gRPC status.
+func submitError(err error) error {
+	if errors.Is(err, ErrBusy) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+func jobMessage(job Job) *nostrmediapb.Job {
+	statuses := map[string]nostrmediapb.JobStatus{
+		StatusPending: nostrmediapb.JobStatus_JOB_STATUS_PENDING,
+		StatusRunning: nostrmediapb.JobStatus_JOB_STATUS_RUNNING,
+		StatusDone:    nostrmediapb.JobStatus_JOB_STATUS_DONE,
+		StatusFailed:  nostrmediapb.JobStatus_JOB_STATUS_FAILED,
+	}
+	return &nostrmediapb.Job{
+		Id:      job.ID,
+		Status:  statuses[job.Status],
+		EventId: job.EventID,
+		Nevent:  job.Nevent,
+		Naddr:   job.Naddr,
+		Relays:  relayMessages(job.Relays),
+		Error:   job.Error,
+	}
+}
+
+func relayMessages(results []nip71uploader.PublishResult) []*nostrmediapb.RelayResult {
+	var messages []*nostrmediapb.RelayResult
+	for _, result := range results {
+		messages = append(messages, &nostrmediapb.RelayResult{
+			Relay: result.Relay,
+			Ok:    result.OK,
+			Error: result.Error,
+		})
+	}
+	return messages
+}
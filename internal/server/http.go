@@ -0,0 +1,131 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// maxMemory is the part of a multipart upload kept in memory, the rest is
+// spooled to disk by net/http.
+const maxMemory = 32 << 20
+
+// Handler returns the routes of the HTTP API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload", s.handleUpload)
+	mux.HandleFunc("GET /status/{id}", s.handleStatus)
+	if s.Telemetry != nil {
+		mux.Handle("GET /metrics", s.Telemetry.Handler())
+	}
+	return mux
+}
+
+// handleUpload accepts a multipart form with a "file" part and the optional
+// fields kind (video, picture or file), title, description, published_at,
+// legacy and long. It answers 202 with the job before processing it, 413
+// when the request is larger than MaxRequestSize and 503 when too many jobs
+// are waiting.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if s.MaxRequestSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxRequestSize)
+	}
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	path, err := saveUpload(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := s.Submit([]string{path}, Request{
+		Kind:        r.FormValue("kind"),
+		Title:       r.FormValue("title"),
+		Description: r.FormValue("description"),
+		PublishedAt: r.FormValue("published_at"),
+		Legacy:      r.FormValue("legacy") == "true",
+		Horizontal:  r.FormValue("long") == "true",
+	})
+	if errors.Is(err, ErrBusy) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/status/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.Job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// saveUpload copies the "file" part to a temporary file and returns its path.
+func saveUpload(r *http.Request) (string, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", fmt.Errorf("missing file: %v", err)
+	}
+	defer file.Close()
+	return saveTemp(file, header.Filename)
+}
+
+// createTemp creates a temporary file for an upload, keeping the extension
+// of its original name.
+func createTemp(filename string) (*os.File, error) {
+	tmp, err := os.CreateTemp(nip71uploader.TempDir, "upload-*"+filepath.Ext(filename))
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %v", err)
+	}
+	return tmp, nil
+}
+
+// saveTemp copies r to a temporary file created with createTemp.
+func saveTemp(r io.Reader, filename string) (string, error) {
+	tmp, err := createTemp(filename)
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, r); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("saving file: %v", err)
+	}
+	return tmp.Name(), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package server implements the APIs of the serve command. Media posted to
+// the HTTP API or streamed to the gRPC service is published asynchronously
+// as a job, whose outcome is polled by its id.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/telemetry"
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Job states.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job is an upload being processed.
+type Job struct {
+	ID      string                        `json:"id"`
+	Status  string                        `json:"status"`
+	EventID string                        `json:"event_id,omitempty"`
+	Nevent  string                        `json:"nevent,omitempty"`
+	Naddr   string                        `json:"naddr,omitempty"`
+	Relays  []nip71uploader.PublishResult `json:"relays,omitempty"`
+	Error   string                        `json:"error,omitempty"`
+	// finished is when the job was done or failed, for its eviction.
+	finished time.Time
+}
+
+// Request is the metadata of an upload.
+type Request struct {
+	// Kind is video, picture or file.
+	Kind        string
+	Title       string
+	Description string
+	// PublishedAt is in unix seconds or a date ParseTimestamp accepts,
+	// defaulting to the time of the upload.
+	PublishedAt string
+	Identifier  string
+	Legacy      bool
+	Horizontal  bool
+	// URL points to an already hosted video instead of an uploaded file.
+	URL string
+}
+
+// Defaults of the limits of a Server.
+const (
+	DefaultWorkers        = 2
+	DefaultMaxQueued      = 100
+	DefaultJobTTL         = time.Hour
+	DefaultMaxRequestSize = 4 << 30
+)
+
+// ErrBusy is returned by Submit when MaxQueued jobs are waiting already.
+var ErrBusy = errors.New("too many jobs waiting, try again later")
+
+// Server runs the upload pipeline for API clients.
+type Server struct {
+	uploader *nip71uploader.Uploader
+	// ctx bounds the jobs, which outlive the requests that started them
+	ctx context.Context
+	// JobTimeout, when non-zero, bounds the time each job takes.
+	JobTimeout time.Duration
+	// Telemetry, when set, records the metrics and traces of the jobs, and
+	// its metrics are served at /metrics.
+	Telemetry *telemetry.Telemetry
+	// Webhook, when set, is posted the outcome of every job, see
+	// nip71uploader.PostWebhook.
+	Webhook string
+	// Workers is how many jobs run at once, the others waiting for their
+	// turn. It must be set before the first job is submitted.
+	Workers int
+	// MaxQueued, when positive, bounds the jobs waiting for a worker.
+	MaxQueued int
+	// JobTTL, when positive, is how long finished jobs can be polled.
+	JobTTL time.Duration
+	// MaxRequestSize, when positive, bounds the bytes of the files uploaded
+	// by a request.
+	MaxRequestSize int64
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending int
+	workers chan struct{}
+}
+
+// New returns a Server publishing with uploader. Jobs are cancelled when
+// ctx is done.
+func New(ctx context.Context, uploader *nip71uploader.Uploader) *Server {
+	return &Server{
+		uploader:       uploader,
+		ctx:            ctx,
+		Workers:        DefaultWorkers,
+		MaxQueued:      DefaultMaxQueued,
+		JobTTL:         DefaultJobTTL,
+		MaxRequestSize: DefaultMaxRequestSize,
+		jobs:           make(map[string]*Job),
+	}
+}
+
+// Submit starts a job publishing the files at paths, which are removed once
+// it is done, and returns it while still pending.
+func (s *Server) Submit(paths []string, req Request) (Job, error) {
+	if req.Kind == "" {
+		req.Kind = "video"
+	}
+	if req.Kind != "video" && req.Kind != "picture" && req.Kind != "file" {
+		removeAll(paths)
+		return Job{}, fmt.Errorf("invalid kind %q", req.Kind)
+	}
+	if len(paths) == 0 && req.URL == "" {
+		return Job{}, fmt.Errorf("no file uploaded")
+	}
+	if len(paths) == 0 && s.uploader.URLGuard != nil {
+		if err := s.uploader.URLGuard.CheckURL(s.ctx, req.URL); err != nil {
+			return Job{}, fmt.Errorf("refusing to download %s: %v", req.URL, err)
+		}
+	}
+	if req.PublishedAt != "" {
+		publishedAt, err := nip71uploader.ParseTimestamp(req.PublishedAt)
+		if err != nil {
+			removeAll(paths)
+			return Job{}, err
+		}
+		req.PublishedAt = strconv.FormatInt(publishedAt, 10)
+	}
+
+	job := &Job{ID: newJobID(), Status: StatusPending}
+	s.mu.Lock()
+	if s.MaxQueued > 0 && s.pending >= s.MaxQueued {
+		s.mu.Unlock()
+		removeAll(paths)
+		return Job{}, ErrBusy
+	}
+	if s.workers == nil {
+		s.workers = make(chan struct{}, max(s.Workers, 1))
+	}
+	s.evict()
+	s.jobs[job.ID] = job
+	s.pending++
+	snapshot := *job
+	s.mu.Unlock()
+	go s.run(job.ID, paths, req)
+	return snapshot, nil
+}
+
+// evict forgets the jobs finished more than JobTTL ago. s.mu must be held.
+func (s *Server) evict() {
+	if s.JobTTL <= 0 {
+		return
+	}
+	for id, job := range s.jobs {
+		if !job.finished.IsZero() && time.Since(job.finished) > s.JobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// Job returns a copy of the job with the given id.
+func (s *Server) Job(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// run processes a job, once a worker is free, and records its outcome.
+func (s *Server) run(id string, paths []string, req Request) {
+	defer removeAll(paths)
+	select {
+	case s.workers <- struct{}{}:
+		defer func() { <-s.workers }()
+	case <-s.ctx.Done():
+		s.update(id, func(job *Job) {
+			s.pending--
+			job.Status = StatusFailed
+			job.Error = "the server is shutting down"
+			job.finished = time.Now()
+		})
+		return
+	}
+	s.update(id, func(job *Job) {
+		s.pending--
+		job.Status = StatusRunning
+	})
+
+	ctx := s.ctx
+	if s.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.JobTimeout)
+		defer cancel()
+	}
+	if s.Telemetry != nil {
+		var end func(error)
+		ctx, end = s.Telemetry.StartJob(ctx, req.Kind, id)
+		defer func() {
+			job, _ := s.Job(id)
+			end(jobError(job))
+		}()
+	}
+	event, results, err := s.publish(ctx, paths, req)
+	if s.Webhook != "" {
+		defer s.notify(id, event, results, err)
+	}
+	s.update(id, func(job *Job) {
+		job.finished = time.Now()
+		job.Relays = results
+		if event != nil {
+			job.EventID = event.ID
+		}
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = StatusDone
+		job.Nevent, job.Naddr, err = nip71uploader.EncodeEvent(event, nip71uploader.AcceptedRelays(results))
+		if err != nil {
+			log.Printf("Error encoding event: %v", err)
+		}
+	})
+}
+
+func (s *Server) publish(ctx context.Context, paths []string, req Request) (*nostr.Event, []nip71uploader.PublishResult, error) {
+	var media []nip71uploader.Media
+	for _, path := range paths {
+		media = append(media, nip71uploader.Media{Path: path})
+	}
+	if len(media) == 0 {
+		media = append(media, nip71uploader.Media{URL: req.URL})
+	}
+
+	var event *nostr.Event
+	var err error
+	switch req.Kind {
+	case "video":
+		event, err = s.uploader.BuildVideoEvent(ctx, nip71uploader.VideoOptions{
+			Media:       media[0],
+			Title:       req.Title,
+			Description: req.Description,
+			PublishedAt: req.PublishedAt,
+			Identifier:  req.Identifier,
+			Legacy:      req.Legacy,
+			Horizontal:  req.Horizontal,
+		})
+	case "picture":
+		event, err = s.uploader.BuildPictureEvent(ctx, nip71uploader.PictureOptions{
+			Pictures:    media,
+			Title:       req.Title,
+			Description: req.Description,
+			PublishedAt: req.PublishedAt,
+		})
+	case "file":
+		event, err = s.uploader.BuildFileEvent(ctx, nip71uploader.FileOptions{
+			Media:       media[0],
+			Description: req.Description,
+		})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.uploader.Sign(ctx, event); err != nil {
+		return nil, nil, err
+	}
+	results, err := s.PublishEvent(ctx, event)
+	return event, results, err
+}
+
+// PublishEvent publishes a signed event, failing when no relay accepted it.
+func (s *Server) PublishEvent(ctx context.Context, event *nostr.Event) ([]nip71uploader.PublishResult, error) {
+	results := s.uploader.Publish(ctx, event)
+	if len(nip71uploader.AcceptedRelays(results)) == 0 {
+		return results, fmt.Errorf("no relay accepted the event")
+	}
+	return results, nil
+}
+
+func (s *Server) update(id string, change func(job *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(s.jobs[id])
+}
+
+// notify posts the outcome of a job to Webhook, logging the errors as the
+// job is done anyway.
+func (s *Server) notify(id string, event *nostr.Event, results []nip71uploader.PublishResult, err error) {
+	payload := nip71uploader.NewWebhookPayload(id, event, results, err)
+	if err := nip71uploader.PostWebhook(context.Background(), s.Webhook, payload); err != nil {
+		log.Printf("Error posting job %s to the webhook: %v", id, err)
+	}
+}
+
+// jobError returns the error of a failed job, nil otherwise.
+func jobError(job Job) error {
+	if job.Status != StatusFailed {
+		return nil
+	}
+	return errors.New(job.Error)
+}
+
+func newJobID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+func removeAll(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
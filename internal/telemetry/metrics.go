@@ -0,0 +1,150 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is a family of series in the Prometheus text format.
+type metric interface {
+	write(w io.Writer)
+}
+
+// counter is a counter, or a gauge, with one series per set of label
+// values.
+type counter struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]float64)}
+}
+
+func newGauge(name, help string, labels ...string) *counter {
+	c := newCounter(name, help, labels...)
+	c.kind = "gauge"
+	return c
+}
+
+// add adds delta to the series with the label values.
+func (c *counter) add(delta float64, values ...string) {
+	key := labelPairs(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[key] += delta
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatValue(c.series[key]))
+	}
+}
+
+// histogram counts observations in cumulative buckets, one series per set
+// of label values.
+type histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+	return &histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// observe records value in the series with the label values.
+func (h *histogram) observe(value float64, values ...string) {
+	key := labelPairs(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	labels := append(slices.Clone(h.labels), "le")
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			le := labelPairs(labels, append(slices.Clone(series.values), formatValue(bound)))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, le, series.counts[i])
+		}
+		le := labelPairs(labels, append(slices.Clone(series.values), "+Inf"))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, le, series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, series.count)
+	}
+}
+
+// labelPairs formats the labels of a series, such as {relay="wss://..."}.
+func labelPairs(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package telemetry exposes the metrics of the serve command in the
+// Prometheus text format, and optionally sends the traces of its jobs to an
+// OpenTelemetry collector. It implements nip71uploader.Observer.
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/nip71uploader"
+)
+
+// Telemetry records the metrics and traces of the upload pipeline.
+type Telemetry struct {
+	metrics []metric
+	// tracer is nil without a collector.
+	tracer *tracer
+
+	jobs          *counter
+	jobsRunning   *counter
+	jobSeconds    *histogram
+	uploads       *counter
+	uploadBytes   *counter
+	downloads     *counter
+	downloadBytes *counter
+	publishes     *counter
+	powSeconds    *histogram
+}
+
+// New returns a Telemetry sending traces to the OTLP/HTTP collector at
+// otlpEndpoint, such as http://localhost:4318, or only keeping metrics when
+// it is empty.
+func New(otlpEndpoint string) *Telemetry {
+	t := &Telemetry{
+		jobs:          newCounter("nostrmedia_jobs_total", "Jobs finished, by kind and status.", "kind", "status"),
+		jobsRunning:   newGauge("nostrmedia_jobs_running", "Jobs being processed."),
+		jobSeconds:    newHistogram("nostrmedia_job_duration_seconds", "Time taken by the jobs, by kind.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}, "kind"),
+		uploads:       newCounter("nostrmedia_uploads_total", "Uploads to Blossom servers, by server and result.", "server", "result"),
+		uploadBytes:   newCounter("nostrmedia_upload_bytes_total", "Bytes uploaded to Blossom servers, by server.", "server"),
+		downloads:     newCounter("nostrmedia_downloads_total", "Downloads of remote media, by result.", "result"),
+		downloadBytes: newCounter("nostrmedia_download_bytes_total", "Bytes of remote media downloaded."),
+		publishes:     newCounter("nostrmedia_publishes_total", "Events sent to relays, by relay and result.", "relay", "result"),
+		powSeconds:    newHistogram("nostrmedia_pow_duration_seconds", "Time taken mining proof of work, by difficulty.", []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900}, "difficulty"),
+	}
+	t.metrics = []metric{t.jobs, t.jobsRunning, t.jobSeconds, t.uploads, t.uploadBytes,
+		t.downloads, t.downloadBytes, t.publishes, t.powSeconds}
+	if otlpEndpoint != "" {
+		t.tracer = newTracer(otlpEndpoint, "nostrmedia")
+	}
+	return t
+}
+
+// Close sends the remaining traces to the collector.
+func (t *Telemetry) Close() error {
+	if t.tracer != nil {
+		t.tracer.close()
+	}
+	return nil
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (t *Telemetry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range t.metrics {
+			m.write(w)
+		}
+	})
+}
+
+// StartJob starts the span of a job, which the spans of its stages are
+// children of, and returns the function recording its outcome.
+func (t *Telemetry) StartJob(ctx context.Context, kind, id string) (context.Context, func(error)) {
+	start := time.Now()
+	t.jobsRunning.add(1)
+	ctx, end := t.Start(ctx, "job", "job.id", id, "job.kind", kind)
+	return ctx, func(err error) {
+		t.jobsRunning.add(-1)
+		t.jobSeconds.observe(time.Since(start).Seconds(), kind)
+		t.jobs.add(1, kind, result(err, "done", "failed"))
+		end(err)
+	}
+}
+
+// Start implements nip71uploader.Observer.
+func (t *Telemetry) Start(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	if t.tracer == nil {
+		return ctx, func(error) {}
+	}
+	return t.tracer.start(ctx, name, attrs...)
+}
+
+// Uploaded implements nip71uploader.Observer.
+func (t *Telemetry) Uploaded(server string, size int64, err error) {
+	t.uploads.add(1, server, result(err, "ok", "error"))
+	if err == nil {
+		t.uploadBytes.add(float64(size), server)
+	}
+}
+
+// Downloaded implements nip71uploader.Observer.
+func (t *Telemetry) Downloaded(size int64, err error) {
+	t.downloads.add(1, result(err, "ok", "error"))
+	if err == nil {
+		t.downloadBytes.add(float64(size))
+	}
+}
+
+// Mined implements nip71uploader.Observer.
+func (t *Telemetry) Mined(difficulty int, elapsed time.Duration, err error) {
+	if err == nil {
+		t.powSeconds.observe(elapsed.Seconds(), strconv.Itoa(difficulty))
+	}
+}
+
+// Published implements nip71uploader.Observer. Rejections are counted by
+// their machine readable reason, such as "rate-limited" or "pow".
+func (t *Telemetry) Published(results []nip71uploader.PublishResult) {
+	for _, r := range results {
+		outcome := "accepted"
+		if !r.OK {
+			outcome = "rejected"
+			if r.Reason != "" {
+				outcome = r.Reason
+			}
+		}
+		t.publishes.add(1, r.Relay, outcome)
+	}
+}
+
+func result(err error, ok, failed string) string {
+	if err != nil {
+		return failed
+	}
+	return ok
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExportInterval is how often the finished spans are sent to the collector.
+var ExportInterval = 5 * time.Second
+
+// maxQueuedSpans bounds the spans kept while the collector is unreachable.
+const maxQueuedSpans = 4096
+
+// span is a stage of a job, in the OTLP JSON encoding.
+type span struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []attribute `json:"attributes,omitempty"`
+	Status       spanStatus  `json:"status"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// OTLP status codes.
+const (
+	statusOK    = 1
+	statusError = 2
+)
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type spanKey struct{}
+
+// tracer sends the spans to an OpenTelemetry collector over OTLP/HTTP with
+// JSON encoding, in batches every ExportInterval.
+type tracer struct {
+	endpoint string
+	service  string
+
+	mu    sync.Mutex
+	queue []span
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newTracer starts exporting to the collector at endpoint, such as
+// http://localhost:4318.
+func newTracer(endpoint, service string) *tracer {
+	t := &tracer{
+		endpoint: strings.TrimRight(endpoint, "/") + "/v1/traces",
+		service:  service,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// start starts a span, child of the span of ctx if any.
+func (t *tracer) start(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	s := &span{Name: name, Kind: 1, SpanID: randomHex(8), Start: unixNano(time.Now())}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.TraceID = parent.TraceID
+		s.ParentSpanID = parent.SpanID
+	} else {
+		s.TraceID = randomHex(16)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.Attributes = append(s.Attributes, attribute{attrs[i], attributeValue{attrs[i+1]}})
+	}
+	return context.WithValue(ctx, spanKey{}, s), func(err error) {
+		s.End = unixNano(time.Now())
+		s.Status = spanStatus{Code: statusOK}
+		if err != nil {
+			s.Status = spanStatus{Code: statusError, Message: err.Error()}
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if len(t.queue) < maxQueuedSpans {
+			t.queue = append(t.queue, *s)
+		}
+	}
+}
+
+func (t *tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(ExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// close sends the remaining spans and stops exporting.
+func (t *tracer) close() {
+	close(t.stop)
+	<-t.done
+}
+
+// flush sends the queued spans, keeping them for the next attempt when the
+// collector cannot be reached.
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		log.Printf("Error exporting traces: %v", err)
+		t.mu.Lock()
+		t.queue = append(spans, t.queue...)[:min(len(spans)+len(t.queue), maxQueuedSpans)]
+		t.mu.Unlock()
+	}
+}
+
+func (t *tracer) export(spans []span) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []attribute{{"service.name", attributeValue{t.service}}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": t.service},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
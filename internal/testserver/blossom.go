@@ -0,0 +1,306 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package testserver runs in-memory Blossom servers and nostr relays over
+// httptest, for tests of the upload and publish pipeline that do not touch
+// the network.
+package testserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Blob is a file stored by a Blossom server.
+type Blob struct {
+	Data     []byte
+	Type     string
+	Uploaded int64
+	// Owner is the pubkey that uploaded the blob.
+	Owner string
+}
+
+// Blossom is a Blossom server (BUD-01, 02, 04 and 06) keeping its blobs in
+// memory. Uploads, deletions and listings are checked for a valid kind 24242
+// authorization.
+type Blossom struct {
+	*httptest.Server
+	// MaxSize, when non-zero, rejects larger uploads with 413.
+	MaxSize int64
+
+	mu      sync.Mutex
+	blobs   map[string]Blob
+	uploads int
+}
+
+// NewBlossom starts a Blossom server, closed when the test ends.
+func NewBlossom(t testing.TB) *Blossom {
+	b := &Blossom{blobs: make(map[string]Blob)}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Blob returns the blob with the given sha256.
+func (b *Blossom) Blob(sha256Hash string) (Blob, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blob, ok := b.blobs[sha256Hash]
+	return blob, ok
+}
+
+// Put stores a blob directly, as if uploaded earlier, and returns its URL.
+func (b *Blossom) Put(data []byte, mimeType string) string {
+	hash := sha256.Sum256(data)
+	sha256Hash := hex.EncodeToString(hash[:])
+	b.mu.Lock()
+	b.blobs[sha256Hash] = Blob{Data: data, Type: mimeType, Uploaded: time.Now().Unix()}
+	b.mu.Unlock()
+	return b.blobURL(sha256Hash, mimeType)
+}
+
+// Uploads returns the number of successful uploads.
+func (b *Blossom) Uploads() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.uploads
+}
+
+func (b *Blossom) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/upload" && r.Method == http.MethodHead:
+		b.checkUpload(w, r)
+	case r.URL.Path == "/upload" && r.Method == http.MethodPut:
+		b.upload(w, r)
+	case r.URL.Path == "/mirror" && r.Method == http.MethodPut:
+		b.mirror(w, r)
+	case strings.HasPrefix(r.URL.Path, "/list/") && r.Method == http.MethodGet:
+		b.list(w, r)
+	case r.Method == http.MethodDelete:
+		b.delete(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		b.get(w, r)
+	default:
+		reject(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (b *Blossom) checkUpload(w http.ResponseWriter, r *http.Request) {
+	if _, err := checkAuth(r, "upload", r.Header.Get("X-SHA-256")); err != nil {
+		reject(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	size, _ := strconv.ParseInt(r.Header.Get("X-Content-Length"), 10, 64)
+	if b.MaxSize > 0 && size > b.MaxSize {
+		reject(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file too large, %d bytes at most", b.MaxSize))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *Blossom) upload(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		reject(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if b.MaxSize > 0 && int64(len(data)) > b.MaxSize {
+		reject(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file too large, %d bytes at most", b.MaxSize))
+		return
+	}
+	hash := sha256.Sum256(data)
+	sha256Hash := hex.EncodeToString(hash[:])
+	owner, err := checkAuth(r, "upload", sha256Hash)
+	if err != nil {
+		reject(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	b.store(w, sha256Hash, Blob{Data: data, Type: r.Header.Get("Content-Type"), Owner: owner})
+}
+
+func (b *Blossom) mirror(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		reject(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	resp, err := http.Get(body.URL)
+	if err != nil {
+		reject(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		reject(w, http.StatusBadGateway, "fetching the blob failed")
+		return
+	}
+	hash := sha256.Sum256(data)
+	sha256Hash := hex.EncodeToString(hash[:])
+	owner, err := checkAuth(r, "upload", sha256Hash)
+	if err != nil {
+		reject(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	b.store(w, sha256Hash, Blob{Data: data, Type: resp.Header.Get("Content-Type"), Owner: owner})
+}
+
+// store keeps the blob and answers with its descriptor.
+func (b *Blossom) store(w http.ResponseWriter, sha256Hash string, blob Blob) {
+	if blob.Type == "" {
+		blob.Type = "application/octet-stream"
+	}
+	blob.Uploaded = time.Now().Unix()
+	b.mu.Lock()
+	b.blobs[sha256Hash] = blob
+	b.uploads++
+	b.mu.Unlock()
+	writeJSON(w, b.descriptor(sha256Hash, blob))
+}
+
+func (b *Blossom) list(w http.ResponseWriter, r *http.Request) {
+	pubKey := strings.TrimPrefix(r.URL.Path, "/list/")
+	b.mu.Lock()
+	descriptors := []map[string]any{}
+	for sha256Hash, blob := range b.blobs {
+		if blob.Owner == pubKey {
+			descriptors = append(descriptors, b.descriptor(sha256Hash, blob))
+		}
+	}
+	b.mu.Unlock()
+	slices.SortFunc(descriptors, func(a, b map[string]any) int {
+		return strings.Compare(a["sha256"].(string), b["sha256"].(string))
+	})
+	writeJSON(w, descriptors)
+}
+
+func (b *Blossom) delete(w http.ResponseWriter, r *http.Request) {
+	sha256Hash := blobHash(r.URL.Path)
+	owner, err := checkAuth(r, "delete", sha256Hash)
+	if err != nil {
+		reject(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blob, ok := b.blobs[sha256Hash]
+	switch {
+	case !ok:
+		reject(w, http.StatusNotFound, "blob not found")
+	case blob.Owner != owner:
+		reject(w, http.StatusForbidden, "not the owner of the blob")
+	default:
+		delete(b.blobs, sha256Hash)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (b *Blossom) get(w http.ResponseWriter, r *http.Request) {
+	blob, ok := b.Blob(blobHash(r.URL.Path))
+	if !ok {
+		reject(w, http.StatusNotFound, "blob not found")
+		return
+	}
+	w.Header().Set("Content-Type", blob.Type)
+	http.ServeContent(w, r, "", time.Unix(blob.Uploaded, 0), strings.NewReader(string(blob.Data)))
+}
+
+func (b *Blossom) descriptor(sha256Hash string, blob Blob) map[string]any {
+	return map[string]any{
+		"url":      b.blobURL(sha256Hash, blob.Type),
+		"sha256":   sha256Hash,
+		"size":     len(blob.Data),
+		"type":     blob.Type,
+		"uploaded": blob.Uploaded,
+	}
+}
+
+// blobURL is the URL of the blob, with the subtype of its MIME type as
+// extension. The system MIME tables are left out so that URLs are the same
+// on every machine.
+func (b *Blossom) blobURL(sha256Hash, mimeType string) string {
+	url := b.URL + "/" + sha256Hash
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if _, subtype, ok := strings.Cut(mediaType, "/"); ok && subtype != "octet-stream" && !strings.ContainsAny(subtype, ".+-") {
+		url += "." + subtype
+	}
+	return url
+}
+
+// blobHash returns the sha256 of a blob path, which may have an extension.
+func blobHash(path string) string {
+	hash, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), ".")
+	return hash
+}
+
+// checkAuth checks the Blossom authorization of the request for the verb
+// and, when not empty, the blob hash. It returns the pubkey that signed it.
+func checkAuth(r *http.Request, verb, sha256Hash string) (string, error) {
+	encoded, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Nostr ")
+	if !ok {
+		return "", errors.New("missing authorization")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("authorization is not base64")
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", errors.New("authorization is not an event")
+	}
+	if event.Kind != 24242 {
+		return "", fmt.Errorf("authorization has kind %d", event.Kind)
+	}
+	if ok, _ := event.CheckSignature(); !ok || event.ID != event.GetID() {
+		return "", errors.New("invalid authorization signature")
+	}
+	if tag := event.Tags.GetFirst([]string{"t", verb}); tag == nil {
+		return "", fmt.Errorf("authorization is not for %s", verb)
+	}
+	tag := event.Tags.GetFirst([]string{"expiration", ""})
+	if tag == nil {
+		return "", errors.New("authorization has no expiration")
+	}
+	if expiration, err := strconv.ParseInt((*tag)[1], 10, 64); err != nil || expiration < time.Now().Unix() {
+		return "", errors.New("authorization expired")
+	}
+	var hashes []string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "x" {
+			hashes = append(hashes, tag[1])
+		}
+	}
+	if sha256Hash != "" && len(hashes) > 0 && !slices.Contains(hashes, sha256Hash) {
+		return "", errors.New("authorization is for other blobs")
+	}
+	return event.PubKey, nil
+}
+
+func reject(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("X-Reason", reason)
+	http.Error(w, reason, status)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
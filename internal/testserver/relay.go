@@ -0,0 +1,170 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package testserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Relay is a nostr relay keeping its events in memory. It answers EVENT
+// with OK and REQ with the stored events matching the filters followed by
+// EOSE, ignores other messages, and serves a NIP-11 document.
+type Relay struct {
+	*httptest.Server
+	// WSURL is the ws:// address of the relay.
+	WSURL string
+	// Info is the NIP-11 document of the relay.
+	Info map[string]any
+	// Reject, when set, is called with every published event. A non-empty
+	// message, such as "pow: difficulty 28 required", rejects the event.
+	Reject func(event *nostr.Event) string
+
+	mu     sync.Mutex
+	events []*nostr.Event
+}
+
+// NewRelay starts a relay, closed when the test ends.
+func NewRelay(t testing.TB) *Relay {
+	r := &Relay{Info: map[string]any{"name": "test relay", "supported_nips": []int{1, 11}}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	r.WSURL = "ws" + strings.TrimPrefix(r.URL, "http")
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Events returns the accepted events, in the order they were published.
+func (r *Relay) Events() []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*nostr.Event(nil), r.events...)
+}
+
+// Add stores an event directly, as if published earlier.
+func (r *Relay) Add(event *nostr.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *Relay) serve(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Upgrade") == "" {
+		w.Header().Set("Content-Type", "application/nostr+json")
+		json.NewEncoder(w).Encode(r.Info)
+		return
+	}
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(-1)
+
+	ctx := req.Context()
+	for {
+		_, message, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var reply []nostr.Envelope
+		switch envelope := nostr.ParseMessage(message).(type) {
+		case *nostr.EventEnvelope:
+			reply = append(reply, r.publish(&envelope.Event))
+		case *nostr.ReqEnvelope:
+			for _, event := range r.query(envelope.Filters) {
+				id := envelope.SubscriptionID
+				reply = append(reply, &nostr.EventEnvelope{SubscriptionID: &id, Event: *event})
+			}
+			eose := nostr.EOSEEnvelope(envelope.SubscriptionID)
+			reply = append(reply, &eose)
+		}
+		if err := write(ctx, conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// publish stores the event unless it is invalid or rejected, replacing the
+// older versions of replaceable and addressable events.
+func (r *Relay) publish(event *nostr.Event) *nostr.OKEnvelope {
+	if ok, _ := event.CheckSignature(); !ok || event.ID != event.GetID() {
+		return &nostr.OKEnvelope{EventID: event.ID, Reason: "invalid: bad signature or id"}
+	}
+	if r.Reject != nil {
+		if reason := r.Reject(event); reason != "" {
+			return &nostr.OKEnvelope{EventID: event.ID, Reason: reason}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, stored := range r.events {
+		if stored.ID == event.ID {
+			return &nostr.OKEnvelope{EventID: event.ID, OK: true, Reason: "duplicate: already have this event"}
+		}
+		if replaces(event, stored) {
+			r.events = append(r.events[:i], r.events[i+1:]...)
+			break
+		}
+	}
+	r.events = append(r.events, event)
+	return &nostr.OKEnvelope{EventID: event.ID, OK: true}
+}
+
+// replaces reports whether the event is a newer version of the stored one.
+func replaces(event, stored *nostr.Event) bool {
+	if event.Kind != stored.Kind || event.PubKey != stored.PubKey || event.CreatedAt < stored.CreatedAt {
+		return false
+	}
+	switch {
+	case nostr.IsReplaceableKind(event.Kind):
+		return true
+	case nostr.IsAddressableKind(event.Kind):
+		return event.Tags.GetD() == stored.Tags.GetD()
+	}
+	return false
+}
+
+// query returns the stored events matching any of the filters, newest
+// first, up to the limit of each filter.
+func (r *Relay) query(filters nostr.Filters) []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*nostr.Event
+	for _, filter := range filters {
+		matched := 0
+		for i := len(r.events) - 1; i >= 0; i-- {
+			if filter.LimitZero || filter.Limit > 0 && matched >= filter.Limit {
+				break
+			}
+			if filter.Matches(r.events[i]) {
+				found = append(found, r.events[i])
+				matched++
+			}
+		}
+	}
+	return found
+}
+
+func write(ctx context.Context, conn *websocket.Conn, envelopes []nostr.Envelope) error {
+	for _, envelope := range envelopes {
+		data, err := envelope.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package events builds NIP-71 video, NIP-68 picture and NIP-94 file events, validating
+// the required tags before anything gets signed or mined.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Event kinds produced by the builders in this package
+const (
+	KindFileMetadata     = 1063
+	KindPicture          = 20
+	KindVideo            = 21
+	KindShortVideo       = 22
+	KindLegacyVideo      = 34235
+	KindLegacyShortVideo = 34236
+)
+
+// mediaEvent holds the fields shared by video and picture events.
+type mediaEvent struct {
+	pubKey      string
+	createdAt   nostr.Timestamp
+	title       string
+	publishedAt string
+	content     string
+	imeta       []*ImetaBuilder
+	extra       nostr.Tags
+}
+
+func (m *mediaEvent) validate() error {
+	if m.pubKey == "" {
+		return errors.New("pubkey cannot be empty")
+	}
+	if !nostr.IsValidPublicKey(m.pubKey) {
+		return fmt.Errorf("invalid pubkey %q", m.pubKey)
+	}
+	if m.publishedAt != "" {
+		if _, err := strconv.ParseInt(m.publishedAt, 10, 64); err != nil {
+			return fmt.Errorf("invalid published_at timestamp %q", m.publishedAt)
+		}
+	}
+	if len(m.imeta) == 0 {
+		return errors.New("at least one imeta entry is required")
+	}
+	return nil
+}
+
+// headerTags returns the title and published_at tags, in that order.
+func (m *mediaEvent) headerTags() nostr.Tags {
+	tags := nostr.Tags{{"title", m.title}}
+	if m.publishedAt != "" {
+		tags = append(tags, nostr.Tag{"published_at", m.publishedAt})
+	}
+	return tags
+}
+
+func (m *mediaEvent) event(kind int, tags nostr.Tags) *nostr.Event {
+	createdAt := m.createdAt
+	if createdAt == 0 {
+		createdAt = nostr.Now()
+	}
+	return &nostr.Event{
+		Kind:      kind,
+		PubKey:    m.pubKey,
+		CreatedAt: createdAt,
+		Tags:      append(tags, m.extra...),
+		Content:   m.content,
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	testPubKey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	testHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func testVideo() *VideoEventBuilder {
+	return NewVideoEventBuilder().
+		PubKey(testPubKey).
+		CreatedAt(1700000000).
+		Title("Sunset").
+		PublishedAt("1690000000").
+		Description("At the beach").
+		Imeta(NewImetaBuilder("https://cdn.example.com/video.mp4").
+			MIME("video/mp4").
+			Hash(testHash).
+			Size(1234).
+			Dim(1920, 1080).
+			Duration(12.5))
+}
+
+func TestVideoKind(t *testing.T) {
+	tests := []struct {
+		legacy, horizontal bool
+		kind               int
+		alt                string
+	}{
+		{false, false, KindShortVideo, "Vertical Video"},
+		{false, true, KindVideo, "Horizontal Video"},
+		{true, false, KindLegacyShortVideo, "Vertical Video"},
+		{true, true, KindLegacyVideo, "Horizontal Video"},
+	}
+	for _, test := range tests {
+		event, err := testVideo().Legacy(test.legacy).Horizontal(test.horizontal).Build()
+		if err != nil {
+			t.Fatalf("legacy %v, horizontal %v: %v", test.legacy, test.horizontal, err)
+		}
+		if event.Kind != test.kind {
+			t.Errorf("legacy %v, horizontal %v: kind %d, want %d", test.legacy, test.horizontal, event.Kind, test.kind)
+		}
+		if alt := event.Tags.GetFirst([]string{"alt", ""}); alt == nil || (*alt)[1] != test.alt {
+			t.Errorf("legacy %v, horizontal %v: alt tag %v, want %q", test.legacy, test.horizontal, alt, test.alt)
+		}
+	}
+}
+
+func TestVideoIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		legacy     bool
+		identifier string
+		want       string
+	}{
+		{"legacy defaults to the hash", true, "", testHash},
+		{"legacy with identifier", true, "episode-1", "episode-1"},
+		{"regular without identifier", false, "", ""},
+		{"regular with identifier", false, "episode-1", "episode-1"},
+	}
+	for _, test := range tests {
+		event, err := testVideo().Legacy(test.legacy).Identifier(test.identifier).Build()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := event.Tags.GetD(); got != test.want {
+			t.Errorf("%s: d tag %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	_, err := NewVideoEventBuilder().Legacy(true).PubKey(testPubKey).Title("No hash").
+		Imeta(NewImetaBuilder("https://cdn.example.com/video.mp4")).Build()
+	if err == nil {
+		t.Error("legacy video without hash nor identifier built")
+	}
+}
+
+func TestVideoTags(t *testing.T) {
+	event, err := testVideo().Tag(nostr.Tag{"t", "beach"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nostr.Tags{
+		{"alt", "Vertical Video"},
+		{"title", "Sunset"},
+		{"published_at", "1690000000"},
+		{"imeta", "url https://cdn.example.com/video.mp4", "m video/mp4", "alt Vertical Video",
+			"x " + testHash, "size 1234", "dim 1920x1080", "duration 12.500"},
+		{"t", "beach"},
+	}
+	if !slices.EqualFunc(event.Tags, want, func(a, b nostr.Tag) bool { return slices.Equal(a, b) }) {
+		t.Errorf("tags\n%v\nwant\n%v", event.Tags, want)
+	}
+	if event.Content != "At the beach" || event.CreatedAt != 1700000000 || event.PubKey != testPubKey {
+		t.Errorf("unexpected event %v", event)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	imeta := func() *ImetaBuilder { return NewImetaBuilder("https://cdn.example.com/a.mp4") }
+	tests := []struct {
+		name    string
+		builder *VideoEventBuilder
+		want    string
+	}{
+		{"no pubkey", NewVideoEventBuilder().Imeta(imeta()), "pubkey cannot be empty"},
+		{"bad pubkey", NewVideoEventBuilder().PubKey("npub1").Imeta(imeta()), "invalid pubkey"},
+		{"no imeta", NewVideoEventBuilder().PubKey(testPubKey), "at least one imeta"},
+		{"bad published_at", NewVideoEventBuilder().PubKey(testPubKey).PublishedAt("yesterday").Imeta(imeta()), "invalid published_at"},
+		{"bad url", NewVideoEventBuilder().PubKey(testPubKey).Imeta(NewImetaBuilder("not a url")), "invalid imeta url"},
+		{"bad hash", NewVideoEventBuilder().PubKey(testPubKey).Imeta(imeta().Hash("abc")), "invalid sha256"},
+	}
+	for _, test := range tests {
+		_, err := test.builder.Build()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestPictureEvent(t *testing.T) {
+	event, err := NewPictureEventBuilder().
+		PubKey(testPubKey).
+		Title("Cat").
+		Imeta(NewImetaBuilder("https://cdn.example.com/a.jpg").MIME("image/jpeg").Dim(800, 600)).
+		Imeta(NewImetaBuilder("https://cdn.example.com/b.png").MIME("image/png")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Kind != KindPicture {
+		t.Errorf("kind %d, want %d", event.Kind, KindPicture)
+	}
+	var urls []string
+	for _, tag := range event.Tags {
+		if tag[0] == "imeta" {
+			urls = append(urls, tag[1])
+		}
+	}
+	if want := []string{"url https://cdn.example.com/a.jpg", "url https://cdn.example.com/b.png"}; !slices.Equal(urls, want) {
+		t.Errorf("imeta urls %v, want %v", urls, want)
+	}
+
+	_, err = NewPictureEventBuilder().PubKey(testPubKey).
+		Imeta(NewImetaBuilder("https://cdn.example.com/a.mp4").MIME("video/mp4")).Build()
+	if err == nil {
+		t.Error("picture event with a video built")
+	}
+}
+
+func TestFileEvent(t *testing.T) {
+	event, err := NewFileEventBuilder(NewImetaBuilder("https://cdn.example.com/a.pdf").
+		MIME("application/pdf").Hash(testHash).Size(42)).
+		PubKey(testPubKey).
+		Description("Paper").
+		Summary("A paper").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nostr.Tags{
+		{"url", "https://cdn.example.com/a.pdf"},
+		{"m", "application/pdf"},
+		{"x", testHash},
+		{"size", "42"},
+		{"summary", "A paper"},
+	}
+	if event.Kind != KindFileMetadata {
+		t.Errorf("kind %d, want %d", event.Kind, KindFileMetadata)
+	}
+	if !slices.EqualFunc(event.Tags, want, func(a, b nostr.Tag) bool { return slices.Equal(a, b) }) {
+		t.Errorf("tags %v, want %v", event.Tags, want)
+	}
+
+	_, err = NewFileEventBuilder(NewImetaBuilder("https://cdn.example.com/a.pdf")).PubKey(testPubKey).Build()
+	if err == nil {
+		t.Error("file event without m and x built")
+	}
+}
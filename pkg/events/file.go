@@ -0,0 +1,89 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"errors"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FileEventBuilder builds NIP-94 file metadata (kind 1063) events. The file
+// is described with an ImetaBuilder, whose fields become top level tags.
+type FileEventBuilder struct {
+	pubKey    string
+	createdAt nostr.Timestamp
+	content   string
+	summary   string
+	file      *ImetaBuilder
+	extra     nostr.Tags
+}
+
+// NewFileEventBuilder returns a builder for the given file.
+func NewFileEventBuilder(file *ImetaBuilder) *FileEventBuilder {
+	return &FileEventBuilder{file: file}
+}
+
+// PubKey sets the author of the event.
+func (b *FileEventBuilder) PubKey(pubKey string) *FileEventBuilder {
+	b.pubKey = pubKey
+	return b
+}
+
+// CreatedAt sets the event timestamp; it defaults to the build time.
+func (b *FileEventBuilder) CreatedAt(createdAt nostr.Timestamp) *FileEventBuilder {
+	b.createdAt = createdAt
+	return b
+}
+
+// Description sets the event content.
+func (b *FileEventBuilder) Description(description string) *FileEventBuilder {
+	b.content = description
+	return b
+}
+
+// Summary sets the "summary" tag, an excerpt of the file content.
+func (b *FileEventBuilder) Summary(summary string) *FileEventBuilder {
+	b.summary = summary
+	return b
+}
+
+// Tag appends an extra tag after the generated ones.
+func (b *FileEventBuilder) Tag(tag nostr.Tag) *FileEventBuilder {
+	b.extra = append(b.extra, tag)
+	return b
+}
+
+// Build validates the builder and returns the unsigned event.
+func (b *FileEventBuilder) Build() (*nostr.Event, error) {
+	if b.pubKey == "" || !nostr.IsValidPublicKey(b.pubKey) {
+		return nil, errors.New("a valid pubkey is required")
+	}
+	if b.file == nil {
+		return nil, errors.New("a file is required")
+	}
+	if b.file.m.MIME == "" || b.file.m.Hash == "" {
+		return nil, errors.New("file events require the m and x fields")
+	}
+	tags, err := b.file.m.Tags()
+	if err != nil {
+		return nil, err
+	}
+	if b.summary != "" {
+		tags = append(tags, nostr.Tag{"summary", b.summary})
+	}
+
+	createdAt := b.createdAt
+	if createdAt == 0 {
+		createdAt = nostr.Now()
+	}
+	return &nostr.Event{
+		Kind:      KindFileMetadata,
+		PubKey:    b.pubKey,
+		CreatedAt: createdAt,
+		Tags:      append(tags, b.extra...),
+		Content:   b.content,
+	}, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ImetaBuilder assembles a NIP-92 "imeta" tag describing one media file.
+type ImetaBuilder struct {
+	m imeta.Imeta
+}
+
+// NewImetaBuilder starts an imeta tag for the file served at url.
+func NewImetaBuilder(url string) *ImetaBuilder {
+	return &ImetaBuilder{m: imeta.Imeta{URL: url}}
+}
+
+// ImetaFrom starts an imeta tag from metadata parsed elsewhere, such as a
+// rendition described by a DVM.
+func ImetaFrom(m imeta.Imeta) *ImetaBuilder {
+	return &ImetaBuilder{m: m}
+}
+
+// MIME sets the "m" field.
+func (b *ImetaBuilder) MIME(mime string) *ImetaBuilder {
+	b.m.MIME = mime
+	return b
+}
+
+// Alt sets the accessibility description of the file.
+func (b *ImetaBuilder) Alt(alt string) *ImetaBuilder {
+	b.m.Alt = alt
+	return b
+}
+
+// Hash sets the "x" field, the hex encoded sha256 of the file.
+func (b *ImetaBuilder) Hash(hash string) *ImetaBuilder {
+	b.m.Hash = hash
+	return b
+}
+
+// Size sets the file size in bytes.
+func (b *ImetaBuilder) Size(size int64) *ImetaBuilder {
+	b.m.Size = size
+	return b
+}
+
+// Dim sets the "dim" field.
+func (b *ImetaBuilder) Dim(width, height int) *ImetaBuilder {
+	b.m.Dim = imeta.Dim{Width: width, Height: height}
+	return b
+}
+
+// Blurhash sets the blurhash placeholder of the file.
+func (b *ImetaBuilder) Blurhash(blurhash string) *ImetaBuilder {
+	b.m.Blurhash = blurhash
+	return b
+}
+
+// Thumbhash sets the ThumbHash placeholder of the file.
+func (b *ImetaBuilder) Thumbhash(thumbhash string) *ImetaBuilder {
+	b.m.Thumbhash = thumbhash
+	return b
+}
+
+// Duration sets the length of a video or audio file, in seconds.
+func (b *ImetaBuilder) Duration(seconds float64) *ImetaBuilder {
+	b.m.Duration = seconds
+	return b
+}
+
+// Bitrate sets the average bitrate of a video or audio file, in bits per
+// second.
+func (b *ImetaBuilder) Bitrate(bitrate int64) *ImetaBuilder {
+	b.m.Bitrate = bitrate
+	return b
+}
+
+// Codec sets the codec of a video or audio file, such as "h264".
+func (b *ImetaBuilder) Codec(codec string) *ImetaBuilder {
+	b.m.Codec = codec
+	return b
+}
+
+// Image sets the URL of a preview image, such as the poster of a video.
+func (b *ImetaBuilder) Image(url string) *ImetaBuilder {
+	b.m.Image = url
+	return b
+}
+
+// Fallback adds an alternative URL serving the same file.
+func (b *ImetaBuilder) Fallback(url string) *ImetaBuilder {
+	b.m.Fallbacks = append(b.m.Fallbacks, url)
+	return b
+}
+
+// Build validates the fields and returns the imeta tag.
+func (b *ImetaBuilder) Build() (nostr.Tag, error) {
+	return b.m.Format()
+}
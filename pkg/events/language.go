@@ -0,0 +1,80 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// LanguageNamespace is the NIP-32 label namespace of language codes.
+const LanguageNamespace = "ISO-639-1"
+
+// Translation is the title and summary of an event in another language.
+type Translation struct {
+	// Language is an ISO 639-1 code, such as "pt".
+	Language string
+	Title    string
+	Summary  string
+}
+
+// Languages describes the language of an event and its translated titles
+// and summaries.
+type Languages struct {
+	// Language is the ISO 639-1 code of the language of the event.
+	Language     string
+	Translations []Translation
+}
+
+// Tags returns the NIP-32 "L" and "l" tags labelling the language of the
+// event and of its translations, followed by a "title" and a "summary" tag
+// per translation, with the language code as their third element. It
+// returns no tags when l is empty.
+func (l Languages) Tags() (nostr.Tags, error) {
+	var codes []string
+	if l.Language != "" {
+		codes = append(codes, l.Language)
+	}
+	for _, translation := range l.Translations {
+		if !slices.Contains(codes, translation.Language) {
+			codes = append(codes, translation.Language)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	tags := nostr.Tags{{"L", LanguageNamespace}}
+	for _, code := range codes {
+		if !isLanguageCode(code) {
+			return nil, fmt.Errorf("invalid language %q, expected an ISO 639-1 code such as en", code)
+		}
+		tags = append(tags, nostr.Tag{"l", code, LanguageNamespace})
+	}
+	for _, translation := range l.Translations {
+		if translation.Title != "" {
+			tags = append(tags, nostr.Tag{"title", translation.Title, translation.Language})
+		}
+		if translation.Summary != "" {
+			tags = append(tags, nostr.Tag{"summary", translation.Summary, translation.Language})
+		}
+	}
+	return tags, nil
+}
+
+// isLanguageCode reports whether code has the shape of an ISO 639-1 code.
+func isLanguageCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// PictureEventBuilder builds NIP-68 picture-first (kind 20) events.
+type PictureEventBuilder struct {
+	mediaEvent
+}
+
+// NewPictureEventBuilder returns an empty picture event builder.
+func NewPictureEventBuilder() *PictureEventBuilder {
+	return &PictureEventBuilder{}
+}
+
+// PubKey sets the author of the event.
+func (b *PictureEventBuilder) PubKey(pubKey string) *PictureEventBuilder {
+	b.pubKey = pubKey
+	return b
+}
+
+// CreatedAt sets the event timestamp; it defaults to the build time.
+func (b *PictureEventBuilder) CreatedAt(createdAt nostr.Timestamp) *PictureEventBuilder {
+	b.createdAt = createdAt
+	return b
+}
+
+// Title sets the "title" tag.
+func (b *PictureEventBuilder) Title(title string) *PictureEventBuilder {
+	b.title = title
+	return b
+}
+
+// PublishedAt sets the "published_at" tag (unix seconds).
+func (b *PictureEventBuilder) PublishedAt(publishedAt string) *PictureEventBuilder {
+	b.publishedAt = publishedAt
+	return b
+}
+
+// Description sets the event content.
+func (b *PictureEventBuilder) Description(description string) *PictureEventBuilder {
+	b.content = description
+	return b
+}
+
+// Imeta adds a picture to the gallery.
+func (b *PictureEventBuilder) Imeta(imeta *ImetaBuilder) *PictureEventBuilder {
+	b.imeta = append(b.imeta, imeta)
+	return b
+}
+
+// Tag appends an extra tag after the generated ones.
+func (b *PictureEventBuilder) Tag(tag nostr.Tag) *PictureEventBuilder {
+	b.extra = append(b.extra, tag)
+	return b
+}
+
+// Build validates the builder and returns the unsigned event.
+func (b *PictureEventBuilder) Build() (*nostr.Event, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	tags := b.headerTags()
+	for _, imeta := range b.imeta {
+		if imeta.m.MIME != "" && !strings.HasPrefix(imeta.m.MIME, "image/") {
+			return nil, fmt.Errorf("picture events only accept images, got %s", imeta.m.MIME)
+		}
+		tag, err := imeta.Build()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return b.event(KindPicture, tags), nil
+}
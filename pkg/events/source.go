@@ -0,0 +1,45 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Source attributes mirrored media to where it was first published.
+type Source struct {
+	// URL is the canonical URL of the original, such as a YouTube page.
+	URL string
+	// Author is the name of the original author, and AuthorPubKey their
+	// nostr public key in hex, when known.
+	Author       string
+	AuthorPubKey string
+}
+
+// Tags returns an "r" tag and a NIP-48 "proxy" tag with the URL of the
+// original, an "author" tag with the name of its author and a "p" tag
+// mentioning them. It returns no tags when s is empty.
+func (s Source) Tags() (nostr.Tags, error) {
+	var tags nostr.Tags
+	if s.URL != "" {
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, errors.New("the source URL must be an http or https URL")
+		}
+		tags = append(tags, nostr.Tag{"r", s.URL}, nostr.Tag{"proxy", s.URL, "web"})
+	}
+	if s.Author != "" {
+		tags = append(tags, nostr.Tag{"author", s.Author})
+	}
+	if s.AuthorPubKey != "" {
+		if !nostr.IsValidPublicKey(s.AuthorPubKey) {
+			return nil, errors.New("invalid author pubkey")
+		}
+		tags = append(tags, nostr.Tag{"p", s.AuthorPubKey})
+	}
+	return tags, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Problem is something wrong with an event, with the tag it concerns and a
+// hint on how to fix it.
+type Problem struct {
+	// Tag is the name of the tag at fault, empty for the event itself.
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+func (p Problem) String() string {
+	message := p.Message
+	if p.Tag != "" {
+		message = p.Tag + ": " + message
+	}
+	if p.Hint != "" {
+		message += " (" + p.Hint + ")"
+	}
+	return message
+}
+
+// Validate checks the event against NIP-71 for video kinds, NIP-68 for
+// pictures and NIP-94 for file metadata: the id and signature when signed,
+// the required tags and the syntax of the imeta fields. It returns nothing
+// for a valid event. URLs are only checked for syntax, not fetched.
+func Validate(event *nostr.Event) []Problem {
+	var problems []Problem
+	add := func(tag, message, hint string) {
+		problems = append(problems, Problem{Tag: tag, Message: message, Hint: hint})
+	}
+
+	if !nostr.IsValidPublicKey(event.PubKey) {
+		add("", fmt.Sprintf("invalid pubkey %q", event.PubKey), "it must be 64 lowercase hex characters")
+	}
+	if event.ID != "" && event.ID != event.GetID() {
+		add("", "the id does not match the content of the event", "the event was changed after it was signed; sign it again")
+	}
+	if event.Sig != "" {
+		if ok, err := event.CheckSignature(); !ok {
+			add("", fmt.Sprintf("invalid signature: %v", err), "sign the event again with the key of its pubkey")
+		}
+	}
+
+	switch event.Kind {
+	case KindVideo, KindShortVideo, KindLegacyVideo, KindLegacyShortVideo, KindPicture:
+		if title := event.Tags.GetFirst([]string{"title", ""}); title == nil || strings.TrimSpace((*title)[1]) == "" {
+			add("title", "missing or empty", "NIP-71 and NIP-68 events require a title tag")
+		}
+		if nostr.IsAddressableKind(event.Kind) && event.Tags.GetD() == "" {
+			add("d", "missing", fmt.Sprintf("kind %d is addressable and needs a d tag identifying it", event.Kind))
+		}
+		if publishedAt := event.Tags.GetFirst([]string{"published_at", ""}); publishedAt != nil {
+			if _, err := strconv.ParseInt((*publishedAt)[1], 10, 64); err != nil {
+				add("published_at", fmt.Sprintf("%q is not a timestamp", (*publishedAt)[1]), "use unix seconds")
+			}
+		}
+		imetas := 0
+		for _, tag := range event.Tags {
+			if len(tag) >= 1 && tag[0] == "imeta" {
+				imetas++
+				problems = append(problems, validateImeta(tag, event.Kind)...)
+			}
+		}
+		if imetas == 0 {
+			add("imeta", "missing", "the media must be described by at least one imeta tag")
+		}
+	case KindFileMetadata:
+		fields := make(map[string]string)
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 {
+				if _, ok := fields[tag[0]]; !ok {
+					fields[tag[0]] = tag[1]
+				}
+			}
+		}
+		for _, name := range []string{"url", "m", "x"} {
+			if fields[name] == "" {
+				add(name, "missing", "NIP-94 requires the url, m and x tags")
+			}
+		}
+		for _, tag := range event.Tags {
+			if len(tag) < 2 {
+				continue
+			}
+			if problem, ok := validateField(tag[0], tag[1]); !ok {
+				problems = append(problems, problem)
+			}
+		}
+	default:
+		add("", fmt.Sprintf("kind %d is not a NIP-71 video, NIP-68 picture or NIP-94 file event", event.Kind), "")
+	}
+	return problems
+}
+
+// validateImeta checks the syntax of every field of an imeta tag.
+func validateImeta(tag nostr.Tag, kind int) []Problem {
+	var problems []Problem
+	hasURL := false
+	for _, field := range tag[1:] {
+		name, value, ok := strings.Cut(field, " ")
+		if !ok || value == "" {
+			problems = append(problems, Problem{Tag: "imeta", Message: fmt.Sprintf("field %q has no value", field), Hint: `fields are "name value" strings`})
+			continue
+		}
+		hasURL = hasURL || name == "url"
+		if problem, ok := validateField(name, value); !ok {
+			problem.Tag = "imeta " + name
+			problems = append(problems, problem)
+		}
+		if name == "m" && kind == KindPicture && !strings.HasPrefix(value, "image/") {
+			problems = append(problems, Problem{Tag: "imeta m", Message: fmt.Sprintf("%q is not an image type", value), Hint: "NIP-68 pictures must be images"})
+		}
+		if name == "m" && kind != KindPicture && !isVideoType(value) {
+			problems = append(problems, Problem{Tag: "imeta m", Message: fmt.Sprintf("%q is not a video type", value), Hint: "NIP-71 events describe videos"})
+		}
+	}
+	if !hasURL {
+		problems = append(problems, Problem{Tag: "imeta", Message: "missing url field", Hint: "every imeta tag needs the URL of the file"})
+	}
+	return problems
+}
+
+// isVideoType reports whether the MIME type is a video or an HLS playlist.
+func isVideoType(mime string) bool {
+	mime = strings.ToLower(mime)
+	return strings.HasPrefix(mime, "video/") ||
+		mime == "application/x-mpegurl" || mime == "application/vnd.apple.mpegurl"
+}
+
+// validateField checks the syntax of a file metadata field, used both as
+// NIP-94 tag and as imeta field.
+func validateField(name, value string) (Problem, bool) {
+	problem := Problem{Tag: name}
+	switch name {
+	case "url", "fallback", "image", "thumb":
+		if u, err := url.ParseRequestURI(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem.Message = fmt.Sprintf("%q is not an http(s) URL", value)
+			return problem, false
+		}
+	case "m":
+		if kind, subtype, ok := strings.Cut(value, "/"); !ok || kind == "" || subtype == "" || strings.ContainsAny(value, " ;") {
+			problem.Message = fmt.Sprintf("%q is not a MIME type", value)
+			problem.Hint = `use a type such as "video/mp4", without parameters`
+			return problem, false
+		}
+	case "x", "ox":
+		if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != 32 {
+			problem.Message = fmt.Sprintf("%q is not a sha256 hash", value)
+			problem.Hint = "it must be 64 hex characters"
+			return problem, false
+		}
+	case "dim":
+		if _, err := imeta.ParseDim(value); err != nil {
+			problem.Message = fmt.Sprintf("%q is not a dimension", value)
+			problem.Hint = `use "<width>x<height>" in pixels, such as "1920x1080"`
+			return problem, false
+		}
+	case "size", "bitrate":
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n <= 0 {
+			problem.Message = fmt.Sprintf("%q is not a positive integer", value)
+			return problem, false
+		}
+	case "duration":
+		if seconds, err := strconv.ParseFloat(value, 64); err != nil || seconds < 0 {
+			problem.Message = fmt.Sprintf("%q is not a duration", value)
+			problem.Hint = "use seconds, such as 12.5"
+			return problem, false
+		}
+	}
+	return problem, true
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package events
+
+import (
+	"errors"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// VideoEventBuilder builds NIP-71 video events (kinds 21/22, or the legacy
+// addressable kinds 34235/34236).
+type VideoEventBuilder struct {
+	mediaEvent
+	legacy     bool
+	horizontal bool
+	identifier string
+}
+
+// NewVideoEventBuilder returns a builder for a vertical, non-legacy video.
+func NewVideoEventBuilder() *VideoEventBuilder {
+	return &VideoEventBuilder{}
+}
+
+// Legacy selects the addressable kinds 34235/34236.
+func (b *VideoEventBuilder) Legacy(legacy bool) *VideoEventBuilder {
+	b.legacy = legacy
+	return b
+}
+
+// Horizontal selects the long/horizontal kinds 21/34235 instead of 22/34236.
+func (b *VideoEventBuilder) Horizontal(horizontal bool) *VideoEventBuilder {
+	b.horizontal = horizontal
+	return b
+}
+
+// PubKey sets the author of the event.
+func (b *VideoEventBuilder) PubKey(pubKey string) *VideoEventBuilder {
+	b.pubKey = pubKey
+	return b
+}
+
+// CreatedAt sets the event timestamp; it defaults to the build time.
+func (b *VideoEventBuilder) CreatedAt(createdAt nostr.Timestamp) *VideoEventBuilder {
+	b.createdAt = createdAt
+	return b
+}
+
+// Title sets the "title" tag.
+func (b *VideoEventBuilder) Title(title string) *VideoEventBuilder {
+	b.title = title
+	return b
+}
+
+// PublishedAt sets the "published_at" tag (unix seconds).
+func (b *VideoEventBuilder) PublishedAt(publishedAt string) *VideoEventBuilder {
+	b.publishedAt = publishedAt
+	return b
+}
+
+// Description sets the event content.
+func (b *VideoEventBuilder) Description(description string) *VideoEventBuilder {
+	b.content = description
+	return b
+}
+
+// Identifier sets the "d" tag. Legacy events always have one, defaulting to
+// the hash of the first video; other events only when it is set.
+func (b *VideoEventBuilder) Identifier(identifier string) *VideoEventBuilder {
+	b.identifier = identifier
+	return b
+}
+
+// Imeta adds a video variant.
+func (b *VideoEventBuilder) Imeta(imeta *ImetaBuilder) *VideoEventBuilder {
+	b.imeta = append(b.imeta, imeta)
+	return b
+}
+
+// Tag appends an extra tag after the generated ones.
+func (b *VideoEventBuilder) Tag(tag nostr.Tag) *VideoEventBuilder {
+	b.extra = append(b.extra, tag)
+	return b
+}
+
+// Kind returns the event kind selected by the Legacy and Horizontal options.
+func (b *VideoEventBuilder) Kind() int {
+	switch {
+	case b.legacy && b.horizontal:
+		return KindLegacyVideo
+	case b.legacy:
+		return KindLegacyShortVideo
+	case b.horizontal:
+		return KindVideo
+	default:
+		return KindShortVideo
+	}
+}
+
+// Alt returns the human readable description used in the "alt" tags.
+func (b *VideoEventBuilder) Alt() string {
+	if b.horizontal {
+		return "Horizontal Video"
+	}
+	return "Vertical Video"
+}
+
+// Build validates the builder and returns the unsigned event.
+func (b *VideoEventBuilder) Build() (*nostr.Event, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	alt := b.Alt()
+	tags := append(nostr.Tags{{"alt", alt}}, b.headerTags()...)
+	for _, imeta := range b.imeta {
+		if imeta.m.Alt == "" {
+			imeta.Alt(alt)
+		}
+		tag, err := imeta.Build()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if b.legacy {
+		identifier := b.identifier
+		if identifier == "" {
+			identifier = b.imeta[0].m.Hash
+		}
+		if identifier == "" {
+			return nil, errors.New("legacy video events require a d tag or a video hash")
+		}
+		tags = append(tags, nostr.Tag{"d", identifier})
+	} else if b.identifier != "" {
+		tags = append(tags, nostr.Tag{"d", b.identifier})
+	}
+
+	return b.event(b.Kind(), tags), nil
+}
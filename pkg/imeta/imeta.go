@@ -0,0 +1,275 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package imeta parses and formats the NIP-92 "imeta" tags describing media
+// files, and the equivalent top level tags of NIP-94 file events, so that
+// fields are typed and validated instead of concatenated by hand.
+package imeta
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Dim is the size of an image or video in pixels, the "dim" field.
+type Dim struct {
+	Width  int
+	Height int
+}
+
+// ParseDim parses "<width>x<height>".
+func ParseDim(s string) (Dim, error) {
+	width, height, ok := strings.Cut(s, "x")
+	if !ok {
+		return Dim{}, fmt.Errorf("invalid dim %q", s)
+	}
+	var d Dim
+	var err1, err2 error
+	d.Width, err1 = strconv.Atoi(width)
+	d.Height, err2 = strconv.Atoi(height)
+	if err1 != nil || err2 != nil || d.Width <= 0 || d.Height <= 0 {
+		return Dim{}, fmt.Errorf("invalid dim %q", s)
+	}
+	return d, nil
+}
+
+// IsZero reports whether the dimensions are unknown.
+func (d Dim) IsZero() bool {
+	return d.Width == 0 && d.Height == 0
+}
+
+func (d Dim) String() string {
+	return fmt.Sprintf("%dx%d", d.Width, d.Height)
+}
+
+// FieldNames are the fields Imeta knows, in the order they are emitted.
+var FieldNames = []string{"url", "m", "alt", "x", "size", "dim", "blurhash",
+	"thumbhash", "duration", "bitrate", "codec", "image", "thumb", "fallback"}
+
+// Imeta describes one media file. Zero values are left out of the tag.
+type Imeta struct {
+	URL  string
+	MIME string
+	Alt  string
+	// Hash is the hex encoded sha256 of the file, the "x" field.
+	Hash     string
+	Size     int64
+	Dim      Dim
+	Blurhash string
+	// Thumbhash is the base64 encoded ThumbHash placeholder.
+	Thumbhash string
+	// Duration is the length of a video or audio file, in seconds.
+	Duration float64
+	// Bitrate is the average bitrate, in bits per second.
+	Bitrate int64
+	Codec   string
+	// Image is the URL of a preview image, such as the poster of a video.
+	Image string
+	// Thumb is the URL of a thumbnail of the file.
+	Thumb     string
+	Fallbacks []string
+	// Extra keeps the fields this package does not know, in order.
+	Extra [][2]string
+}
+
+// Validate checks the fields that have a syntax.
+func (m Imeta) Validate() error {
+	if m.URL == "" {
+		return errors.New("imeta url cannot be empty")
+	}
+	if _, err := url.ParseRequestURI(m.URL); err != nil {
+		return fmt.Errorf("invalid imeta url %q", m.URL)
+	}
+	if m.Hash != "" {
+		if decoded, err := hex.DecodeString(m.Hash); err != nil || len(decoded) != 32 {
+			return fmt.Errorf("invalid sha256 hash %q", m.Hash)
+		}
+	}
+	if m.Dim.Width < 0 || m.Dim.Height < 0 || (m.Dim.Width == 0) != (m.Dim.Height == 0) {
+		return fmt.Errorf("invalid dimensions %dx%d", m.Dim.Width, m.Dim.Height)
+	}
+	if m.Size < 0 {
+		return fmt.Errorf("invalid size %d", m.Size)
+	}
+	if m.Duration < 0 || math.IsNaN(m.Duration) || math.IsInf(m.Duration, 0) || m.Bitrate < 0 {
+		return fmt.Errorf("invalid duration %g or bitrate %d", m.Duration, m.Bitrate)
+	}
+	return nil
+}
+
+// Fields validates the metadata and returns its name/value pairs in the
+// order they are emitted.
+func (m Imeta) Fields() ([][2]string, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	fields := [][2]string{{"url", m.URL}}
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+	add("m", m.MIME)
+	add("alt", m.Alt)
+	add("x", m.Hash)
+	if m.Size > 0 {
+		add("size", strconv.FormatInt(m.Size, 10))
+	}
+	if !m.Dim.IsZero() {
+		add("dim", m.Dim.String())
+	}
+	add("blurhash", m.Blurhash)
+	add("thumbhash", m.Thumbhash)
+	// durations below a millisecond round to nothing
+	if duration := strconv.FormatFloat(m.Duration, 'f', 3, 64); duration != "0.000" {
+		add("duration", duration)
+	}
+	if m.Bitrate > 0 {
+		add("bitrate", strconv.FormatInt(m.Bitrate, 10))
+	}
+	add("codec", m.Codec)
+	add("image", m.Image)
+	add("thumb", m.Thumb)
+	for _, fallback := range m.Fallbacks {
+		add("fallback", fallback)
+	}
+	return append(fields, m.Extra...), nil
+}
+
+// Only returns a copy of the metadata without the fields that are not named,
+// except the url that every file needs.
+func (m Imeta) Only(names []string) (Imeta, error) {
+	fields, err := m.Fields()
+	if err != nil {
+		return Imeta{}, err
+	}
+	var kept [][2]string
+	for _, field := range fields {
+		if field[0] == "url" || slices.Contains(names, field[0]) {
+			kept = append(kept, field)
+		}
+	}
+	return parseFields(kept)
+}
+
+// Format returns the imeta tag.
+func (m Imeta) Format() (nostr.Tag, error) {
+	fields, err := m.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tag := nostr.Tag{"imeta"}
+	for _, field := range fields {
+		tag = append(tag, field[0]+" "+field[1])
+	}
+	return tag, nil
+}
+
+// Tags returns the fields as the top level tags of a NIP-94 file event.
+func (m Imeta) Tags() (nostr.Tags, error) {
+	fields, err := m.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(nostr.Tags, 0, len(fields))
+	for _, field := range fields {
+		tags = append(tags, nostr.Tag{field[0], field[1]})
+	}
+	return tags, nil
+}
+
+// Parse reads an imeta tag, whose elements are "name value" strings.
+func Parse(tag nostr.Tag) (Imeta, error) {
+	if len(tag) == 0 || tag[0] != "imeta" {
+		return Imeta{}, errors.New("not an imeta tag")
+	}
+	var fields [][2]string
+	for _, field := range tag[1:] {
+		name, value, ok := strings.Cut(field, " ")
+		if !ok {
+			return Imeta{}, fmt.Errorf("imeta field %q has no value", field)
+		}
+		fields = append(fields, [2]string{name, value})
+	}
+	return parseFields(fields)
+}
+
+// FromTags reads the file described by the top level tags of a NIP-94 file
+// event. Tags that are not file metadata, such as "t" or "summary", are kept
+// in Extra.
+func FromTags(tags nostr.Tags) (Imeta, error) {
+	var fields [][2]string
+	for _, tag := range tags {
+		if len(tag) >= 2 {
+			fields = append(fields, [2]string{tag[0], tag[1]})
+		}
+	}
+	return parseFields(fields)
+}
+
+func parseFields(fields [][2]string) (Imeta, error) {
+	var m Imeta
+	for _, field := range fields {
+		name, value := field[0], field[1]
+		var err error
+		switch name {
+		case "url":
+			m.URL = value
+		case "m":
+			m.MIME = value
+		case "alt":
+			m.Alt = value
+		case "x":
+			m.Hash = value
+		case "size":
+			m.Size, err = strconv.ParseInt(value, 10, 64)
+		case "dim":
+			m.Dim, err = ParseDim(value)
+		case "blurhash":
+			m.Blurhash = value
+		case "thumbhash":
+			m.Thumbhash = value
+		case "duration":
+			m.Duration, err = strconv.ParseFloat(value, 64)
+		case "bitrate":
+			m.Bitrate, err = strconv.ParseInt(value, 10, 64)
+		case "codec":
+			m.Codec = value
+		case "image":
+			m.Image = value
+		case "thumb":
+			m.Thumb = value
+		case "fallback":
+			m.Fallbacks = append(m.Fallbacks, value)
+		default:
+			m.Extra = append(m.Extra, field)
+		}
+		if err != nil {
+			return Imeta{}, fmt.Errorf("invalid imeta %s %q", name, value)
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return Imeta{}, err
+	}
+	return m, nil
+}
+
+// Field returns the value of the first field called name of an imeta tag,
+// without parsing the others, for reading events that may be malformed.
+func Field(tag nostr.Tag, name string) string {
+	for _, field := range tag[min(1, len(tag)):] {
+		if value, ok := strings.CutPrefix(field, name+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package imeta
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const testHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func full() Imeta {
+	return Imeta{
+		URL:       "https://cdn.example.com/video.mp4",
+		MIME:      "video/mp4",
+		Alt:       "Vertical Video",
+		Hash:      testHash,
+		Size:      1234,
+		Dim:       Dim{Width: 1080, Height: 1920},
+		Blurhash:  "LEHV6nWB2yk8pyo0adR*.7kCMdnj",
+		Thumbhash: "1QcSHQRnh493V4dIh4eXh1h4kJUI",
+		Duration:  12.5,
+		Bitrate:   800000,
+		Codec:     "avc1.64001f",
+		Image:     "https://cdn.example.com/poster.jpg",
+		Thumb:     "https://cdn.example.com/thumb.jpg",
+		Fallbacks: []string{"https://mirror.example.com/video.mp4", "https://other.example.com/video.mp4"},
+		Extra:     [][2]string{{"service", "nip96"}},
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tag, err := full().Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nostr.Tag{"imeta",
+		"url https://cdn.example.com/video.mp4",
+		"m video/mp4",
+		"alt Vertical Video",
+		"x " + testHash,
+		"size 1234",
+		"dim 1080x1920",
+		"blurhash LEHV6nWB2yk8pyo0adR*.7kCMdnj",
+		"thumbhash 1QcSHQRnh493V4dIh4eXh1h4kJUI",
+		"duration 12.500",
+		"bitrate 800000",
+		"codec avc1.64001f",
+		"image https://cdn.example.com/poster.jpg",
+		"thumb https://cdn.example.com/thumb.jpg",
+		"fallback https://mirror.example.com/video.mp4",
+		"fallback https://other.example.com/video.mp4",
+		"service nip96",
+	}
+	if !slices.Equal(tag, want) {
+		t.Errorf("tag\n%q\nwant\n%q", tag, want)
+	}
+
+	// zero values are left out
+	tag, err = Imeta{URL: "https://cdn.example.com/a.jpg"}.Format()
+	if err != nil || !slices.Equal(tag, nostr.Tag{"imeta", "url https://cdn.example.com/a.jpg"}) {
+		t.Errorf("minimal tag %q, %v", tag, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []Imeta{
+		full(),
+		{URL: "https://cdn.example.com/a.jpg"},
+		{URL: "https://cdn.example.com/a.jpg", MIME: "image/jpeg", Dim: Dim{Width: 1, Height: 1}},
+		{URL: "https://cdn.example.com/a.mp3", Duration: 0.001, Alt: "with  spaces and unicode ✓"},
+	}
+	for _, m := range tests {
+		tag, err := m.Format()
+		if err != nil {
+			t.Fatalf("formatting %v: %v", m, err)
+		}
+		parsed, err := Parse(tag)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tag, err)
+		}
+		if !reflect.DeepEqual(parsed, m) {
+			t.Errorf("round trip of %q\ngot  %+v\nwant %+v", tag, parsed, m)
+		}
+
+		tags, err := m.Tags()
+		if err != nil {
+			t.Fatalf("tags of %v: %v", m, err)
+		}
+		fromTags, err := FromTags(tags)
+		if err != nil {
+			t.Fatalf("reading tags %v: %v", tags, err)
+		}
+		if !reflect.DeepEqual(fromTags, m) {
+			t.Errorf("round trip of %v\ngot  %+v\nwant %+v", tags, fromTags, m)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  nostr.Tag
+		want string
+	}{
+		{"not imeta", nostr.Tag{"e", "abc"}, "not an imeta tag"},
+		{"no value", nostr.Tag{"imeta", "url"}, "has no value"},
+		{"no url", nostr.Tag{"imeta", "m video/mp4"}, "url cannot be empty"},
+		{"bad url", nostr.Tag{"imeta", "url video.mp4"}, "invalid imeta url"},
+		{"bad size", nostr.Tag{"imeta", "url https://a.com/b", "size big"}, "invalid imeta size"},
+		{"bad dim", nostr.Tag{"imeta", "url https://a.com/b", "dim 100"}, "invalid imeta dim"},
+		{"negative dim", nostr.Tag{"imeta", "url https://a.com/b", "dim -1x5"}, "invalid imeta dim"},
+		{"bad hash", nostr.Tag{"imeta", "url https://a.com/b", "x 1234"}, "invalid sha256"},
+		{"bad duration", nostr.Tag{"imeta", "url https://a.com/b", "duration long"}, "invalid imeta duration"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.tag)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestOnly(t *testing.T) {
+	m, err := full().Only([]string{"m", "dim", "fallback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Imeta{
+		URL:       "https://cdn.example.com/video.mp4",
+		MIME:      "video/mp4",
+		Dim:       Dim{Width: 1080, Height: 1920},
+		Fallbacks: []string{"https://mirror.example.com/video.mp4", "https://other.example.com/video.mp4"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+}
+
+func TestField(t *testing.T) {
+	tag := nostr.Tag{"imeta", "url https://a.com/b", "m video/mp4", "broken"}
+	if got := Field(tag, "m"); got != "video/mp4" {
+		t.Errorf("m = %q", got)
+	}
+	if got := Field(tag, "x"); got != "" {
+		t.Errorf("x = %q", got)
+	}
+	if got := Field(nostr.Tag{}, "url"); got != "" {
+		t.Errorf("url of an empty tag = %q", got)
+	}
+}
+
+// FuzzParse feeds arbitrary fields to Parse, which reads tags of events
+// downloaded from relays. Whatever it accepts must format to a tag that
+// parses back to the same metadata.
+func FuzzParse(f *testing.F) {
+	tag, _ := full().Format()
+	f.Add(strings.Join(tag[1:], "\n"))
+	f.Add("url https://a.com/b\ndim 10x20\nsize 5")
+	f.Add("url https://a.com/b\nduration 1e-9")
+	f.Add("url https://a.com/b\ndim 0x0")
+	f.Add("url :\nx " + testHash)
+	f.Fuzz(func(t *testing.T, fields string) {
+		m, err := Parse(append(nostr.Tag{"imeta"}, strings.Split(fields, "\n")...))
+		if err != nil {
+			return
+		}
+		tag, err := m.Format()
+		if err != nil {
+			t.Fatalf("parsed %+v does not format: %v", m, err)
+		}
+		parsed, err := Parse(tag)
+		if err != nil {
+			t.Fatalf("formatted %q does not parse: %v", tag, err)
+		}
+		again, err := parsed.Format()
+		if err != nil || !slices.Equal(again, tag) {
+			t.Fatalf("formatting is not stable: %q then %q, %v", tag, again, err)
+		}
+	})
+}
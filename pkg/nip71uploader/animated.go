@@ -0,0 +1,184 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Animation describes an animated GIF or WebP image.
+type Animation struct {
+	Width  int
+	Height int
+	Frames int
+	// Duration is the time one loop takes, in seconds.
+	Duration float64
+}
+
+// ReadAnimation reads the frames of a GIF or WebP image without decoding
+// them. It returns nil for still images and other files.
+func ReadAnimation(path string) (*Animation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var animation *Animation
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a")):
+		animation, err = readGIFAnimation(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		animation, err = readWebPAnimation(data)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if animation == nil || animation.Frames < 2 {
+		return nil, nil
+	}
+	return animation, nil
+}
+
+// gifFrameDelay is the delay of GIF frames declaring none or almost none,
+// as browsers play them.
+const gifFrameDelay = 10
+
+// readGIFAnimation counts the image descriptors of a GIF and adds up the
+// delays of their graphic control extensions.
+func readGIFAnimation(data []byte) (*Animation, error) {
+	if len(data) < 13 {
+		return nil, errors.New("truncated GIF header")
+	}
+	animation := &Animation{
+		Width:  int(binary.LittleEndian.Uint16(data[6:])),
+		Height: int(binary.LittleEndian.Uint16(data[8:])),
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	delay := 0
+	hundredths := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension
+			if pos+2 > len(data) {
+				return nil, errors.New("truncated GIF extension")
+			}
+			if data[pos+1] == 0xf9 && pos+6 <= len(data) {
+				delay = int(binary.LittleEndian.Uint16(data[pos+4:]))
+			}
+			pos += 2
+		case 0x2c: // image descriptor
+			if pos+10 > len(data) {
+				return nil, errors.New("truncated GIF image descriptor")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// the LZW minimum code size precedes the image data
+			pos++
+			animation.Frames++
+			if delay <= 1 {
+				delay = gifFrameDelay
+			}
+			hundredths += delay
+			delay = 0
+		case 0x3b: // trailer
+			animation.Duration = float64(hundredths) / 100
+			return animation, nil
+		default:
+			return nil, fmt.Errorf("unexpected GIF block 0x%02x", data[pos])
+		}
+
+		// skip the data sub-blocks
+		for pos < len(data) && data[pos] != 0 {
+			pos += int(data[pos]) + 1
+		}
+		pos++
+	}
+	// tolerate GIFs missing their trailer
+	animation.Duration = float64(hundredths) / 100
+	return animation, nil
+}
+
+// readWebPAnimation reads the canvas size from the VP8X chunk of an animated
+// WebP and adds up the durations of its ANMF frames.
+func readWebPAnimation(data []byte) (*Animation, error) {
+	var animation *Animation
+	milliseconds := 0
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if end > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		payload := data[pos+8 : end]
+		switch string(data[pos : pos+4]) {
+		case "VP8X":
+			if len(payload) < 10 || payload[0]&0x02 == 0 {
+				// not animated
+				return nil, nil
+			}
+			animation = &Animation{
+				Width:  1 + int(uint32(payload[4])|uint32(payload[5])<<8|uint32(payload[6])<<16),
+				Height: 1 + int(uint32(payload[7])|uint32(payload[8])<<8|uint32(payload[9])<<16),
+			}
+		case "ANMF":
+			if animation == nil || len(payload) < 16 {
+				return nil, errors.New("malformed WebP animation frame")
+			}
+			animation.Frames++
+			milliseconds += int(uint32(payload[12]) | uint32(payload[13])<<8 | uint32(payload[14])<<16)
+		}
+		pos = end + size%2
+	}
+	if animation != nil {
+		animation.Duration = float64(milliseconds) / 1000
+	}
+	return animation, nil
+}
+
+// ConvertAnimation converts an animated GIF or WebP to an H.264 MP4 video
+// with ffmpeg, into a temporary file the caller removes with RemoveTemp.
+// Decoding animated WebP needs ffmpeg 7.1 or later.
+func ConvertAnimation(ctx context.Context, path string) (string, error) {
+	ffmpeg, err := ffmpegBinary(ctx)
+	if err != nil {
+		return "", errors.New("converting animations to video needs ffmpeg")
+	}
+	// the H.264 video is rarely larger than the animation
+	if info, err := os.Stat(path); err == nil {
+		if err := checkFreeSpace(info.Size()); err != nil {
+			return "", err
+		}
+	}
+	output, err := createTemp("animation-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	output.Close()
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-v", "error", "-i", path,
+		"-movflags", "+faststart", "-pix_fmt", "yuv420p",
+		// H.264 needs even dimensions
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libx264", "-an", output.Name())
+	if message, err := cmd.CombinedOutput(); err != nil {
+		RemoveTemp(output.Name())
+		return "", fmt.Errorf("converting %s to video: %v: %s", path, err, bytes.TrimSpace(message))
+	}
+	return output.Name(), nil
+}
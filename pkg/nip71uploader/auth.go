@@ -0,0 +1,246 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Kinds of the authorization events sent in Authorization headers
+const (
+	KindBlossomAuth = 24242
+	KindHTTPAuth    = 27235
+)
+
+// AuthExpiration is how long authorization events stay valid when no other
+// expiration is given.
+var AuthExpiration = 5 * time.Minute
+
+// BlossomAuth is a Blossom (BUD-01) authorization for one action on a
+// server.
+type BlossomAuth struct {
+	// Verb is the action authorized: get, upload, list, delete or mirror.
+	Verb string
+	// Content is the human readable description of the action.
+	Content string
+	// Hashes are the sha256 of the blobs the authorization is limited to.
+	Hashes []string
+	// Server, when set, limits the authorization to that server.
+	Server string
+	// Nonce, when set, makes the authorization unique.
+	Nonce string
+	// Expiration defaults to AuthExpiration.
+	Expiration time.Duration
+}
+
+// Header signs the authorization and returns the value of the Authorization
+// header.
+func (a BlossomAuth) Header(ctx context.Context, signer nostr.Keyer) (string, error) {
+	tags := nostr.Tags{{"t", a.Verb}}
+	for _, hash := range a.Hashes {
+		tags = append(tags, nostr.Tag{"x", hash})
+	}
+	if a.Server != "" {
+		tags = append(tags, nostr.Tag{"server", a.Server})
+	}
+	if a.Nonce != "" {
+		tags = append(tags, nostr.Tag{"nonce", a.Nonce})
+	}
+	tags = append(tags, expirationTag(a.Expiration))
+	return signAuthorization(ctx, signer, KindBlossomAuth, a.Content, tags)
+}
+
+// ServerAuth customizes the Blossom authorizations sent to one server.
+type ServerAuth struct {
+	// Content replaces the description of every action, for servers that
+	// show or check it.
+	Content string
+	// Expiration replaces AuthExpiration.
+	Expiration time.Duration
+	// Scoped limits the authorizations to the server with a "server" tag.
+	Scoped bool
+	// Nonce adds a random "nonce" tag, for servers refusing authorizations
+	// they have seen before. Such authorizations are never reused.
+	Nonce bool
+}
+
+// ServerAuths customize the Blossom authorizations by server base URL.
+var ServerAuths = map[string]ServerAuth{}
+
+// authReuseMargin is how long an authorization must stay valid to be reused.
+const authReuseMargin = 30 * time.Second
+
+// signedAuths keeps the Blossom authorizations signed by Authorize and
+// PrepareAuth, so that one signature serves several requests.
+var signedAuths = struct {
+	sync.Mutex
+	list []signedAuth
+}{}
+
+type signedAuth struct {
+	pubKey  string
+	server  string
+	verb    string
+	hashes  []string
+	header  string
+	expires time.Time
+}
+
+// Authorize returns the Authorization header of a Blossom action on the
+// blob with the given hash, or on no blob when hash is empty. An
+// authorization signed before for the same server, verb and blob is reused
+// while it stays valid. content describes the action, unless the ServerAuths
+// of the server replace it.
+func Authorize(ctx context.Context, signer nostr.Keyer, server, verb, content, hash string) (string, error) {
+	pubKey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	server = strings.TrimRight(server, "/")
+
+	signedAuths.Lock()
+	signedAuths.list = slices.DeleteFunc(signedAuths.list, func(auth signedAuth) bool {
+		return time.Until(auth.expires) < authReuseMargin
+	})
+	for _, auth := range signedAuths.list {
+		if auth.pubKey == pubKey && auth.server == server && auth.verb == verb &&
+			(slices.Contains(auth.hashes, hash) || hash == "" && len(auth.hashes) == 0) {
+			signedAuths.Unlock()
+			return auth.header, nil
+		}
+	}
+	signedAuths.Unlock()
+
+	var hashes []string
+	if hash != "" {
+		hashes = []string{hash}
+	}
+	return signBlossomAuth(ctx, signer, pubKey, server, verb, content, hashes)
+}
+
+// PrepareAuth signs one authorization for several blobs, which Authorize
+// then reuses for each of them, saving signatures with remote signers.
+func PrepareAuth(ctx context.Context, signer nostr.Keyer, server, verb, content string, hashes []string) error {
+	pubKey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = signBlossomAuth(ctx, signer, pubKey, strings.TrimRight(server, "/"), verb, content, hashes)
+	return err
+}
+
+// signBlossomAuth signs an authorization customized by the ServerAuths of
+// the server and keeps it for reuse.
+func signBlossomAuth(ctx context.Context, signer nostr.Keyer, pubKey, server, verb, content string, hashes []string) (string, error) {
+	custom := ServerAuths[server]
+	auth := BlossomAuth{Verb: verb, Content: content, Hashes: hashes, Expiration: custom.Expiration}
+	if custom.Content != "" {
+		auth.Content = custom.Content
+	}
+	if custom.Scoped {
+		if u, err := url.Parse(server); err == nil {
+			auth.Server = u.Host
+		}
+	}
+	if custom.Nonce {
+		nonce := make([]byte, 16)
+		rand.Read(nonce)
+		auth.Nonce = hex.EncodeToString(nonce)
+	}
+	if auth.Expiration == 0 {
+		auth.Expiration = AuthExpiration
+	}
+
+	expires := time.Now().Add(auth.Expiration)
+	header, err := auth.Header(ctx, signer)
+	if err != nil {
+		return "", err
+	}
+	if !custom.Nonce {
+		signedAuths.Lock()
+		signedAuths.list = append(signedAuths.list, signedAuth{
+			pubKey: pubKey, server: server, verb: verb, hashes: hashes, header: header, expires: expires,
+		})
+		signedAuths.Unlock()
+	}
+	return header, nil
+}
+
+// HTTPAuth is a NIP-98 authorization for one HTTP request.
+type HTTPAuth struct {
+	URL    string
+	Method string
+	// PayloadHash is the hex sha256 of the request body, if it has one.
+	PayloadHash string
+	// Expiration defaults to AuthExpiration.
+	Expiration time.Duration
+}
+
+// WithPayload sets PayloadHash to the hash of the request body.
+func (a HTTPAuth) WithPayload(body []byte) HTTPAuth {
+	hash := sha256.Sum256(body)
+	a.PayloadHash = hex.EncodeToString(hash[:])
+	return a
+}
+
+// Header signs the authorization and returns the value of the Authorization
+// header.
+func (a HTTPAuth) Header(ctx context.Context, signer nostr.Keyer) (string, error) {
+	tags := nostr.Tags{{"u", a.URL}, {"method", a.Method}}
+	if a.PayloadHash != "" {
+		tags = append(tags, nostr.Tag{"payload", a.PayloadHash})
+	}
+	tags = append(tags, expirationTag(a.Expiration))
+	return signAuthorization(ctx, signer, KindHTTPAuth, "", tags)
+}
+
+func expirationTag(expiration time.Duration) nostr.Tag {
+	if expiration == 0 {
+		expiration = AuthExpiration
+	}
+	return nostr.Tag{"expiration", fmt.Sprintf("%d", time.Now().Add(expiration).Unix())}
+}
+
+// signAuthorization signs an authorization event and returns it base64
+// encoded after the "Nostr" scheme, ready for the Authorization header.
+func signAuthorization(ctx context.Context, signer nostr.Keyer, kind int, content string, tags nostr.Tags) (string, error) {
+	event := nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+		Content:   content,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SignTimeout)
+	defer cancel()
+
+	pubKey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	event.PubKey = pubKey
+	if err := signer.SignEvent(ctx, &event); err != nil {
+		return "", err
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(eventJSON), nil
+}
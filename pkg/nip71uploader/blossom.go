@@ -0,0 +1,341 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// UserAgent is sent with the HTTP requests to Blossom servers, media
+// downloads and webhooks, so server operators can tell which version of
+// which client talks to them, and with SendUserAgent with every request and
+// relay connection.
+var UserAgent = "nostrmedia"
+
+// BlobDescriptor is the response of a Blossom server to a successful upload.
+type BlobDescriptor struct {
+	URL      string `json:"url"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Type     string `json:"type"`
+	Uploaded int64  `json:"uploaded"`
+}
+
+// UploadProgressInterval is how often uploads report their progress.
+var UploadProgressInterval = time.Second
+
+// UploadStatus is the progress of an upload.
+type UploadStatus struct {
+	Path  string
+	Done  int64
+	Total int64
+}
+
+// UploadFile uploads a local file to a Blossom server.
+func UploadFile(ctx context.Context, server, filePath string, signer nostr.Keyer) (*BlobDescriptor, error) {
+	hashes, err := HashFile(ctx, filePath, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return uploadFile(ctx, server, filePath, hashes.SHA256, signer, nil, "")
+}
+
+// PaymentRequiredError is returned when a Blossom server asks to be paid
+// before accepting an upload (BUD-07).
+type PaymentRequiredError struct {
+	Server string
+	// Invoice is the lightning invoice to pay, from the X-Lightning header.
+	Invoice string
+	// Cashu is the cashu payment request, from the X-Cashu header.
+	Cashu string
+	// Reason is the X-Reason header.
+	Reason string
+}
+
+func (e *PaymentRequiredError) Error() string {
+	message := fmt.Sprintf("%s requires payment", e.Server)
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	if e.Invoice != "" {
+		message += ", lightning invoice " + e.Invoice
+	}
+	if e.Cashu != "" {
+		message += ", cashu request " + e.Cashu
+	}
+	return message
+}
+
+// paymentRequired returns a *PaymentRequiredError for a 402 response.
+func paymentRequired(server string, resp *http.Response) error {
+	if resp.StatusCode != http.StatusPaymentRequired {
+		return nil
+	}
+	return &PaymentRequiredError{
+		Server:  server,
+		Invoice: resp.Header.Get("X-Lightning"),
+		Cashu:   resp.Header.Get("X-Cashu"),
+		Reason:  resp.Header.Get("X-Reason"),
+	}
+}
+
+// progressReader reports the bytes read through it at most every
+// UploadProgressInterval.
+type progressReader struct {
+	io.Reader
+	status   UploadStatus
+	progress func(UploadStatus)
+	last     time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.status.Done += int64(n)
+	if time.Since(r.last) >= UploadProgressInterval || (err == io.EOF && n > 0) {
+		r.last = time.Now()
+		r.progress(r.status)
+	}
+	return n, err
+}
+
+// uploadFile uploads a local file whose sha256 is already known. progress,
+// when set, is called as the file is sent. preimage, when set, proves the
+// payment of the invoice returned by a previous attempt.
+func uploadFile(ctx context.Context, server, filePath, sha256Hash string, signer nostr.Keyer, progress func(UploadStatus), preimage string) (*BlobDescriptor, error) {
+	ctx, cancel := withTimeout(ctx, UploadTimeout)
+	defer cancel()
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Get file info
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Identify the MIME type, sent as the Content-Type
+	mimeType, err := DetectMIME(filePath)
+	if errors.Is(err, ErrUnknownFileType) {
+		mimeType = "application/octet-stream"
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Create authorization event
+	auth, err := Authorize(ctx, signer, server, "upload", "Upload file", sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create request
+	var body io.Reader = file
+	if progress != nil {
+		body = &progressReader{Reader: file, status: UploadStatus{Path: filePath, Total: fileInfo.Size()}, progress: progress}
+	}
+	uploadURL := server + "/upload"
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.ContentLength = fileInfo.Size()
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("Authorization", auth)
+	if preimage != "" {
+		// proof of the payment asked by a previous attempt
+		req.Header.Set("X-Lightning", preimage)
+	}
+
+	// Send request
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check response
+	if err := paymentRequired(server, resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusCreated &&
+		resp.StatusCode != http.StatusAccepted {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("upload failed: %s, code %d", string(bodyBytes), resp.StatusCode)
+	}
+
+	// Parse response
+	var descriptor BlobDescriptor
+	err = json.NewDecoder(resp.Body).Decode(&descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if descriptor.URL == "" {
+		return nil, fmt.Errorf("upload response from %s has no url", server)
+	}
+
+	return &descriptor, nil
+}
+
+// CheckUpload asks a Blossom server whether it would accept a blob, before
+// uploading it (BUD-06). It returns nil when the server accepts it or does
+// not support the check, and the reason given by the server otherwise.
+func CheckUpload(ctx context.Context, server, sha256Hash string, size int64, mimeType string, signer nostr.Keyer) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	auth, err := Authorize(ctx, signer, server, "upload", "Upload file", sha256Hash)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, server+"/upload", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("X-SHA-256", sha256Hash)
+	req.Header.Set("X-Content-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("X-Content-Type", mimeType)
+	req.Header.Set("Authorization", auth)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed ||
+		resp.StatusCode == http.StatusNotImplemented:
+		// the server does not implement BUD-06
+		return nil
+	}
+	if err := paymentRequired(server, resp); err != nil {
+		return err
+	}
+	reason := resp.Header.Get("X-Reason")
+	if reason == "" {
+		reason = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("%s, code %d", reason, resp.StatusCode)
+}
+
+// MirrorBlob asks a Blossom server to download a blob from another URL
+// (BUD-04), so that it does not have to be uploaded again.
+func MirrorBlob(ctx context.Context, server, blobURL, sha256Hash string, signer nostr.Keyer) (*BlobDescriptor, error) {
+	ctx, cancel := withTimeout(ctx, UploadTimeout)
+	defer cancel()
+	auth, err := Authorize(ctx, signer, server, "upload", "Mirror blob", sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{"url": blobURL})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", server+"/mirror", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("mirror failed: %s, code %d", string(bodyBytes), resp.StatusCode)
+	}
+
+	var descriptor BlobDescriptor
+	if err := json.NewDecoder(resp.Body).Decode(&descriptor); err != nil {
+		return nil, err
+	}
+	if descriptor.URL == "" {
+		return nil, fmt.Errorf("mirror response from %s has no url", server)
+	}
+	return &descriptor, nil
+}
+
+// ListBlobs returns the blobs uploaded by pubKey to a Blossom server.
+func ListBlobs(ctx context.Context, server, pubKey string, signer nostr.Keyer) ([]BlobDescriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", server+"/list/"+pubKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	// some servers only list blobs to their owner
+	if signer != nil {
+		auth, err := Authorize(ctx, signer, server, "list", "List blobs", "")
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list failed: %s, code %d", string(bodyBytes), resp.StatusCode)
+	}
+
+	var blobs []BlobDescriptor
+	if err := json.NewDecoder(resp.Body).Decode(&blobs); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// DeleteBlob removes the blob with the given sha256 from a Blossom server.
+func DeleteBlob(ctx context.Context, server, sha256Hash string, signer nostr.Keyer) error {
+	auth, err := Authorize(ctx, signer, server, "delete", "Delete blob", sha256Hash)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", server+"/"+sha256Hash, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Authorization", auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed: %s, code %d", string(bodyBytes), resp.StatusCode)
+	}
+	return nil
+}
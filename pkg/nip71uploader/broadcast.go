@@ -0,0 +1,99 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// BroadcastRelays are large public relays that accept events from anyone,
+// used to maximize the reach of an announcement.
+var BroadcastRelays = []string{
+	"wss://relay.damus.io",
+	"wss://nos.lol",
+	"wss://relay.primal.net",
+	"wss://relay.nostr.band",
+	"wss://nostr.wine",
+	"wss://relay.snort.social",
+	"wss://nostr.mom",
+	"wss://offchain.pub",
+	"wss://relay.nostr.bg",
+	"wss://nostr.oxtr.dev",
+	"wss://relay.nostrplebs.com",
+	"wss://purplerelay.com",
+}
+
+// BroadcastRate is the number of broadcast relays contacted per second.
+var BroadcastRate = 4
+
+// FetchBroadcastRelays downloads a JSON array of relay URLs, such as the
+// online relay lists published by relay monitors.
+func FetchBroadcastRelays(ctx context.Context, listURL string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", listURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", listURL, resp.Status)
+	}
+
+	var relays []string
+	if err := json.NewDecoder(resp.Body).Decode(&relays); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", listURL, err)
+	}
+	var valid []string
+	for _, relayURL := range relays {
+		if nostr.IsValidRelayURL(relayURL) {
+			valid = append(valid, relayURL)
+		}
+	}
+	return valid, nil
+}
+
+// Broadcast publishes the event to the broadcast relays that are not in
+// exclude, contacting at most BroadcastRate new relays per second.
+func Broadcast(ctx context.Context, event *nostr.Event, signer nostr.Keyer, relays []string, exclude []string) []PublishResult {
+	var pending []string
+	for _, relayURL := range relays {
+		if !slices.ContainsFunc(exclude, func(excluded string) bool {
+			return nostr.NormalizeURL(excluded) == nostr.NormalizeURL(relayURL)
+		}) {
+			pending = append(pending, relayURL)
+		}
+	}
+
+	rate := max(BroadcastRate, 1)
+	var results []PublishResult
+	for len(pending) > 0 {
+		batch := pending[:min(rate, len(pending))]
+		pending = pending[len(batch):]
+		started := time.Now()
+		results = append(results, PublishEvent(ctx, event, signer, batch)...)
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-time.After(time.Until(started.Add(time.Second))):
+		case <-ctx.Done():
+			return results
+		}
+	}
+	return results
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MediaKinds are the kinds of the media events published by this package.
+var MediaKinds = []int{
+	events.KindPicture,
+	events.KindVideo, events.KindShortVideo,
+	events.KindLegacyVideo, events.KindLegacyShortVideo,
+	events.KindFileMetadata,
+}
+
+// LinkCheckTimeout bounds the request CheckURL makes.
+var LinkCheckTimeout = 20 * time.Second
+
+// DeadLink is a media URL of an event that could not be fetched.
+type DeadLink struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error"`
+}
+
+// FetchMediaEvents returns the media events of pubKey found on the relays,
+// newest first. Of addressable events only the latest version is kept.
+func FetchMediaEvents(ctx context.Context, pubKey string, relays []string) []*nostr.Event {
+	filter := nostr.Filter{Kinds: MediaKinds, Authors: []string{pubKey}}
+	latest := make(map[string]*nostr.Event)
+	for _, relayURL := range relays {
+		for _, event := range queryRelay(ctx, filter, relayURL) {
+			key := event.ID
+			if nostr.IsAddressableKind(event.Kind) {
+				key = fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.Tags.GetD())
+			}
+			if known, ok := latest[key]; !ok || event.CreatedAt > known.CreatedAt {
+				latest[key] = event
+			}
+		}
+	}
+
+	found := make([]*nostr.Event, 0, len(latest))
+	for _, event := range latest {
+		found = append(found, event)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].CreatedAt > found[j].CreatedAt
+	})
+	return found
+}
+
+// CheckURL reports whether the URL can be fetched. Servers that refuse HEAD
+// requests are asked for the first byte instead.
+func CheckURL(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, LinkCheckTimeout)
+	defer cancel()
+
+	status, err := requestStatus(ctx, http.MethodHead, url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = requestStatus(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	return nil
+}
+
+func requestStatus(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// CheckLinks checks the primary URL of every media of the event and returns
+// the ones that are dead.
+func CheckLinks(ctx context.Context, event *nostr.Event) []DeadLink {
+	var dead []DeadLink
+	for _, media := range eventMediaURLs(event) {
+		if err := CheckURL(ctx, media[0]); err != nil {
+			dead = append(dead, DeadLink{URL: media[0], SHA256: media[1], Error: err.Error()})
+		}
+	}
+	return dead
+}
+
+// eventMediaURLs returns the URL and hash of every media of the event.
+func eventMediaURLs(event *nostr.Event) [][2]string {
+	var media [][2]string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "imeta" {
+			media = append(media, [2]string{imeta.Field(tag, "url"), imeta.Field(tag, "x")})
+		}
+	}
+	if event.Kind == events.KindFileMetadata {
+		var hash string
+		if x := event.Tags.GetFirst([]string{"x", ""}); x != nil {
+			hash = x.Value()
+		}
+		if url := event.Tags.GetFirst([]string{"url", ""}); url != nil {
+			media = append(media, [2]string{url.Value(), hash})
+		}
+	}
+	return media
+}
+
+// IndexLocalFiles hashes every file under dir and returns their paths by
+// sha256, so that dead media can be found among local copies.
+func IndexLocalFiles(ctx context.Context, dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		hash, err := fileSHA256(ctx, path)
+		if err != nil {
+			return err
+		}
+		files[hash] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("indexing %s: %v", dir, err)
+	}
+	return files, nil
+}
+
+// Repair uploads the local copy, looked up by sha256 in files, of every dead
+// media of the event and returns a corrected copy of the event, with proof
+// of work already mined. The dead URLs are replaced, or with keepURL kept and
+// followed by the new URLs as fallbacks. It returns nil when none of the dead
+// media has a local copy.
+func (u *Uploader) Repair(ctx context.Context, event *nostr.Event, dead []DeadLink, files map[string]string, keepURL bool) (*nostr.Event, error) {
+	replace := func(ctx context.Context, url, hash string) (string, error) {
+		isDead := false
+		for _, link := range dead {
+			isDead = isDead || link.URL == url
+		}
+		path, ok := files[strings.ToLower(hash)]
+		if !isDead || !ok {
+			return "", nil
+		}
+		descriptor, err := u.upload(ctx, u.blossomServer(), path, strings.ToLower(hash))
+		if err != nil {
+			return "", fmt.Errorf("uploading %s: %v", path, err)
+		}
+		log.Printf("Re-uploaded %s as %s", path, descriptor.URL)
+		return descriptor.URL, nil
+	}
+
+	repaired, replaced, err := u.replaceMedia(ctx, event, replace, keepURL, false)
+	if err != nil || replaced == 0 {
+		return nil, err
+	}
+	return repaired, u.Pow(ctx, repaired)
+}
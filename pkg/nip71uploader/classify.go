@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Classification is the verdict of a classifier on a media file.
+type Classification struct {
+	// Sensitive media gets a NIP-36 content-warning tag.
+	Sensitive bool
+	// Reason is published in the content-warning tag, and may be empty.
+	Reason string
+}
+
+// ClassifyCommand returns a classifier for Uploader.Classify running an
+// external command, split on white space, with the path of the media file as its last argument,
+// and its MIME type in the NOSTRMEDIA_MIME environment variable. The first
+// line the command prints decides:
+//
+//	sfw                   the media is published as is
+//	nsfw [reason]         the event gets a content-warning tag
+//	reject [reason]       publishing is aborted
+//
+// A command failing or printing anything else also aborts publishing, so
+// that media is never published unlabeled when the classifier breaks.
+func ClassifyCommand(command string) (func(ctx context.Context, path, mimeType string) (Classification, error), error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty classifier command")
+	}
+	return func(ctx context.Context, path, mimeType string) (Classification, error) {
+		cmd := exec.CommandContext(ctx, args[0], append(args[1:], path)...)
+		cmd.Env = append(os.Environ(), "NOSTRMEDIA_MIME="+mimeType)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return Classification{}, fmt.Errorf("classifier failed: %v: %s", err, message)
+			}
+			return Classification{}, fmt.Errorf("classifier failed: %v", err)
+		}
+		return parseClassification(stdout.String())
+	}, nil
+}
+
+// parseClassification reads the verdict printed by a classifier command.
+func parseClassification(output string) (Classification, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	verdict, reason, _ := strings.Cut(strings.TrimSpace(line), " ")
+	reason = strings.TrimSpace(reason)
+	switch strings.ToLower(verdict) {
+	case "sfw":
+		return Classification{}, nil
+	case "nsfw":
+		return Classification{Sensitive: true, Reason: reason}, nil
+	case "reject":
+		if reason == "" {
+			return Classification{}, errors.New("classifier rejected the media")
+		}
+		return Classification{}, fmt.Errorf("classifier rejected the media: %s", reason)
+	default:
+		return Classification{}, fmt.Errorf("unexpected classifier output %q, expected sfw, nsfw or reject", line)
+	}
+}
+
+// classify runs Classify on the local copy of the media, if set.
+func (u *Uploader) classify(ctx context.Context, path string, info *MediaInfo) error {
+	if u.Classify == nil {
+		return nil
+	}
+	classification, err := u.Classify(ctx, path, info.MIME)
+	if err != nil {
+		return err
+	}
+	info.Sensitive = classification.Sensitive
+	info.ContentWarning = classification.Reason
+	return nil
+}
+
+// addContentWarning adds a NIP-36 content-warning tag to the event when
+// some of its media was classified as sensitive, with their reasons.
+func addContentWarning(event *nostr.Event, infos ...*MediaInfo) {
+	sensitive := false
+	var reasons []string
+	for _, info := range infos {
+		if !info.Sensitive {
+			continue
+		}
+		sensitive = true
+		if info.ContentWarning != "" && !slices.Contains(reasons, info.ContentWarning) {
+			reasons = append(reasons, info.ContentWarning)
+		}
+	}
+	if sensitive && event.Tags.GetFirst([]string{"content-warning"}) == nil {
+		event.Tags = append(event.Tags, nostr.Tag{"content-warning", strings.Join(reasons, ", ")})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ConfirmTimeout bounds the wait of ConfirmStored, and ConfirmInterval is
+// how often a relay that does not return the event yet is queried again.
+var (
+	ConfirmTimeout  = 30 * time.Second
+	ConfirmInterval = 3 * time.Second
+)
+
+// ConfirmStored queries every relay that accepted the event for its id,
+// until the relay returns it or ConfirmTimeout passes, and records in the
+// Confirmed field of each result whether it did. Some relays acknowledge
+// events and then drop them.
+func ConfirmStored(ctx context.Context, event *nostr.Event, results []PublishResult) {
+	ctx, cancel := context.WithTimeout(ctx, ConfirmTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range results {
+		if !results[i].OK {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			confirmed := queryUntilStored(ctx, event.ID, results[i].Relay)
+			if !confirmed {
+				log.Printf("Relay %s accepted the event but does not return it", results[i].Relay)
+			}
+			results[i].Confirmed = &confirmed
+		}()
+	}
+	wg.Wait()
+}
+
+// ConfirmedRelays returns the relays ConfirmStored found the event on.
+func ConfirmedRelays(results []PublishResult) []string {
+	var relays []string
+	for _, result := range results {
+		if result.Confirmed != nil && *result.Confirmed {
+			relays = append(relays, result.Relay)
+		}
+	}
+	return relays
+}
+
+// queryUntilStored polls the relay for the event until it is returned or
+// ctx is done, connecting again when the relay closes the connection.
+func queryUntilStored(ctx context.Context, id, relayURL string) bool {
+	filter := nostr.Filter{IDs: []string{id}}
+	var relay *nostr.Relay
+	defer func() {
+		if relay != nil {
+			relay.Close()
+		}
+	}()
+	for {
+		if relay != nil && !relay.IsConnected() {
+			relay.Close()
+			relay = nil
+		}
+		if relay == nil {
+			connectCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+			if connected, err := nostr.RelayConnect(connectCtx, relayURL); err == nil {
+				relay = connected
+			}
+			cancel()
+		}
+		if relay != nil {
+			queryCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+			events, err := relay.QuerySync(queryCtx, filter)
+			cancel()
+			if err == nil && slices.ContainsFunc(events, func(event *nostr.Event) bool { return event.ID == id }) {
+				return true
+			}
+		}
+		select {
+		case <-time.After(ConfirmInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
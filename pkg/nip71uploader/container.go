@@ -0,0 +1,579 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// VideoHeader describes the video stream of a file. Fields the container
+// does not tell are left zero.
+type VideoHeader struct {
+	// Width and Height are the size of the stored frames, before Rotation.
+	Width  int
+	Height int
+	// Duration is in seconds.
+	Duration float64
+	// Codec is the ffmpeg name of the codec, such as "h264" or "vp9".
+	Codec string
+	// Bitrate is in bits per second.
+	Bitrate   int64
+	FrameRate float64
+	// Rotation is the clockwise rotation, in degrees, players apply when
+	// displaying the video.
+	Rotation int
+	// Title is the title embedded in the container, if any.
+	Title string
+	// Language is the ISO 639-1 code of the language the audio stream is
+	// tagged with, if any. Only ffprobe reads it.
+	Language string
+}
+
+// DisplaySize returns the size of the video as players show it, with width
+// and height swapped when it is rotated a quarter turn, as videos recorded
+// holding a phone upright usually are.
+func (h *VideoHeader) DisplaySize() (int, int) {
+	if h.Rotation%180 == 90 {
+		return h.Height, h.Width
+	}
+	return h.Width, h.Height
+}
+
+// rotationDegrees normalizes a rotation to a multiple of 90 degrees from 0
+// to 270.
+func rotationDegrees(degrees float64) int {
+	quarters := int(math.Round(degrees / 90))
+	return (quarters%4 + 4) % 4 * 90
+}
+
+// ReadVideoHeader reads the dimensions and duration of an MP4, MOV, WebM or
+// MKV video from its container, without decoding it and without ffmpeg.
+func ReadVideoHeader(filePath string) (*VideoHeader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 12)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+
+	var header *VideoHeader
+	switch {
+	case bytes.Equal(magic[:4], []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		header, err = readMatroskaHeader(file, info.Size())
+	case string(magic[4:8]) == "ftyp" || string(magic[4:8]) == "moov" || string(magic[4:8]) == "wide" ||
+		string(magic[4:8]) == "mdat" || string(magic[4:8]) == "free":
+		header, err = readMP4Header(file, info.Size())
+	default:
+		return nil, errors.New("unsupported video container")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	if header.Width == 0 || header.Height == 0 {
+		return nil, fmt.Errorf("reading %s: no video track found", filePath)
+	}
+	return header, nil
+}
+
+// containerMIME returns the MIME type of an MP4, QuickTime, WebM or Matroska
+// file from its header: the major brand of the ftyp box, or the EBML
+// DocType. It returns "" for other files.
+func containerMIME(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+
+	magic := make([]byte, 12)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return ""
+	}
+	switch {
+	case bytes.Equal(magic[:4], []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return matroskaMIME(file, info.Size())
+	case string(magic[4:8]) == "ftyp":
+		switch string(magic[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ", "M4B ":
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case string(magic[4:8]) == "moov" || string(magic[4:8]) == "wide" || string(magic[4:8]) == "mdat":
+		// only QuickTime files may lack a ftyp box
+		return "video/quicktime"
+	}
+	return ""
+}
+
+// matroskaMIME returns video/webm or video/x-matroska from the DocType of
+// the EBML header.
+func matroskaMIME(r io.ReaderAt, size int64) string {
+	top, err := ebmlElements(r, 0, min(size, 1<<16))
+	if err != nil || len(top) == 0 || top[0].id != ebmlHeader {
+		return ""
+	}
+	fields, err := ebmlElements(r, top[0].start, top[0].end)
+	if err != nil {
+		return ""
+	}
+	for _, field := range fields {
+		if field.id != ebmlDocType || field.end-field.start > 64 {
+			continue
+		}
+		docType := make([]byte, field.end-field.start)
+		if _, err := r.ReadAt(docType, field.start); err != nil {
+			return ""
+		}
+		if string(bytes.TrimRight(docType, "\x00")) == "webm" {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	}
+	return ""
+}
+
+// mp4Box is an ISO base media file format box.
+type mp4Box struct {
+	kind  string
+	start int64 // offset of the payload
+	end   int64
+}
+
+// mp4Boxes lists the boxes between start and end.
+func mp4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	buf := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(buf[:8], pos); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(buf))
+		box := mp4Box{kind: string(buf[4:8]), start: pos + 8}
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(buf[8:16], pos+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(buf[8:16]))
+			box.start += 8
+		}
+		// a 64 bit size may be large enough to overflow pos+size
+		if size < box.start-pos || size > end-pos {
+			return nil, fmt.Errorf("malformed %q box", box.kind)
+		}
+		box.end = pos + size
+		boxes = append(boxes, box)
+		pos += size
+	}
+	return boxes, nil
+}
+
+// readBox reads the payload of a small box.
+func readBox(r io.ReaderAt, box mp4Box) ([]byte, error) {
+	if box.end-box.start > 1<<20 {
+		return nil, fmt.Errorf("%q box too large", box.kind)
+	}
+	data := make([]byte, box.end-box.start)
+	_, err := r.ReadAt(data, box.start)
+	return data, err
+}
+
+func readMP4Header(r io.ReaderAt, size int64) (*VideoHeader, error) {
+	boxes, err := mp4Boxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	header := &VideoHeader{}
+	for _, box := range boxes {
+		if box.kind != "moov" {
+			continue
+		}
+		children, err := mp4Boxes(r, box.start, box.end)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			switch child.kind {
+			case "mvhd":
+				data, err := readBox(r, child)
+				if err != nil {
+					return nil, err
+				}
+				header.Duration = mvhdDuration(data)
+			case "trak":
+				track, err := mp4VideoTrack(r, child)
+				if err != nil {
+					return nil, err
+				}
+				if track != nil && track.Width > 0 && header.Width == 0 {
+					header.Width, header.Height = track.Width, track.Height
+					header.Rotation = track.Rotation
+				}
+			}
+		}
+	}
+	return header, nil
+}
+
+// mvhdDuration returns the duration in seconds of a movie header.
+func mvhdDuration(data []byte) float64 {
+	var timescale, duration uint64
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	case len(data) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return float64(duration) / float64(timescale)
+}
+
+// mp4VideoTrack returns the size and rotation of a track, or nil when it is
+// not a video track.
+func mp4VideoTrack(r io.ReaderAt, trak mp4Box) (*VideoHeader, error) {
+	children, err := mp4Boxes(r, trak.start, trak.end)
+	if err != nil {
+		return nil, err
+	}
+	var tkhd []byte
+	video := false
+	for _, child := range children {
+		switch child.kind {
+		case "tkhd":
+			if tkhd, err = readBox(r, child); err != nil {
+				return nil, err
+			}
+		case "mdia":
+			mdia, err := mp4Boxes(r, child.start, child.end)
+			if err != nil {
+				return nil, err
+			}
+			for _, box := range mdia {
+				if box.kind != "hdlr" {
+					continue
+				}
+				hdlr, err := readBox(r, box)
+				if err != nil {
+					return nil, err
+				}
+				video = len(hdlr) >= 12 && string(hdlr[8:12]) == "vide"
+			}
+		}
+	}
+	if !video || tkhd == nil {
+		return nil, nil
+	}
+
+	// the version dependent times are followed by the layer, volume, the
+	// display matrix and the size
+	offset := 4 + 20 + 16
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		offset = 4 + 32 + 16
+	}
+	if len(tkhd) < offset+36+8 {
+		return nil, errors.New("truncated tkhd box")
+	}
+	// the first two entries of the 16.16 fixed point matrix are the cosine
+	// and sine of the clockwise rotation
+	cos := float64(int32(binary.BigEndian.Uint32(tkhd[offset:])))
+	sin := float64(int32(binary.BigEndian.Uint32(tkhd[offset+4:])))
+	return &VideoHeader{
+		Width:    int(binary.BigEndian.Uint32(tkhd[offset+36:]) >> 16),
+		Height:   int(binary.BigEndian.Uint32(tkhd[offset+40:]) >> 16),
+		Rotation: rotationDegrees(math.Atan2(sin, cos) * 180 / math.Pi),
+	}, nil
+}
+
+// Matroska element IDs used to find the video size and duration
+const (
+	ebmlHeader           = 0x1a45dfa3
+	ebmlDocType          = 0x4282
+	ebmlSegment          = 0x18538067
+	ebmlInfo             = 0x1549a966
+	ebmlTimestampScale   = 0x2ad7b1
+	ebmlDuration         = 0x4489
+	ebmlTitle            = 0x7ba9
+	ebmlTracks           = 0x1654ae6b
+	ebmlTrackEntry       = 0xae
+	ebmlTrackType        = 0x83
+	ebmlVideo            = 0xe0
+	ebmlPixelWidth       = 0xb0
+	ebmlPixelHeight      = 0xba
+	ebmlProjection       = 0x7670
+	ebmlProjectionRoll   = 0x7675
+	ebmlCluster          = 0x1f43b675
+	matroskaVideoTrack   = 1
+	matroskaDefaultScale = 1000000
+)
+
+// ebmlElement is an element of a Matroska or WebM file.
+type ebmlElement struct {
+	id    uint64
+	start int64 // offset of the data
+	end   int64
+}
+
+// readVint reads an EBML variable size integer, keeping the length marker
+// for IDs. It also returns its length and whether it is the reserved
+// "unknown size" value.
+func readVint(r io.ReaderAt, pos int64, keepMarker bool) (uint64, int, bool, error) {
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf[:1], pos); err != nil {
+		return 0, 0, false, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, false, errors.New("invalid EBML integer")
+	}
+	if _, err := r.ReadAt(buf[1:length], pos+1); err != nil {
+		return 0, 0, false, err
+	}
+
+	value := uint64(buf[0])
+	if !keepMarker {
+		value &= uint64(0xff >> length)
+	}
+	unknown := value == uint64(0xff>>length)
+	for _, b := range buf[1:length] {
+		value = value<<8 | uint64(b)
+		unknown = unknown && b == 0xff
+	}
+	return value, length, unknown, nil
+}
+
+// ebmlElements lists the elements between start and end. Elements of
+// unknown size extend to end.
+func ebmlElements(r io.ReaderAt, start, end int64) ([]ebmlElement, error) {
+	var elements []ebmlElement
+	for pos := start; pos < end; {
+		id, idLength, _, err := readVint(r, pos, true)
+		if err != nil {
+			return nil, err
+		}
+		size, sizeLength, unknown, err := readVint(r, pos+int64(idLength), false)
+		if err != nil {
+			return nil, err
+		}
+		element := ebmlElement{id: id, start: pos + int64(idLength+sizeLength)}
+		if element.start > end {
+			return nil, errors.New("truncated EBML element")
+		}
+		element.end = element.start + int64(size)
+		if unknown || size > uint64(end-element.start) {
+			element.end = end
+		}
+		elements = append(elements, element)
+		if id == ebmlCluster {
+			// the media data follows, the headers come before it
+			break
+		}
+		pos = element.end
+	}
+	return elements, nil
+}
+
+// ebmlData reads the data of a small element.
+func ebmlData(r io.ReaderAt, element ebmlElement) ([]byte, error) {
+	if element.end-element.start > 8 {
+		return nil, errors.New("EBML number too long")
+	}
+	data := make([]byte, element.end-element.start)
+	_, err := r.ReadAt(data, element.start)
+	return data, err
+}
+
+// maxEBMLString is the longest string element read, longer ones being
+// truncated.
+const maxEBMLString = 4 << 10
+
+// ebmlString reads the data of a string element, up to maxEBMLString bytes.
+func ebmlString(r io.ReaderAt, element ebmlElement) (string, error) {
+	data := make([]byte, min(element.end-element.start, maxEBMLString))
+	if _, err := r.ReadAt(data, element.start); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\x00"), nil
+}
+
+func ebmlUint(r io.ReaderAt, element ebmlElement) (uint64, error) {
+	data, err := ebmlData(r, element)
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value, err
+}
+
+func ebmlFloat(r io.ReaderAt, element ebmlElement) (float64, error) {
+	data, err := ebmlData(r, element)
+	if err != nil {
+		return 0, err
+	}
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+	return 0, nil
+}
+
+func readMatroskaHeader(r io.ReaderAt, size int64) (*VideoHeader, error) {
+	top, err := ebmlElements(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	header := &VideoHeader{}
+	for _, segment := range top {
+		if segment.id != ebmlSegment {
+			continue
+		}
+		children, err := ebmlElements(r, segment.start, segment.end)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			switch child.id {
+			case ebmlInfo:
+				if header.Duration, header.Title, err = matroskaInfo(r, child); err != nil {
+					return nil, err
+				}
+			case ebmlTracks:
+				track, err := matroskaVideo(r, child)
+				if err != nil {
+					return nil, err
+				}
+				if track != nil {
+					header.Width, header.Height = track.Width, track.Height
+					header.Rotation = track.Rotation
+				}
+			}
+		}
+	}
+	return header, nil
+}
+
+// matroskaInfo returns the duration in seconds and the title of a segment.
+func matroskaInfo(r io.ReaderAt, info ebmlElement) (float64, string, error) {
+	elements, err := ebmlElements(r, info.start, info.end)
+	if err != nil {
+		return 0, "", err
+	}
+	scale := uint64(matroskaDefaultScale)
+	var duration float64
+	var title string
+	for _, element := range elements {
+		switch element.id {
+		case ebmlTimestampScale:
+			if scale, err = ebmlUint(r, element); err != nil {
+				return 0, "", err
+			}
+		case ebmlDuration:
+			if duration, err = ebmlFloat(r, element); err != nil {
+				return 0, "", err
+			}
+		case ebmlTitle:
+			if title, err = ebmlString(r, element); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+	return duration * float64(scale) / 1e9, title, nil
+}
+
+// matroskaVideo returns the size and rotation of the first video track,
+// or nil when there is none.
+func matroskaVideo(r io.ReaderAt, tracks ebmlElement) (*VideoHeader, error) {
+	entries, err := ebmlElements(r, tracks.start, tracks.end)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.id != ebmlTrackEntry {
+			continue
+		}
+		fields, err := ebmlElements(r, entry.start, entry.end)
+		if err != nil {
+			return nil, err
+		}
+		var trackType, width, height uint64
+		var roll float64
+		for _, field := range fields {
+			switch field.id {
+			case ebmlTrackType:
+				if trackType, err = ebmlUint(r, field); err != nil {
+					return nil, err
+				}
+			case ebmlVideo:
+				video, err := ebmlElements(r, field.start, field.end)
+				if err != nil {
+					return nil, err
+				}
+				for _, element := range video {
+					switch element.id {
+					case ebmlPixelWidth:
+						width, err = ebmlUint(r, element)
+					case ebmlPixelHeight:
+						height, err = ebmlUint(r, element)
+					case ebmlProjection:
+						roll, err = matroskaRoll(r, element)
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if trackType == matroskaVideoTrack && width > 0 {
+			// the roll is counterclockwise
+			return &VideoHeader{Width: int(width), Height: int(height), Rotation: rotationDegrees(-roll)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// matroskaRoll returns the roll, in degrees, of a video projection.
+func matroskaRoll(r io.ReaderAt, projection ebmlElement) (float64, error) {
+	elements, err := ebmlElements(r, projection.start, projection.end)
+	if err != nil {
+		return 0, err
+	}
+	for _, element := range elements {
+		if element.id == ebmlProjectionRoll {
+			return ebmlFloat(r, element)
+		}
+	}
+	return 0, nil
+}
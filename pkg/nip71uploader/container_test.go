@@ -0,0 +1,284 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isoBox returns an MP4 box with a 32 bit size.
+func isoBox(kind string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(8+len(data))), append([]byte(kind), data...)...)
+}
+
+// largeBox returns an MP4 box with a 64 bit size, as written for boxes
+// larger than 4 GiB.
+func largeBox(kind string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := append(binary.BigEndian.AppendUint32(nil, 1), kind...)
+	box = binary.BigEndian.AppendUint64(box, uint64(16+len(data)))
+	return append(box, data...)
+}
+
+func u32s(values ...uint32) []byte {
+	var data []byte
+	for _, v := range values {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return data
+}
+
+// tkhdBox returns a track header of the given version with the display
+// matrix a, b, c, d and the size in pixels.
+func tkhdBox(version byte, a, b, c, d int32, width, height uint32) []byte {
+	// version, flags, the version dependent times and duration, the track id
+	times := make([]byte, 24)
+	if version == 1 {
+		times = make([]byte, 36)
+	}
+	times[0] = version
+	payload := append(times, make([]byte, 16)...)
+	payload = append(payload, u32s(uint32(a), uint32(b), 0, uint32(c), uint32(d), 0, 0, 0, 0x40000000)...)
+	payload = append(payload, u32s(width<<16, height<<16)...)
+	return isoBox("tkhd", payload)
+}
+
+func trakBox(tkhd []byte, handler string) []byte {
+	hdlr := append(u32s(0, 0), append([]byte(handler), make([]byte, 13)...)...)
+	return isoBox("trak", tkhd, isoBox("mdia", isoBox("hdlr", hdlr)))
+}
+
+func TestReadMP4Header(t *testing.T) {
+	ftyp := isoBox("ftyp", []byte("isom"), u32s(0x200), []byte("isomavc1"))
+	// version 0: flags, times, timescale and duration
+	mvhd0 := isoBox("mvhd", u32s(0, 0, 0, 1000, 12500), make([]byte, 80))
+	// version 1: 64 bit times and duration
+	mvhd1 := isoBox("mvhd", []byte{1, 0, 0, 0}, make([]byte, 16), u32s(90000, 0, 90000*3), make([]byte, 80))
+	audio := trakBox(tkhdBox(0, 0x10000, 0, 0, 0x10000, 0, 0), "soun")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     VideoHeader
+		wantSize [2]int
+	}{
+		{
+			"tkhd version 0",
+			bytes.Join([][]byte{ftyp, isoBox("moov", mvhd0, trakBox(tkhdBox(0, 0x10000, 0, 0, 0x10000, 1280, 720), "vide"))}, nil),
+			VideoHeader{Width: 1280, Height: 720, Duration: 12.5},
+			[2]int{1280, 720},
+		},
+		{
+			"tkhd version 1 rotated 90 degrees",
+			bytes.Join([][]byte{ftyp, isoBox("moov", mvhd1, audio, trakBox(tkhdBox(1, 0, 0x10000, -0x10000, 0, 1920, 1080), "vide"))}, nil),
+			VideoHeader{Width: 1920, Height: 1080, Duration: 3, Rotation: 90},
+			[2]int{1080, 1920},
+		},
+		{
+			"rotated 180 degrees",
+			bytes.Join([][]byte{ftyp, isoBox("moov", mvhd0, trakBox(tkhdBox(0, -0x10000, 0, 0, -0x10000, 640, 480), "vide"))}, nil),
+			VideoHeader{Width: 640, Height: 480, Duration: 12.5, Rotation: 180},
+			[2]int{640, 480},
+		},
+		{
+			"rotated 270 degrees",
+			bytes.Join([][]byte{ftyp, isoBox("moov", mvhd0, trakBox(tkhdBox(0, 0, -0x10000, 0x10000, 0, 640, 480), "vide"))}, nil),
+			VideoHeader{Width: 640, Height: 480, Duration: 12.5, Rotation: 270},
+			[2]int{480, 640},
+		},
+		{
+			"64 bit sizes and a last box up to the end",
+			bytes.Join([][]byte{ftyp, largeBox("moov", mvhd0, largeBox("trak", tkhdBox(0, 0x10000, 0, 0, 0x10000, 320, 240), isoBox("mdia", isoBox("hdlr", u32s(0, 0), []byte("vide"))))),
+				{0, 0, 0, 0}, []byte("mdat"), make([]byte, 100)}, nil),
+			VideoHeader{Width: 320, Height: 240, Duration: 12.5},
+			[2]int{320, 240},
+		},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "video.mp4")
+		if err := os.WriteFile(path, test.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		header, err := ReadVideoHeader(path)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *header != test.want {
+			t.Errorf("%s: header %+v, want %+v", test.name, *header, test.want)
+		}
+		if width, height := header.DisplaySize(); width != test.wantSize[0] || height != test.wantSize[1] {
+			t.Errorf("%s: display size %dx%d, want %dx%d", test.name, width, height, test.wantSize[0], test.wantSize[1])
+		}
+	}
+}
+
+func TestReadMP4HeaderMalformed(t *testing.T) {
+	ftyp := isoBox("ftyp", []byte("isom"), u32s(0x200))
+	video := trakBox(tkhdBox(0, 0x10000, 0, 0, 0x10000, 1280, 720), "vide")
+	withSize := func(box []byte, size uint32) []byte {
+		box = bytes.Clone(box)
+		binary.BigEndian.PutUint32(box, size)
+		return box
+	}
+	with64BitSize := func(box []byte, size uint64) []byte {
+		box = bytes.Clone(box)
+		binary.BigEndian.PutUint64(box[8:], size)
+		return box
+	}
+	moov := isoBox("moov", video)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"box smaller than its header", append(ftyp, withSize(moov, 4)...)},
+		{"box past the end", append(ftyp, withSize(moov, uint32(len(moov)+1))...)},
+		{"64 bit size cut", append(ftyp, 0, 0, 0, 1, 'm', 'o', 'o', 'v', 0, 0)},
+		{"64 bit size smaller than its header", append(ftyp, with64BitSize(largeBox("moov", video), 12)...)},
+		{"64 bit size past the end", append(ftyp, with64BitSize(largeBox("moov", video), 1<<40)...)},
+		{"64 bit size overflowing", append(ftyp, with64BitSize(largeBox("moov", video), math.MaxInt64)...)},
+		{"64 bit size negative", append(ftyp, with64BitSize(largeBox("moov", video), math.MaxUint64)...)},
+		{"child past its parent", append(ftyp, isoBox("moov", withSize(video, uint32(len(video)+9)), make([]byte, 8))...)},
+		{"truncated tkhd", append(ftyp, isoBox("moov", trakBox(isoBox("tkhd", make([]byte, 40)), "vide"))...)},
+		{"no video track", append(ftyp, isoBox("moov", trakBox(tkhdBox(0, 0x10000, 0, 0, 0x10000, 0, 0), "soun"))...)},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "video.mp4")
+		if err := os.WriteFile(path, test.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if header, err := ReadVideoHeader(path); err == nil {
+			t.Errorf("%s: header %+v, want an error", test.name, *header)
+		}
+	}
+}
+
+// ebml returns a Matroska element with an 8 byte size.
+func ebml(id uint64, payload ...[]byte) []byte {
+	var element []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(element) > 0 {
+			element = append(element, b)
+		}
+	}
+	data := bytes.Join(payload, nil)
+	element = binary.BigEndian.AppendUint64(element, uint64(len(data))|1<<56)
+	return append(element, data...)
+}
+
+// ebmlUnknown returns a Matroska element of unknown size, as written by
+// live encoders for the segment.
+func ebmlUnknown(id uint64, payload ...[]byte) []byte {
+	element := ebml(id)
+	copy(element[len(element)-8:], []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	return append(element, bytes.Join(payload, nil)...)
+}
+
+func ebmlUintData(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func ebmlFloatData(v float64) []byte { return binary.BigEndian.AppendUint64(nil, math.Float64bits(v)) }
+
+// matroskaFile returns a file with the DocType, an audio and a video track
+// of 640x360 with a roll of -90 degrees, and a duration of 5s.
+func matroskaFile(docType string) []byte {
+	roll := binary.BigEndian.AppendUint32(nil, math.Float32bits(-90))
+	return append(ebml(ebmlHeader, ebml(ebmlDocType, []byte(docType))),
+		ebmlUnknown(ebmlSegment,
+			ebml(ebmlInfo,
+				ebml(ebmlTimestampScale, ebmlUintData(1000000)),
+				ebml(ebmlDuration, ebmlFloatData(5000)),
+				ebml(ebmlTitle, []byte("A longer clip title"))),
+			ebml(ebmlTracks,
+				ebml(ebmlTrackEntry, ebml(ebmlTrackType, []byte{2})),
+				ebml(ebmlTrackEntry,
+					ebml(ebmlTrackType, []byte{matroskaVideoTrack}),
+					ebml(ebmlVideo,
+						ebml(ebmlPixelWidth, []byte{0x02, 0x80}),
+						ebml(ebmlPixelHeight, []byte{0x01, 0x68}),
+						ebml(ebmlProjection, ebml(ebmlProjectionRoll, roll))))),
+			ebmlUnknown(ebmlCluster, make([]byte, 32)))...)
+}
+
+func TestReadMatroskaHeader(t *testing.T) {
+	for docType, mime := range map[string]string{"webm": "video/webm", "matroska": "video/x-matroska"} {
+		path := filepath.Join(t.TempDir(), "video."+docType)
+		if err := os.WriteFile(path, matroskaFile(docType), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		header, err := ReadVideoHeader(path)
+		if err != nil {
+			t.Fatalf("%s: %v", docType, err)
+		}
+		want := VideoHeader{Width: 640, Height: 360, Duration: 5, Rotation: 90, Title: "A longer clip title"}
+		if *header != want {
+			t.Errorf("%s: header %+v, want %+v", docType, *header, want)
+		}
+		if got := containerMIME(path); got != mime {
+			t.Errorf("%s: MIME type %s, want %s", docType, got, mime)
+		}
+	}
+}
+
+func TestReadMatroskaHeaderMalformed(t *testing.T) {
+	file := matroskaFile("webm")
+	tracks := bytes.Index(file, ebml(ebmlTracks)[:4])
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"cut in an element ID", file[:tracks+2]},
+		{"cut in an element size", file[:tracks+6]},
+		{"invalid integer", append(bytes.Clone(file[:tracks]), 0x00, 0x00, 0x00, 0x00)},
+		{"element header past its parent", append(ebml(ebmlHeader), ebml(ebmlSegment, []byte{0x44})...)},
+		{"number too long", append(ebml(ebmlHeader), ebml(ebmlSegment, ebml(ebmlTracks, ebml(ebmlTrackEntry, ebml(ebmlTrackType, make([]byte, 9)))))...)},
+		{"overflowing size", append(ebml(ebmlHeader), ebml(ebmlSegment, ebml(ebmlInfo, []byte{0x44, 0x89, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 0, 0, 0, 0, 0, 0, 0, 0, 0}))...)},
+		{"no video track", append(ebml(ebmlHeader), ebml(ebmlSegment, ebml(ebmlTracks, ebml(ebmlTrackEntry, ebml(ebmlTrackType, []byte{2}))))...)},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "video.webm")
+		if err := os.WriteFile(path, test.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if header, err := ReadVideoHeader(path); err == nil {
+			t.Errorf("%s: header %+v, want an error", test.name, *header)
+		}
+	}
+
+	// the DocType ID ends the EBML header, its size running into the segment
+	header := append([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x82, 0x42, 0x82}, ebml(ebmlSegment)...)
+	if _, err := ebmlElements(bytes.NewReader(header), 5, 7); err == nil {
+		t.Error("listed an element whose header runs past its parent")
+	}
+	if mime := matroskaMIME(bytes.NewReader(header), int64(len(header))); mime != "" {
+		t.Errorf("MIME type %q of a malformed header", mime)
+	}
+}
+
+func TestContainerMIME(t *testing.T) {
+	for data, want := range map[string]string{
+		string(isoBox("ftyp", []byte("isom"))):     "video/mp4",
+		string(isoBox("ftyp", []byte("qt  "))):     "video/quicktime",
+		string(isoBox("ftyp", []byte("M4A "))):     "audio/mp4",
+		string(isoBox("moov", make([]byte, 8))):    "video/quicktime",
+		string(isoBox("free", make([]byte, 8))):    "",
+		"\x1a\x45\xdf\xa3\x00\x00\x00\x00\x00\x00": "",
+		"not a video at all":                       "",
+	} {
+		path := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := containerMIME(path); got != want {
+			t.Errorf("containerMIME(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// MediaRecord is what is known locally about a blob.
+type MediaRecord struct {
+	SHA256 string `json:"sha256"`
+	// URLs are where the blob was uploaded.
+	URLs []string `json:"urls,omitempty"`
+	// Events are the events that published the blob.
+	Events []PublishedMedia `json:"events,omitempty"`
+}
+
+// PublishedMedia is an event that published a blob.
+type PublishedMedia struct {
+	ID          string   `json:"id"`
+	PubKey      string   `json:"pubkey"`
+	Kind        int      `json:"kind"`
+	PublishedAt int64    `json:"published_at,omitempty"`
+	Relays      []string `json:"relays,omitempty"`
+}
+
+// Nevent returns the NIP-19 nevent of the event, with its relays as hints.
+func (p PublishedMedia) Nevent() string {
+	nevent, _ := nip19.EncodeEvent(p.ID, p.Relays, p.PubKey)
+	return nevent
+}
+
+// MediaIndex remembers, by sha256, where blobs were uploaded and which
+// events published them, so that publishing the same file again reuses its
+// URL and is caught as a duplicate.
+type MediaIndex interface {
+	// Media returns the record of the blob with the given sha256.
+	Media(sha256 string) (*MediaRecord, bool)
+	// SaveUpload records that the blob was uploaded to url.
+	SaveUpload(sha256, url string)
+	// SavePublished records an event publishing the blobs.
+	SavePublished(hashes []string, event PublishedMedia)
+}
+
+// AlreadyPublishedError is returned when building an event for media the
+// same key already published, unless Force is set.
+type AlreadyPublishedError struct {
+	SHA256 string
+	Event  PublishedMedia
+}
+
+func (e *AlreadyPublishedError) Error() string {
+	return fmt.Sprintf("%s was already published in %s", e.SHA256, e.Event.Nevent())
+}
+
+// indexedURL returns a URL on the Blossom server the blob was already
+// uploaded to and that still serves it.
+func (u *Uploader) indexedURL(ctx context.Context, blossom, sha256Hash string) (string, bool) {
+	if u.MediaIndex == nil {
+		return "", false
+	}
+	record, ok := u.MediaIndex.Media(sha256Hash)
+	if !ok {
+		return "", false
+	}
+	for _, url := range record.URLs {
+		if !strings.HasPrefix(url, strings.TrimSuffix(blossom, "/")+"/") {
+			continue
+		}
+		if err := CheckURL(ctx, url); err != nil {
+			log.Printf("Uploading %s again, %s is gone: %v", sha256Hash, url, err)
+			continue
+		}
+		return url, true
+	}
+	return "", false
+}
+
+// checkDuplicate fails when the signer already published the blob, unless
+// Force or UpdateExisting is set.
+func (u *Uploader) checkDuplicate(ctx context.Context, sha256Hash string) error {
+	if u.MediaIndex == nil || u.Force || u.UpdateExisting {
+		return nil
+	}
+	record, ok := u.MediaIndex.Media(sha256Hash)
+	if !ok || len(record.Events) == 0 {
+		return nil
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+	for _, event := range record.Events {
+		if event.PubKey == pubKey {
+			return &AlreadyPublishedError{SHA256: sha256Hash, Event: event}
+		}
+	}
+	return nil
+}
+
+// indexPublished records the media of an event accepted by relays.
+func (u *Uploader) indexPublished(event *nostr.Event, relays []string) {
+	if u.MediaIndex == nil || len(relays) == 0 {
+		return
+	}
+	var hashes []string
+	for _, media := range eventMediaURLs(event) {
+		if media[1] != "" {
+			hashes = append(hashes, strings.ToLower(media[1]))
+		}
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	published := PublishedMedia{ID: event.ID, PubKey: event.PubKey, Kind: event.Kind, Relays: relays}
+	if tag := event.Tags.GetFirst([]string{"published_at", ""}); tag != nil {
+		published.PublishedAt, _ = strconv.ParseInt(tag.Value(), 10, 64)
+	}
+	u.MediaIndex.SavePublished(hashes, published)
+}
+
+// findPublished returns the newest event pubKey published with one of the
+// blobs, looked up through MediaIndex, then among the media events of
+// pubKey on the relays, or nil.
+func (u *Uploader) findPublished(ctx context.Context, pubKey string, hashes []string) *nostr.Event {
+	if u.MediaIndex != nil {
+		for _, hash := range hashes {
+			record, ok := u.MediaIndex.Media(hash)
+			if !ok {
+				continue
+			}
+			for i := len(record.Events) - 1; i >= 0; i-- {
+				published := record.Events[i]
+				if published.PubKey != pubKey {
+					continue
+				}
+				event, err := FetchEvent(ctx, published.ID, slices.Concat(published.Relays, u.Relays))
+				if err != nil {
+					log.Printf("Error fetching event %s: %v", published.ID, err)
+					continue
+				}
+				return event
+			}
+		}
+	}
+	for _, event := range FetchMediaEvents(ctx, pubKey, u.Relays) {
+		for _, media := range eventMediaURLs(event) {
+			if slices.Contains(hashes, strings.ToLower(media[1])) {
+				return event
+			}
+		}
+	}
+	return nil
+}
+
+// updateExisting turns the event into an update of the event the signer
+// published already with the same media, for UpdateExisting. Addressable
+// events of the same kind replace it; others are published next to it.
+func (u *Uploader) updateExisting(ctx context.Context, event *nostr.Event) error {
+	var hashes []string
+	for _, media := range eventMediaURLs(event) {
+		if media[1] != "" {
+			hashes = append(hashes, strings.ToLower(media[1]))
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("getting public key: %v", err)
+	}
+	existing := u.findPublished(ctx, pubKey, hashes)
+	if existing == nil {
+		return nil
+	}
+	if err := MergeExisting(existing, event); err != nil {
+		return err
+	}
+	if nostr.IsAddressableKind(event.Kind) && existing.Kind == event.Kind {
+		log.Printf("Updating event %s, which published the same media", existing.ID)
+	} else {
+		log.Printf("Keeping the metadata of event %s, which published the same media and stays on the relays until deleted", existing.ID)
+	}
+	return nil
+}
+
+// MergeExisting keeps in event, built for media already published, the
+// metadata of the existing event: its title, description, published_at and
+// hashtags, and the URLs of the same media, which become fallbacks. An
+// addressable event of the same kind gets its d tag, so that it replaces it.
+func MergeExisting(existing, event *nostr.Event) error {
+	if nostr.IsAddressableKind(event.Kind) && existing.Kind == event.Kind {
+		setTag(event, "d", existing.Tags.GetD())
+	}
+	for _, name := range []string{"title", "summary", "published_at"} {
+		if value := firstTagValue(existing.Tags, name); value != "" {
+			setTag(event, name, value)
+		}
+	}
+	if existing.Content != "" {
+		event.Content = existing.Content
+	}
+	for _, hashtag := range tagValues(existing.Tags, "t") {
+		if !event.Tags.ContainsAny("t", []string{hashtag}) {
+			event.Tags = append(event.Tags, nostr.Tag{"t", hashtag})
+		}
+	}
+
+	// the URLs the existing event had for each blob
+	urls := make(map[string][]string)
+	for _, tag := range existing.Tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+		media, err := imeta.Parse(tag)
+		if err != nil || media.Hash == "" {
+			continue
+		}
+		hash := strings.ToLower(media.Hash)
+		urls[hash] = append(urls[hash], append([]string{media.URL}, media.Fallbacks...)...)
+	}
+	if existing.Kind == events.KindFileMetadata {
+		hash := strings.ToLower(firstTagValue(existing.Tags, "x"))
+		urls[hash] = append(urls[hash], append(tagValues(existing.Tags, "url"), tagValues(existing.Tags, "fallback")...)...)
+	}
+
+	for i, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+		media, err := imeta.Parse(tag)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls[strings.ToLower(media.Hash)] {
+			if url != "" && url != media.URL && !slices.Contains(media.Fallbacks, url) {
+				media.Fallbacks = append(media.Fallbacks, url)
+			}
+		}
+		if event.Tags[i], err = media.Format(); err != nil {
+			return err
+		}
+	}
+	if event.Kind == events.KindFileMetadata {
+		primary := firstTagValue(event.Tags, "url")
+		for _, url := range urls[strings.ToLower(firstTagValue(event.Tags, "x"))] {
+			if url != "" && url != primary && !slices.Contains(tagValues(event.Tags, "fallback"), url) {
+				event.Tags = append(event.Tags, nostr.Tag{"fallback", url})
+			}
+		}
+	}
+	return nil
+}
+
+// setTag sets the value of the first tag with the name, adding one when the
+// event has none.
+func setTag(event *nostr.Event, name, value string) {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			tag[1] = value
+			return
+		}
+	}
+	event.Tags = append(event.Tags, nostr.Tag{name, value})
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip17"
+)
+
+// FetchDMRelays looks up the newest NIP-17 DM relay list (kind 10050) of
+// pubKey on the relays and returns the relays it lists, or nil.
+func FetchDMRelays(ctx context.Context, pubKey string, relays []string) []string {
+	event := FetchLatestEvent(ctx, nostr.Filter{
+		Kinds:   []int{nostr.KindDMRelayList},
+		Authors: []string{pubKey},
+		Limit:   1,
+	}, relays)
+	if event == nil {
+		return nil
+	}
+	var dmRelays []string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "relay" && nostr.IsValidRelayURL(tag[1]) {
+			dmRelays = append(dmRelays, nostr.NormalizeURL(tag[1]))
+		}
+	}
+	return dmRelays
+}
+
+// PublishedMessage is the direct message telling collaborators about a
+// published event.
+func PublishedMessage(event *nostr.Event, relays []string) (string, error) {
+	nevent, naddr, err := EncodeEvent(event, relays)
+	if err != nil {
+		return "", err
+	}
+	reference := nevent
+	if naddr != "" {
+		reference = naddr
+	}
+	if title := event.Tags.GetFirst([]string{"title", ""}); title != nil && title.Value() != "" {
+		return fmt.Sprintf("Published %q\nnostr:%s", title.Value(), reference), nil
+	}
+	return "Published nostr:" + reference, nil
+}
+
+// SendDirectMessage sends content to recipient as a NIP-17 direct message,
+// gift wrapped by signer. The message goes to the DM relays of the recipient
+// found on lookup (DefaultIndexerRelays when empty) and relays, or to relays
+// when they have none, and a copy wrapped for the sender goes to relays. It
+// fails when no relay accepted the message for the recipient.
+func SendDirectMessage(ctx context.Context, signer nostr.Keyer, recipient, content string, relays, lookup []string) error {
+	toUs, toThem, err := nip17.PrepareMessage(ctx, content, nil, signer, recipient, nil)
+	if err != nil {
+		return fmt.Errorf("wrapping message: %v", err)
+	}
+	if len(lookup) == 0 {
+		lookup = DefaultIndexerRelays
+	}
+	theirRelays := FetchDMRelays(ctx, recipient, slices.Concat(lookup, relays))
+	if len(theirRelays) == 0 {
+		theirRelays = relays
+	}
+	results := PublishEvent(ctx, &toThem, signer, theirRelays)
+	if len(AcceptedRelays(results)) == 0 {
+		return fmt.Errorf("no relay accepted the message: %s", firstError(results))
+	}
+	PublishEvent(ctx, &toUs, signer, relays)
+	return nil
+}
+
+// SendLegacyDirectMessage sends content to recipient as a NIP-04 encrypted
+// direct message (kind 4), for clients without NIP-17. NIP-04 encryption
+// needs the private key itself, which signers do not expose.
+func SendLegacyDirectMessage(ctx context.Context, privateKey, recipient, content string, relays []string) error {
+	privateKey, err := DecodePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	sharedSecret, err := nip04.ComputeSharedSecret(recipient, privateKey)
+	if err != nil {
+		return fmt.Errorf("computing shared secret: %v", err)
+	}
+	encrypted, err := nip04.Encrypt(content, sharedSecret)
+	if err != nil {
+		return fmt.Errorf("encrypting message: %v", err)
+	}
+	pubKey, err := nostr.GetPublicKey(privateKey)
+	if err != nil {
+		return err
+	}
+	event := &nostr.Event{
+		Kind:      nostr.KindEncryptedDirectMessage,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipient}},
+		Content:   encrypted,
+	}
+	if err := event.Sign(privateKey); err != nil {
+		return fmt.Errorf("signing message: %v", err)
+	}
+	signer, err := NewSigner(privateKey)
+	if err != nil {
+		return err
+	}
+	results := PublishEvent(ctx, event, signer, relays)
+	if len(AcceptedRelays(results)) == 0 {
+		return fmt.Errorf("no relay accepted the message: %s", firstError(results))
+	}
+	return nil
+}
+
+// firstError returns the error of the first relay that rejected the event.
+func firstError(results []PublishResult) string {
+	for _, result := range results {
+		if !result.OK {
+			return result.Relay + ": " + result.Error
+		}
+	}
+	return "no relays"
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/girino/nip71-video-uploader/internal/testserver"
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip59"
+)
+
+func TestSendDirectMessage(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, relay := newTestUploader(t)
+	recipientKey := nostr.GeneratePrivateKey()
+	recipient, _ := NewSigner(recipientKey)
+	recipientPubKey, _ := recipient.GetPublicKey(ctx)
+
+	// the recipient reads its messages on another relay
+	inbox := testserver.NewRelay(t)
+	dmRelays := &nostr.Event{Kind: nostr.KindDMRelayList, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"relay", inbox.WSURL}}}
+	if err := dmRelays.Sign(recipientKey); err != nil {
+		t.Fatal(err)
+	}
+	relay.Add(dmRelays)
+
+	if err := SendDirectMessage(ctx, uploader.Signer, recipientPubKey, "Published nostr:nevent1", uploader.Relays, uploader.Relays); err != nil {
+		t.Fatal(err)
+	}
+	var wraps []*nostr.Event
+	for _, event := range inbox.Events() {
+		if event.Kind == nostr.KindGiftWrap {
+			wraps = append(wraps, event)
+		}
+	}
+	if len(wraps) != 1 {
+		t.Fatalf("inbox has %d gift wraps", len(wraps))
+	}
+	rumor, err := nip59.GiftUnwrap(*wraps[0], func(pubKey, ciphertext string) (string, error) {
+		return recipient.Decrypt(ctx, ciphertext, pubKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rumor.Kind != nostr.KindDirectMessage || rumor.Content != "Published nostr:nevent1" {
+		t.Errorf("rumor %+v", rumor)
+	}
+}
+
+func TestSendLegacyDirectMessage(t *testing.T) {
+	ctx := context.Background()
+	relay := testserver.NewRelay(t)
+	senderKey, recipientKey := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	senderPubKey, _ := nostr.GetPublicKey(senderKey)
+	recipientPubKey, _ := nostr.GetPublicKey(recipientKey)
+
+	if err := SendLegacyDirectMessage(ctx, senderKey, recipientPubKey, "hello", []string{relay.WSURL}); err != nil {
+		t.Fatal(err)
+	}
+	events := relay.Events()
+	if len(events) != 1 || events[0].Kind != nostr.KindEncryptedDirectMessage || events[0].Tags.GetFirst([]string{"p", recipientPubKey}) == nil {
+		t.Fatalf("events %v", events)
+	}
+	sharedSecret, _ := nip04.ComputeSharedSecret(senderPubKey, recipientKey)
+	content, err := nip04.Decrypt(events[0].Content, sharedSecret)
+	if err != nil || content != "hello" {
+		t.Errorf("decrypted %q, %v", content, err)
+	}
+}
+
+func TestPublishedMessage(t *testing.T) {
+	event := &nostr.Event{Kind: events.KindVideo, PubKey: strings.Repeat("ab", 32), ID: strings.Repeat("cd", 32), Tags: nostr.Tags{{"title", "Trailer"}}}
+	message, err := PublishedMessage(event, []string{"wss://relay.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(message, "Published \"Trailer\"\nnostr:nevent1") {
+		t.Errorf("message %q", message)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package nip71uploader uploads media to Blossom servers, extracts the
+// metadata needed by NIP-71 and NIP-68 events, and publishes the resulting
+// events to nostr relays.
+//
+// The Uploader type runs the whole pipeline; the lower level functions are
+// exported for callers that need only part of it. Every function takes a
+// context and reports failures as errors.
+package nip71uploader
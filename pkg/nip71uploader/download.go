@@ -0,0 +1,104 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DownloadFile downloads the file at the given URL into a temporary file and
+// returns its path. The caller is responsible for removing it with RemoveTemp.
+func DownloadFile(ctx context.Context, fileURL string) (string, error) {
+	return downloadFile(ctx, fileURL, nil)
+}
+
+// downloadFile implements DownloadFile within the limits of guard, which
+// may be nil.
+func downloadFile(ctx context.Context, fileURL string, guard *URLGuard) (string, error) {
+	ctx, cancel := withTimeout(ctx, DownloadTimeout)
+	defer cancel()
+	ctx, cancel = guard.timeout(ctx)
+	defer cancel()
+	resp, err := get(ctx, guard.client(), fileURL, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+	if err := checkFreeSpace(resp.ContentLength); err != nil {
+		return "", err
+	}
+	body, err := guard.body(resp)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := createTemp("download-*" + downloadExtension(fileURL, resp.Header.Get("Content-Type")))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, body)
+	if err != nil {
+		RemoveTemp(file.Name())
+		return "", err
+	}
+	// a truncated file would be published with the hash of its beginning
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		RemoveTemp(file.Name())
+		return "", fmt.Errorf("downloaded %d bytes, but the Content-Length is %d", written, resp.ContentLength)
+	}
+
+	return file.Name(), nil
+}
+
+// urlHash returns the sha256 naming the file at the URL, as in Blossom
+// blob URLs such as https://cdn.example.com/<sha256>.mp4, or "".
+func urlHash(fileURL string) string {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(parsed.Path)
+	name = strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+	if decoded, err := hex.DecodeString(name); err != nil || len(decoded) != 32 {
+		return ""
+	}
+	return name
+}
+
+// downloadExtension returns the extension of the file name in the URL, or
+// else the usual one of the Content-Type, so that downloaded files keep a
+// meaningful extension.
+func downloadExtension(fileURL, contentType string) string {
+	if parsed, err := url.Parse(fileURL); err == nil {
+		if ext := path.Ext(parsed.Path); ext != "" && len(ext) <= 6 {
+			return strings.ToLower(ext)
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for ext, mimeType := range mediaExtensions {
+		// .m4v and .opus share their type with .mp4 and .ogg
+		if mimeType == mediaType && ext != ".m4v" && ext != ".opus" {
+			return ext
+		}
+	}
+	if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
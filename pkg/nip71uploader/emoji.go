@@ -0,0 +1,62 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-30 shortcodes are made of letters, digits and underscores
+var (
+	shortcodeRegexp      = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	emojiShortcodeRegexp = regexp.MustCompile(`:([a-zA-Z0-9_]+):`)
+)
+
+// ParseEmoji parses a NIP-30 custom emoji given as shortcode=url, with or
+// without the colons around the shortcode, into its "emoji" tag.
+func ParseEmoji(value string) (nostr.Tag, error) {
+	shortcode, imageURL, ok := strings.Cut(value, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid emoji %q, expected shortcode=url", value)
+	}
+	shortcode = strings.Trim(strings.TrimSpace(shortcode), ":")
+	if !shortcodeRegexp.MatchString(shortcode) {
+		return nil, fmt.Errorf("invalid emoji shortcode %q, only letters, digits and underscores are allowed", shortcode)
+	}
+	parsed, err := url.Parse(strings.TrimSpace(imageURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid emoji URL %q", imageURL)
+	}
+	return nostr.Tag{"emoji", shortcode, parsed.String()}, nil
+}
+
+// addEmojiTags adds the Emojis tags of the shortcodes used in the content,
+// title or summary of the event. Emojis the event does not use are left out,
+// as there is nothing for clients to render them in.
+func (u *Uploader) addEmojiTags(event *nostr.Event) {
+	if len(u.Emojis) == 0 {
+		return
+	}
+	text := strings.Join([]string{firstTagValue(event.Tags, "title"), firstTagValue(event.Tags, "summary"), event.Content}, "\n")
+	used := make(map[string]bool)
+	for _, match := range emojiShortcodeRegexp.FindAllStringSubmatch(text, -1) {
+		used[match[1]] = true
+	}
+	for _, emoji := range u.Emojis {
+		if !used[emoji[1]] {
+			log.Printf("Emoji :%s: is not used in the event, not adding it", emoji[1])
+			continue
+		}
+		if !event.Tags.ContainsAny("emoji", []string{emoji[1]}) {
+			event.Tags = append(event.Tags, nostr.Tag{"emoji", emoji[1], emoji[2]})
+		}
+	}
+}
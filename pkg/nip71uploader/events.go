@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Pow mines a nonce tag for the event until its id has diff leading zero bits.
+func Pow(ctx context.Context, event *nostr.Event, diff int) error {
+	if err := MinePow(ctx, event, diff, nil); err != nil {
+		return fmt.Errorf("error generating proof of work: %v", err)
+	}
+	return nil
+}
+
+var hashtagRegexp = regexp.MustCompile(`#\w+`)
+
+// ExtractHashtags adds a "t" tag for every hashtag in the event content
+func ExtractHashtags(event *nostr.Event) {
+	if event.Content == "" {
+		return
+	}
+	tags := hashtagRegexp.FindAllString(event.Content, -1)
+	for _, tag := range tags {
+		event.Tags = append(event.Tags, nostr.Tag{"t", strings.TrimPrefix(tag, "#")})
+	}
+}
+
+// SaveEvent writes the event as indented JSON to the given file.
+func SaveEvent(filePath string, event *nostr.Event) error {
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding event: %v", err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// LoadEvent reads an event previously written by SaveEvent.
+func LoadEvent(filePath string) (*nostr.Event, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", filePath, err)
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", filePath, err)
+	}
+	return &event, nil
+}
+
+// WaitUntil blocks until the given unix timestamp is reached or the context
+// is canceled.
+func WaitUntil(ctx context.Context, timestamp int64) error {
+	delay := time.Until(time.Unix(timestamp, 0))
+	if delay <= 0 {
+		return nil
+	}
+	log.Printf("Waiting %s to publish at %s", delay.Round(time.Second), time.Unix(timestamp, 0).Format(time.RFC1123))
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishScheduleRequest asks a NIP-90 scheduling DVM (kind 5905) to publish
+// the signed event at its created_at time. If dvmPubKey is empty the request
+// is open to any service provider. The returned results are those of
+// publishing the job request.
+func PublishScheduleRequest(ctx context.Context, event *nostr.Event, signer nostr.Keyer, relays []string, dvmPubKey string) ([]PublishResult, error) {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("encoding event: %v", err)
+	}
+
+	relaysParam := append([]string{"param", "relays"}, relays...)
+	request := nostr.Event{
+		Kind:      5905,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"i", string(eventJSON), "text"},
+			relaysParam,
+			append([]string{"relays"}, relays...),
+		},
+	}
+	if dvmPubKey != "" {
+		request.Tags = append(request.Tags, nostr.Tag{"p", dvmPubKey})
+	}
+
+	if err := signer.SignEvent(ctx, &request); err != nil {
+		return nil, fmt.Errorf("signing schedule request: %v", err)
+	}
+
+	return PublishEvent(ctx, &request, signer, relays), nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// templateReplaces are the tags generated once per event, which the tags of
+// the same name of an event template replace. Other template tags are added
+// to the generated ones.
+var templateReplaces = []string{"title", "summary", "published_at", "d", "alt", "content-warning", "client"}
+
+// LoadEventTemplate reads a partial event in JSON, from a file or from stdin
+// when path is "-", to merge into the built event. Its id, pubkey and sig
+// are ignored, as the event is signed once built.
+func LoadEventTemplate(path string) (*nostr.Event, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading event template: %v", err)
+	}
+	var template nostr.Event
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("decoding event template: %v", err)
+	}
+	return &template, nil
+}
+
+// mergeTemplate merges the content and tags of the template into the built
+// event: a non-empty content replaces the generated description, tags named
+// in templateReplaces replace the generated ones, and the other tags are
+// added unless the event has them already. A template kind other than 0
+// must match the built event.
+func mergeTemplate(event, template *nostr.Event) error {
+	if template == nil {
+		return nil
+	}
+	if template.Kind != 0 && template.Kind != event.Kind {
+		return fmt.Errorf("the event template has kind %d, but a kind %d event was built", template.Kind, event.Kind)
+	}
+	if template.Content != "" {
+		event.Content = template.Content
+	}
+	for _, tag := range template.Tags {
+		if len(tag) == 0 {
+			continue
+		}
+		if slices.Contains(templateReplaces, tag[0]) {
+			event.Tags = slices.DeleteFunc(event.Tags, func(generated nostr.Tag) bool {
+				return len(generated) > 0 && generated[0] == tag[0]
+			})
+		}
+		if !slices.ContainsFunc(event.Tags, func(generated nostr.Tag) bool { return slices.Equal(generated, tag) }) {
+			event.Tags = append(event.Tags, slices.Clone(tag))
+		}
+	}
+	return nil
+}
+
+// ParseTag parses a tag given as key=value.
+func ParseTag(value string) (nostr.Tag, error) {
+	key, tagValue, ok := strings.Cut(value, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid tag %q, expected key=value", value)
+	}
+	tag := nostr.Tag{strings.TrimSpace(key), tagValue}
+	if err := checkExtraTag(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// LoadTags reads a JSON array of tags, such as [["k", "v"], ["k", "v", "x"]].
+func LoadTags(path string) (nostr.Tags, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tags: %v", err)
+	}
+	var tags nostr.Tags
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	for _, tag := range tags {
+		if err := checkExtraTag(tag); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return tags, nil
+}
+
+// checkExtraTag refuses the tags that cannot be added to a built event.
+func checkExtraTag(tag nostr.Tag) error {
+	switch {
+	case len(tag) == 0 || tag[0] == "":
+		return errors.New("tags need a key")
+	case tag[0] == "nonce":
+		return errors.New("the nonce tag is added by the proof of work")
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+)
+
+// StripMetadata removes the EXIF, XMP, IPTC and text metadata, which may hold
+// GPS coordinates and camera serial numbers, from a JPEG, PNG or WebP image
+// without re-encoding it. The cleaned image is written to a temporary file
+// whose path is returned; the caller is responsible for removing it with
+// RemoveTemp. Other files, and images without metadata, are left alone and
+// their own path is returned. The EXIF orientation of JPEG images is kept,
+// so they are still displayed the right way up.
+func StripMetadata(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var stripped []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		stripped, err = stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		stripped, err = stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		stripped, err = stripWebP(data)
+	default:
+		return path, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("stripping metadata from %s: %v", path, err)
+	}
+	if bytes.Equal(stripped, data) {
+		return path, nil
+	}
+
+	file, err := createTemp("stripped-*" + filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(stripped); err != nil {
+		RemoveTemp(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// stripJPEG drops the APPn segments other than JFIF, ICC profiles and Adobe
+// color information, and the comments. A minimal EXIF segment holding only
+// the orientation replaces the original one.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := []byte{0xff, 0xd8}
+	orientation := uint16(1)
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		case marker == 0xda:
+			// the entropy coded image data follows the start of scan
+			if orientation > 1 {
+				out = insertOrientation(out, orientation)
+			}
+			return append(out, data[pos:]...), nil
+		}
+
+		if pos+4 > len(data) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		// the length counts its own two bytes
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 {
+			return nil, errors.New("malformed JPEG segment")
+		}
+		end := pos + 2 + length
+		if end > len(data) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+		pos = end
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, exifHeader):
+			orientation = exifOrientation(payload[len(exifHeader):])
+		case marker == 0xe0, marker == 0xee:
+			out = append(out, segment...)
+		case marker == 0xe2 && bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00")):
+			out = append(out, segment...)
+		case marker >= 0xe0 && marker <= 0xef, marker == 0xfe:
+			// other application segments and comments are metadata
+		default:
+			out = append(out, segment...)
+		}
+	}
+}
+
+// exifOrientation reads the orientation from the first IFD of TIFF data,
+// returning 1 (upright) when it is missing or unreadable.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd+2 > int64(len(tiff)) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := int(ifd) + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return order.Uint16(tiff[entry+8:])
+		}
+	}
+	return 1
+}
+
+// insertOrientation adds an EXIF segment with just the orientation after the
+// JFIF segment, or right after the start of image.
+func insertOrientation(jpeg []byte, orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08, // header, IFD at offset 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // orientation, SHORT, count 1
+		byte(orientation >> 8), byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	segment := append([]byte{0xff, 0xe1, 0, 0}, payload...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	at := 2
+	if len(jpeg) >= 6 && jpeg[2] == 0xff && jpeg[3] == 0xe0 {
+		at = 4 + int(binary.BigEndian.Uint16(jpeg[4:]))
+	}
+	out := append([]byte{}, jpeg[:at]...)
+	out = append(out, segment...)
+	return append(out, jpeg[at:]...)
+}
+
+// stripPNG drops the eXIf, text and modification time chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	out := append([]byte{}, pngSignature...)
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		length := int64(binary.BigEndian.Uint32(data[pos:]))
+		if length > int64(len(data)-pos-12) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		end := pos + 12 + int(length)
+		switch string(data[pos+4 : pos+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags in the
+// extended header.
+func stripWebP(data []byte) ([]byte, error) {
+	out := append([]byte{}, data[:12]...)
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(data[pos+4:]))
+		if size+size%2 > int64(len(data)-pos-8) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		end := pos + 8 + int(size+size%2)
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripMalformed(t *testing.T) {
+	png := func(chunks ...byte) []byte { return append(append([]byte{}, pngSignature...), chunks...) }
+	webp := func(chunks ...byte) []byte { return append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunks...) }
+	tests := []struct {
+		name  string
+		strip func([]byte) ([]byte, error)
+		data  []byte
+	}{
+		{"jpeg segment length 0", stripJPEG, []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x00, 0xff, 0xda}},
+		{"jpeg segment length 1", stripJPEG, []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 0xff, 0xda}},
+		{"jpeg segment past the end", stripJPEG, []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x10, 0x00}},
+		{"jpeg length cut", stripJPEG, []byte{0xff, 0xd8, 0xff, 0xe1, 0x00}},
+		{"jpeg no marker", stripJPEG, []byte{0xff, 0xd8, 0x00, 0x00}},
+		{"jpeg no start of scan", stripJPEG, []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x02}},
+		{"png chunk header cut", stripPNG, png(0x00, 0x00)},
+		{"png chunk past the end", stripPNG, png(0x00, 0x00, 0x00, 0x10, 'I', 'H', 'D', 'R')},
+		{"png huge chunk", stripPNG, png(0xff, 0xff, 0xff, 0xff, 'I', 'H', 'D', 'R')},
+		{"webp chunk header cut", stripWebP, webp('E', 'X', 'I')},
+		{"webp chunk past the end", stripWebP, webp('E', 'X', 'I', 'F', 0x10, 0x00, 0x00, 0x00)},
+		{"webp huge chunk", stripWebP, webp('E', 'X', 'I', 'F', 0xff, 0xff, 0xff, 0xff)},
+	}
+	for _, test := range tests {
+		if _, err := test.strip(test.data); err == nil {
+			t.Errorf("%s: stripped without error", test.name)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "crafted.jpg")
+	if err := os.WriteFile(path, tests[0].data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StripMetadata(path); err == nil {
+		t.Error("StripMetadata accepted a segment length of 0")
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// little endian EXIF rotated 90 degrees, pointing to GPS data
+	tiff := []byte{
+		'I', 'I', 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x02, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00,
+		0x25, 0x88, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	tiff = append(tiff, "serial 1234 gps 48.85N"...)
+	exif := append(append([]byte{}, exifHeader...), tiff...)
+	segments := jpegSegment(0xe1, exif)
+	segments = append(segments, jpegSegment(0xfe, []byte("comment by the camera"))...)
+	data := append([]byte{0xff, 0xd8}, segments...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	stripped, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("serial")) || bytes.Contains(stripped, []byte("camera")) {
+		t.Error("metadata left in the image")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("decoding the stripped image: %v", err)
+	}
+	if stripped[2] != 0xff || stripped[3] != 0xe1 {
+		t.Fatalf("no EXIF segment after the start of image: % x", stripped[:4])
+	}
+	length := int(binary.BigEndian.Uint16(stripped[4:]))
+	payload := stripped[6 : 4+length]
+	if !bytes.HasPrefix(payload, exifHeader) {
+		t.Fatalf("segment % x is not EXIF", payload)
+	}
+	if orientation := exifOrientation(payload[len(exifHeader):]); orientation != 6 {
+		t.Errorf("orientation %d, want 6", orientation)
+	}
+
+	// an image without orientation loses its EXIF segment entirely
+	again, err := stripJPEG(append([]byte{0xff, 0xd8}, append(jpegSegment(0xe1, append(append([]byte{}, exifHeader...), "MM"...)), encoded.Bytes()[2:]...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, encoded.Bytes()) {
+		t.Error("stripping an upright image did not give back the encoded image")
+	}
+}
+
+// jpegSegment returns a JPEG marker segment with the payload.
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestStripPNG(t *testing.T) {
+	data, err := os.ReadFile(writePNG(t, 4, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := []byte{0, 0, 0, 14, 't', 'E', 'X', 't'}
+	text = append(text, "Author\x00someone"...)
+	text = append(text, 0, 0, 0, 0)
+	iend := len(data) - 12
+	withText := append(append(append([]byte{}, data[:iend]...), text...), data[iend:]...)
+
+	stripped, err := stripPNG(withText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, data) {
+		t.Error("the tEXt chunk was not removed")
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("decoding the stripped image: %v", err)
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	chunk := func(name string, payload []byte) []byte {
+		c := append([]byte(name), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(c[4:], uint32(len(payload)))
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	body := chunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	body = append(body, chunk("EXIF", []byte("serial"))...)
+	body = append(body, chunk("VP8L", []byte{1, 2, 3})...)
+	body = append(body, chunk("XMP ", []byte("<x/>"))...)
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), body...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunk("VP8X", []byte{0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0})...)
+	want = append(want, chunk("VP8L", []byte{1, 2, 3})...)
+	binary.LittleEndian.PutUint32(want[4:], uint32(len(want)-8))
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("stripped\n% x\nwant\n% x", stripped, want)
+	}
+}
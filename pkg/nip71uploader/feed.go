@@ -0,0 +1,233 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FeedItem is a video episode of an RSS or Atom feed.
+type FeedItem struct {
+	// ID is the guid or id of the episode, used as the "d" tag of its event.
+	ID          string
+	Title       string
+	Description string
+	// URL is the video file of the episode.
+	URL       string
+	Thumbnail string
+	// PublishedAt is the publication time in unix seconds, 0 if unknown.
+	PublishedAt int64
+	Width       int
+	Height      int
+}
+
+// feedDocument covers the parts of RSS 2.0 and Atom feeds that describe
+// episodes, including the Media RSS extensions PeerTube uses.
+type feedDocument struct {
+	Items   []feedEntry `xml:"channel>item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+type feedEntry struct {
+	GUID        string `xml:"guid"`
+	ID          string `xml:"id"`
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+	Summary     string `xml:"summary"`
+	Content     string `xml:"http://www.w3.org/2005/Atom content"`
+	PubDate     string `xml:"pubDate"`
+	Published   string `xml:"published"`
+	Updated     string `xml:"updated"`
+	Enclosures  []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	Links []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+	Media       []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	Groups      []mediaGroup   `xml:"http://search.yahoo.com/mrss/ group"`
+	Thumbnails  []mediaImage   `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	ItunesImage mediaImage     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type mediaContent struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type mediaGroup struct {
+	Media       []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails  []mediaImage   `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Description string         `xml:"http://search.yahoo.com/mrss/ description"`
+}
+
+type mediaImage struct {
+	URL  string `xml:"url,attr"`
+	Href string `xml:"href,attr"`
+}
+
+// feedDateLayouts are the date formats found in RSS (RFC 822 and its
+// variants) and Atom (RFC 3339) feeds.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+}
+
+// FetchFeed downloads an RSS or Atom feed and returns its video episodes,
+// oldest first. Entries without a video enclosure are left out.
+func FetchFeed(ctx context.Context, feedURL string) ([]FeedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download feed: %s", resp.Status)
+	}
+
+	var document feedDocument
+	if err := xml.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("decoding feed: %v", err)
+	}
+
+	var items []FeedItem
+	for _, entry := range append(document.Items, document.Entries...) {
+		if item, ok := entry.item(); ok {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedAt < items[j].PublishedAt
+	})
+	return items, nil
+}
+
+// item converts the entry, reporting false when it has no video.
+func (e feedEntry) item() (FeedItem, bool) {
+	item := FeedItem{
+		ID:          firstNonEmpty(e.GUID, e.ID),
+		Title:       strings.TrimSpace(e.Title),
+		Description: strings.TrimSpace(firstNonEmpty(e.Description, e.Summary, e.Content)),
+		Thumbnail:   firstNonEmpty(e.ItunesImage.Href, e.ItunesImage.URL),
+	}
+
+	// the Media RSS variants tell the resolution, prefer the largest one
+	media := e.Media
+	for _, group := range e.Groups {
+		media = append(media, group.Media...)
+		if item.Description == "" {
+			item.Description = strings.TrimSpace(group.Description)
+		}
+		for _, thumbnail := range group.Thumbnails {
+			item.Thumbnail = firstNonEmpty(item.Thumbnail, thumbnail.URL)
+		}
+	}
+	for _, content := range media {
+		if content.Medium != "video" && !strings.HasPrefix(content.Type, "video/") {
+			continue
+		}
+		if item.URL == "" || content.Height > item.Height {
+			item.URL = content.URL
+			item.Width, item.Height = content.Width, content.Height
+		}
+	}
+	for _, enclosure := range e.Enclosures {
+		if item.URL == "" && strings.HasPrefix(enclosure.Type, "video/") {
+			item.URL = enclosure.URL
+		}
+	}
+	for _, link := range e.Links {
+		if item.URL == "" && link.Rel == "enclosure" && strings.HasPrefix(link.Type, "video/") {
+			item.URL = link.Href
+		}
+	}
+	for _, thumbnail := range e.Thumbnails {
+		item.Thumbnail = firstNonEmpty(item.Thumbnail, thumbnail.URL)
+	}
+	if item.URL == "" {
+		return item, false
+	}
+	if item.ID == "" {
+		item.ID = item.URL
+	}
+
+	for _, value := range []string{e.PubDate, e.Published, e.Updated} {
+		if item.PublishedAt = parseFeedDate(value); item.PublishedAt != 0 {
+			break
+		}
+	}
+	return item, true
+}
+
+func parseFeedDate(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	for _, layout := range feedDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Unix()
+		}
+	}
+	return 0
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// PublishedIdentifiers returns which of the given "d" tags already appear on
+// a video event of pubKey on the relays.
+func PublishedIdentifiers(ctx context.Context, pubKey string, identifiers []string, relays []string) map[string]bool {
+	published := make(map[string]bool)
+	if len(identifiers) == 0 {
+		return published
+	}
+	filter := nostr.Filter{
+		Kinds: []int{
+			events.KindVideo, events.KindShortVideo,
+			events.KindLegacyVideo, events.KindLegacyShortVideo,
+		},
+		Authors: []string{pubKey},
+		Tags:    nostr.TagMap{"d": identifiers},
+	}
+	for _, relayURL := range relays {
+		for _, event := range queryRelay(ctx, filter, relayURL) {
+			if tag := event.Tags.GetFirst([]string{"d", ""}); tag != nil {
+				published[tag.Value()] = true
+			}
+		}
+	}
+	return published
+}
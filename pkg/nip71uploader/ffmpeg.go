@@ -0,0 +1,173 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	// FFmpeg and FFprobe are the executables run to measure and convert
+	// media: names looked up in the PATH, with the .exe extension on
+	// Windows, or paths.
+	FFmpeg  = "ffmpeg"
+	FFprobe = "ffprobe"
+	// DownloadFFmpeg downloads static builds of ffmpeg and ffprobe to
+	// FFmpegCacheDir the first time they are needed and not installed.
+	DownloadFFmpeg bool
+	// FFmpegDownloadURL is the URL of the zip archives downloaded with
+	// DownloadFFmpeg, where {tool} and {platform} are replaced by the
+	// executable name and the platform of the build.
+	FFmpegDownloadURL = "https://github.com/ffbinaries/ffbinaries-prebuilt/releases/download/v6.1/{tool}-6.1-{platform}.zip"
+)
+
+// ffmpegPlatforms are the platforms static builds are downloaded for.
+var ffmpegPlatforms = map[string]string{
+	"windows/amd64": "win-64",
+	"linux/amd64":   "linux-64",
+	"linux/arm64":   "linux-arm-64",
+	"darwin/amd64":  "macos-64",
+	// macOS runs the Intel builds through Rosetta
+	"darwin/arm64": "macos-64",
+}
+
+// tools remembers where the executables were found, or why they were not,
+// so that PATH lookups and downloads happen once.
+var tools = struct {
+	sync.Mutex
+	paths map[string]string
+	errs  map[string]error
+}{paths: map[string]string{}, errs: map[string]error{}}
+
+// FFmpegCacheDir returns the directory DownloadFFmpeg saves the executables
+// to, in the user cache directory.
+func FFmpegCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "nostrmedia", "ffmpeg")
+}
+
+// ffmpegBinary returns the path of the ffmpeg executable.
+func ffmpegBinary(ctx context.Context) (string, error) {
+	return findTool(ctx, "ffmpeg", FFmpeg)
+}
+
+// ffprobeBinary returns the path of the ffprobe executable.
+func ffprobeBinary(ctx context.Context) (string, error) {
+	return findTool(ctx, "ffprobe", FFprobe)
+}
+
+// findTool looks the executable up in the PATH, then among the downloaded
+// ones, downloading it with DownloadFFmpeg.
+func findTool(ctx context.Context, tool, name string) (string, error) {
+	tools.Lock()
+	defer tools.Unlock()
+	if path, ok := tools.paths[name]; ok {
+		return path, nil
+	}
+	if err, ok := tools.errs[name]; ok {
+		return "", err
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil && name == tool {
+		cached := filepath.Join(FFmpegCacheDir(), executableName(tool))
+		if _, statErr := os.Stat(cached); statErr == nil {
+			path, err = cached, nil
+		} else if DownloadFFmpeg {
+			path, err = downloadTool(ctx, tool, cached)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s not found: %v", name, err)
+		tools.errs[name] = err
+		return "", err
+	}
+	tools.paths[name] = path
+	return path, nil
+}
+
+// executableName adds .exe to the name of executables on Windows.
+func executableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// downloadTool downloads the static build of ffmpeg or ffprobe for this
+// platform and extracts it to path.
+func downloadTool(ctx context.Context, tool, path string) (string, error) {
+	platform, ok := ffmpegPlatforms[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok {
+		return "", fmt.Errorf("no %s build to download for %s/%s", tool, runtime.GOOS, runtime.GOARCH)
+	}
+	url := strings.NewReplacer("{tool}", tool, "{platform}", platform).Replace(FFmpegDownloadURL)
+	log.Printf("Downloading %s from %s", tool, url)
+
+	archive, err := DownloadFile(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer RemoveTemp(archive)
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %v", url, err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if filepath.Base(file.Name) != executableName(tool) {
+			continue
+		}
+		if err := extractExecutable(file, path); err != nil {
+			return "", fmt.Errorf("extracting %s: %v", tool, err)
+		}
+		log.Printf("Saved %s to %s", tool, path)
+		return path, nil
+	}
+	return "", fmt.Errorf("%s has no %s", url, executableName(tool))
+}
+
+// extractExecutable writes the file of a zip archive to path, through a
+// temporary file so that an interrupted download leaves nothing behind.
+func extractExecutable(file *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dst.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), path)
+}
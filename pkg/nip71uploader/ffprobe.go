@@ -0,0 +1,282 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ffprobeOutput is the part of `ffprobe -print_format json` output used.
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		BitRate      string            `json:"bit_rate"`
+		Duration     string            `json:"duration"`
+		SampleRate   string            `json:"sample_rate"`
+		Channels     int               `json:"channels"`
+		Tags         map[string]string `json:"tags"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// ProbeVideo describes the video stream of a file with ffprobe, which reads
+// the container and stream headers without decoding any frame. When ffprobe
+// is not installed, it falls back to ReadVideoHeader.
+func ProbeVideo(ctx context.Context, filePath string) (*VideoHeader, error) {
+	if _, err := ffprobeBinary(ctx); err != nil {
+		return ReadVideoHeader(filePath)
+	}
+
+	probe, err := runFFprobe(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	language := probe.audioLanguage()
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" || stream.Width == 0 || stream.Disposition.AttachedPic == 1 {
+			continue
+		}
+		header := &VideoHeader{
+			Width:     stream.Width,
+			Height:    stream.Height,
+			Codec:     stream.CodecName,
+			FrameRate: parseRatio(stream.AvgFrameRate),
+			Language:  language,
+		}
+		header.Duration, _ = strconv.ParseFloat(firstNonEmpty(stream.Duration, probe.Format.Duration), 64)
+		header.Bitrate, _ = strconv.ParseInt(firstNonEmpty(stream.BitRate, probe.Format.BitRate), 10, 64)
+		var rotation float64
+		if rotate, ok := stream.Tags["rotate"]; ok {
+			rotation, _ = strconv.ParseFloat(rotate, 64)
+		}
+		for _, sideData := range stream.SideDataList {
+			if sideData.Rotation != 0 {
+				// the display matrix rotates counterclockwise, the tag clockwise
+				rotation = -sideData.Rotation
+			}
+		}
+		header.Rotation = rotationDegrees(rotation)
+		// Matroska tags are upper case, MP4 ones lower case
+		for name, value := range probe.Format.Tags {
+			if strings.EqualFold(name, "title") {
+				header.Title = value
+			}
+		}
+		return header, nil
+	}
+	return nil, errors.New("no video stream found")
+}
+
+// AudioHeader describes the audio stream of a file.
+type AudioHeader struct {
+	// Duration is in seconds.
+	Duration float64
+	// Codec is the ffmpeg name of the codec, such as "mp3" or "opus".
+	Codec string
+	// Bitrate is in bits per second.
+	Bitrate    int64
+	SampleRate int
+	Channels   int
+	// Cover reports whether the file embeds cover art, see ExtractCoverArt.
+	Cover bool
+	// Language is the ISO 639-1 code of the language the audio stream is
+	// tagged with, if any.
+	Language string
+}
+
+// ProbeAudio describes the audio stream of a file with ffprobe, which must
+// be installed.
+func ProbeAudio(ctx context.Context, filePath string) (*AudioHeader, error) {
+	if _, err := ffprobeBinary(ctx); err != nil {
+		return nil, errors.New("measuring audio needs ffprobe")
+	}
+	probe, err := runFFprobe(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	var header *AudioHeader
+	cover := false
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 1:
+			cover = true
+		case stream.CodecType == "audio" && header == nil:
+			header = &AudioHeader{Codec: stream.CodecName, Channels: stream.Channels}
+			header.Duration, _ = strconv.ParseFloat(firstNonEmpty(stream.Duration, probe.Format.Duration), 64)
+			header.Bitrate, _ = strconv.ParseInt(firstNonEmpty(stream.BitRate, probe.Format.BitRate), 10, 64)
+			header.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+		}
+	}
+	if header == nil {
+		return nil, errors.New("no audio stream found")
+	}
+	header.Cover = cover
+	header.Language = probe.audioLanguage()
+	return header, nil
+}
+
+// audioLanguage returns the ISO 639-1 code of the language the first audio
+// stream tagged with one is in, see StreamLanguage.
+func (probe *ffprobeOutput) audioLanguage() string {
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		if language := StreamLanguage(stream.Tags["language"]); language != "" {
+			return language
+		}
+	}
+	return ""
+}
+
+// ExtractCoverArt saves the cover art embedded in an audio file as a JPEG,
+// in a temporary file the caller removes with RemoveTemp.
+func ExtractCoverArt(ctx context.Context, filePath string) (string, error) {
+	ffmpeg, err := ffmpegBinary(ctx)
+	if err != nil {
+		return "", fmt.Errorf("extracting cover art: %v", err)
+	}
+	cover, err := createTemp("cover-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	cover.Close()
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-v", "error", "-i", filePath,
+		"-an", "-map", "0:v:0", "-frames:v", "1", cover.Name())
+	if message, err := cmd.CombinedOutput(); err != nil {
+		RemoveTemp(cover.Name())
+		return "", fmt.Errorf("extracting cover art: %v: %s", err, strings.TrimSpace(string(message)))
+	}
+	return cover.Name(), nil
+}
+
+// ExtractFrame saves the frame of a video at the given time as a JPEG, in a
+// temporary file the caller removes with RemoveTemp.
+func ExtractFrame(ctx context.Context, filePath string, at time.Duration) (string, error) {
+	return extractFrame(ctx, filePath, at, 0)
+}
+
+// extractFrame implements ExtractFrame, scaling the frame down to fit in
+// size x size pixels when size is positive.
+func extractFrame(ctx context.Context, filePath string, at time.Duration, size int) (string, error) {
+	ffmpeg, err := ffmpegBinary(ctx)
+	if err != nil {
+		return "", fmt.Errorf("extracting frame: %v", err)
+	}
+	frame, err := createTemp("frame-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	frame.Close()
+	// seeking before the input is fast, and exact since ffmpeg 2.1
+	args := []string{"-y", "-v", "error", "-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", filePath, "-an", "-map", "0:v:0", "-frames:v", "1", "-q:v", "2"}
+	if size > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=w='min(%d,iw)':h='min(%d,ih)':force_original_aspect_ratio=decrease", size, size))
+	}
+	cmd := exec.CommandContext(ctx, ffmpeg, append(args, frame.Name())...)
+	if message, err := cmd.CombinedOutput(); err != nil {
+		RemoveTemp(frame.Name())
+		return "", fmt.Errorf("extracting frame: %v: %s", err, strings.TrimSpace(string(message)))
+	}
+	// ffmpeg writes nothing, without failing, past the end of the video
+	if stat, err := os.Stat(frame.Name()); err != nil || stat.Size() == 0 {
+		RemoveTemp(frame.Name())
+		return "", fmt.Errorf("the video has no frame at %v", at)
+	}
+	return frame.Name(), nil
+}
+
+// runFFprobe returns the streams and format of a file.
+func runFFprobe(ctx context.Context, filePath string) (*ffprobeOutput, error) {
+	ffprobe, err := ffprobeBinary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ffprobe, "-v", "error", "-print_format", "json",
+		"-show_streams", "-show_format", filePath)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running ffprobe: %v", err)
+	}
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("decoding ffprobe output: %v", err)
+	}
+	return &probe, nil
+}
+
+// ffprobeFormats maps the ffprobe names of the containers filetype does not
+// recognize to their MIME type.
+var ffprobeFormats = map[string]string{
+	"mpegts":   "video/mp2t",
+	"avi":      "video/x-msvideo",
+	"flv":      "video/x-flv",
+	"asf":      "video/x-ms-asf",
+	"mpeg":     "video/mpeg",
+	"ogg":      "audio/ogg",
+	"flac":     "audio/flac",
+	"wav":      "audio/wav",
+	"mp3":      "audio/mpeg",
+	"aac":      "audio/aac",
+	"matroska": "video/x-matroska",
+}
+
+// ffprobeMIME returns the MIME type of the container ffprobe finds in a
+// file, or "" when ffprobe is not installed or does not know it.
+func ffprobeMIME(filePath string) string {
+	probe, err := runFFprobe(context.Background(), filePath)
+	if err != nil {
+		return ""
+	}
+	// format names list the aliases of the demuxer, such as "matroska,webm"
+	for _, name := range strings.Split(probe.Format.FormatName, ",") {
+		if mimeType, ok := ffprobeFormats[name]; ok {
+			return mimeType
+		}
+	}
+	return ""
+}
+
+// parseRatio parses a frame rate such as "30000/1001".
+func parseRatio(ratio string) float64 {
+	numerator, denominator, found := strings.Cut(ratio, "/")
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+//go:build !unix
+
+package nip71uploader
+
+import "errors"
+
+// freeSpace is not implemented outside unix systems, where checkFreeSpace
+// lets everything pass.
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
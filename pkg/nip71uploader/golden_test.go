@@ -0,0 +1,188 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenKey is the private key signing the golden events, so that their
+// pubkey does not change.
+const goldenKey = "0000000000000000000000000000000000000000000000000000000000000001"
+
+// goldenBlossom replaces the address of the fake Blossom server, which
+// listens on a random port, in the golden files.
+const goldenBlossom = "https://blossom.example.com"
+
+// TestGoldenEvents builds representative events and compares them with
+// testdata/golden/<name>.json. Run `go test -run TestGoldenEvents -update`
+// after changing the tag layout on purpose, and review the diff.
+func TestGoldenEvents(t *testing.T) {
+	// measure videos with the built-in MP4 reader whether ffprobe is
+	// installed or not, and skip the blurhash frame
+	ffprobe := FFprobe
+	FFprobe = "nostrmedia-test-no-ffprobe"
+	t.Cleanup(func() { FFprobe = ffprobe })
+
+	tests := []struct {
+		name  string
+		build func(ctx context.Context, u *Uploader) (*nostr.Event, error)
+	}{
+		{"video-horizontal", func(ctx context.Context, u *Uploader) (*nostr.Event, error) {
+			return u.BuildVideoEvent(ctx, VideoOptions{
+				Media:       Media{Path: writeMP4(t, 1920, 1080, 95)},
+				Title:       "Sunset timelapse",
+				Description: "Two hours of sunset in a minute and a half #timelapse",
+				PublishedAt: "1700000000",
+				Horizontal:  true,
+			})
+		}},
+		{"video-vertical", func(ctx context.Context, u *Uploader) (*nostr.Event, error) {
+			return u.BuildVideoEvent(ctx, VideoOptions{
+				Media:       Media{Path: writeMP4(t, 1080, 1920, 15)},
+				Title:       "Cat jumps",
+				PublishedAt: "1700000000",
+			})
+		}},
+		{"video-legacy", func(ctx context.Context, u *Uploader) (*nostr.Event, error) {
+			return u.BuildVideoEvent(ctx, VideoOptions{
+				Media:       Media{Path: writeMP4(t, 1280, 720, 60)},
+				Title:       "Old client",
+				PublishedAt: "1700000000",
+				Legacy:      true,
+				Horizontal:  true,
+			})
+		}},
+		{"gallery", func(ctx context.Context, u *Uploader) (*nostr.Event, error) {
+			return u.BuildPictureEvent(ctx, PictureOptions{
+				Pictures: []Media{
+					{Path: writePNG(t, 64, 48)},
+					{Path: writePNG(t, 48, 64)},
+					{Path: writePNG(t, 32, 32)},
+				},
+				Title:       "Gradients",
+				Description: "Three gradients #art",
+				PublishedAt: "1700000000",
+			})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			uploader, blossom, _ := newTestUploader(t)
+			signer, err := NewSigner(goldenKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uploader.Signer = signer
+			uploader.Previews = Previews{NoBlurhash: strings.HasPrefix(test.name, "video")}
+			uploader.Hashtags = []string{"nostrmedia"}
+			uploader.Client = "nostrmedia"
+
+			event, err := test.build(ctx, uploader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := uploader.Sign(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+			got := normalizeEvent(t, event, blossom.URL)
+
+			path := filepath.Join("testdata", "golden", test.name+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("event differs from %s, run with -update to accept it:\n%s", path, got)
+			}
+		})
+	}
+}
+
+// normalizeEvent returns the JSON of the event, one tag per line, without
+// the fields that change on every run: the id, signature, creation time,
+// proof of work nonce and the address of the fake Blossom server.
+func normalizeEvent(t *testing.T, event *nostr.Event, blossomURL string) []byte {
+	t.Helper()
+	marshal := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "{\n  \"kind\": %d,\n  \"pubkey\": %s,\n  \"content\": %s,\n  \"tags\": [",
+		event.Kind, marshal(event.PubKey), marshal(event.Content))
+	for i, tag := range event.Tags {
+		tag = slices.Clone(tag)
+		if tag[0] == "nonce" && len(tag) > 1 {
+			tag[1] = ""
+		}
+		for j := range tag {
+			tag[j] = strings.ReplaceAll(tag[j], blossomURL, goldenBlossom)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n    " + marshal(tag))
+	}
+	b.WriteString("\n  ]\n}\n")
+	return []byte(b.String())
+}
+
+// writeMP4 writes the headers of an MP4 file with one video track of the
+// given size and duration, enough for ReadVideoHeader.
+func writeMP4(t *testing.T, width, height, seconds int) string {
+	t.Helper()
+	box := func(kind string, payload ...[]byte) []byte {
+		data := bytes.Join(payload, nil)
+		return append(binary.BigEndian.AppendUint32(nil, uint32(8+len(data))), append([]byte(kind), data...)...)
+	}
+	u32 := func(values ...uint32) []byte {
+		var data []byte
+		for _, v := range values {
+			data = binary.BigEndian.AppendUint32(data, v)
+		}
+		return data
+	}
+
+	// version, flags, creation and modification times, timescale, duration
+	mvhd := append(u32(0, 0, 0, 1000, uint32(seconds*1000)), make([]byte, 80)...)
+	// version, flags, times, track id, reserved, duration, reserved, layer,
+	// group, volume, reserved, identity matrix, size in 16.16 fixed point
+	tkhd := append(u32(0, 0, 0, 1, 0, uint32(seconds*1000), 0, 0, 0, 0),
+		u32(0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000, uint32(width)<<16, uint32(height)<<16)...)
+	hdlr := append(u32(0, 0), append([]byte("vide"), make([]byte, 13)...)...)
+
+	data := append(box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2avc1mp41")),
+		box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd), box("mdia", box("hdlr", hdlr))))...)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// URLGuard protects the machine running the uploader from server-side
+// request forgery when the URLs it downloads come from untrusted clients, as
+// with the serve command: downloads from loopback, private, link-local and
+// other non-public addresses are refused unless allowed, and their size and
+// duration are bounded.
+type URLGuard struct {
+	// Allow lists the host names, IP addresses and CIDR ranges that may be
+	// downloaded from although they are not public.
+	Allow []string
+	// MaxSize, when positive, is the largest download accepted, in bytes.
+	MaxSize int64
+	// Timeout, when positive, bounds each download.
+	Timeout time.Duration
+}
+
+// nonPublicNetworks are the ranges net.IP has no predicate for.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// CheckURL refuses URLs other than http and https ones, and URLs whose host
+// is, or resolves to, an address that is neither public nor allowed.
+func (g *URLGuard) CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("URL %s has no host", rawURL)
+	}
+	_, err = g.resolve(ctx, parsed.Hostname())
+	return err
+}
+
+// errGuardProxy refuses guarded downloads with UseProxy: the proxy resolves
+// the host again and connects wherever it points, or to internal addresses
+// only the proxy can reach, so the checked address cannot be enforced.
+var errGuardProxy = errors.New("media URLs are not downloaded through a proxy, which would connect to addresses that cannot be checked")
+
+// resolve returns the addresses of host, checked, or nil for allowed hosts,
+// which are resolved as usual.
+func (g *URLGuard) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if proxy != nil {
+		return nil, errGuardProxy
+	}
+	if g.allowedHost(host) {
+		return nil, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) && !g.allowedIP(addr.IP) {
+			return nil, fmt.Errorf("%s resolves to %s, which is not a public address", host, addr.IP)
+		}
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s has no address", host)
+	}
+	return ips, nil
+}
+
+// allowedHost reports whether the host name or address is in Allow.
+func (g *URLGuard) allowedHost(host string) bool {
+	for _, allowed := range g.Allow {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.allowedIP(ip)
+	}
+	return false
+}
+
+// allowedIP reports whether the address is in Allow.
+func (g *URLGuard) allowedIP(ip net.IP) bool {
+	for _, allowed := range g.Allow {
+		if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+			return true
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublic reports whether the address is routable on the internet.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// client returns the HTTP client of the downloads, http.DefaultClient for a
+// nil guard. Connections go to the addresses the guard checked rather than
+// to addresses resolved again, so that a host changing its DNS answer after
+// the check (DNS rebinding) cannot reach an internal address, and every
+// redirect is checked. Nothing is downloaded with UseProxy, see
+// errGuardProxy.
+func (g *URLGuard) client() *http.Client {
+	if g == nil {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the internal addresses on our behalf
+	transport.Proxy = nil
+	transport.DialContext = g.dial
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return g.CheckURL(req.Context(), req.URL.String())
+		},
+	}
+}
+
+// dial connects to the first checked address of the host.
+func (g *URLGuard) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if ips != nil {
+		address = net.JoinHostPort(ips[0].String(), port)
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// timeout bounds ctx by the Timeout of the guard, if any.
+func (g *URLGuard) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g == nil {
+		return context.WithCancel(ctx)
+	}
+	return withTimeout(ctx, g.Timeout)
+}
+
+// body returns the body of a download, failing once it exceeds MaxSize.
+// Downloads announcing a larger Content-Length are refused right away.
+func (g *URLGuard) body(resp *http.Response) (io.Reader, error) {
+	if g == nil || g.MaxSize <= 0 {
+		return resp.Body, nil
+	}
+	if resp.ContentLength > g.MaxSize {
+		return nil, fmt.Errorf("the file is %s, more than the %s allowed", FormatSize(resp.ContentLength), FormatSize(g.MaxSize))
+	}
+	return &sizeLimitReader{r: resp.Body, remaining: g.MaxSize, max: g.MaxSize}, nil
+}
+
+// sizeLimitReader fails once more than remaining bytes are read.
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	// one byte more than allowed tells a file of the maximum size from a
+	// larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, fmt.Errorf("the file is more than the %s allowed", FormatSize(l.max))
+	}
+	return n, err
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestURLGuard(t *testing.T) {
+	ctx := context.Background()
+	guard := &URLGuard{Allow: []string{"192.168.1.0/24", "internal.example"}}
+	for url, ok := range map[string]bool{
+		"http://127.0.0.1/video.mp4":       false,
+		"http://localhost:8080/video.mp4":  false,
+		"http://10.0.0.1/video.mp4":        false,
+		"http://169.254.169.254/latest":    false,
+		"http://[::1]/video.mp4":           false,
+		"http://100.64.0.1/video.mp4":      false,
+		"file:///etc/passwd":               false,
+		"http:///video.mp4":                false,
+		"http://192.168.1.20/video.mp4":    true,
+		"http://192.168.2.20/video.mp4":    false,
+		"https://internal.example/a.mp4":   true,
+		"https://93.184.215.14/video.mp4":  true,
+		"https://[2606:4700::1]/video.mp4": true,
+	} {
+		if err := guard.CheckURL(ctx, url); (err == nil) != ok {
+			t.Errorf("CheckURL(%s) = %v", url, err)
+		}
+	}
+}
+
+func TestGuardedDownload(t *testing.T) {
+	ctx := context.Background()
+	_, data := writeRandom(t, 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://127.0.0.1:1/video.mp4", http.StatusFound)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	if _, err := downloadFile(ctx, server.URL+"/video.mp4", &URLGuard{}); err == nil {
+		t.Error("downloaded from localhost")
+	}
+	allowed := &URLGuard{Allow: []string{"127.0.0.1"}}
+	path, err := downloadFile(ctx, server.URL+"/video.mp4", allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RemoveTemp(path)
+
+	// the redirect goes to another port of an allowed host
+	if path, err := downloadFile(ctx, server.URL+"/redirect", &URLGuard{Allow: []string{"127.0.0.1/32"}}); err == nil {
+		RemoveTemp(path)
+		t.Error("followed the redirect to a closed port")
+	}
+
+	small := &URLGuard{Allow: []string{"127.0.0.1"}, MaxSize: 999}
+	if path, err := downloadFile(ctx, server.URL+"/video.mp4", small); err == nil {
+		RemoveTemp(path)
+		t.Error("downloaded more than MaxSize")
+	}
+	exact := &URLGuard{Allow: []string{"127.0.0.1"}, MaxSize: 1000}
+	path, err = downloadFile(ctx, server.URL+"/video.mp4", exact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RemoveTemp(path)
+}
+
+func TestGuardWithProxy(t *testing.T) {
+	ctx := context.Background()
+	var proxied bool
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+		w.Write([]byte("internal"))
+	}))
+	defer proxyServer.Close()
+	proxyURL, err := ParseProxy(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := http.DefaultTransport.(*http.Transport)
+	defer func(previous func(*http.Request) (*url.URL, error)) {
+		transport.Proxy = previous
+		proxy = nil
+	}(transport.Proxy)
+	UseProxy(proxyURL)
+
+	guard := &URLGuard{Allow: []string{"internal.example"}}
+	for _, rawURL := range []string{"http://127.0.0.1/video.mp4", "https://93.184.215.14/video.mp4", "http://internal.example/video.mp4"} {
+		if err := guard.CheckURL(ctx, rawURL); err == nil {
+			t.Errorf("CheckURL(%s) accepted a URL with a proxy", rawURL)
+		}
+		if path, err := downloadFile(ctx, rawURL, guard); err == nil {
+			RemoveTemp(path)
+			t.Errorf("downloaded %s with a proxy", rawURL)
+		}
+	}
+	if proxied {
+		t.Error("a guarded download went through the proxy")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lukechampine.com/blake3"
+)
+
+// HashProgressInterval is how often HashFile reports its progress.
+var HashProgressInterval = 2 * time.Second
+
+// hashChunkSize is how much of the file is read before hashing it.
+const hashChunkSize = 1 << 20
+
+// hashBuffers keeps the chunk buffers of HashFile, which batches and
+// galleries call for every file.
+var hashBuffers = sync.Pool{New: func() any { return new([hashChunkSize]byte) }}
+
+// FileHashes are the digests of a file, in hex.
+type FileHashes struct {
+	SHA256 string `json:"sha256"`
+	// BLAKE3 is empty unless it was asked for.
+	BLAKE3 string `json:"blake3,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+// HashStatus is the progress of HashFile.
+type HashStatus struct {
+	Path    string
+	Done    int64
+	Total   int64
+	Elapsed time.Duration
+}
+
+// Rate returns the bytes hashed per second.
+func (s HashStatus) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Done) / s.Elapsed.Seconds()
+}
+
+// HashCache remembers the hashes of local files, so that repeated runs do
+// not hash large files again. Entries are only valid while the size and
+// modification time of the file are unchanged.
+type HashCache interface {
+	// Hashes returns the hashes recorded for path with that size and
+	// modification time.
+	Hashes(path string, size int64, modTime time.Time) (*FileHashes, bool)
+	// SaveHashes records the hashes of path.
+	SaveHashes(path string, size int64, modTime time.Time, hashes *FileHashes)
+}
+
+// HashFile computes the SHA-256 of a file and, with withBLAKE3, its BLAKE3,
+// both in a single read of the file. progress, when set, is called every
+// HashProgressInterval until the file is hashed.
+func HashFile(ctx context.Context, path string, withBLAKE3 bool, progress func(HashStatus)) (*FileHashes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return hashReader(ctx, file, path, info.Size(), withBLAKE3, progress)
+}
+
+// hashReader implements HashFile over the content of r, named path in the
+// progress and errors. total is its size, or -1 when unknown.
+func hashReader(ctx context.Context, r io.Reader, path string, total int64, withBLAKE3 bool, progress func(HashStatus)) (*FileHashes, error) {
+	hashers := []hash.Hash{sha256.New()}
+	if withBLAKE3 {
+		hashers = append(hashers, blake3.New(32, nil))
+	}
+	status := HashStatus{Path: path, Total: total}
+	start := time.Now()
+	ticker := time.NewTicker(HashProgressInterval)
+	defer ticker.Stop()
+
+	chunk := hashBuffers.Get().(*[hashChunkSize]byte)
+	defer hashBuffers.Put(chunk)
+	buf := chunk[:]
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// each algorithm hashes the chunk on its own core
+			var wg sync.WaitGroup
+			for _, hasher := range hashers[1:] {
+				wg.Add(1)
+				go func(hasher hash.Hash) {
+					defer wg.Done()
+					hasher.Write(buf[:n])
+				}(hasher)
+			}
+			hashers[0].Write(buf[:n])
+			wg.Wait()
+			status.Done += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %v", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			if progress != nil {
+				status.Elapsed = time.Since(start)
+				progress(status)
+			}
+		default:
+		}
+	}
+
+	hashes := &FileHashes{SHA256: hex.EncodeToString(hashers[0].Sum(nil)), Size: status.Done}
+	if withBLAKE3 {
+		hashes.BLAKE3 = hex.EncodeToString(hashers[1].Sum(nil))
+	}
+	return hashes, nil
+}
+
+// hashFile hashes a local file, reusing the hashes HashCache recorded for it
+// while it is unchanged.
+func (u *Uploader) hashFile(ctx context.Context, path string) (*FileHashes, error) {
+	if u.HashCache == nil {
+		return HashFile(ctx, path, u.BLAKE3, u.HashProgress)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if hashes, ok := u.HashCache.Hashes(path, info.Size(), info.ModTime()); ok && (hashes.BLAKE3 != "" || !u.BLAKE3) {
+		return hashes, nil
+	}
+	hashes, err := HashFile(ctx, path, u.BLAKE3, u.HashProgress)
+	if err != nil {
+		return nil, err
+	}
+	u.HashCache.SaveHashes(path, info.Size(), info.ModTime(), hashes)
+	return hashes, nil
+}
+
+func fileSHA256(ctx context.Context, path string) (string, error) {
+	hashes, err := HashFile(ctx, path, false, nil)
+	if err != nil {
+		return "", err
+	}
+	return hashes.SHA256, nil
+}
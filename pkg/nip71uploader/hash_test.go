@@ -0,0 +1,63 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRandom writes a file of size random bytes.
+func writeRandom(t testing.TB, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	path := filepath.Join(t.TempDir(), "random.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestHashFile(t *testing.T) {
+	// not a multiple of the chunk size, to hash a partial last chunk
+	path, data := writeRandom(t, 3*hashChunkSize+12345)
+	sum := sha256.Sum256(data)
+	for range 2 {
+		hashes, err := HashFile(context.Background(), path, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashes.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("sha256 %s, want %x", hashes.SHA256, sum)
+		}
+		if len(hashes.BLAKE3) != 64 {
+			t.Errorf("blake3 %q", hashes.BLAKE3)
+		}
+	}
+}
+
+func BenchmarkHashFile(b *testing.B) {
+	path, data := writeRandom(b, 32<<20)
+	for _, withBLAKE3 := range []bool{false, true} {
+		name := "sha256"
+		if withBLAKE3 {
+			name = "sha256+blake3"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for range b.N {
+				if _, err := HashFile(context.Background(), path, withBLAKE3, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultImetaFields are the media fields published for each kind when
+// Uploader.ImetaFields is empty: the fields of the NIP of the kind, plus the
+// technical ones players make use of.
+var DefaultImetaFields = map[int][]string{
+	events.KindVideo:            videoImetaFields,
+	events.KindShortVideo:       videoImetaFields,
+	events.KindLegacyVideo:      videoImetaFields,
+	events.KindLegacyShortVideo: videoImetaFields,
+	events.KindPicture:          {"url", "m", "alt", "x", "size", "dim", "blurhash", "thumbhash", "duration", "fallback"},
+	events.KindFileMetadata:     imeta.FieldNames,
+}
+
+var videoImetaFields = []string{"url", "m", "alt", "x", "size", "dim", "blurhash",
+	"thumbhash", "duration", "bitrate", "codec", "image", "fallback"}
+
+// CheckImetaFields returns an error for the names that are not media fields.
+func CheckImetaFields(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(imeta.FieldNames, name) {
+			return fmt.Errorf("unknown imeta field %q, must be one of %v", name, imeta.FieldNames)
+		}
+	}
+	return nil
+}
+
+// imetaFields returns the media fields to publish in events of the kind.
+func (u *Uploader) imetaFields(kind int) []string {
+	if len(u.ImetaFields) > 0 {
+		return u.ImetaFields
+	}
+	if fields, ok := DefaultImetaFields[kind]; ok {
+		return fields
+	}
+	return imeta.FieldNames
+}
+
+// selectImetaFields drops the media fields that are not to be published
+// from the imeta tags of the event, or from the top level tags of NIP-94
+// file events.
+func (u *Uploader) selectImetaFields(event *nostr.Event) error {
+	names := u.imetaFields(event.Kind)
+	tags := make(nostr.Tags, 0, len(event.Tags))
+	for _, tag := range event.Tags {
+		switch {
+		case len(tag) >= 1 && tag[0] == "imeta":
+			media, err := imeta.Parse(tag)
+			if err == nil {
+				media, err = media.Only(names)
+			}
+			if err == nil {
+				tag, err = media.Format()
+			}
+			if err != nil {
+				return fmt.Errorf("selecting imeta fields: %v", err)
+			}
+		case event.Kind == events.KindFileMetadata && len(tag) >= 1 &&
+			tag[0] != "url" && slices.Contains(imeta.FieldNames, tag[0]) && !slices.Contains(names, tag[0]):
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	event.Tags = tags
+	return nil
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// InputError is an invalid input, with the field or flag it concerns and a
+// hint on how to fix it.
+type InputError struct {
+	// Field is the name of the field or flag at fault, such as "-url",
+	// empty when the problem is not about a single one.
+	Field   string
+	Message string
+	Hint    string
+}
+
+func (e *InputError) Error() string {
+	message := e.Message
+	if e.Field != "" {
+		message = e.Field + ": " + message
+	}
+	if e.Hint != "" {
+		message += " (" + e.Hint + ")"
+	}
+	return message
+}
+
+// InputErrors are all the problems found in an input, reported together so
+// they can be fixed at once.
+type InputErrors []*InputError
+
+func (e InputErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := []string{fmt.Sprintf("%d problems with the input:", len(e))}
+	for _, problem := range e {
+		lines = append(lines, "  "+problem.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateInput checks if the provided video URL and published_at are
+// valid, returning an InputError naming the one at fault.
+func ValidateInput(videoURL, title, publishedAt string) error {
+	if videoURL == "" {
+		return &InputError{Field: "url", Message: "the video URL is empty", Hint: "upload a local file or give the URL of a hosted one"}
+	}
+
+	if parsed, err := url.ParseRequestURI(videoURL); err != nil || parsed.Host == "" {
+		return &InputError{Field: "url", Message: fmt.Sprintf("invalid video URL %q", videoURL), Hint: "give an absolute URL such as https://example.com/video.mp4"}
+	}
+
+	if publishedAt == "" {
+		return &InputError{Field: "published_at", Message: "published_at is empty", Hint: "give unix seconds or leave it out for the upload time"}
+	}
+
+	if _, err := strconv.ParseInt(publishedAt, 10, 64); err != nil {
+		return &InputError{Field: "published_at", Message: fmt.Sprintf("invalid published_at timestamp %q", publishedAt), Hint: "give unix seconds, converting dates with ParseTimestamp"}
+	}
+
+	return nil
+}
+
+// timestampLayouts are the date formats ParseTimestamp accepts besides unix
+// seconds. Those without a time zone are in local time.
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// relativeDays are the days ParseTimestamp accepts by name, as offsets from
+// today.
+var relativeDays = map[string]int{"yesterday": -1, "today": 0, "tomorrow": 1}
+
+// ParseTimestamp parses unix seconds, an RFC 3339 date, a date such as
+// "2024-01-02 15:04" or "2024-01-02" in local time, "now", "yesterday",
+// "today" or "tomorrow" optionally followed by a time such as "20:00", or a
+// time relative to now such as "-2h" or "+1d12h", into unix seconds.
+func ParseTimestamp(value string) (int64, error) {
+	return parseTimestamp(value, time.Now())
+}
+
+func parseTimestamp(value string, now time.Time) (int64, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if offset, err := parseOffset(value[1:]); err == nil {
+			if value[0] == '-' {
+				offset = -offset
+			}
+			return now.Add(offset).Unix(), nil
+		}
+	}
+	day, clock, _ := strings.Cut(strings.ToLower(value), " ")
+	if day == "now" && clock == "" {
+		return now.Unix(), nil
+	}
+	if offset, ok := relativeDays[day]; ok {
+		var hour, minute, second int
+		if clock = strings.TrimSpace(clock); clock != "" {
+			t, err := time.Parse("15:04:05", clock)
+			if err != nil {
+				t, err = time.Parse("15:04", clock)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid time %q in %q, expected HH:MM", clock, value)
+			}
+			hour, minute, second = t.Clock()
+		}
+		year, month, date := now.In(time.Local).Date()
+		return time.Date(year, month, date+offset, hour, minute, second, 0, time.Local).Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid date %q, expected unix seconds, RFC 3339, YYYY-MM-DD HH:MM, a day such as 'yesterday 20:00' or a relative time such as -2h", value)
+}
+
+// parseOffset parses a Go duration optionally preceded by a number of days,
+// such as "2h", "3d" or "1d12h".
+func parseOffset(value string) (time.Duration, error) {
+	var offset time.Duration
+	if days, rest, ok := strings.Cut(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		offset, value = time.Duration(n*24*float64(time.Hour)), rest
+		if value == "" {
+			return offset, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return offset + d, nil
+}
+
+// ParseTimecode parses a position in a video, given as seconds, as
+// "MM:SS" or "HH:MM:SS" with optional fractions of a second, or as a Go
+// duration such as "1m23s".
+func ParseTimecode(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q, expected seconds, MM:SS or HH:MM:SS", value)
+	}
+	var seconds float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		// minutes and hours are whole, and only the hours are unbounded
+		if err != nil || n < 0 || (i < len(parts)-1 && n != float64(int64(n))) || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid time %q, expected seconds, MM:SS or HH:MM:SS", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// sizeUnits are the suffixes ParseSize accepts, longest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"B", 1},
+}
+
+// ParseSize parses a number of bytes, optionally followed by a unit such as
+// "500MB", "1.5GB" or "2GiB".
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number, unit := value, int64(1)
+	for _, u := range sizeUnits {
+		if len(value) > len(u.suffix) && strings.EqualFold(value[len(value)-len(u.suffix):], u.suffix) {
+			number, unit = strings.TrimSpace(value[:len(value)-len(u.suffix)]), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a number with a unit such as 500MB", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize formats a number of bytes for humans, such as "1.5 GB".
+func FormatSize(bytes int64) string {
+	switch {
+	case bytes >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/1e9)
+	case bytes >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/1e6)
+	case bytes >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(bytes)/1e3)
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// NewSigner creates a signer from a hex or nsec encoded private key.
+func NewSigner(privateKey string) (nostr.Keyer, error) {
+	privateKey, err := DecodePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := keyer.NewPlainKeySigner(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating signer: %v", err)
+	}
+	return signer, nil
+}
+
+// DecodePrivateKey accepts a hex or nsec encoded private key and returns it
+// as hex.
+func DecodePrivateKey(privateKey string) (string, error) {
+	if !strings.HasPrefix(privateKey, "nsec") {
+		return privateKey, nil
+	}
+	_, decodedKey, err := nip19.Decode(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("decoding private key: %v", err)
+	}
+	hexKey, ok := decodedKey.(string)
+	if !ok {
+		return "", errors.New("decoded private key is not a string")
+	}
+	return hexKey, nil
+}
+
+// DecodePubKey accepts a hex, npub or nprofile encoded public key and
+// returns it as hex. See DecodeProfile for the relay hints of an nprofile.
+func DecodePubKey(pubKey string) (string, error) {
+	profile, err := DecodeProfile(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return profile.PublicKey, nil
+}
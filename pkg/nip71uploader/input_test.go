@@ -0,0 +1,65 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	now := time.Date(2024, 6, 2, 15, 30, 0, 0, time.Local)
+	for _, test := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"1717200000", time.Unix(1717200000, 0)},
+		{"2024-06-01T12:00:00Z", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-06-01 20:15", time.Date(2024, 6, 1, 20, 15, 0, 0, time.Local)},
+		{"now", now},
+		{"yesterday 20:00", time.Date(2024, 6, 1, 20, 0, 0, 0, time.Local)},
+		{"Today", time.Date(2024, 6, 2, 0, 0, 0, 0, time.Local)},
+		{"tomorrow 08:30:15", time.Date(2024, 6, 3, 8, 30, 15, 0, time.Local)},
+		{"-2h", now.Add(-2 * time.Hour)},
+		{"+90m", now.Add(90 * time.Minute)},
+		{"-1d12h", now.Add(-36 * time.Hour)},
+		{"+3d", now.Add(72 * time.Hour)},
+	} {
+		got, err := parseTimestamp(test.value, now)
+		if err != nil {
+			t.Errorf("parseTimestamp(%q): %v", test.value, err)
+		} else if got != test.want.Unix() {
+			t.Errorf("parseTimestamp(%q) = %v, want %v", test.value, time.Unix(got, 0), test.want)
+		}
+	}
+	for _, value := range []string{"", "soon", "yesterday 25:00", "-2x", "+-2h", "now 10:00"} {
+		if _, err := parseTimestamp(value, now); err == nil {
+			t.Errorf("parseTimestamp(%q) succeeded", value)
+		}
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	for _, test := range []struct {
+		url, publishedAt string
+		field            string
+	}{
+		{"https://example.com/video.mp4", "1717200000", ""},
+		{"", "1717200000", "url"},
+		{"video.mp4", "1717200000", "url"},
+		{"https://example.com/video.mp4", "yesterday", "published_at"},
+	} {
+		err := ValidateInput(test.url, "", test.publishedAt)
+		var inputErr *InputError
+		switch {
+		case test.field == "" && err != nil:
+			t.Errorf("ValidateInput(%q, %q): %v", test.url, test.publishedAt, err)
+		case test.field != "" && (!errors.As(err, &inputErr) || inputErr.Field != test.field || inputErr.Hint == ""):
+			t.Errorf("ValidateInput(%q, %q) = %v, want a hint about %s", test.url, test.publishedAt, err, test.field)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// stopwords are frequent short words telling apart the languages written in
+// the Latin script. Words shared by several languages count for all of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "this", "you", "on", "are", "was", "my", "we", "be", "have", "from", "at", "not", "what"},
+	"pt": {"o", "a", "os", "as", "de", "do", "da", "dos", "das", "e", "que", "não", "um", "uma", "para", "com", "em", "no", "na", "é", "se", "por", "mais", "mas", "você", "isso", "muito"},
+	"es": {"el", "la", "los", "las", "de", "del", "y", "que", "no", "un", "una", "para", "con", "en", "es", "se", "por", "más", "pero", "lo", "como", "muy", "esto", "está"},
+	"fr": {"le", "la", "les", "de", "des", "du", "et", "que", "ne", "pas", "un", "une", "pour", "avec", "en", "est", "dans", "sur", "qui", "ce", "il", "je", "vous", "nous", "au"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "den", "von", "ich", "sie", "es", "auf", "für", "im", "dem", "auch", "wir", "sich", "aber"},
+	"it": {"il", "la", "lo", "gli", "le", "di", "del", "della", "e", "che", "non", "un", "una", "per", "con", "in", "è", "si", "ma", "sono", "questo", "anche", "come"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "op", "te", "met", "voor", "zijn", "ik", "je", "maar", "ook", "wat", "er", "dit"},
+}
+
+// scripts are the writing systems used by a single language, or by one
+// language far more than any other.
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Arabic, "ar"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// links and hashtags say nothing about the language of a text
+var languageNoiseRegexp = regexp.MustCompile(`(?:https?://|nostr:|#)\S*`)
+
+// DetectLanguage guesses the ISO 639-1 code of the language of a text from
+// its script or, for the Latin script, from the frequent words it uses. It
+// returns "" when the text is too short or too mixed to tell.
+func DetectLanguage(text string) string {
+	text = languageNoiseRegexp.ReplaceAllString(text, " ")
+
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+	// any kana makes Han characters Japanese rather than Chinese
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+	if language, count := mostFrequent(counts); count > 0 && count*2 >= letters {
+		return language
+	}
+
+	clear(counts)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for language, words := range stopwords {
+			for _, stopword := range words {
+				if word == stopword {
+					counts[language]++
+				}
+			}
+		}
+	}
+	language, count := mostFrequent(counts)
+	for other, otherCount := range counts {
+		// a tie leaves the language unknown
+		if other != language && otherCount == count {
+			return ""
+		}
+	}
+	if count < 3 {
+		return ""
+	}
+	return language
+}
+
+// mostFrequent returns the language with the highest count.
+func mostFrequent(counts map[string]int) (string, int) {
+	var language string
+	count := 0
+	for candidate, n := range counts {
+		if n > count {
+			language, count = candidate, n
+		}
+	}
+	return language, count
+}
+
+// iso6392 maps the ISO 639-2 codes containers tag audio streams with to
+// their ISO 639-1 codes, for the languages media is commonly published in.
+var iso6392 = map[string]string{
+	"eng": "en", "por": "pt", "spa": "es", "fra": "fr", "fre": "fr",
+	"deu": "de", "ger": "de", "ita": "it", "nld": "nl", "dut": "nl",
+	"rus": "ru", "ukr": "uk", "pol": "pl", "ces": "cs", "cze": "cs",
+	"swe": "sv", "nor": "no", "dan": "da", "fin": "fi", "tur": "tr",
+	"ell": "el", "gre": "el", "heb": "he", "ara": "ar", "fas": "fa",
+	"per": "fa", "hin": "hi", "jpn": "ja", "kor": "ko", "zho": "zh",
+	"chi": "zh", "tha": "th", "vie": "vi", "ind": "id", "cat": "ca",
+	"ron": "ro", "rum": "ro", "hun": "hu",
+}
+
+// StreamLanguage returns the ISO 639-1 code of the language a media stream
+// is tagged with, given as an ISO 639-1 or 639-2 code, or "" when it is
+// undetermined or unknown.
+func StreamLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if len(tag) == 2 {
+		return tag
+	}
+	return iso6392[tag]
+}
+
+// labelLanguage adds, with DetectLanguage, the NIP-32 tags labelling the
+// language of an event that does not have a language label yet.
+func (u *Uploader) labelLanguage(event *nostr.Event, language string) {
+	if !u.DetectLanguage || language == "" {
+		return
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == events.LanguageNamespace {
+			return
+		}
+	}
+	if !event.Tags.ContainsAny("L", []string{events.LanguageNamespace}) {
+		event.Tags = append(event.Tags, nostr.Tag{"L", events.LanguageNamespace})
+	}
+	event.Tags = append(event.Tags, nostr.Tag{"l", language, events.LanguageNamespace})
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want string
+	}{
+		{"This is the story of a trip to the mountains with my friends #travel", "en"},
+		{"Um vídeo sobre a viagem que fizemos para a praia com os amigos", "pt"},
+		{"Un vídeo sobre el viaje que hicimos a la playa con los amigos", "es"},
+		{"Une vidéo sur le voyage que nous avons fait dans les montagnes", "fr"},
+		{"Ein Video über die Reise, die wir mit den Freunden gemacht haben", "de"},
+		{"東京の夜景を撮影しました", "ja"},
+		{"Прогулка по вечерней Москве", "ru"},
+		{"Sunset", ""},
+		{"https://example.com/video.mp4 #nostr", ""},
+	} {
+		if got := DetectLanguage(test.text); got != test.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+
+	for tag, want := range map[string]string{"eng": "en", "por": "pt", "ger": "de", "PT": "pt", "und": "", "": ""} {
+		if got := StreamLanguage(tag); got != want {
+			t.Errorf("StreamLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+
+	uploader := &Uploader{DetectLanguage: true}
+	event := &nostr.Event{Tags: nostr.Tags{{"L", "ISO-639-1"}, {"l", "pt", "ISO-639-1"}}}
+	uploader.labelLanguage(event, "en")
+	if len(event.Tags) != 2 {
+		t.Errorf("labelled language overridden: %v", event.Tags)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// legacyKinds are the legacy addressable kinds of the kind 21 and 22 videos.
+var legacyKinds = map[int]int{
+	events.KindVideo:      events.KindLegacyVideo,
+	events.KindShortVideo: events.KindLegacyShortVideo,
+}
+
+// LegacyAddress returns the "a" coordinate of the legacy copy of a kind 21
+// or 22 video event, which is known before the copy is built. Its "d" tag is
+// the one of the event or, without one, the hash of the first video.
+func LegacyAddress(event *nostr.Event) (string, error) {
+	kind, ok := legacyKinds[event.Kind]
+	if !ok {
+		return "", fmt.Errorf("events of kind %d have no legacy kind", event.Kind)
+	}
+	identifier := legacyIdentifier(event)
+	if identifier == "" {
+		return "", errors.New("legacy video events require a d tag or a video hash")
+	}
+	return fmt.Sprintf("%d:%s:%s", kind, event.PubKey, identifier), nil
+}
+
+func legacyIdentifier(event *nostr.Event) string {
+	if identifier := event.Tags.GetD(); identifier != "" {
+		return identifier
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "imeta" {
+			return imeta.Field(tag, "x")
+		}
+	}
+	return ""
+}
+
+// BuildLegacyCopy returns the unsigned legacy kind 34235 or 34236 copy of a
+// signed kind 21 or 22 video event, with proof of work already mined. The
+// copy keeps the content and tags of the event, and references it with an
+// "e" tag, the first relay being the hint; the event references the copy
+// with an "a" tag to its LegacyAddress when built with VideoOptions.BothKinds.
+func (u *Uploader) BuildLegacyCopy(ctx context.Context, video *nostr.Event, relays []string) (*nostr.Event, error) {
+	address, err := LegacyAddress(video)
+	if err != nil {
+		return nil, err
+	}
+	relay := RelayHint(relays)
+
+	event := &nostr.Event{
+		Kind:      legacyKinds[video.Kind],
+		PubKey:    video.PubKey,
+		CreatedAt: video.CreatedAt,
+		Content:   video.Content,
+	}
+	for _, tag := range video.Tags {
+		switch {
+		case len(tag) >= 1 && (tag[0] == "nonce" || tag[0] == "d"):
+		case len(tag) >= 2 && tag[0] == "a" && tag[1] == address:
+		default:
+			event.Tags = append(event.Tags, tag)
+		}
+	}
+	event.Tags = append(event.Tags, nostr.Tag{"d", legacyIdentifier(video)}, nostr.Tag{"e", video.ID, relay})
+	return event, u.Pow(ctx, event)
+}
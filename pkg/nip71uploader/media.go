@@ -0,0 +1,405 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnknownFileType is returned when the type of a file cannot be sniffed.
+var ErrUnknownFileType = errors.New("unknown file type")
+
+// MediaInfo describes a local media file.
+type MediaInfo struct {
+	Width    int
+	Height   int
+	Size     int64
+	Hash     string
+	Blurhash string
+	// Thumbhash is set when asked for with Previews.Thumbhash.
+	Thumbhash string
+	MIME      string
+	// Duration, Codec and Bitrate describe videos and audio, see
+	// VideoHeader and AudioHeader. The Duration of animated images is also
+	// set.
+	Duration float64
+	Codec    string
+	Bitrate  int64
+	// Cover reports whether an audio file embeds cover art.
+	Cover bool
+	// Language is the ISO 639-1 code of the language the audio of videos
+	// and audio files is tagged with, if any.
+	Language string
+	// Sensitive and ContentWarning are the verdict of Uploader.Classify.
+	Sensitive      bool
+	ContentWarning string
+}
+
+// Previews select the placeholders computed for images and videos, which
+// clients show while the media loads.
+type Previews struct {
+	// NoBlurhash leaves the blurhash out, which also saves extracting a
+	// frame of videos.
+	NoBlurhash bool
+	// Thumbhash adds a ThumbHash, see EncodeThumbhash.
+	Thumbhash bool
+}
+
+// enabled reports whether any placeholder is computed, which needs a frame
+// of videos and the pixels of images.
+func (p Previews) enabled() bool {
+	return !p.NoBlurhash || p.Thumbhash
+}
+
+// previewSize is the longest side images are scaled down to before
+// computing their placeholders, which only keep the coarsest details.
+const previewSize = 100
+
+// GetImageDimensions returns the width and height of an image file
+func GetImageDimensions(filePath string) (int, int, string, error) {
+	width, height, placeholders, err := measureImage(filePath, Previews{})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return width, height, placeholders.Blurhash, nil
+}
+
+// measureImage decodes an image and computes its placeholders, returned in
+// the Blurhash and Thumbhash of a MediaInfo. Without placeholders, only the
+// header of the image is read.
+func measureImage(filePath string, previews Previews) (int, int, *MediaInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer file.Close()
+
+	if !previews.enabled() {
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return config.Width, config.Height, &MediaInfo{}, nil
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	placeholders, err := imagePreviews(img, previews)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return img.Bounds().Dx(), img.Bounds().Dy(), placeholders, nil
+}
+
+// imagePreviews computes the placeholders of an image, returned in the
+// Blurhash and Thumbhash of a MediaInfo.
+func imagePreviews(img image.Image, previews Previews) (*MediaInfo, error) {
+	img = downscale(img, previewSize)
+	placeholders := &MediaInfo{}
+	if !previews.NoBlurhash {
+		bhash, err := generateBlurhash(img)
+		if err != nil {
+			return nil, err
+		}
+		placeholders.Blurhash = bhash
+	}
+	if previews.Thumbhash {
+		placeholders.Thumbhash = EncodeThumbhash(img)
+	}
+	return placeholders, nil
+}
+
+// downscale returns the image scaled down to fit in size x size pixels, or
+// the image itself when it fits already.
+func downscale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= size && bounds.Dy() <= size {
+		return img
+	}
+	width, height := size, bounds.Dy()*size/bounds.Dx()
+	if bounds.Dy() > bounds.Dx() {
+		width, height = bounds.Dx()*size/bounds.Dy(), size
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, max(1, width), max(1, height)))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// GetVideoDimensions measures the video with ProbeVideo and computes the
+// blurhash of a frame extracted with ffmpeg. The dimensions are the
+// displayed ones, swapped for rotated videos. Without ffmpeg, or when the
+// extraction fails, the blurhash is left empty.
+func GetVideoDimensions(ctx context.Context, filePath string) (int, int, string, error) {
+	header, placeholders, err := probeVideo(ctx, filePath, Previews{})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	width, height := header.DisplaySize()
+	return width, height, placeholders.Blurhash, nil
+}
+
+// probeVideo measures the video and computes the placeholders of a frame,
+// returned in the Blurhash and Thumbhash of a MediaInfo.
+func probeVideo(ctx context.Context, filePath string, previews Previews) (*VideoHeader, *MediaInfo, error) {
+	header, err := ProbeVideo(ctx, filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("measuring video: %v", err)
+	}
+	if !previews.enabled() {
+		return header, &MediaInfo{}, nil
+	}
+	if _, err := ffmpegBinary(ctx); err != nil {
+		log.Printf("ffmpeg is not installed, publishing %s without blurhash", filePath)
+		return header, &MediaInfo{}, nil
+	}
+
+	// a small frame is enough, and much faster to decode
+	framePath, err := extractFrame(ctx, filePath, time.Second, previewSize)
+	if err != nil {
+		log.Printf("%v, publishing %s without blurhash", err, filePath)
+		return header, &MediaInfo{}, nil
+	}
+	defer RemoveTemp(framePath)
+	img, err := LoadImage(framePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	placeholders, err := imagePreviews(img, previews)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, placeholders, nil
+}
+
+func generateBlurhash(img image.Image) (string, error) {
+	x, y := 9, 7
+	if img.Bounds().Dx() < img.Bounds().Dy() {
+		x, y = y, x
+	}
+
+	// Generate the BlurHash string
+	bhash, err := blurhash.Encode(x, y, img)
+	if err != nil {
+		return "", fmt.Errorf("generating blurhash: %v", err)
+	}
+	return bhash, nil
+}
+
+// DetectMIME sniffs the MIME type of a file from its first bytes. The type
+// of video and audio containers is then refined from their headers, as
+// WebM, Matroska and QuickTime files are easily mistaken for one another,
+// and files that cannot be sniffed fall back to ffprobe and to their
+// extension.
+func DetectMIME(filePath string) (string, error) {
+	sniffed, err := sniffMIME(filePath)
+	if err != nil && !errors.Is(err, ErrUnknownFileType) {
+		return "", err
+	}
+	if err == nil && !strings.HasPrefix(sniffed, "video/") && !strings.HasPrefix(sniffed, "audio/") {
+		return sniffed, nil
+	}
+	if container := containerMIME(filePath); container != "" {
+		return container, nil
+	}
+	if err == nil {
+		return sniffed, nil
+	}
+	if probed := ffprobeMIME(filePath); probed != "" {
+		return probed, nil
+	}
+	if byExtension := extensionMIME(filePath); byExtension != "" {
+		return byExtension, nil
+	}
+	return "", ErrUnknownFileType
+}
+
+// mediaExtensions maps the extensions of media files to their MIME type,
+// for files whose content cannot be sniffed.
+var mediaExtensions = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".ts":   "video/mp2t",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+}
+
+// extensionMIME returns the MIME type of a file from its extension.
+func extensionMIME(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if mimeType, ok := mediaExtensions[ext]; ok {
+		return mimeType
+	}
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return mimeType
+}
+
+// sniffMIME identifies a file from its first bytes with filetype.
+func sniffMIME(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 261)
+	_, err = file.Read(head)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+
+	kind, err := filetype.Match(head)
+	if err != nil {
+		return "", fmt.Errorf("error matching file: %v", err)
+	}
+
+	if kind == types.Unknown {
+		return "", ErrUnknownFileType
+	}
+	return kind.MIME.Value, nil
+}
+
+// GetMediaDimensions returns the dimensions, blurhash and MIME type of a
+// media file. fileType must be "image", "video" or "audio", or "file" to
+// accept any file and only measure it when it is an image or a video.
+func GetMediaDimensions(ctx context.Context, filePath string, fileType string) (int, int, string, string, error) {
+	info, err := mediaDimensions(ctx, filePath, fileType, Previews{})
+	if err != nil {
+		return 0, 0, "", "", err
+	}
+	return info.Width, info.Height, info.Blurhash, info.MIME, nil
+}
+
+// mediaDimensions implements GetMediaDimensions, also filling the details
+// of the video stream of videos and the placeholders selected by previews.
+func mediaDimensions(ctx context.Context, filePath string, fileType string, previews Previews) (*MediaInfo, error) {
+	mime, err := DetectMIME(filePath)
+	if errors.Is(err, ErrUnknownFileType) && fileType == "file" {
+		return &MediaInfo{MIME: "application/octet-stream"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return measureMedia(ctx, filePath, mime, fileType, previews)
+}
+
+// measureMedia is mediaDimensions for a file of a known MIME type. Videos and
+// audio files can be URLs, which ffprobe and ffmpeg read in place.
+func measureMedia(ctx context.Context, filePath, mime, fileType string, previews Previews) (*MediaInfo, error) {
+	var err error
+	info := &MediaInfo{MIME: mime}
+	if strings.HasPrefix(mime, "image") && (fileType == "image" || fileType == "file") {
+		var animation *Animation
+		if animation, err = ReadAnimation(filePath); err == nil && animation != nil {
+			info.Duration = animation.Duration
+		}
+		if err == nil {
+			var placeholders *MediaInfo
+			info.Width, info.Height, placeholders, err = measureImage(filePath, previews)
+			if err == nil {
+				info.Blurhash, info.Thumbhash = placeholders.Blurhash, placeholders.Thumbhash
+			}
+			// the WebP decoder does not support animations, which then
+			// go without blurhash
+			if err != nil && animation != nil {
+				info.Width, info.Height, err = animation.Width, animation.Height, nil
+			}
+		}
+	} else if strings.HasPrefix(mime, "video") && (fileType == "video" || fileType == "file") {
+		var header *VideoHeader
+		var placeholders *MediaInfo
+		header, placeholders, err = probeVideo(ctx, filePath, previews)
+		if err == nil {
+			info.Blurhash, info.Thumbhash = placeholders.Blurhash, placeholders.Thumbhash
+			info.Width, info.Height = header.DisplaySize()
+			info.Duration = header.Duration
+			info.Codec = header.Codec
+			info.Bitrate = header.Bitrate
+			info.Language = header.Language
+		}
+	} else if strings.HasPrefix(mime, "audio") && (fileType == "audio" || fileType == "file") {
+		header, probeErr := ProbeAudio(ctx, filePath)
+		if probeErr != nil {
+			log.Printf("%v, publishing %s without duration", probeErr, filePath)
+		} else {
+			info.Duration = header.Duration
+			info.Codec = header.Codec
+			info.Bitrate = header.Bitrate
+			info.Cover = header.Cover
+			info.Language = header.Language
+		}
+	} else if fileType != "file" {
+		return nil, errors.New("unsupported media type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ExtractMediaInfo measures, hashes and identifies a local media file.
+func ExtractMediaInfo(ctx context.Context, filePath string, fileType string) (*MediaInfo, error) {
+	info, err := mediaDimensions(ctx, filePath, fileType, Previews{})
+	if err != nil {
+		return nil, fmt.Errorf("GetMediaDimensions: %v", err)
+	}
+
+	hashes, err := HashFile(ctx, filePath, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = hashes.Size
+	info.Hash = hashes.SHA256
+	return info, nil
+}
+
+// LoadImage loads an image from the specified file path.
+func LoadImage(filePath string) (image.Image, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open(%s): %v", filePath, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode(%s): %v", filePath, err)
+	}
+
+	return img, nil
+}
+
+// ExtractFrameFromVideo extracts a frame from the video file and saves it as an image
+// in a temporary file, which the caller removes with RemoveTemp.
+// ffmpeg applies the rotation of the video, so the frame is the right way up.
+func ExtractFrameFromVideo(ctx context.Context, videoPath string) (string, error) {
+	return ExtractFrame(ctx, videoPath, time.Second)
+}
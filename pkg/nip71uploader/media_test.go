@@ -0,0 +1,62 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"testing"
+)
+
+func TestMeasureImage(t *testing.T) {
+	path := writePNG(t, 640, 480)
+	for _, previews := range []Previews{{}, {NoBlurhash: true}, {NoBlurhash: true, Thumbhash: true}} {
+		width, height, placeholders, err := measureImage(path, previews)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != 640 || height != 480 {
+			t.Errorf("%+v: dimensions %dx%d, want 640x480", previews, width, height)
+		}
+		if (placeholders.Blurhash != "") == previews.NoBlurhash {
+			t.Errorf("%+v: blurhash %q", previews, placeholders.Blurhash)
+		}
+		if (placeholders.Thumbhash != "") != previews.Thumbhash {
+			t.Errorf("%+v: thumbhash %q", previews, placeholders.Thumbhash)
+		}
+	}
+}
+
+func BenchmarkMeasureImage(b *testing.B) {
+	path := writePNG(b, 2048, 1536)
+	for _, test := range []struct {
+		name     string
+		previews Previews
+	}{
+		{"dimensions", Previews{NoBlurhash: true}},
+		{"blurhash", Previews{}},
+		{"thumbhash", Previews{NoBlurhash: true, Thumbhash: true}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			for range b.N {
+				if _, _, _, err := measureImage(path, test.previews); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateBlurhash(b *testing.B) {
+	img, err := LoadImage(writePNG(b, 2048, 1536))
+	if err != nil {
+		b.Fatal(err)
+	}
+	img = downscale(img, previewSize)
+	b.ResetTimer()
+	for range b.N {
+		if _, err := generateBlurhash(img); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
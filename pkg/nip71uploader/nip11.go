@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip11"
+)
+
+// CheckRelayInfo fetches the NIP-11 document of every relay and returns a
+// warning for each limit the event will run into: a kind the relay does not
+// store, content or tags beyond its maximum, or a required payment. Relays
+// asking for more proof of work than configured have their pow-required
+// raised with SetRelayConfig, so the event gets mined for them. It must be
+// called before mining the proof of work.
+func CheckRelayInfo(ctx context.Context, event *nostr.Event, relays []string) []string {
+	var mu sync.Mutex
+	var warnings []string
+	var wg sync.WaitGroup
+	for _, relayURL := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetchCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+			defer cancel()
+			info, err := nip11.Fetch(fetchCtx, relayURL)
+			if err != nil {
+				log.Printf("Error fetching NIP-11 document of relay %s: %v", relayURL, err)
+				return
+			}
+			relayWarnings := checkRelayLimits(event, relayURL, info)
+			mu.Lock()
+			warnings = append(warnings, relayWarnings...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return warnings
+}
+
+func checkRelayLimits(event *nostr.Event, relayURL string, info nip11.RelayInformationDocument) []string {
+	var warnings []string
+	for _, retention := range info.Retention {
+		if retention != nil && retention.Count == 0 && retention.Time == 0 && kindInRanges(event.Kind, retention.Kinds) {
+			warnings = append(warnings, fmt.Sprintf("relay %s does not store events of kind %d", relayURL, event.Kind))
+		}
+	}
+
+	limits := info.Limitation
+	if limits == nil {
+		return warnings
+	}
+	if limits.MaxContentLength > 0 && len(event.Content) > limits.MaxContentLength {
+		warnings = append(warnings, fmt.Sprintf("relay %s accepts at most %d characters of content, event has %d",
+			relayURL, limits.MaxContentLength, len(event.Content)))
+	}
+	if limits.MaxEventTags > 0 && len(event.Tags) > limits.MaxEventTags {
+		warnings = append(warnings, fmt.Sprintf("relay %s accepts at most %d tags, event has %d",
+			relayURL, limits.MaxEventTags, len(event.Tags)))
+	}
+	if limits.PaymentRequired {
+		warnings = append(warnings, fmt.Sprintf("relay %s requires payment", relayURL))
+	}
+	if config := relayConfig(relayURL); limits.MinPowDifficulty > config.PowRequired {
+		warnings = append(warnings, fmt.Sprintf("relay %s requires proof of work %d, mining for it",
+			relayURL, limits.MinPowDifficulty))
+		config.PowRequired = limits.MinPowDifficulty
+		SetRelayConfig(config)
+	}
+	return warnings
+}
+
+// kindInRanges reports whether kind is listed in NIP-11 kinds, where each
+// entry is either a single kind or a [from, to] range.
+func kindInRanges(kind int, ranges [][]int) bool {
+	if len(ranges) == 0 {
+		// a retention entry without kinds applies to every kind
+		return true
+	}
+	for _, r := range ranges {
+		switch len(r) {
+		case 1:
+			if r[0] == kind {
+				return true
+			}
+		case 2:
+			if kind >= r[0] && kind <= r[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// EncodeEvent returns the NIP-19 nevent of a signed event and, for
+// addressable kinds, its naddr. The relays are embedded as hints.
+func EncodeEvent(event *nostr.Event, relays []string) (nevent string, naddr string, err error) {
+	nevent, err = nip19.EncodeEvent(event.ID, relays, event.PubKey)
+	if err != nil {
+		return "", "", err
+	}
+	if nostr.IsAddressableKind(event.Kind) {
+		naddr, err = nip19.EncodeEntity(event.PubKey, event.Kind, event.Tags.GetD(), relays)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return nevent, naddr, nil
+}
+
+var nip19Prefixes = []string{"npub", "nsec", "note", "nprofile", "nevent", "naddr", "nrelay"}
+
+// nip19Prefix returns the kind of NIP-19 entity of value, such as "nevent",
+// or "" when it is not one. A NIP-21 "nostr:" scheme is removed from value.
+func nip19Prefix(value string) (string, string) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "nostr:")
+	for _, prefix := range nip19Prefixes {
+		if strings.HasPrefix(value, prefix+"1") {
+			return prefix, value
+		}
+	}
+	return "", value
+}
+
+// shorten abbreviates a long value for error messages.
+func shorten(value string) string {
+	if len(value) > 20 {
+		return value[:16] + "..."
+	}
+	return value
+}
+
+// decodeNIP19 decodes a NIP-19 entity of one of the wanted kinds, telling
+// what the value is when it is of another kind.
+func decodeNIP19(value, want string, prefixes ...string) (string, any, error) {
+	prefix, value := nip19Prefix(value)
+	if prefix == "" || !slices.Contains(prefixes, prefix) {
+		if prefix != "" {
+			return "", nil, fmt.Errorf("%s is an %s, expected %s", shorten(value), prefix, want)
+		}
+		return "", nil, fmt.Errorf("%q is not %s", shorten(value), want)
+	}
+	_, decoded, err := nip19.Decode(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding %s %s: %v", prefix, shorten(value), err)
+	}
+	return prefix, decoded, nil
+}
+
+// DecodeProfile accepts a hex public key, an npub or an nprofile, with or
+// without the "nostr:" scheme, and returns the public key with the relay
+// hints of the nprofile.
+func DecodeProfile(value string) (nostr.ProfilePointer, error) {
+	if nostr.IsValidPublicKey(value) {
+		return nostr.ProfilePointer{PublicKey: value}, nil
+	}
+	_, decoded, err := decodeNIP19(value, "a pubkey, npub or nprofile", "npub", "nprofile")
+	if err != nil {
+		return nostr.ProfilePointer{}, err
+	}
+	var profile nostr.ProfilePointer
+	switch v := decoded.(type) {
+	case string:
+		profile.PublicKey = v
+	case nostr.ProfilePointer:
+		profile = v
+	}
+	if !nostr.IsValidPublicKey(profile.PublicKey) {
+		return nostr.ProfilePointer{}, fmt.Errorf("invalid public key %q", profile.PublicKey)
+	}
+	return profile, nil
+}
+
+// DecodeEventPointer accepts a hex event id, a note, an nevent, an naddr or
+// a "<kind>:<pubkey>:<d tag>" coordinate, with or without the "nostr:"
+// scheme. It returns a nostr.EventPointer or, for addresses, a
+// nostr.EntityPointer, with the relay hints of the reference.
+func DecodeEventPointer(ref string) (nostr.Pointer, error) {
+	if _, err := hex.DecodeString(ref); err == nil && len(ref) == 64 {
+		return nostr.EventPointer{ID: ref}, nil
+	}
+	if parts := strings.SplitN(ref, ":", 3); len(parts) == 3 && parts[0] != "nostr" {
+		kind, err := strconv.Atoi(parts[0])
+		if err != nil || !nostr.IsValidPublicKey(parts[1]) {
+			return nil, fmt.Errorf("invalid coordinate %q, expected <kind>:<pubkey>:<d tag>", shorten(ref))
+		}
+		return nostr.EntityPointer{Kind: kind, PublicKey: parts[1], Identifier: parts[2]}, nil
+	}
+	_, decoded, err := decodeNIP19(ref, "an nevent, naddr, note, coordinate or event id", "note", "nevent", "naddr")
+	if err != nil {
+		return nil, err
+	}
+	switch v := decoded.(type) {
+	case string:
+		return nostr.EventPointer{ID: v}, nil
+	case nostr.EventPointer:
+		return v, nil
+	case nostr.EntityPointer:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported reference type %T", decoded)
+}
+
+// DecodeRelay accepts a ws:// or wss:// relay address or an nrelay, with or
+// without the "nostr:" scheme, and returns the address.
+func DecodeRelay(value string) (string, error) {
+	if strings.HasPrefix(value, "ws://") || strings.HasPrefix(value, "wss://") {
+		return value, nil
+	}
+	prefix, value := nip19Prefix(value)
+	if prefix == "" {
+		return "", fmt.Errorf("%q is not a ws:// or wss:// relay address or an nrelay", shorten(value))
+	}
+	if prefix != "nrelay" {
+		return "", fmt.Errorf("%s is an %s, expected a relay address or an nrelay", shorten(value), prefix)
+	}
+	// go-nostr no longer decodes the deprecated nrelay, a TLV entry with
+	// the relay address
+	_, bits5, err := bech32.DecodeNoLimit(value)
+	if err != nil {
+		return "", fmt.Errorf("decoding nrelay %s: %v", shorten(value), err)
+	}
+	data, err := bech32.ConvertBits(bits5, 5, 8, false)
+	if err != nil {
+		return "", fmt.Errorf("decoding nrelay %s: %v", shorten(value), err)
+	}
+	for len(data) >= 2 && len(data) >= 2+int(data[1]) {
+		typ, entry := data[0], data[2:2+int(data[1])]
+		data = data[2+len(entry):]
+		if typ == 0 {
+			relay := string(entry)
+			if !strings.HasPrefix(relay, "ws://") && !strings.HasPrefix(relay, "wss://") {
+				return "", fmt.Errorf("nrelay %s has an invalid relay address %q", shorten(value), relay)
+			}
+			return relay, nil
+		}
+	}
+	return "", fmt.Errorf("nrelay %s has no relay address", shorten(value))
+}
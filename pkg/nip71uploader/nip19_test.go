@@ -0,0 +1,51 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// nip19Seeds returns one entity of every NIP-19 kind.
+func nip19Seeds() []string {
+	pubKey := "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	id := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	npub, _ := nip19.EncodePublicKey(pubKey)
+	nprofile, _ := nip19.EncodeProfile(pubKey, []string{"wss://relay.damus.io"})
+	note, _ := nip19.EncodeNote(id)
+	nevent, _ := nip19.EncodeEvent(id, []string{"wss://relay.damus.io"}, pubKey)
+	naddr, _ := nip19.EncodeEntity(pubKey, 34235, "episode-1", []string{"wss://nos.lol"})
+	nsec, _ := nip19.EncodePrivateKey(strings.Repeat("01", 32))
+	relay := "wss://relay.damus.io"
+	bits5, _ := bech32.ConvertBits(append([]byte{0, byte(len(relay))}, relay...), 8, 5, true)
+	nrelay, _ := bech32.Encode("nrelay", bits5)
+	return []string{pubKey, id, npub, nprofile, note, nevent, "nostr:" + naddr, nsec,
+		nrelay,
+		"34235:" + pubKey + ":episode-1", "wss://relay.damus.io", "nostr:", "npub1", ""}
+}
+
+// FuzzDecodeReferences feeds arbitrary references, as typed by users or
+// found in downloaded events, to the NIP-19 decoders.
+func FuzzDecodeReferences(f *testing.F) {
+	for _, seed := range nip19Seeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if profile, err := DecodeProfile(value); err == nil && !nostr.IsValidPublicKey(profile.PublicKey) {
+			t.Fatalf("%q decoded to the invalid pubkey %q", value, profile.PublicKey)
+		}
+		if pointer, err := DecodeEventPointer(value); err == nil && pointer == nil {
+			t.Fatalf("%q decoded to a nil pointer", value)
+		}
+		if relay, err := DecodeRelay(value); err == nil && !strings.HasPrefix(relay, "ws://") && !strings.HasPrefix(relay, "wss://") {
+			t.Fatalf("%q decoded to the relay %q", value, relay)
+		}
+	})
+}
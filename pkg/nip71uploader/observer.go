@@ -0,0 +1,47 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Observer is told about the stages of the pipeline, for the metrics and
+// traces of long running commands. Its methods are called concurrently.
+type Observer interface {
+	// Start starts a span for the named stage, such as "download", "upload",
+	// "pow" or "publish", within the span of ctx. attrs are key and value
+	// pairs. The returned function ends the span with the error of the
+	// stage, nil on success.
+	Start(ctx context.Context, name string, attrs ...string) (context.Context, func(error))
+	// Uploaded is called after every upload of size bytes to a Blossom
+	// server.
+	Uploaded(server string, size int64, err error)
+	// Downloaded is called after every download of a remote media file.
+	Downloaded(size int64, err error)
+	// Mined is called after the proof of work of an event is computed.
+	Mined(difficulty int, elapsed time.Duration, err error)
+	// Published is called with the outcome of every publish.
+	Published(results []PublishResult)
+}
+
+// start starts a span of Observer, or does nothing without it.
+func (u *Uploader) start(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	if u.Observer == nil {
+		return ctx, func(error) {}
+	}
+	return u.Observer.Start(ctx, name, attrs...)
+}
+
+// fileSize returns the size of the file, or 0 when it cannot be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
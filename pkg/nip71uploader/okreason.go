@@ -0,0 +1,138 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Machine readable prefixes of the messages of OK and CLOSED relay
+// responses (NIP-01, formerly NIP-20).
+const (
+	ReasonDuplicate    = "duplicate"
+	ReasonPow          = "pow"
+	ReasonBlocked      = "blocked"
+	ReasonRateLimited  = "rate-limited"
+	ReasonInvalid      = "invalid"
+	ReasonRestricted   = "restricted"
+	ReasonAuthRequired = "auth-required"
+	ReasonError        = "error"
+)
+
+var knownReasons = []string{ReasonDuplicate, ReasonPow, ReasonBlocked, ReasonRateLimited,
+	ReasonInvalid, ReasonRestricted, ReasonAuthRequired, ReasonError}
+
+// RateLimitRetries is how many times publishing to a relay is tried again
+// after a rate-limited rejection, waiting RateLimitBackoff, then twice as
+// long each time.
+var (
+	RateLimitRetries = 3
+	RateLimitBackoff = 2 * time.Second
+)
+
+// MaxRemineDifficulty is the highest difficulty an event is mined again for
+// when relays reject it with a pow reason, so that a relay asking for an
+// unreasonable difficulty does not keep the command mining.
+var MaxRemineDifficulty = 28
+
+// ParseReason returns the machine readable prefix of the message of a relay
+// rejection, empty when it has none, and the rest of the message.
+func ParseReason(err error) (string, string) {
+	if err == nil {
+		return "", ""
+	}
+	// go-nostr reports the message of the relay as "msg: <message>"
+	message := strings.TrimPrefix(err.Error(), "msg: ")
+	prefix, rest, ok := strings.Cut(message, ":")
+	if !ok {
+		return "", message
+	}
+	for _, reason := range knownReasons {
+		if prefix == reason {
+			return reason, strings.TrimSpace(rest)
+		}
+	}
+	return "", message
+}
+
+var numberPattern = regexp.MustCompile(`\d+`)
+
+// powRequirement reads the difficulty required by a pow rejection, such as
+// "difficulty 20 is less than 28", as the highest number of the message.
+func powRequirement(message string) int {
+	required := 0
+	for _, number := range numberPattern.FindAllString(message, -1) {
+		if n, err := strconv.Atoi(number); err == nil && n <= 256 {
+			required = max(required, n)
+		}
+	}
+	return required
+}
+
+// blockedRelays are the relays that rejected an event of a pubkey as
+// blocked, which are not tried again for that pubkey during the run.
+var blockedRelays = struct {
+	sync.Mutex
+	set map[string]bool
+}{set: make(map[string]bool)}
+
+func blockedKey(relayURL, pubKey string) string {
+	return relayURL + " " + pubKey
+}
+
+// publishReacting publishes to one relay with publish, reacting to the
+// reason of a rejection: it backs off and tries again when rate limited,
+// pausing the later publishes to the relay as long,
+// skips relays that blocked the pubkey before, and raises the proof of work
+// the relay requires on pow, for Uploader.Publish to mine the event again.
+func publishReacting(ctx context.Context, relayURL, pubKey string, publish func(ctx context.Context, relayURL string) error) (string, error) {
+	blockedRelays.Lock()
+	blocked := blockedRelays.set[blockedKey(relayURL, pubKey)]
+	blockedRelays.Unlock()
+	if blocked {
+		return ReasonBlocked, fmt.Errorf("relay blocked an event of this pubkey before, skipping it")
+	}
+
+	backoff := RateLimitBackoff
+	for attempt := 0; ; attempt++ {
+		err := publish(ctx, relayURL)
+		reason, message := ParseReason(err)
+		switch reason {
+		case ReasonDuplicate:
+			// the relay has the event already
+			return reason, nil
+		case ReasonRateLimited:
+			if attempt < RateLimitRetries {
+				log.Printf("Relay %s is rate limiting, trying again in %v", relayURL, backoff)
+				pauseRelay(relayURL, backoff)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return reason, err
+				}
+				backoff *= 2
+				continue
+			}
+		case ReasonBlocked:
+			blockedRelays.Lock()
+			blockedRelays.set[blockedKey(relayURL, pubKey)] = true
+			blockedRelays.Unlock()
+		case ReasonPow:
+			if required := powRequirement(message); required > relayConfig(relayURL).PowRequired {
+				config := relayConfig(relayURL)
+				config.PowRequired = required
+				SetRelayConfig(config)
+			}
+		}
+		return reason, err
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultIndexerRelays are queried for NIP-65 relay lists when no other
+// indexers are configured.
+var DefaultIndexerRelays = []string{
+	"wss://purplepag.es",
+	"wss://user.kindpag.es",
+	"wss://relay.nos.social",
+}
+
+// FetchWriteRelays looks up the newest NIP-65 relay list (kind 10002) of
+// pubKey on the indexer relays and returns the relays declared for writing.
+// It returns nil when no relay list was found.
+func FetchWriteRelays(ctx context.Context, pubKey string, indexers []string) []string {
+	if len(indexers) == 0 {
+		indexers = DefaultIndexerRelays
+	}
+	filter := nostr.Filter{
+		Kinds:   []int{nostr.KindRelayListMetadata},
+		Authors: []string{pubKey},
+		Limit:   1,
+	}
+	event := FetchLatestEvent(ctx, filter, indexers)
+	if event == nil {
+		return nil
+	}
+	return writeRelays(event.Tags)
+}
+
+// writeRelays returns the "r" tags without a marker or marked "write".
+func writeRelays(tags nostr.Tags) []string {
+	var relays []string
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "r" || !nostr.IsValidRelayURL(tag[1]) {
+			continue
+		}
+		if len(tag) >= 3 && tag[2] != "write" {
+			continue
+		}
+		relays = append(relays, nostr.NormalizeURL(tag[1]))
+	}
+	return relays
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RelayPool keeps relay connections open between publishes, so that batch
+// operations connect and authenticate once per relay instead of once per
+// event. Connections that dropped are reopened on the next publish. A
+// RelayPool is safe for concurrent use.
+type RelayPool struct {
+	signer nostr.Keyer
+
+	mu     sync.Mutex
+	relays map[string]*pooledRelay
+}
+
+type pooledRelay struct {
+	// mu serializes connecting and authenticating with the relay
+	mu    sync.Mutex
+	relay *nostr.Relay
+}
+
+// NewRelayPool returns an empty pool authenticating with signer.
+func NewRelayPool(signer nostr.Keyer) *RelayPool {
+	return &RelayPool{
+		signer: signer,
+		relays: make(map[string]*pooledRelay),
+	}
+}
+
+// Publish sends the event to the relays like PublishEvent, reusing the
+// pool's connections.
+func (p *RelayPool) Publish(ctx context.Context, event *nostr.Event, relays []string) []PublishResult {
+	return publishAll(ctx, event, relays, func(ctx context.Context, relayURL string) error {
+		return p.publishToRelay(ctx, event, relayURL)
+	})
+}
+
+// Close closes every connection of the pool.
+func (p *RelayPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for url, pooled := range p.relays {
+		pooled.mu.Lock()
+		if pooled.relay != nil {
+			pooled.relay.Close()
+		}
+		pooled.mu.Unlock()
+		delete(p.relays, url)
+	}
+}
+
+func (p *RelayPool) entry(relayURL string) *pooledRelay {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	url := nostr.NormalizeURL(relayURL)
+	pooled, ok := p.relays[url]
+	if !ok {
+		pooled = &pooledRelay{}
+		p.relays[url] = pooled
+	}
+	return pooled
+}
+
+// connect returns the open connection to the relay, reconnecting (and
+// authenticating again when needed) if it was lost.
+func (p *RelayPool) connect(ctx context.Context, relayURL string) (*pooledRelay, *nostr.Relay, error) {
+	pooled := p.entry(relayURL)
+	pooled.mu.Lock()
+	defer pooled.mu.Unlock()
+	if pooled.relay != nil && pooled.relay.IsConnected() {
+		return pooled, pooled.relay, nil
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+	defer cancel()
+	// the connection outlives this publish, so it is not bound to ctx
+	relay := nostr.NewRelay(context.Background(), relayURL)
+	if err := relay.Connect(connectCtx); err != nil {
+		log.Printf("Error connecting to relay %s: %v", relayURL, err)
+		return nil, nil, err
+	}
+	pooled.relay = relay
+
+	if relayConfig(relayURL).Auth {
+		if err := authenticate(ctx, p.signer, relay, true); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pooled, relay, nil
+}
+
+func (p *RelayPool) publishToRelay(ctx context.Context, event *nostr.Event, relayURL string) error {
+	if err := checkPow(event, relayURL); err != nil {
+		return err
+	}
+	pooled, relay, err := p.connect(ctx, relayURL)
+	if err != nil {
+		return err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+	defer cancel()
+	err = relay.Publish(publishCtx, *event)
+	if err != nil && !relay.IsConnected() {
+		// the pooled connection was closed by the relay, retry once
+		if pooled, relay, err = p.connect(ctx, relayURL); err != nil {
+			return err
+		}
+		err = relay.Publish(publishCtx, *event)
+	}
+	if err == nil {
+		log.Printf("Published event to relay %s successfully", relayURL)
+		return nil
+	}
+	if !strings.HasPrefix(err.Error(), "msg: auth-required:") {
+		log.Printf("Error publishing event to relay %s: %v", relayURL, err)
+		return err
+	}
+
+	pooled.mu.Lock()
+	err = authenticate(ctx, p.signer, relay, false)
+	pooled.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return publishAfterAuth(ctx, event, relay)
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"hash"
+	"math"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// PowProgressInterval is how often MinePow reports its progress.
+var PowProgressInterval = 5 * time.Second
+
+// PowStatus is the progress of a proof of work computation.
+type PowStatus struct {
+	// Target is the difficulty being mined.
+	Target int
+	// Best is the highest difficulty found so far.
+	Best int
+	// Hashes is the number of ids computed so far.
+	Hashes  uint64
+	Elapsed time.Duration
+}
+
+// Hashrate returns the ids computed per second.
+func (s PowStatus) Hashrate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Hashes) / s.Elapsed.Seconds()
+}
+
+// MinePow mines a nonce tag for the event on every CPU core until its id has
+// diff leading zero bits. progress, when not nil, is called every
+// PowProgressInterval. The event is left untouched when ctx is done first.
+func MinePow(ctx context.Context, event *nostr.Event, diff int, progress func(PowStatus)) error {
+	if diff <= 0 {
+		return nil
+	}
+	if event.PubKey == "" {
+		return errors.New("event has no pubkey")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var hashes atomic.Uint64
+	var best atomic.Int64
+	found := make(chan nostr.Tag, 1)
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hasher := newPowHasher(event, diff)
+			for i, n := 1, uint64(worker); ; i, n = i+1, n+uint64(workers) {
+				difficulty := leadingZeroBits(hasher.hash(n))
+				if difficulty >= diff {
+					select {
+					case found <- nostr.Tag{"nonce", strconv.FormatUint(n, 10), strconv.Itoa(diff)}:
+					default:
+					}
+					cancel()
+					return
+				}
+				for current := best.Load(); int64(difficulty) > current; current = best.Load() {
+					if best.CompareAndSwap(current, int64(difficulty)) {
+						break
+					}
+				}
+				if i%1024 == 0 {
+					hashes.Add(1024)
+					if ctx.Err() != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(PowProgressInterval)
+	defer ticker.Stop()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			select {
+			case nonce := <-found:
+				event.Tags = append(event.Tags, nonce)
+				return nil
+			default:
+				return ctx.Err()
+			}
+		case <-ticker.C:
+			if progress != nil {
+				progress(PowStatus{
+					Target:  diff,
+					Best:    int(best.Load()),
+					Hashes:  hashes.Load(),
+					Elapsed: time.Since(start),
+				})
+			}
+		}
+	}
+}
+
+// powSample is how long EstimatePow hashes the event for.
+const powSample = 200 * time.Millisecond
+
+// EstimatePow measures how fast the ids of the event are computed on one
+// core and returns how long mining diff bits takes on average with all of
+// them.
+func EstimatePow(event *nostr.Event, diff int) time.Duration {
+	if diff <= 0 {
+		return 0
+	}
+	hasher := newPowHasher(event, diff)
+	hashes := 0
+	start := time.Now()
+	for time.Since(start) < powSample {
+		hasher.hash(uint64(hashes))
+		hashes++
+	}
+	rate := float64(hashes) / time.Since(start).Seconds() * float64(runtime.NumCPU())
+	seconds := math.Exp2(float64(diff)) / rate
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// powHasher computes the ids of an event with a nonce tag appended. Only the
+// nonce changes between attempts, so the serialized event before it is
+// hashed once and the sha256 state restored for every attempt, instead of
+// serializing and hashing the whole event, which for a gallery with dozens
+// of imeta tags is most of the work.
+type powHasher struct {
+	digest hash.Hash
+	// state is the marshaled digest of the event up to the nonce value.
+	state  []byte
+	suffix []byte
+	buf    []byte
+	sum    []byte
+}
+
+func newPowHasher(event *nostr.Event, diff int) *powHasher {
+	candidate := *event
+	candidate.Tags = append(append(nostr.Tags{}, event.Tags...), nostr.Tag{"nonce", "", strconv.Itoa(diff)})
+	serialized := candidate.Serialize()
+	// quotes are escaped in values, so the last unescaped match is the
+	// nonce tag, followed by the difficulty and the content
+	at := bytes.LastIndex(serialized, []byte(`["nonce","`)) + len(`["nonce","`)
+	digest := sha256.New()
+	digest.Write(serialized[:at])
+	state, _ := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	return &powHasher{digest: digest, state: state, suffix: serialized[at:], sum: make([]byte, 0, sha256.Size)}
+}
+
+// hash returns the id of the event with the nonce.
+func (h *powHasher) hash(nonce uint64) [32]byte {
+	h.digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(h.state)
+	h.buf = strconv.AppendUint(h.buf[:0], nonce, 10)
+	h.digest.Write(h.buf)
+	h.digest.Write(h.suffix)
+	return [32]byte(h.digest.Sum(h.sum[:0]))
+}
+
+func leadingZeroBits(hash [32]byte) int {
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		prefix []byte
+		want   int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x40}, 9},
+		{[]byte{0x00, 0x00, 0x0f}, 20},
+	}
+	for _, test := range tests {
+		var hash [32]byte
+		copy(hash[:], test.prefix)
+		if got := leadingZeroBits(hash); got != test.want {
+			t.Errorf("%x: %d leading zero bits, want %d", test.prefix, got, test.want)
+		}
+	}
+	if got := leadingZeroBits([32]byte{}); got != 256 {
+		t.Errorf("zero hash: %d leading zero bits, want 256", got)
+	}
+}
+
+func TestMinePow(t *testing.T) {
+	for _, diff := range []int{0, 1, 8, 12} {
+		event := &nostr.Event{
+			PubKey:    "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			CreatedAt: 1700000000,
+			Kind:      1,
+			Tags:      nostr.Tags{{"t", "test"}},
+		}
+		if err := MinePow(context.Background(), event, diff, nil); err != nil {
+			t.Fatalf("difficulty %d: %v", diff, err)
+		}
+		nonce := event.Tags.GetFirst([]string{"nonce", ""})
+		if diff == 0 {
+			if nonce != nil {
+				t.Errorf("difficulty 0 added %v", nonce)
+			}
+			continue
+		}
+		if nonce == nil || len(*nonce) != 3 || (*nonce)[2] != strconv.Itoa(diff) {
+			t.Errorf("difficulty %d: nonce tag %v", diff, nonce)
+		}
+		if got := nip13.Difficulty(event.GetID()); got < diff {
+			t.Errorf("difficulty %d: mined id has %d", diff, got)
+		}
+	}
+
+	if err := MinePow(context.Background(), &nostr.Event{}, 8, nil); err == nil {
+		t.Error("mined an event without pubkey")
+	}
+}
+
+func TestPowHasher(t *testing.T) {
+	event := &nostr.Event{
+		PubKey:    "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		CreatedAt: 1700000000,
+		Kind:      20,
+		Tags:      nostr.Tags{{"title", `a "quoted" ["nonce","title"]`}},
+		Content:   `["nonce","0","8"]`,
+	}
+	hasher := newPowHasher(event, 8)
+	for _, nonce := range []uint64{0, 7, 1 << 40} {
+		candidate := *event
+		candidate.Tags = append(append(nostr.Tags{}, event.Tags...), nostr.Tag{"nonce", strconv.FormatUint(nonce, 10), "8"})
+		if got, want := hasher.hash(nonce), sha256.Sum256(candidate.Serialize()); got != want {
+			t.Errorf("nonce %d: id %x, want %x", nonce, got, want)
+		}
+	}
+}
+
+// galleryEvent returns an event with the imeta tags of a 50 image gallery.
+func galleryEvent() *nostr.Event {
+	event := &nostr.Event{
+		PubKey:    "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		CreatedAt: 1700000000,
+		Kind:      20,
+	}
+	for i := range 50 {
+		hash := fmt.Sprintf("%064x", i)
+		event.Tags = append(event.Tags, nostr.Tag{"imeta",
+			"url https://blossom.example.com/" + hash + ".jpg",
+			"m image/jpeg",
+			"x " + hash,
+			"dim 4032x3024",
+			"blurhash LEHV6nWB2yk8pyo0adR*.7kCMdnj",
+		})
+	}
+	return event
+}
+
+func BenchmarkPowHasher(b *testing.B) {
+	hasher := newPowHasher(galleryEvent(), 20)
+	for i := range b.N {
+		hasher.hash(uint64(i))
+	}
+}
+
+func BenchmarkSerializeHash(b *testing.B) {
+	event := galleryEvent()
+	event.Tags = append(event.Tags, nostr.Tag{"nonce", "0", "20"})
+	for i := range b.N {
+		event.Tags[len(event.Tags)-1][1] = strconv.Itoa(i)
+		sha256.Sum256(event.Serialize())
+	}
+}
+
+func BenchmarkMinePow(b *testing.B) {
+	for range b.N {
+		if err := MinePow(context.Background(), galleryEvent(), 12, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// Kinds of the NIP-90 proof of work jobs, as used by the PoW providers.
+var (
+	PowJobRequestKind = 68001
+	PowJobResultKind  = 68002
+)
+
+// DelegatePow outsources the proof of work of the event to a NIP-90 Data
+// Vending Machine. It publishes a job request with the unsigned event as
+// input and waits, until ctx is done, for a result holding the event with a
+// nonce tag of at least diff. Payment requests sent as job feedback are
+// logged with their amount and invoice, and the first one is paid with pay
+// when it is set. An empty dvmPubKey leaves the job open to any provider.
+func DelegatePow(ctx context.Context, event *nostr.Event, diff int, signer nostr.Keyer, relays []string, dvmPubKey string,
+	pay func(ctx context.Context, invoice string) (string, error)) error {
+	if diff <= 0 {
+		return nil
+	}
+	if len(relays) == 0 {
+		return fmt.Errorf("no relays to send the proof of work job to")
+	}
+	template, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %v", err)
+	}
+
+	request := nostr.Event{
+		Kind:      PowJobRequestKind,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"i", string(template), "text"},
+			{"param", "difficulty", strconv.Itoa(diff)},
+			append(nostr.Tag{"relays"}, relays...),
+		},
+	}
+	if dvmPubKey != "" {
+		request.Tags = append(request.Tags, nostr.Tag{"p", dvmPubKey})
+	}
+	if err := signer.SignEvent(ctx, &request); err != nil {
+		return fmt.Errorf("signing proof of work request: %v", err)
+	}
+
+	// subscribe before publishing so a fast provider is not missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	replies := pool.SubMany(ctx, relays, nostr.Filters{{
+		Kinds: []int{PowJobResultKind, nostr.KindJobFeedback},
+		Tags:  nostr.TagMap{"e": []string{request.ID}},
+	}})
+
+	if len(AcceptedRelays(PublishEvent(ctx, &request, signer, relays))) == 0 {
+		return fmt.Errorf("no relay accepted the proof of work request")
+	}
+	log.Printf("Waiting for proof of work from DVM (job %s)", request.ID)
+
+	paid := false
+	for reply := range replies {
+		if dvmPubKey != "" && reply.PubKey != dvmPubKey {
+			continue
+		}
+		if reply.Kind == nostr.KindJobFeedback {
+			invoice := logJobFeedback("Proof of work", reply.Event)
+			if invoice != "" && pay != nil && !paid {
+				if _, err := pay(ctx, invoice); err != nil {
+					return fmt.Errorf("paying proof of work DVM: %v", err)
+				}
+				log.Printf("Paid proof of work DVM %s", reply.PubKey)
+				paid = true
+			}
+			continue
+		}
+		if err := applyPowResult(event, reply.Event, diff); err != nil {
+			log.Printf("Ignoring proof of work result from %s: %v", reply.PubKey, err)
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("waiting for proof of work: %v", ctx.Err())
+}
+
+// applyPowResult copies the tags of the mined event in the result to the
+// event after checking it is the same event with enough proof of work.
+func applyPowResult(event *nostr.Event, result *nostr.Event, diff int) error {
+	var mined nostr.Event
+	if err := json.Unmarshal([]byte(result.Content), &mined); err != nil {
+		return fmt.Errorf("decoding mined event: %v", err)
+	}
+	if mined.PubKey != event.PubKey || mined.Kind != event.Kind ||
+		mined.CreatedAt != event.CreatedAt || mined.Content != event.Content {
+		return fmt.Errorf("mined event does not match the request")
+	}
+	if len(mined.Tags) != len(event.Tags)+1 {
+		return fmt.Errorf("mined event must only add a nonce tag")
+	}
+	for i, tag := range event.Tags {
+		if !slices.Equal(tag, mined.Tags[i]) {
+			return fmt.Errorf("mined event changed tag %d", i)
+		}
+	}
+	if difficulty := nip13.Difficulty(mined.GetID()); difficulty < diff {
+		return fmt.Errorf("mined event has difficulty %d, requested %d", difficulty, diff)
+	}
+	event.Tags = mined.Tags
+	return nil
+}
+
+// logJobFeedback logs a job feedback event of the named DVM, with the
+// amount and invoice when the DVM asks to be paid, and returns the invoice
+// to pay.
+func logJobFeedback(name string, feedback *nostr.Event) string {
+	var status, amount, invoice string
+	for _, tag := range feedback.Tags {
+		switch {
+		case len(tag) >= 2 && tag[0] == "status":
+			status = tag[1]
+		case len(tag) >= 2 && tag[0] == "amount":
+			amount = tag[1]
+			if len(tag) >= 3 {
+				invoice = tag[2]
+			}
+		}
+	}
+	if status == "payment-required" {
+		log.Printf("%s DVM requires payment of %s msats: %s %s", name, amount, invoice, feedback.Content)
+		return invoice
+	}
+	log.Printf("%s DVM status: %s %s", name, status, feedback.Content)
+	return ""
+}
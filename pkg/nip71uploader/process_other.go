@@ -0,0 +1,21 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+//go:build !unix
+
+package nip71uploader
+
+import "os"
+
+// processAlive tells whether a process with the given id is running. On
+// Windows, finding a process opens it, which fails once it exited; elsewhere
+// every process is taken for a running one, keeping its files.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+//go:build unix
+
+package nip71uploader
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive tells whether a process with the given id is running, by
+// sending it the null signal. Processes of other users cannot be signalled,
+// but exist.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
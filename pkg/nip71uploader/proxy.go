@@ -0,0 +1,69 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxy is the proxy set with UseProxy, nil when connecting directly.
+var proxy *url.URL
+
+// ParseProxy parses the URL of an HTTP, HTTPS or SOCKS5 proxy, such as
+// "socks5://127.0.0.1:9050" for Tor. A bare host:port is an HTTP proxy.
+func ParseProxy(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// SOCKS5 proxies always resolve the names themselves
+		parsed.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" || parsed.Port() == "" {
+		return nil, fmt.Errorf("proxy URL %s needs a host and a port", parsed.Redacted())
+	}
+	return parsed, nil
+}
+
+// UseProxy sends the HTTP requests of the process, the websocket
+// connections to relays and the downloads of yt-dlp through the proxy. Host
+// names are sent to the proxy unresolved, so .onion servers and relays can
+// be reached through Tor.
+func UseProxy(proxyURL *url.URL) {
+	proxy = proxyURL
+	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+}
+
+// SendUserAgent makes http.DefaultClient, which the relay connections use
+// too, send UserAgent with every request, in place of the User-Agent of Go or
+// go-nostr. An empty UserAgent sends none.
+func SendUserAgent() {
+	if _, ok := http.DefaultClient.Transport.(userAgentTransport); !ok {
+		http.DefaultClient.Transport = userAgentTransport{base: http.DefaultTransport}
+	}
+}
+
+// userAgentTransport sets UserAgent on the requests it sends.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", UserAgent)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RehostKinds are the event kinds Rehost accepts.
+var RehostKinds = []int{
+	events.KindVideo, events.KindShortVideo,
+	events.KindLegacyVideo, events.KindLegacyShortVideo,
+	events.KindFileMetadata,
+}
+
+// FetchEvent looks up the event an nevent, naddr, note, coordinate or hex id
+// refers to, on the relay hints of the reference and on the given relays.
+func FetchEvent(ctx context.Context, ref string, relays []string) (*nostr.Event, error) {
+	event, _, err := FetchEventSeen(ctx, ref, relays)
+	return event, err
+}
+
+// FetchEventSeen is FetchEvent also returning the relays that have the
+// event, which are the relay hints of references to it.
+func FetchEventSeen(ctx context.Context, ref string, relays []string) (*nostr.Event, []string, error) {
+	pointer, err := DecodeEventPointer(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	var filter nostr.Filter
+	switch v := pointer.(type) {
+	case nostr.EventPointer:
+		filter.IDs = []string{v.ID}
+		relays = append(slices.Clone(v.Relays), relays...)
+	case nostr.EntityPointer:
+		filter.Kinds = []int{v.Kind}
+		filter.Authors = []string{v.PublicKey}
+		filter.Tags = nostr.TagMap{"d": []string{v.Identifier}}
+		relays = append(slices.Clone(v.Relays), relays...)
+	}
+	if len(relays) == 0 {
+		return nil, nil, errors.New("no relays to look the event up on")
+	}
+
+	event, seen := FetchLatestEventSeen(ctx, filter, relays)
+	if event == nil {
+		return nil, nil, fmt.Errorf("event %s not found on the relays", ref)
+	}
+	return event, seen, nil
+}
+
+// ReferenceTag returns the "e" or "a" tag referencing the event an nevent,
+// naddr, note, coordinate or hex id refers to. A reference without relay
+// hints is looked up on relays, and the tag gets a hint of where it was found
+// when it is.
+func ReferenceTag(ctx context.Context, ref string, relays []string) (nostr.Tag, error) {
+	pointer, err := DecodeEventPointer(ref)
+	if err != nil {
+		return nil, err
+	}
+	switch v := pointer.(type) {
+	case nostr.EventPointer:
+		if len(v.Relays) == 0 && len(relays) > 0 {
+			if event, seen, err := FetchEventSeen(ctx, ref, relays); err == nil {
+				v.Relays, v.Author = seen, event.PubKey
+			}
+		}
+		return v.AsTag(), nil
+	case nostr.EntityPointer:
+		if len(v.Relays) == 0 && len(relays) > 0 {
+			if _, seen, err := FetchEventSeen(ctx, ref, relays); err == nil {
+				v.Relays = seen
+			}
+		}
+		return v.AsTag(), nil
+	}
+	return pointer.AsTag(), nil
+}
+
+// Rehost downloads the media of a video or file metadata event, checks them
+// against their hashes, uploads them to the Blossom server and returns a copy
+// of the event authored by the signer, with proof of work already mined. The
+// rehosted URLs become the primary ones and the original URLs are kept as
+// fallbacks; with keepURL the original URLs stay primary and the rehosted
+// ones are added as fallbacks.
+func (u *Uploader) Rehost(ctx context.Context, original *nostr.Event, keepURL bool) (*nostr.Event, error) {
+	if !slices.Contains(RehostKinds, original.Kind) {
+		return nil, fmt.Errorf("cannot rehost events of kind %d", original.Kind)
+	}
+	event, replaced, err := u.replaceMedia(ctx, original, u.rehostBlob, keepURL, true)
+	if err != nil {
+		return nil, err
+	}
+	if replaced == 0 {
+		return nil, errors.New("the event has no media to rehost")
+	}
+	return event, u.Pow(ctx, event)
+}
+
+// replaceMedia returns an unsigned copy of the event, authored by the signer,
+// in which the media for which replace returns a URL point at that URL
+// instead, and the number of media replaced. With keepURL the new URL is
+// added as a fallback instead; otherwise the old URL becomes a fallback when
+// fallbackOld is set and is dropped when it is not.
+func (u *Uploader) replaceMedia(ctx context.Context, original *nostr.Event, replace func(ctx context.Context, url, hash string) (string, error), keepURL, fallbackOld bool) (*nostr.Event, int, error) {
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting public key: %v", err)
+	}
+
+	event := &nostr.Event{
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Kind:      original.Kind,
+		Content:   original.Content,
+	}
+	replaced := 0
+	for _, tag := range original.Tags {
+		if len(tag) < 2 || tag[0] == "nonce" {
+			// the proof of work is mined again for the new event
+			continue
+		}
+		tag = slices.Clone(tag)
+
+		switch {
+		case tag[0] == "imeta":
+			media, err := imeta.Parse(tag)
+			if err != nil {
+				return nil, 0, err
+			}
+			newURL, err := replace(ctx, media.URL, media.Hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			if newURL == "" {
+				break
+			}
+			if keepURL {
+				media.Fallbacks = append(media.Fallbacks, newURL)
+			} else {
+				if fallbackOld {
+					media.Fallbacks = append(media.Fallbacks, media.URL)
+				}
+				media.URL = newURL
+			}
+			if tag, err = media.Format(); err != nil {
+				return nil, 0, err
+			}
+			replaced++
+		case tag[0] == "url" && original.Kind == events.KindFileMetadata:
+			oldURL := tag[1]
+			var hash string
+			if x := original.Tags.GetFirst([]string{"x", ""}); x != nil {
+				hash = x.Value()
+			}
+			newURL, err := replace(ctx, oldURL, hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			if newURL == "" {
+				break
+			}
+			if keepURL {
+				event.Tags = append(event.Tags, tag)
+				tag = nostr.Tag{"fallback", newURL}
+			} else if fallbackOld {
+				event.Tags = append(event.Tags, nostr.Tag{"url", newURL})
+				tag = nostr.Tag{"fallback", oldURL}
+			} else {
+				tag[1] = newURL
+			}
+			replaced++
+		}
+		event.Tags = append(event.Tags, tag)
+	}
+	return event, replaced, nil
+}
+
+// rehostBlob downloads a blob, verifies it against the expected hash, when
+// known, and mirrors or uploads it to the Blossom server.
+func (u *Uploader) rehostBlob(ctx context.Context, blobURL, expectedHash string) (string, error) {
+	if blobURL == "" {
+		return "", errors.New("media without url")
+	}
+	path, err := DownloadFile(ctx, blobURL)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", blobURL, err)
+	}
+	defer RemoveTemp(path)
+
+	hashes, err := HashFile(ctx, path, false, u.HashProgress)
+	if err != nil {
+		return "", err
+	}
+	hash := hashes.SHA256
+	if expectedHash == "" {
+		log.Printf("No hash to verify %s against", blobURL)
+	} else if !strings.EqualFold(hash, expectedHash) {
+		return "", fmt.Errorf("%s does not match its hash: expected %s, got %s", blobURL, expectedHash, hash)
+	}
+
+	// servers supporting mirror fetch the blob themselves, saving the upload
+	descriptor, err := MirrorBlob(ctx, u.blossomServer(), blobURL, hash, u.Signer)
+	if err != nil {
+		descriptor, err = u.upload(ctx, u.blossomServer(), path, hash)
+		if err != nil {
+			return "", fmt.Errorf("uploading %s: %v", blobURL, err)
+		}
+	}
+	log.Printf("Rehosted %s as %s", blobURL, descriptor.URL)
+	return descriptor.URL, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RelayRate is the most events sent to each relay per minute, 0 for no
+// limit, so that bulk publishing does not get the pubkey banned. Publishes
+// beyond it wait for their turn.
+var RelayRate float64
+
+// relayTurns holds, for each relay, when the next event may be sent to it.
+var relayTurns = struct {
+	sync.Mutex
+	next map[string]time.Time
+}{next: make(map[string]time.Time)}
+
+// reserveTurn books the next turn of the relay and returns how long to wait
+// for it.
+func reserveTurn(relayURL string) time.Duration {
+	relayTurns.Lock()
+	defer relayTurns.Unlock()
+	url := nostr.NormalizeURL(relayURL)
+	now := time.Now()
+	turn := now
+	if next := relayTurns.next[url]; next.After(now) {
+		turn = next
+	}
+	if RelayRate > 0 {
+		relayTurns.next[url] = turn.Add(time.Duration(float64(time.Minute) / RelayRate))
+	}
+	return turn.Sub(now)
+}
+
+// pauseRelay delays the later turns of a relay that is rate limiting by d.
+func pauseRelay(relayURL string, d time.Duration) {
+	relayTurns.Lock()
+	defer relayTurns.Unlock()
+	url := nostr.NormalizeURL(relayURL)
+	if resume := time.Now().Add(d); resume.After(relayTurns.next[url]) {
+		relayTurns.next[url] = resume
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+	"gopkg.in/yaml.v3"
+)
+
+// authChallengeWait is how long a relay configured for preemptive AUTH is
+// given to send its challenge after connecting.
+const authChallengeWait = time.Second
+
+// RelayConfig holds the settings of one relay from a relay list file.
+type RelayConfig struct {
+	URL string `yaml:"url"`
+	// Write is false for relays that are only read from. Unset means true.
+	Write *bool `yaml:"write"`
+	// Auth authenticates with the relay right after connecting, instead of
+	// waiting for an auth-required rejection.
+	Auth bool `yaml:"auth"`
+	// PowRequired is the minimum proof of work difficulty the relay accepts.
+	PowRequired int `yaml:"pow-required"`
+}
+
+// UnmarshalYAML accepts either a bare relay URL or a mapping.
+func (c *RelayConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.URL = value.Value
+		return nil
+	}
+	type plain RelayConfig
+	return value.Decode((*plain)(c))
+}
+
+// Writable reports whether events may be published to the relay.
+func (c RelayConfig) Writable() bool {
+	return c.Write == nil || *c.Write
+}
+
+var (
+	relayConfigsMu sync.RWMutex
+	relayConfigs   = make(map[string]RelayConfig)
+)
+
+// SetRelayConfig registers the settings PublishEvent and the proof of work
+// use for a relay. LoadRelaysFromFile calls it for every relay it reads.
+func SetRelayConfig(config RelayConfig) {
+	relayConfigsMu.Lock()
+	defer relayConfigsMu.Unlock()
+	relayConfigs[nostr.NormalizeURL(config.URL)] = config
+}
+
+func relayConfig(relayURL string) RelayConfig {
+	relayConfigsMu.RLock()
+	defer relayConfigsMu.RUnlock()
+	config, ok := relayConfigs[nostr.NormalizeURL(relayURL)]
+	if !ok {
+		config.URL = relayURL
+	}
+	return config
+}
+
+// RequiredDifficulty returns the highest pow-required of the given relays.
+func RequiredDifficulty(relays []string) int {
+	difficulty := 0
+	for _, relayURL := range relays {
+		difficulty = max(difficulty, relayConfig(relayURL).PowRequired)
+	}
+	return difficulty
+}
+
+// PublishResult is the outcome of publishing an event to one relay.
+type PublishResult struct {
+	Relay string `json:"relay"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Reason is the machine readable prefix of the relay's message, such
+	// as "rate-limited" or "pow", see ParseReason.
+	Reason string `json:"reason,omitempty"`
+	// Confirmed is set by ConfirmStored to whether the relay returned the
+	// event when queried for it.
+	Confirmed *bool `json:"confirmed,omitempty"`
+}
+
+// PublishWorkers is the number of relays PublishEvent talks to at once.
+var PublishWorkers = 8
+
+// PublishDeadline bounds the whole of PublishEvent, including auth retries.
+var PublishDeadline = 60 * time.Second
+
+// PublishEvent sends the event to every relay concurrently, at most
+// PublishWorkers at a time, authenticating with the signer when a relay asks
+// for it. Failures are logged and do not stop the others; the outcome for
+// each relay is returned in the order of relays. Relays that have not
+// answered within PublishDeadline are reported as failed. Rate limited
+// publishes are tried again, see publishReacting, and publishes beyond
+// RelayRate wait for their turn, which PublishDeadline does not count.
+func PublishEvent(ctx context.Context, event *nostr.Event, signer nostr.Keyer, relays []string) []PublishResult {
+	return publishAll(ctx, event, relays, func(ctx context.Context, relayURL string) error {
+		return publishToRelay(ctx, event, signer, relayURL)
+	})
+}
+
+// publishAll runs publish for every relay on PublishWorkers goroutines
+// within PublishDeadline and collects the results in the order of relays.
+func publishAll(ctx context.Context, event *nostr.Event, relays []string, publish func(ctx context.Context, relayURL string) error) []PublishResult {
+	waits := make([]time.Duration, len(relays))
+	var longest time.Duration
+	for i, relayURL := range relays {
+		waits[i] = reserveTurn(relayURL)
+		longest = max(longest, waits[i])
+	}
+	ctx, cancel := context.WithTimeout(ctx, PublishDeadline+longest)
+	defer cancel()
+
+	results := make([]PublishResult, len(relays))
+	sem := make(chan struct{}, max(PublishWorkers, 1))
+	var wg sync.WaitGroup
+	for i, relayURL := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := PublishResult{Relay: relayURL, OK: true}
+			if waits[i] > 0 {
+				log.Printf("Waiting %v for the turn of relay %s", waits[i].Round(time.Second), relayURL)
+				select {
+				case <-time.After(waits[i]):
+				case <-ctx.Done():
+				}
+			}
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				reason, err := publishReacting(ctx, relayURL, event.PubKey, publish)
+				result.Reason = reason
+				if err != nil {
+					result.OK = false
+					result.Error = err.Error()
+				}
+			case <-ctx.Done():
+				result.OK = false
+				result.Error = ctx.Err().Error()
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// AcceptedRelays returns the relays that accepted the event.
+func AcceptedRelays(results []PublishResult) []string {
+	var relays []string
+	for _, result := range results {
+		if result.OK {
+			relays = append(relays, result.Relay)
+		}
+	}
+	return relays
+}
+
+// checkPow fails when the event has less proof of work than the relay
+// requires, so the relay is not contacted in vain.
+func checkPow(event *nostr.Event, relayURL string) error {
+	required := relayConfig(relayURL).PowRequired
+	if difficulty := nip13.Difficulty(event.ID); difficulty < required {
+		err := fmt.Errorf("relay requires proof of work %d, event has %d", required, difficulty)
+		log.Printf("Skipping relay %s: %v", relayURL, err)
+		return err
+	}
+	return nil
+}
+
+func publishToRelay(ctx context.Context, event *nostr.Event, signer nostr.Keyer, relayURL string) error {
+	if err := checkPow(event, relayURL); err != nil {
+		return err
+	}
+	config := relayConfig(relayURL)
+
+	connectCtx, cancel := context.WithTimeout(ctx, RelayTimeout)
+	defer cancel()
+	relay, err := nostr.RelayConnect(connectCtx, relayURL)
+	if err != nil {
+		log.Printf("Error connecting to relay %s: %v", relayURL, err)
+		return err
+	}
+	defer relay.Close()
+
+	if config.Auth {
+		if err := authenticate(ctx, signer, relay, true); err != nil {
+			return err
+		}
+		return publishAfterAuth(ctx, event, relay)
+	}
+
+	err = relay.Publish(connectCtx, *event)
+	if err == nil {
+		log.Printf("Published event to relay %s successfully", relayURL)
+		return nil
+	}
+	if !strings.HasPrefix(err.Error(), "msg: auth-required:") {
+		log.Printf("Error publishing event to relay %s: %v", relayURL, err)
+		return err
+	}
+	if err := authenticate(ctx, signer, relay, false); err != nil {
+		return err
+	}
+	return publishAfterAuth(ctx, event, relay)
+}
+
+// authenticate answers the relay's NIP-42 challenge. With waitChallenge the
+// relay has not asked for auth yet and is given time to send the challenge.
+func authenticate(ctx context.Context, signer nostr.Keyer, relay *nostr.Relay, waitChallenge bool) error {
+	authCtx, cancel := context.WithTimeout(ctx, SignTimeout)
+	defer cancel()
+
+	if waitChallenge {
+		select {
+		case <-time.After(authChallengeWait):
+		case <-authCtx.Done():
+			return authCtx.Err()
+		}
+	}
+
+	err := relay.Auth(authCtx, func(authEvent *nostr.Event) error {
+		return signer.SignEvent(authCtx, authEvent)
+	})
+	if err != nil {
+		log.Printf("Error sending auth event to relay %s: %v", relay.URL, err)
+	}
+	return err
+}
+
+func publishAfterAuth(ctx context.Context, event *nostr.Event, relay *nostr.Relay) error {
+	ctx, cancel := context.WithTimeout(ctx, RelayTimeout)
+	defer cancel()
+	err := relay.Publish(ctx, *event)
+	if err != nil {
+		log.Printf("Error publishing event to relay %s after auth: %v", relay.URL, err)
+		return err
+	}
+	log.Printf("Published event to relay %s successfully after auth", relay.URL)
+	return nil
+}
+
+// FetchLatestEvent queries every relay for the given filter and returns the
+// newest matching event, or nil if none of the relays has one.
+func FetchLatestEvent(ctx context.Context, filter nostr.Filter, relays []string) *nostr.Event {
+	latest, _ := FetchLatestEventSeen(ctx, filter, relays)
+	return latest
+}
+
+// FetchLatestEventSeen is FetchLatestEvent also returning the relays that
+// have the event, which are the relay hints of references to it.
+func FetchLatestEventSeen(ctx context.Context, filter nostr.Filter, relays []string) (*nostr.Event, []string) {
+	var latest *nostr.Event
+	var seen []string
+	for _, relayURL := range relays {
+		for _, event := range queryRelay(ctx, filter, relayURL) {
+			switch {
+			case latest == nil || event.CreatedAt > latest.CreatedAt:
+				latest, seen = event, []string{relayURL}
+			case event.ID == latest.ID && !slices.Contains(seen, relayURL):
+				seen = append(seen, relayURL)
+			}
+		}
+	}
+	return latest, seen
+}
+
+// RelayHint returns the relay hint of tags referencing an event found on or
+// published to relays: the first one, or "" when there are none.
+func RelayHint(relays []string) string {
+	if len(relays) == 0 {
+		return ""
+	}
+	return relays[0]
+}
+
+func queryRelay(ctx context.Context, filter nostr.Filter, relayURL string) []*nostr.Event {
+	ctx, cancel := context.WithTimeout(ctx, RelayTimeout)
+	defer cancel()
+	relay, err := nostr.RelayConnect(ctx, relayURL)
+	if err != nil {
+		log.Printf("Error connecting to relay %s: %v", relayURL, err)
+		return nil
+	}
+	defer relay.Close()
+
+	events, err := relay.QuerySync(ctx, filter)
+	if err != nil {
+		log.Printf("Error querying relay %s: %v", relayURL, err)
+		return nil
+	}
+	return events
+}
+
+// LoadRelayConfigs reads a JSON or YAML list of relays. Each entry is either
+// a relay URL or a mapping with url, write, auth and pow-required keys.
+func LoadRelayConfigs(filePath string) ([]RelayConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", filePath, err)
+	}
+
+	// YAML is a superset of JSON, so one decoder handles both formats
+	var configs []RelayConfig
+	if err := yaml.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", filePath, err)
+	}
+	for _, config := range configs {
+		if config.URL == "" {
+			return nil, fmt.Errorf("decoding %s: relay entry without url", filePath)
+		}
+	}
+	return configs, nil
+}
+
+// LoadRelaysFromFile reads a relay list with LoadRelayConfigs, registers the
+// settings of every relay with SetRelayConfig and returns the URLs of the
+// relays that can be written to.
+func LoadRelaysFromFile(filePath string) ([]string, error) {
+	configs, err := LoadRelayConfigs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var relays []string
+	for _, config := range configs {
+		SetRelayConfig(config)
+		if config.Writable() {
+			relays = append(relays, config.URL)
+		}
+	}
+	return relays, nil
+}
+
+// LoadRelays interprets a relay parameter: a ws:// or wss:// address or an
+// nrelay is returned as an address, an existing file is loaded with
+// LoadRelaysFromFile, and anything else yields no relays.
+func LoadRelays(relayParam string) ([]string, error) {
+	if prefix, _ := nip19Prefix(relayParam); prefix != "" || strings.HasPrefix(relayParam, "ws://") || strings.HasPrefix(relayParam, "wss://") {
+		relay, err := DecodeRelay(relayParam)
+		if err != nil {
+			return nil, err
+		}
+		return []string{relay}, nil
+	}
+	if _, err := os.Stat(relayParam); err == nil {
+		return LoadRelaysFromFile(relayParam)
+	}
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/testserver"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestReferenceTag(t *testing.T) {
+	ctx := context.Background()
+	empty, relay := testserver.NewRelay(t), testserver.NewRelay(t)
+	event := &nostr.Event{Kind: nostr.KindTextNote, CreatedAt: nostr.Now(), Content: "hello"}
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	relay.Add(event)
+
+	tag, err := ReferenceTag(ctx, event.ID, []string{empty.WSURL, relay.WSURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (nostr.Tag{"e", event.ID, relay.WSURL, event.PubKey}); !slices.Equal(tag, want) {
+		t.Errorf("tag %v, want %v", tag, want)
+	}
+	// references not found are kept without hints
+	missing := nostr.GeneratePrivateKey()
+	if tag, err := ReferenceTag(ctx, missing, []string{empty.WSURL}); err != nil || !slices.Equal(tag, nostr.Tag{"e", missing}) {
+		t.Errorf("tag %v, %v", tag, err)
+	}
+}
+
+// FuzzLoadRelaysFromFile feeds arbitrary relay list files, which users
+// download from relay directories, to LoadRelaysFromFile.
+func FuzzLoadRelaysFromFile(f *testing.F) {
+	f.Add([]byte(`["wss://relay.damus.io", "wss://nos.lol"]`))
+	f.Add([]byte("- wss://relay.damus.io\n- url: wss://nos.lol\n  write: false\n- url: wss://pow.example.com\n  pow-required: 28\n  auth: true\n"))
+	f.Add([]byte(`[{"url": ""}]`))
+	f.Add([]byte(`{"url": "wss://relay.damus.io"}`))
+	f.Add([]byte("- [wss://a, wss://b]\n"))
+	f.Add([]byte("&a [*a, *a]"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "relays.yaml")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		relays, err := LoadRelaysFromFile(path)
+		if err != nil {
+			return
+		}
+		configs, err := LoadRelayConfigs(path)
+		if err != nil {
+			t.Fatalf("relays %v loaded but not their configuration: %v", relays, err)
+		}
+		for _, relay := range relays {
+			if relay == "" {
+				t.Fatalf("empty relay loaded from %q", data)
+			}
+			if !slices.ContainsFunc(configs, func(c RelayConfig) bool { return c.URL == relay && c.Writable() }) {
+				t.Fatalf("relay %q is not a writable entry of %q", relay, data)
+			}
+		}
+	})
+}
+
+func TestRelayRate(t *testing.T) {
+	previous := RelayRate
+	RelayRate = 30
+	defer func() { RelayRate = previous }()
+
+	relay := "wss://rate.example.com"
+	if wait := reserveTurn(relay); wait != 0 {
+		t.Errorf("first turn in %v", wait)
+	}
+	if wait := reserveTurn(relay + "/"); wait < 1900*time.Millisecond || wait > 2*time.Second {
+		t.Errorf("second turn in %v, want 2s", wait)
+	}
+	if wait := reserveTurn("wss://other.example.com"); wait != 0 {
+		t.Errorf("other relay waits %v", wait)
+	}
+
+	RelayRate = 0
+	paused := "wss://paused.example.com"
+	pauseRelay(paused, time.Minute)
+	if wait := reserveTurn(paused); wait < 59*time.Second {
+		t.Errorf("paused relay waits %v", wait)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FetchReplaced looks up on the relays the newest event the addressable
+// event would replace, with the same kind, pubkey and d tag, and returns it,
+// or nil when there is none or the event is not addressable.
+func FetchReplaced(ctx context.Context, event *nostr.Event, relays []string) *nostr.Event {
+	if !nostr.IsAddressableKind(event.Kind) || event.PubKey == "" {
+		return nil
+	}
+	previous := FetchLatestEvent(ctx, nostr.Filter{
+		Kinds:   []int{event.Kind},
+		Authors: []string{event.PubKey},
+		Tags:    nostr.TagMap{"d": {event.Tags.GetD()}},
+		Limit:   1,
+	}, relays)
+	if previous == nil || previous.ID == event.ID {
+		return nil
+	}
+	return previous
+}
+
+// EventChanges describes, one line each, what event changes from previous:
+// its title, summary, content, publication date, media URLs, previews and
+// hashtags. It is empty when none of those changed.
+func EventChanges(previous, event *nostr.Event) []string {
+	var changes []string
+	for _, name := range []string{"title", "summary", "published_at", "alt"} {
+		if before, after := firstTagValue(previous.Tags, name), firstTagValue(event.Tags, name); before != after {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", name, before, after))
+		}
+	}
+	if previous.Content != event.Content {
+		changes = append(changes, fmt.Sprintf("content: %q -> %q", truncateChange(previous.Content), truncateChange(event.Content)))
+	}
+	for _, field := range []struct{ name, label string }{{"url", "media"}, {"image", "preview"}} {
+		before, after := mediaValues(previous, field.name), mediaValues(event, field.name)
+		for _, value := range before {
+			if !slices.Contains(after, value) {
+				changes = append(changes, fmt.Sprintf("%s removed: %s", field.label, value))
+			}
+		}
+		for _, value := range after {
+			if !slices.Contains(before, value) {
+				changes = append(changes, fmt.Sprintf("%s added: %s", field.label, value))
+			}
+		}
+	}
+	before, after := tagValues(previous.Tags, "t"), tagValues(event.Tags, "t")
+	for _, hashtag := range before {
+		if !slices.Contains(after, hashtag) {
+			changes = append(changes, "hashtag removed: #"+hashtag)
+		}
+	}
+	for _, hashtag := range after {
+		if !slices.Contains(before, hashtag) {
+			changes = append(changes, "hashtag added: #"+hashtag)
+		}
+	}
+	return changes
+}
+
+// mediaValues returns the values of the field in the imeta tags of the
+// event, and in its tags of the same name, as file metadata events have.
+func mediaValues(event *nostr.Event, name string) []string {
+	values := tagValues(event.Tags, name)
+	for _, tag := range event.Tags {
+		if len(tag) > 1 && tag[0] == "imeta" {
+			if value := imeta.Field(tag, name); value != "" && !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func firstTagValue(tags nostr.Tags, name string) string {
+	if tag := tags.GetFirst([]string{name, ""}); tag != nil && len(*tag) > 1 {
+		return (*tag)[1]
+	}
+	return ""
+}
+
+func tagValues(tags nostr.Tags, name string) []string {
+	var values []string
+	for _, tag := range tags {
+		if len(tag) > 1 && tag[0] == name && !slices.Contains(values, tag[1]) {
+			values = append(values, tag[1])
+		}
+	}
+	return values
+}
+
+// truncateChange shortens long contents to their first line and 60
+// characters.
+func truncateChange(content string) string {
+	content, _, _ = strings.Cut(content, "\n")
+	if runes := []rune(content); len(runes) > 60 {
+		return string(runes[:60]) + "..."
+	}
+	return content
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/girino/nip71-video-uploader/internal/testserver"
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestFetchReplaced(t *testing.T) {
+	ctx := context.Background()
+	relay := testserver.NewRelay(t)
+	key := nostr.GeneratePrivateKey()
+	sign := func(event *nostr.Event) *nostr.Event {
+		if err := event.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	previous := sign(&nostr.Event{
+		Kind:      events.KindLegacyVideo,
+		CreatedAt: nostr.Now() - 60,
+		Content:   "Curated elsewhere",
+		Tags: nostr.Tags{
+			{"d", "talk"},
+			{"title", "My talk (edited)"},
+			{"imeta", "url https://blossom.example.com/old.mp4", "m video/mp4"},
+			{"t", "nostr"},
+		},
+	})
+	relay.Add(previous)
+	relay.Add(sign(&nostr.Event{Kind: events.KindLegacyVideo, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", "other"}}}))
+
+	event := sign(&nostr.Event{
+		Kind:      events.KindLegacyVideo,
+		CreatedAt: nostr.Now(),
+		Content:   "Curated elsewhere",
+		Tags: nostr.Tags{
+			{"d", "talk"},
+			{"title", "My talk"},
+			{"imeta", "url https://blossom.example.com/new.mp4", "m video/mp4"},
+			{"t", "nostr"},
+			{"t", "video"},
+		},
+	})
+	found := FetchReplaced(ctx, event, []string{relay.WSURL})
+	if found == nil || found.ID != previous.ID {
+		t.Fatalf("found %v", found)
+	}
+	want := []string{
+		`title: "My talk (edited)" -> "My talk"`,
+		"media removed: https://blossom.example.com/old.mp4",
+		"media added: https://blossom.example.com/new.mp4",
+		"hashtag added: #video",
+	}
+	if changes := EventChanges(found, event); !slices.Equal(changes, want) {
+		t.Errorf("changes %q, want %q", changes, want)
+	}
+	if changes := EventChanges(previous, previous); len(changes) != 0 {
+		t.Errorf("changes of the same event %q", changes)
+	}
+
+	// regular events and events already published replace nothing
+	if found := FetchReplaced(ctx, previous, []string{relay.WSURL}); found != nil {
+		t.Errorf("the event replaces itself")
+	}
+	note := sign(&nostr.Event{Kind: events.KindVideo, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", "talk"}}})
+	if found := FetchReplaced(ctx, note, []string{relay.WSURL}); found != nil {
+		t.Errorf("a regular event replaces %s", found.ID)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultJPEGQuality is the quality of recompressed images when none is set.
+const DefaultJPEGQuality = 85
+
+// ResizeOptions control how ResizeImage shrinks pictures. The zero value
+// leaves pictures alone.
+type ResizeOptions struct {
+	// MaxDimension is the maximum width and height, 0 keeps the size.
+	MaxDimension int
+	// Quality is the JPEG quality, from 1 to 100, defaulting to
+	// DefaultJPEGQuality.
+	Quality int
+}
+
+// Enabled reports whether the options change anything.
+func (o ResizeOptions) Enabled() bool {
+	return o.MaxDimension > 0 || o.Quality > 0
+}
+
+// ResizeImage downscales a JPEG or WebP image to fit MaxDimension and
+// recompresses it as a JPEG of the given quality, into a temporary file whose
+// path is returned; the caller is responsible for removing it with
+// RemoveTemp. The EXIF orientation of JPEG images is carried over. Other
+// formats, animations, and images the recompression would not make smaller,
+// are left alone and their own path is returned.
+func ResizeImage(path string, opts ResizeOptions) (string, error) {
+	if animation, err := ReadAnimation(path); err != nil || animation != nil {
+		// recompressing animations as JPEG would keep only the first frame
+		return path, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding %s: %v", path, err)
+	}
+	if format != "jpeg" && format != "webp" {
+		return path, nil
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if opts.MaxDimension > 0 && max(width, height) > opts.MaxDimension {
+		if width >= height {
+			width, height = opts.MaxDimension, max(1, height*opts.MaxDimension/width)
+		} else {
+			width, height = max(1, width*opts.MaxDimension/height), opts.MaxDimension
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		img = scaled
+	}
+
+	quality := opts.Quality
+	if quality <= 0 {
+		quality = DefaultJPEGQuality
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: min(quality, 100)}); err != nil {
+		return "", fmt.Errorf("encoding %s: %v", path, err)
+	}
+	resized := encoded.Bytes()
+	if format == "jpeg" {
+		if orientation := jpegOrientation(data); orientation > 1 {
+			resized = insertOrientation(resized, orientation)
+		}
+	}
+	if len(resized) >= len(data) {
+		log.Printf("Keeping %s as is, recompressing it would not make it smaller", path)
+		return path, nil
+	}
+
+	file, err := createTemp("resized-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(resized); err != nil {
+		RemoveTemp(file.Name())
+		return "", err
+	}
+	log.Printf("Resized %s from %dx%d (%d KB) to %dx%d (%d KB), %.0f%% smaller", path,
+		bounds.Dx(), bounds.Dy(), len(data)/1024, width, height, len(resized)/1024,
+		100-100*float64(len(resized))/float64(len(data)))
+	return file.Name(), nil
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image, 1 when it
+// has none.
+func jpegOrientation(data []byte) uint16 {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		marker := data[pos+1]
+		if marker == 0xda {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		if payload := data[pos+4 : end]; marker == 0xe1 && bytes.HasPrefix(payload, exifHeader) {
+			return exifOrientation(payload[len(exifHeader):])
+		}
+		pos = end
+	}
+	return 1
+}
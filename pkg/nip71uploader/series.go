@@ -0,0 +1,62 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// EpisodeReference returns the tag referencing a signed episode from the
+// NIP-51 set of its series: an "a" tag for addressable kinds, so the set
+// follows the episode when it is replaced, or an "e" tag otherwise.
+func EpisodeReference(episode *nostr.Event, relay string) nostr.Tag {
+	if nostr.IsAddressableKind(episode.Kind) {
+		return nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", episode.Kind, episode.PubKey, episode.Tags.GetD()), relay}
+	}
+	return nostr.Tag{"e", episode.ID, relay, episode.PubKey}
+}
+
+// AddEpisode returns the unsigned new version of the NIP-51 set of a series
+// with the signed episode appended to its references, with proof of work
+// already mined, or nil when the set already references the episode. The set
+// must be addressable and authored by the signer.
+func (u *Uploader) AddEpisode(ctx context.Context, set, episode *nostr.Event, relay string) (*nostr.Event, error) {
+	if !nostr.IsAddressableKind(set.Kind) {
+		return nil, fmt.Errorf("series event of kind %d is not a set", set.Kind)
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	if set.PubKey != pubKey {
+		return nil, fmt.Errorf("series is published by %s, not by the signer", set.PubKey)
+	}
+
+	reference := EpisodeReference(episode, relay)
+	for _, tag := range set.Tags {
+		if len(tag) >= 2 && tag[0] == reference[0] && tag[1] == reference[1] {
+			return nil, nil
+		}
+	}
+
+	event := &nostr.Event{
+		Kind:      set.Kind,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Content:   set.Content,
+		Tags:      append(set.Tags.FilterOut([]string{"nonce"}), reference),
+	}
+	// a set updated in the same second must still replace the old one
+	if event.CreatedAt <= set.CreatedAt {
+		event.CreatedAt = set.CreatedAt + 1
+	}
+	if err := u.Pow(ctx, event); err != nil {
+		return event, fmt.Errorf("calculating proof of work: %v", err)
+	}
+	return event, nil
+}
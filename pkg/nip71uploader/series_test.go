@@ -0,0 +1,57 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestAddEpisode(t *testing.T) {
+	ctx := context.Background()
+	signer, err := NewSigner(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploader := &Uploader{Signer: signer}
+	pubKey, _ := signer.GetPublicKey(ctx)
+
+	set := &nostr.Event{
+		Kind:      30005,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now() + 60,
+		Tags:      nostr.Tags{{"d", "show"}, {"title", "The Show"}, {"e", "first"}, {"nonce", "1", "8"}},
+	}
+	episode := &nostr.Event{ID: "second", Kind: 21, PubKey: pubKey}
+
+	updated, err := uploader.AddEpisode(ctx, set, episode, "wss://relay.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nostr.Tags{{"d", "show"}, {"title", "The Show"}, {"e", "first"}, {"e", "second", "wss://relay.example", pubKey}}
+	if !slices.EqualFunc(updated.Tags, want, slices.Equal) {
+		t.Errorf("tags %v, want %v", updated.Tags, want)
+	}
+	if updated.CreatedAt <= set.CreatedAt {
+		t.Errorf("created at %d, not after the set", updated.CreatedAt)
+	}
+
+	if again, err := uploader.AddEpisode(ctx, updated, episode, ""); err != nil || again != nil {
+		t.Errorf("episode added twice: %v, %v", again, err)
+	}
+
+	addressable := &nostr.Event{Kind: 34235, PubKey: pubKey, Tags: nostr.Tags{{"d", "ep3"}}}
+	if tag := EpisodeReference(addressable, ""); tag[0] != "a" || tag[1] != "34235:"+pubKey+":ep3" {
+		t.Errorf("reference %v", tag)
+	}
+
+	set.PubKey = nostr.GeneratePrivateKey()
+	if _, err := uploader.AddEpisode(ctx, set, episode, ""); err == nil {
+		t.Error("added to the set of another key")
+	}
+}
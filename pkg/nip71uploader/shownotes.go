@@ -0,0 +1,120 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ShowNotesOptions describes a NIP-23 long-form article with the show notes
+// of a published video or audio event.
+type ShowNotesOptions struct {
+	// Identifier is the "d" tag of the article, see ShowNotesAddress.
+	Identifier string
+	Title      string
+	Summary    string
+	// Notes is the Markdown content of the article. A nostr: reference to
+	// the media event is appended to it, so clients embed the media.
+	Notes string
+	// Relays are published as hints of where the media event is found.
+	Relays []string
+	// CreatedAt overrides the event timestamp when non-zero.
+	CreatedAt nostr.Timestamp
+}
+
+// ShowNotesAddress returns the "a" coordinate of the show notes article with
+// the given identifier. Media events link to their show notes with it, which
+// is known before the article is built.
+func ShowNotesAddress(pubKey, identifier string) string {
+	return fmt.Sprintf("%d:%s:%s", nostr.KindArticle, pubKey, identifier)
+}
+
+// BuildShowNotesEvent returns the unsigned kind 30023 article with the show
+// notes of a signed media event, with proof of work already mined. The
+// article copies the media of the event and links back to it.
+func (u *Uploader) BuildShowNotesEvent(ctx context.Context, media *nostr.Event, opts ShowNotesOptions) (*nostr.Event, error) {
+	if opts.Identifier == "" {
+		return nil, errors.New("the show notes need an identifier")
+	}
+	if strings.TrimSpace(opts.Notes) == "" {
+		return nil, errors.New("the show notes are empty")
+	}
+	nevent, naddr, err := EncodeEvent(media, opts.Relays)
+	if err != nil {
+		return nil, fmt.Errorf("encoding event: %v", err)
+	}
+	reference := nevent
+	if naddr != "" {
+		reference = naddr
+	}
+	relay := RelayHint(opts.Relays)
+
+	event := &nostr.Event{
+		Kind:      nostr.KindArticle,
+		PubKey:    media.PubKey,
+		CreatedAt: opts.CreatedAt,
+		Content:   strings.TrimRight(opts.Notes, "\n") + "\n\nnostr:" + reference + "\n",
+		Tags:      nostr.Tags{{"d", opts.Identifier}},
+	}
+	if event.CreatedAt == 0 {
+		event.CreatedAt = nostr.Now()
+	}
+	if opts.Title != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"title", opts.Title})
+	}
+	if opts.Summary != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"summary", opts.Summary})
+	}
+	if publishedAt := media.Tags.GetFirst([]string{"published_at", ""}); publishedAt != nil {
+		event.Tags = append(event.Tags, *publishedAt)
+	}
+	imetas := mediaImetas(media)
+	for _, tag := range imetas {
+		if image := imeta.Field(tag, "image"); image != "" {
+			event.Tags = append(event.Tags, nostr.Tag{"image", image})
+			break
+		}
+	}
+	event.Tags = append(event.Tags, imetas...)
+	event.Tags = append(event.Tags, nostr.Tag{"e", media.ID, relay, "mention"})
+	if nostr.IsAddressableKind(media.Kind) {
+		event.Tags = append(event.Tags, nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", media.Kind, media.PubKey, media.Tags.GetD()), relay})
+	}
+
+	return u.finish(ctx, event)
+}
+
+// mediaImetas returns the imeta tags of an event, building one from the top
+// level tags of NIP-94 file events.
+func mediaImetas(event *nostr.Event) nostr.Tags {
+	if event.Kind != events.KindFileMetadata {
+		var imetas nostr.Tags
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "imeta" {
+				imetas = append(imetas, tag)
+			}
+		}
+		return imetas
+	}
+	file, err := imeta.FromTags(event.Tags)
+	if err != nil {
+		return nil
+	}
+	// the other tags of the file event describe the event, not the file
+	file.Extra = nil
+	tag, err := file.Format()
+	if err != nil {
+		return nil
+	}
+	return nostr.Tags{tag}
+}
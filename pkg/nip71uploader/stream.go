@@ -0,0 +1,166 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// streamHeadSize is how much of a streamed file is downloaded to identify
+// its type.
+const streamHeadSize = 64 << 10
+
+// errNoRange is returned by downloadHead for servers that ignore Range.
+var errNoRange = errors.New("the server does not support Range requests")
+
+// errGuardedStream refuses streaming with a URLGuard: ffprobe, ffmpeg and
+// the classifier would resolve the URL again and follow redirects and
+// playlist entries to any host, out of reach of the guard.
+var errGuardedStream = errors.New("media from untrusted URLs is not streamed")
+
+// resolveRemote resolves a video or audio URL without downloading it, for
+// NoLocalCopy: only its first bytes are downloaded to identify it, while
+// ffprobe and ffmpeg read the rest in place with Range requests. It fails
+// for other files, with a URLGuard, when ffprobe is missing or when the
+// server does not support Range requests.
+func (u *Uploader) resolveRemote(ctx context.Context, media Media) (*resolvedMedia, error) {
+	if u.URLGuard != nil {
+		return nil, errGuardedStream
+	}
+	if _, err := ffprobeBinary(ctx); err != nil {
+		return nil, err
+	}
+	head, err := downloadHead(ctx, u.URLGuard.client(), media.URL, streamHeadSize)
+	if err != nil {
+		return nil, err
+	}
+	mimeType, err := DetectMIME(head)
+	if err != nil {
+		RemoveTemp(head)
+		return nil, err
+	}
+	if !strings.HasPrefix(mimeType, "video/") && !strings.HasPrefix(mimeType, "audio/") {
+		RemoveTemp(head)
+		return nil, fmt.Errorf("only videos and audio files are streamed, not %s", mimeType)
+	}
+	log.Printf("Streaming %s without a local copy", media.URL)
+	return &resolvedMedia{media: media, url: media.URL, path: media.URL, mime: mimeType, cleanup: func() { RemoveTemp(head) }}, nil
+}
+
+// remoteMediaInfo is mediaInfo for media resolved by resolveRemote: the file
+// is measured in place and hashed while streaming it once. It is classified
+// from its URL and not archived.
+func (u *Uploader) remoteMediaInfo(ctx context.Context, media *resolvedMedia, fileType string) (*MediaInfo, error) {
+	info, err := measureMedia(ctx, media.url, media.mime, fileType, u.Previews)
+	if err != nil {
+		return nil, fmt.Errorf("GetMediaDimensions: %v", err)
+	}
+	hashes, err := u.hashURL(ctx, media.url)
+	if err != nil {
+		return nil, err
+	}
+	if err := media.media.checkHash(hashes.SHA256); err != nil {
+		return nil, err
+	}
+	if err := u.checkDuplicate(ctx, hashes.SHA256); err != nil {
+		return nil, err
+	}
+	info.Hash = hashes.SHA256
+	info.Size = hashes.Size
+	if err := u.classify(ctx, media.url, info); err != nil {
+		return nil, err
+	}
+	if u.Archive != nil {
+		log.Printf("Not archiving %s, which has no local copy", media.url)
+	}
+	return info, nil
+}
+
+// hashURL computes the SHA-256 of a remote file while downloading it,
+// without writing it to disk.
+func (u *Uploader) hashURL(ctx context.Context, url string) (hashes *FileHashes, err error) {
+	ctx, end := u.start(ctx, "download", "url", url)
+	defer func() {
+		end(err)
+		if u.Observer != nil && hashes != nil {
+			u.Observer.Downloaded(hashes.Size, err)
+		}
+	}()
+	ctx, cancel := withTimeout(ctx, DownloadTimeout)
+	defer cancel()
+	ctx, cancel = u.URLGuard.timeout(ctx)
+	defer cancel()
+	resp, err := get(ctx, u.URLGuard.client(), url, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	body, err := u.URLGuard.body(resp)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err = hashReader(ctx, body, url, resp.ContentLength, false, u.HashProgress)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength >= 0 && hashes.Size != resp.ContentLength {
+		return nil, fmt.Errorf("downloaded %d bytes of %s, but the Content-Length is %d", hashes.Size, url, resp.ContentLength)
+	}
+	return hashes, nil
+}
+
+// downloadHead downloads the first size bytes of a file with a Range request
+// into a temporary file, named with the extension of the file. It returns
+// errNoRange when the server answers with the whole file.
+func downloadHead(ctx context.Context, client *http.Client, fileURL string, size int64) (string, error) {
+	ctx, cancel := withTimeout(ctx, RequestTimeout)
+	defer cancel()
+	resp, err := get(ctx, client, fileURL, fmt.Sprintf("bytes=0-%d", size-1))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return "", errNoRange
+	default:
+		return "", fmt.Errorf("downloading %s: %s", fileURL, resp.Status)
+	}
+
+	file, err := createTemp("head-*" + downloadExtension(fileURL, resp.Header.Get("Content-Type")))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, io.LimitReader(resp.Body, size)); err != nil {
+		RemoveTemp(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// get sends a GET request for the URL with client, for the given byte range
+// when set.
+func get(ctx context.Context, client *http.Client, url, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestStreamRemote(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	_, data := writeRandom(t, 2*hashChunkSize+100)
+	url := blossom.Put(data, "video/mp4")
+
+	head, err := downloadHead(ctx, http.DefaultClient, url, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveTemp(head)
+	if got, _ := os.ReadFile(head); !bytes.Equal(got, data[:1000]) {
+		t.Errorf("head has %d bytes", len(got))
+	}
+
+	hashes, err := uploader.hashURL(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); hashes.SHA256 != hex.EncodeToString(sum[:]) || hashes.Size != int64(len(data)) {
+		t.Errorf("hashes %+v", hashes)
+	}
+
+	// servers ignoring Range answer with the whole file
+	whole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer whole.Close()
+	if _, err := downloadHead(ctx, http.DefaultClient, whole.URL+"/video.mp4", 1000); !errors.Is(err, errNoRange) {
+		t.Errorf("downloadHead without Range support: %v", err)
+	}
+
+	// URLs from untrusted clients are downloaded under the guard
+	uploader.URLGuard = &URLGuard{Allow: []string{"127.0.0.1"}}
+	if _, err := uploader.resolveRemote(ctx, Media{URL: url}); !errors.Is(err, errGuardedStream) {
+		t.Errorf("resolveRemote with a URLGuard: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TempDir is the directory the temporary files are created in, the system
+// one when empty. They go into a nostrmedia subdirectory, itself holding a
+// directory per process named after its id, so that the ones left behind by
+// crashed runs can be told apart and removed with RemoveOrphanedTemp.
+var TempDir string
+
+// OrphanedTempAge is how old the temporary files of a process that is no
+// longer running must be before RemoveOrphanedTemp removes them. The process
+// ids of other containers sharing the directory cannot be checked, so their
+// recent files are kept.
+const OrphanedTempAge = 24 * time.Hour
+
+// processDirPrefix starts the names of the directories of the processes,
+// followed by their id.
+const processDirPrefix = "run-"
+
+// freeSpaceMargin is the space left free by checkFreeSpace, so that the rest
+// of the system keeps working.
+const freeSpaceMargin = 100 << 20
+
+// tempFiles tracks the temporary files and directories created by the
+// package, so they can be removed when the program is interrupted.
+var tempFiles = struct {
+	sync.Mutex
+	paths  map[string]bool
+	closed bool
+	// dir is the directory of the process, created in root
+	dir, root string
+}{paths: map[string]bool{}}
+
+var errTempClosed = errors.New("temporary files were removed, the program is exiting")
+
+// createTemp creates a uniquely named temporary file, so that concurrent
+// jobs and processes never share one.
+func createTemp(pattern string) (*os.File, error) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	if tempFiles.closed {
+		return nil, errTempClosed
+	}
+	dir, err := processTempDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	tempFiles.paths[file.Name()] = true
+	return file, nil
+}
+
+// mkdirTemp creates a uniquely named temporary directory.
+func mkdirTemp(pattern string) (string, error) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	if tempFiles.closed {
+		return "", errTempClosed
+	}
+	root, err := processTempDir()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(root, pattern)
+	if err != nil {
+		return "", err
+	}
+	tempFiles.paths[dir] = true
+	return dir, nil
+}
+
+// RemoveTemp removes a temporary file or directory returned by the package,
+// such as the paths of DownloadFile, StripMetadata, ResizeImage and
+// ExtractFrameFromVideo.
+func RemoveTemp(path string) error {
+	tempFiles.Lock()
+	delete(tempFiles.paths, path)
+	tempFiles.Unlock()
+	return os.RemoveAll(path)
+}
+
+// RemoveTempFiles removes every temporary file and directory of the package
+// not removed yet, and makes later attempts to create one fail. Programs call
+// it when interrupted, as exiting skips the deferred removals.
+func RemoveTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	tempFiles.closed = true
+	for path := range tempFiles.paths {
+		os.RemoveAll(path)
+		delete(tempFiles.paths, path)
+	}
+	if tempFiles.dir != "" {
+		os.RemoveAll(tempFiles.dir)
+		tempFiles.dir = ""
+	}
+}
+
+// tempRoot returns the directory of the temporary files, creating it.
+func tempRoot() (string, error) {
+	dir := TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, "nostrmedia")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating temporary directory: %v", err)
+	}
+	return dir, nil
+}
+
+// processTempDir returns the directory of the temporary files of this
+// process inside tempRoot, creating it. tempFiles must be locked.
+func processTempDir() (string, error) {
+	root, err := tempRoot()
+	if err != nil {
+		return "", err
+	}
+	if tempFiles.dir != "" && tempFiles.root == root {
+		// it is created again when removed from under the process
+		if _, err := os.Stat(tempFiles.dir); err == nil {
+			return tempFiles.dir, nil
+		}
+	}
+	dir, err := os.MkdirTemp(root, fmt.Sprintf("%s%d-", processDirPrefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("creating temporary directory: %v", err)
+	}
+	tempFiles.dir, tempFiles.root = dir, root
+	return dir, nil
+}
+
+// RemoveOrphanedTemp removes the temporary files and directories left behind
+// by runs that crashed or were killed, which are the ones older than maxAge
+// whose process is no longer running, and returns how many it removed.
+func RemoveOrphanedTemp(maxAge time.Duration) (int, error) {
+	dir, err := tempRoot()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if pid, ok := processDirPID(entry.Name()); ok && processAlive(pid) {
+			continue
+		}
+		// without a user cache directory, ffmpeg is cached next to the
+		// temporary files
+		if filepath.Join(dir, entry.Name()) == FFmpegCacheDir() {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			log.Printf("Error removing orphaned temporary file: %v", err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// processDirPID returns the process id in the name of a directory created
+// by processTempDir. Files of earlier versions have none.
+func processDirPID(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, processDirPrefix)
+	if !ok {
+		return 0, false
+	}
+	digits, _, _ := strings.Cut(rest, "-")
+	pid, err := strconv.Atoi(digits)
+	return pid, err == nil && pid > 0
+}
+
+// checkFreeSpace fails when the temporary directory has less than size bytes
+// free, keeping a margin, so that a download or a conversion fails before it
+// starts rather than when the disk is full. Unknown sizes and free spaces
+// pass.
+func checkFreeSpace(size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	dir, err := tempRoot()
+	if err != nil {
+		return err
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return nil
+	}
+	if free < size+freeSpaceMargin {
+		return fmt.Errorf("not enough free space in %s: %s needed, %s free", dir, FormatSize(size), FormatSize(free))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTempDir(t *testing.T) {
+	previous := TempDir
+	TempDir = t.TempDir()
+	defer func() { TempDir = previous }()
+
+	file, err := createTemp("download-*.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer RemoveTemp(file.Name())
+	root := filepath.Join(TempDir, "nostrmedia")
+	processDir := filepath.Dir(file.Name())
+	if filepath.Dir(processDir) != root {
+		t.Errorf("created %s outside of TempDir", file.Name())
+	}
+
+	// a process that exited, and files of an earlier version without one
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	orphans := []string{
+		filepath.Join(root, fmt.Sprintf("run-%d-123", exited.Process.Pid)),
+		filepath.Join(root, "import-456"),
+	}
+	for _, orphan := range orphans {
+		if err := os.MkdirAll(filepath.Join(orphan, "video.mp4"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recent := filepath.Join(root, "run-1-789")
+	if err := os.Mkdir(recent, 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * OrphanedTempAge)
+	for _, path := range append(orphans, processDir) {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := RemoveOrphanedTemp(OrphanedTempAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != len(orphans) {
+		t.Errorf("removed %d files", removed)
+	}
+	for _, orphan := range orphans {
+		if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", orphan)
+		}
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("recent directory removed: %v", err)
+	}
+	// this process is running, however old its directory
+	if _, err := os.Stat(file.Name()); err != nil {
+		t.Errorf("file of a running process removed: %v", err)
+	}
+
+	if err := checkFreeSpace(1 << 62); err == nil && freeSpaceKnown(TempDir) {
+		t.Error("4 EB fit in the temporary directory")
+	}
+	if err := checkFreeSpace(1); err != nil {
+		t.Error(err)
+	}
+}
+
+func freeSpaceKnown(dir string) bool {
+	_, err := freeSpace(dir)
+	return err == nil
+}
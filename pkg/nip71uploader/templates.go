@@ -0,0 +1,149 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTitleTemplate titles videos published without a title with the
+// title embedded in the file or, failing that, with its file name.
+const DefaultTitleTemplate = "{{if .Title}}{{.Title}}{{else}}{{.Name}}{{end}}"
+
+// MediaFields are the values available to title and description templates.
+type MediaFields struct {
+	// Title is the title of the event in description templates. In title
+	// templates it is the title embedded in the container, if any.
+	Title string
+	// Filename is the name of the file, as given.
+	Filename string
+	// Name is the file name without extension, date and separators.
+	Name string
+	// Date is the date found in the file name, or the zero time.
+	Date time.Time
+	// Duration is in seconds.
+	Duration float64
+	Width    int
+	Height   int
+	// URL is where the media is published.
+	URL    string
+	SHA256 string
+	MIME   string
+	Size   int64
+	// UploadDate is when Blossom received the file, or when it was
+	// downloaded for media given by URL.
+	UploadDate time.Time
+}
+
+// fileNameDate matches the dates, and optionally times, cameras and phones
+// put in file names, such as VID_20230415_183012.mp4 or 2023-04-15 trip.mov.
+var fileNameDate = regexp.MustCompile(`(^|[^0-9])((?:19|20)[0-9]{2})[-_.]?([01][0-9])[-_.]?([0-3][0-9])` +
+	`(?:[-_. T]?([0-2][0-9])[-_.:]?([0-5][0-9])[-_.:]?([0-5][0-9]))?([^0-9]|$)`)
+
+// ParseFileName cleans up a file name into a title: the extension and date
+// are removed and underscores and dots become spaces. The date, when found,
+// is returned on its own.
+func ParseFileName(filename string) (string, time.Time) {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var date time.Time
+	if match := fileNameDate.FindStringSubmatch(name); match != nil {
+		value := fmt.Sprintf("%s-%s-%s", match[2], match[3], match[4])
+		layout := "2006-01-02"
+		if match[5] != "" {
+			value += fmt.Sprintf(" %s:%s:%s", match[5], match[6], match[7])
+			layout += " 15:04:05"
+		}
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			date = parsed
+			name = strings.Replace(name, match[0], match[1]+" "+match[8], 1)
+		}
+	}
+	name = strings.NewReplacer("_", " ", ".", " ").Replace(name)
+	name = strings.Trim(strings.Join(strings.Fields(name), " "), " -")
+	return name, date
+}
+
+// RenderTitle fills a title template, DefaultTitleTemplate when empty.
+func RenderTitle(titleTemplate string, fields MediaFields) (string, error) {
+	if titleTemplate == "" {
+		titleTemplate = DefaultTitleTemplate
+	}
+	return RenderTemplate("title", titleTemplate, fields)
+}
+
+// RenderTemplate fills a text/template over MediaFields. Leading and
+// trailing spaces are trimmed from the result.
+func RenderTemplate(name, text string, fields MediaFields) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %v", name, err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, fields); err != nil {
+		return "", fmt.Errorf("rendering %s template: %v", name, err)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// mediaFields collects the template fields of a resolved media, with the
+// title embedded in videos.
+func mediaFields(ctx context.Context, media Media, resolved *resolvedMedia, info *MediaInfo) MediaFields {
+	fields := MediaFields{
+		Filename:   mediaFileName(media),
+		Duration:   info.Duration,
+		Width:      info.Width,
+		Height:     info.Height,
+		URL:        resolved.url,
+		SHA256:     info.Hash,
+		MIME:       info.MIME,
+		Size:       info.Size,
+		UploadDate: time.Now(),
+	}
+	if resolved.uploaded != 0 {
+		fields.UploadDate = time.Unix(resolved.uploaded, 0)
+	}
+	fields.Name, fields.Date = ParseFileName(fields.Filename)
+	if strings.HasPrefix(info.MIME, "video/") {
+		if header, err := ProbeVideo(ctx, resolved.path); err == nil {
+			fields.Title = strings.TrimSpace(header.Title)
+		}
+	}
+	return fields
+}
+
+// renderDescription returns the description, or renders descriptionTemplate
+// when it is empty.
+func renderDescription(description, descriptionTemplate string, fields MediaFields) (string, error) {
+	if description != "" || descriptionTemplate == "" {
+		return description, nil
+	}
+	return RenderTemplate("description", descriptionTemplate, fields)
+}
+
+// mediaFileName returns the name of the local file, or the last element of
+// the URL path.
+func mediaFileName(media Media) string {
+	if media.Path != "" {
+		return filepath.Base(media.Path)
+	}
+	parsed, err := url.Parse(media.URL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(parsed.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
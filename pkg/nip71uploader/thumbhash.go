@@ -0,0 +1,138 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"encoding/base64"
+	"image"
+	"image/color"
+	"math"
+)
+
+// EncodeThumbhash returns the base64 encoded ThumbHash of an image, a more
+// compact placeholder than blurhash that also keeps the aspect ratio and
+// the transparency (https://evanw.github.io/thumbhash/). Images larger than
+// 100x100 are scaled down first.
+func EncodeThumbhash(img image.Image) string {
+	img = downscale(img, 100)
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return ""
+	}
+	// JavaScript rounding, which the reference encoder uses
+	round := func(x float64) int { return int(math.Floor(x + 0.5)) }
+
+	// the average color, weighted by opacity
+	n := w * h
+	r, g, b, a := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	var avgR, avgG, avgB, avgA float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			i := x + y*w
+			a[i] = float64(c.A) / 255
+			r[i], g[i], b[i] = float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+			avgR += a[i] * r[i]
+			avgG += a[i] * g[i]
+			avgB += a[i] * b[i]
+			avgA += a[i]
+		}
+	}
+	if avgA > 0 {
+		avgR, avgG, avgB = avgR/avgA, avgG/avgA, avgB/avgA
+	}
+
+	hasAlpha := avgA < float64(n)
+	limit := 7.0
+	if hasAlpha {
+		// fewer luminance bits leave room for the alpha channel
+		limit = 5
+	}
+	longest := float64(max(w, h))
+	lx := max(1, round(limit*float64(w)/longest))
+	ly := max(1, round(limit*float64(h)/longest))
+
+	// luminance, yellow-blue and red-green, composited over the average
+	l, p, q := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := range n {
+		cr := avgR*(1-a[i]) + a[i]*r[i]
+		cg := avgG*(1-a[i]) + a[i]*g[i]
+		cb := avgB*(1-a[i]) + a[i]*b[i]
+		l[i] = (cr + cg + cb) / 3
+		p[i] = (cr+cg)/2 - cb
+		q[i] = cr - cg
+	}
+
+	// encode returns the DC term of the DCT of a channel, its AC terms
+	// normalized to 0..1 and their scale
+	encode := func(channel []float64, nx, ny int) (float64, []float64, float64) {
+		var dc, scale float64
+		var ac []float64
+		fx := make([]float64, w)
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				for x := range w {
+					fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+				}
+				var f float64
+				for y := range h {
+					fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+					for x := range w {
+						f += channel[x+y*w] * fx[x] * fy
+					}
+				}
+				f /= float64(n)
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return dc, ac, scale
+	}
+	lDC, lAC, lScale := encode(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encode(p, 3, 3)
+	qDC, qAC, qScale := encode(q, 3, 3)
+
+	landscape := w > h
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 | round(31*lScale)<<18
+	header16 := round(63*pScale)<<3 | round(63*qScale)<<9
+	if landscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+	acs := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+	if hasAlpha {
+		aDC, aAC, aScale := encode(a, 5, 5)
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		acs = append(acs, aAC)
+	}
+
+	// the AC terms, four bits each
+	start, index := len(hash), 0
+	for _, ac := range acs {
+		for _, f := range ac {
+			if start+index/2 >= len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[start+index/2] |= byte(round(15*f) << ((index & 1) * 4))
+			index++
+		}
+	}
+	return base64.StdEncoding.EncodeToString(hash)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts of the network operations of the package, which programs may
+// change before using it. Every operation also stops when its context is
+// done. PublishDeadline, PowTimeout and LinkCheckTimeout bound the other
+// stages.
+var (
+	// RelayTimeout bounds connecting to a relay and each query or publish
+	// sent to it, as well as fetching its NIP-11 document.
+	RelayTimeout = 5 * time.Second
+	// SignTimeout bounds signing an event or a NIP-42 challenge, which may
+	// involve a remote signer.
+	SignTimeout = 20 * time.Second
+	// RequestTimeout bounds the small HTTP requests and relay lookups, such
+	// as fetching relay lists.
+	RequestTimeout = 15 * time.Second
+	// DownloadTimeout and UploadTimeout bound the transfer of each media
+	// file. There is no limit when they are zero.
+	DownloadTimeout time.Duration
+	UploadTimeout   time.Duration
+)
+
+// withTimeout bounds ctx by timeout, unless timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
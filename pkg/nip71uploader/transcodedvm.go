@@ -0,0 +1,129 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Kinds of the NIP-90 video transcoding jobs.
+var (
+	TranscodeJobRequestKind = 5201
+	TranscodeJobResultKind  = 6201
+)
+
+// Transcoded is the result of a transcoding job.
+type Transcoded struct {
+	// Renditions are the transcoded videos, from the imeta tags of the
+	// result.
+	Renditions []imeta.Imeta
+	// Thumbnail is the URL of a poster image, from the "thumb" or "image"
+	// tag of the result.
+	Thumbnail string
+}
+
+// DelegateTranscode asks a NIP-90 Data Vending Machine to transcode the
+// video served at videoURL, so that weak hardware does not have to. It
+// publishes a job request with the URL as input and waits, until ctx is
+// done, for a result describing the renditions in imeta tags. Payment
+// requests are handled as in DelegatePow. An empty dvmPubKey leaves the job
+// open to any provider.
+func DelegateTranscode(ctx context.Context, videoURL string, signer nostr.Keyer, relays []string, dvmPubKey string,
+	pay func(ctx context.Context, invoice string) (string, error)) (*Transcoded, error) {
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("no relays to send the transcoding job to")
+	}
+	request := nostr.Event{
+		Kind:      TranscodeJobRequestKind,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"i", videoURL, "url"},
+			{"output", "video/mp4"},
+			append(nostr.Tag{"relays"}, relays...),
+		},
+	}
+	if dvmPubKey != "" {
+		request.Tags = append(request.Tags, nostr.Tag{"p", dvmPubKey})
+	}
+	if err := signer.SignEvent(ctx, &request); err != nil {
+		return nil, fmt.Errorf("signing transcoding request: %v", err)
+	}
+
+	// subscribe before publishing so a fast provider is not missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	replies := pool.SubMany(ctx, relays, nostr.Filters{{
+		Kinds: []int{TranscodeJobResultKind, nostr.KindJobFeedback},
+		Tags:  nostr.TagMap{"e": []string{request.ID}},
+	}})
+
+	if len(AcceptedRelays(PublishEvent(ctx, &request, signer, relays))) == 0 {
+		return nil, fmt.Errorf("no relay accepted the transcoding request")
+	}
+	log.Printf("Waiting for transcoding DVM (job %s)", request.ID)
+
+	paid := false
+	for reply := range replies {
+		if dvmPubKey != "" && reply.PubKey != dvmPubKey {
+			continue
+		}
+		if reply.Kind == nostr.KindJobFeedback {
+			invoice := logJobFeedback("Transcoding", reply.Event)
+			if invoice != "" && pay != nil && !paid {
+				if _, err := pay(ctx, invoice); err != nil {
+					return nil, fmt.Errorf("paying transcoding DVM: %v", err)
+				}
+				log.Printf("Paid transcoding DVM %s", reply.PubKey)
+				paid = true
+			}
+			continue
+		}
+		transcoded, err := parseTranscodeResult(reply.Event)
+		if err != nil {
+			log.Printf("Ignoring transcoding result from %s: %v", reply.PubKey, err)
+			continue
+		}
+		log.Printf("Transcoding DVM %s returned %d renditions", reply.PubKey, len(transcoded.Renditions))
+		return transcoded, nil
+	}
+	return nil, fmt.Errorf("waiting for transcoding: %v", ctx.Err())
+}
+
+// parseTranscodeResult reads the renditions and thumbnail of a result. A
+// result whose content is a single URL is a rendition without metadata.
+func parseTranscodeResult(result *nostr.Event) (*Transcoded, error) {
+	var transcoded Transcoded
+	for _, tag := range result.Tags {
+		switch {
+		case len(tag) >= 2 && tag[0] == "imeta":
+			rendition, err := imeta.Parse(tag)
+			if err != nil {
+				return nil, err
+			}
+			transcoded.Renditions = append(transcoded.Renditions, rendition)
+		case len(tag) >= 2 && (tag[0] == "thumb" || tag[0] == "image") && transcoded.Thumbnail == "":
+			transcoded.Thumbnail = tag[1]
+		}
+	}
+	if content := strings.TrimSpace(result.Content); len(transcoded.Renditions) == 0 && content != "" {
+		rendition := imeta.Imeta{URL: content, MIME: "video/mp4"}
+		if err := rendition.Validate(); err != nil {
+			return nil, err
+		}
+		transcoded.Renditions = append(transcoded.Renditions, rendition)
+	}
+	if len(transcoded.Renditions) == 0 {
+		return nil, fmt.Errorf("result has no rendition")
+	}
+	return &transcoded, nil
+}
@@ -0,0 +1,1352 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/pkg/events"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// DefaultBlossomServer is the Blossom server used when none is configured.
+const DefaultBlossomServer = "https://cdn.nostrcheck.me"
+
+// Uploader runs the whole pipeline: upload or download the media, extract
+// its metadata, build the event, mine proof of work, sign and publish.
+// When mining the proof of work fails or is interrupted, the Build methods
+// return the event built so far, without nonce, along with the error.
+type Uploader struct {
+	// Signer signs the Blossom authorizations and the events.
+	Signer nostr.Keyer
+	// Blossom is the base URL of the Blossom server used for local files.
+	Blossom string
+	// Relays receive the published events.
+	Relays []string
+	// Difficulty is the NIP-13 proof of work difficulty, 0 disables it.
+	Difficulty int
+	// Hashtags are added as "t" tags to every media event.
+	Hashtags []string
+	// Client, when set, is published in a "client" tag.
+	Client string
+	// ClientVersion, when set, follows the Client name in the "client" tag,
+	// as in "nostrmedia v1.2.3".
+	ClientVersion string
+	// ExtraTags are added as they are to every media event, for tags this
+	// package does not know about.
+	ExtraTags nostr.Tags
+	// DetectLanguage labels the language of events without one, with the
+	// language the audio of videos and audio files is tagged with or else
+	// the one DetectLanguage guesses from the title and description.
+	DetectLanguage bool
+	// Emojis are the NIP-30 "emoji" tags of the custom emojis that may be
+	// used as :shortcode: in the title and description, see ParseEmoji.
+	Emojis nostr.Tags
+	// Cache, when set, is consulted before uploading a local file and told
+	// about every upload.
+	Cache UploadCache
+	// HashCache, when set, saves hashing local files again while they are
+	// unchanged.
+	HashCache HashCache
+	// HashProgress, when set, is called periodically while hashing large
+	// files.
+	HashProgress func(HashStatus)
+	// UploadProgress, when set, is called periodically while uploading.
+	UploadProgress func(UploadStatus)
+	// BLAKE3 also computes the BLAKE3 digest of local files, recorded in
+	// HashCache for dedupe indexes.
+	BLAKE3 bool
+	// MediaIndex, when set, provides the URLs of blobs uploaded before and
+	// is told about every upload and published event.
+	MediaIndex MediaIndex
+	// Archive, when set, keeps a copy of every media file of the events
+	// built, before their temporary files are removed.
+	Archive MediaArchive
+	// Force publishes media MediaIndex knows the signer published already,
+	// which otherwise fails with an AlreadyPublishedError.
+	Force bool
+	// UpdateExisting turns events for media the signer published already,
+	// according to MediaIndex or the relays, into updates of the existing
+	// event, keeping its metadata, see MergeExisting.
+	UpdateExisting bool
+	// Pool, when set, keeps the relay connections open between publishes.
+	Pool *RelayPool
+	// PowTimeout, when non-zero, bounds the proof of work computation.
+	PowTimeout time.Duration
+	// PowProgress, when set, is called periodically while mining.
+	PowProgress func(PowStatus)
+	// PowDVM, when set, delegates the proof of work to a NIP-90 DVM with
+	// DelegatePow. "any" leaves the job open to every provider.
+	PowDVM string
+	// TranscodeDVM, when set, asks a NIP-90 DVM for renditions and a
+	// poster of uploaded videos with DelegateTranscode. "any" leaves the job
+	// open to every provider.
+	TranscodeDVM string
+	// TranscodeTimeout, when non-zero, bounds the wait for TranscodeDVM.
+	TranscodeTimeout time.Duration
+	// CheckRelayInfo checks the NIP-11 documents of the relays before
+	// mining proof of work, see CheckRelayInfo.
+	CheckRelayInfo bool
+	// MaxUploadSize, when non-zero, refuses uploading larger files.
+	MaxUploadSize int64
+	// PayInvoice, when set, pays the lightning invoices of the Blossom
+	// servers and DVMs requiring payment and returns their preimage, so that
+	// the upload is retried. Otherwise the invoice is returned in the error,
+	// or logged by DVMs.
+	PayInvoice func(ctx context.Context, invoice string) (string, error)
+	// ImetaFields, when set, are the only media fields published, besides
+	// the url. Otherwise DefaultImetaFields of the event kind are.
+	ImetaFields []string
+	// Previews select the placeholders computed for images and videos.
+	Previews Previews
+	// Classify, when set, is called with the local copy of every media file
+	// once measured, see ClassifyCommand. Events with media classified as
+	// sensitive get a NIP-36 content-warning tag, and an error stops the
+	// build.
+	Classify func(ctx context.Context, path, mimeType string) (Classification, error)
+	// Confirm, when set, is shown every media event once built, before its
+	// proof of work is mined. An error stops the build.
+	Confirm func(ctx context.Context, event *nostr.Event) error
+	// Observer, when set, is told about the downloads, uploads, proof of work
+	// and publishes, for metrics and traces.
+	Observer Observer
+	// URLGuard, when set, keeps the media downloads from reaching internal
+	// addresses and bounds their size and duration, for URLs given by
+	// untrusted clients.
+	URLGuard *URLGuard
+	// NoLocalCopy measures remote videos and audio files in place instead of
+	// downloading them: ffprobe and ffmpeg read them with Range requests and
+	// they are hashed while streamed once, without writing them to disk.
+	// Other files, servers without Range support and media downloaded
+	// under a URLGuard are downloaded.
+	NoLocalCopy bool
+}
+
+// Media is a file to publish. Path points to a local file that gets uploaded
+// to Blossom; otherwise URL points to an already hosted file, which is
+// downloaded temporarily to extract its metadata.
+type Media struct {
+	Path string
+	URL  string
+	// SHA256, when set, is the hex sha256 the file must have: a file or
+	// download with another hash is refused before it is published.
+	SHA256 string
+}
+
+// checkHash refuses a file whose sha256 is not the expected one. A
+// downloaded file is also checked against the hash in its URL, which names
+// Blossom blobs, with a warning only as other servers may name files with
+// unrelated hashes.
+func (m Media) checkHash(sha256Hash string) error {
+	if m.SHA256 != "" && !strings.EqualFold(m.SHA256, sha256Hash) {
+		return fmt.Errorf("%s has sha256 %s, expected %s", m.name(), sha256Hash, m.SHA256)
+	}
+	if m.Path == "" && m.SHA256 == "" {
+		if named := urlHash(m.URL); named != "" && named != sha256Hash {
+			log.Printf("Warning: %s has sha256 %s, not the hash in its URL", m.URL, sha256Hash)
+		}
+	}
+	return nil
+}
+
+// name names the media in errors.
+func (m Media) name() string {
+	if m.Path != "" {
+		return m.Path
+	}
+	return m.URL
+}
+
+// VideoOptions describes a NIP-71 video event.
+type VideoOptions struct {
+	Media
+	// Fallbacks are other URLs serving the same video, such as mirrors on
+	// other CDNs. They are downloaded to check that they match its hash and
+	// published as fallback fields of its imeta tag.
+	Fallbacks []string
+	// Title, when empty, is rendered from TitleTemplate, see MediaFields.
+	Title string
+	// TitleTemplate is a text/template over MediaFields, defaulting to
+	// DefaultTitleTemplate.
+	TitleTemplate string
+	// Description, when empty, is rendered from DescriptionTemplate.
+	Description         string
+	DescriptionTemplate string
+	// PublishedAt is the published_at tag in unix seconds. When empty, it
+	// is the upload time reported by Blossom for a Path, or the current time.
+	PublishedAt string
+	// Identifier is the "d" tag of legacy events, defaulting to the hash.
+	Identifier string
+	Legacy     bool
+	Horizontal bool
+	// Orientation, when set, decides Horizontal from the display size of
+	// the video once it is measured, rotation included, and is given zero
+	// sizes when they are unknown.
+	Orientation func(width, height int) bool
+	// BothKinds links a kind 21 or 22 event to its legacy copy, built with
+	// BuildLegacyCopy once the event is signed, with an "a" tag.
+	BothKinds bool
+	// Thumbnail, when set, is the poster image of the video, published as
+	// the imeta "image" field.
+	Thumbnail Media
+	// ThumbnailAt, when positive and Thumbnail is not set, is the time of
+	// the frame of the video extracted with ffmpeg as its poster.
+	ThumbnailAt time.Duration
+	// ShowNotes, when set, is the ShowNotesAddress of the article with the
+	// show notes of the video, published as an "a" tag.
+	ShowNotes string
+	// References are "a" and "e" tags linking the event to the series it
+	// is an episode of and to the previous episode, see ReferenceTag.
+	References nostr.Tags
+	// Languages labels the language of the event and adds translated
+	// titles and summaries.
+	Languages events.Languages
+	// Source, when set, attributes mirrored media to the original.
+	Source events.Source
+	// CreatedAt overrides the event timestamp when non-zero.
+	CreatedAt nostr.Timestamp
+	// Template, when set, is a partial event whose content and tags are
+	// merged into the built event, see LoadEventTemplate.
+	Template *nostr.Event
+}
+
+// PictureOptions describes a NIP-68 picture event.
+type PictureOptions struct {
+	Pictures    []Media
+	Title       string
+	Description string
+	// PublishedAt is the published_at tag in unix seconds. When empty, it
+	// is the upload time reported by Blossom for the last picture with a
+	// Path, or the current time.
+	PublishedAt string
+	// KeepMetadata uploads local pictures as they are. By default their
+	// EXIF and other metadata are removed first, see StripMetadata.
+	KeepMetadata bool
+	// Resize, when enabled, downscales and recompresses local JPEG and WebP
+	// pictures before uploading them, see ResizeImage.
+	Resize ResizeOptions
+	// Languages labels the language of the event and adds translated
+	// titles and summaries.
+	Languages events.Languages
+	// Source, when set, attributes mirrored media to the original.
+	Source events.Source
+	// CreatedAt overrides the event timestamp when non-zero.
+	CreatedAt nostr.Timestamp
+	// Template, when set, is a partial event whose content and tags are
+	// merged into the built event, see LoadEventTemplate.
+	Template *nostr.Event
+}
+
+// FileOptions describes a NIP-94 file metadata event.
+type FileOptions struct {
+	Media
+	// Description, when empty, is rendered from DescriptionTemplate, see
+	// MediaFields.
+	Description         string
+	DescriptionTemplate string
+	Summary             string
+	Alt                 string
+	// Languages labels the language of the event and adds translated
+	// titles and summaries.
+	Languages events.Languages
+	// Source, when set, attributes mirrored media to the original.
+	Source events.Source
+	// CreatedAt overrides the event timestamp when non-zero.
+	CreatedAt nostr.Timestamp
+	// Template, when set, is a partial event whose content and tags are
+	// merged into the built event, see LoadEventTemplate.
+	Template *nostr.Event
+}
+
+// AudioOptions describes a NIP-94 file metadata event for a podcast episode
+// or a song.
+type AudioOptions struct {
+	Media
+	// Description, when empty, is rendered from DescriptionTemplate, see
+	// MediaFields.
+	Description         string
+	DescriptionTemplate string
+	Summary             string
+	Alt                 string
+	// Cover, when set, is published as the preview image instead of the
+	// cover art embedded in the file.
+	Cover Media
+	// ShowNotes, when set, is the ShowNotesAddress of the article with the
+	// show notes, published as an "a" tag.
+	ShowNotes string
+	// References are "a" and "e" tags linking the event to the series it
+	// is an episode of and to the previous episode, see ReferenceTag.
+	References nostr.Tags
+	// Languages labels the language of the event and adds translated
+	// titles and summaries.
+	Languages events.Languages
+	// Source, when set, attributes mirrored media to the original.
+	Source events.Source
+	// CreatedAt overrides the event timestamp when non-zero.
+	CreatedAt nostr.Timestamp
+	// Template, when set, is a partial event whose content and tags are
+	// merged into the built event, see LoadEventTemplate.
+	Template *nostr.Event
+}
+
+// UploadCache remembers the blobs already uploaded, so that a resumed or
+// repeated run does not upload the same file again.
+type UploadCache interface {
+	// Uploaded returns the blob a previous upload of path produced.
+	Uploaded(path string) (*BlobDescriptor, bool)
+	// SaveUploaded records the blob an upload of path produced.
+	SaveUploaded(path string, blob *BlobDescriptor)
+}
+
+// resolvedMedia is a media file available both locally and on the web.
+type resolvedMedia struct {
+	media    Media
+	url      string
+	path     string
+	uploaded int64
+	// hashes are known for uploaded files, which are hashed beforehand.
+	hashes *FileHashes
+	// mime is set for media streamed by resolveRemote, whose path is the
+	// URL itself.
+	mime    string
+	cleanup func()
+}
+
+// blossomServer returns Blossom, or DefaultBlossomServer when it is unset.
+func (u *Uploader) blossomServer() string {
+	if u.Blossom == "" {
+		return DefaultBlossomServer
+	}
+	return u.Blossom
+}
+
+// upload uploads the file, whose sha256 is already known, unless Cache knows
+// it was uploaded already or MediaIndex knows a URL still serving it.
+func (u *Uploader) upload(ctx context.Context, blossom, path, sha256Hash string) (*BlobDescriptor, error) {
+	if u.Cache != nil {
+		if descriptor, ok := u.Cache.Uploaded(path); ok {
+			return descriptor, nil
+		}
+	}
+	descriptor, err := u.uploadOnce(ctx, blossom, path, sha256Hash)
+	if err != nil {
+		return nil, err
+	}
+	if u.Cache != nil {
+		u.Cache.SaveUploaded(path, descriptor)
+	}
+	if u.MediaIndex != nil {
+		u.MediaIndex.SaveUpload(sha256Hash, descriptor.URL)
+	}
+	return descriptor, nil
+}
+
+// uploadOnce uploads the file unless MediaIndex knows a URL for it.
+func (u *Uploader) uploadOnce(ctx context.Context, blossom, path, sha256Hash string) (*BlobDescriptor, error) {
+	url, ok := u.indexedURL(ctx, blossom, sha256Hash)
+	if !ok {
+		if err := u.preflight(ctx, blossom, path, sha256Hash); err != nil {
+			return nil, err
+		}
+		return u.uploadPaying(ctx, blossom, path, sha256Hash)
+	}
+	log.Printf("Reusing %s, uploaded before", url)
+	descriptor := &BlobDescriptor{URL: url, SHA256: sha256Hash}
+	if info, err := os.Stat(path); err == nil {
+		descriptor.Size = info.Size()
+	}
+	return descriptor, nil
+}
+
+// uploadPaying uploads the file, paying the server with PayInvoice and
+// trying again when it requires payment.
+func (u *Uploader) uploadPaying(ctx context.Context, blossom, path, sha256Hash string) (descriptor *BlobDescriptor, err error) {
+	ctx, end := u.start(ctx, "upload", "server", blossom, "sha256", sha256Hash)
+	defer func() {
+		end(err)
+		if u.Observer != nil {
+			u.Observer.Uploaded(blossom, fileSize(path), err)
+		}
+	}()
+	descriptor, err = uploadFile(ctx, blossom, path, sha256Hash, u.Signer, u.UploadProgress, "")
+	var payment *PaymentRequiredError
+	if !errors.As(err, &payment) || payment.Invoice == "" || u.PayInvoice == nil {
+		return descriptor, err
+	}
+	log.Printf("%s requires payment to upload %s, paying invoice %s", blossom, path, payment.Invoice)
+	preimage, err := u.PayInvoice(ctx, payment.Invoice)
+	if err != nil {
+		return nil, fmt.Errorf("paying %s: %v", blossom, err)
+	}
+	return uploadFile(ctx, blossom, path, sha256Hash, u.Signer, u.UploadProgress, preimage)
+}
+
+// checkUploadSize refuses files above MaxUploadSize.
+func (u *Uploader) checkUploadSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if u.MaxUploadSize > 0 && info.Size() > u.MaxUploadSize {
+		return 0, fmt.Errorf("%s is %s, above the maximum upload size of %s", path,
+			FormatSize(info.Size()), FormatSize(u.MaxUploadSize))
+	}
+	return info.Size(), nil
+}
+
+// preflight checks the size of the file, and warns when the Blossom server
+// tells it would reject it, before spending the time to upload it.
+func (u *Uploader) preflight(ctx context.Context, blossom, path, sha256Hash string) error {
+	size, err := u.checkUploadSize(path)
+	if err != nil {
+		return err
+	}
+	mimeType, err := DetectMIME(path)
+	if err != nil {
+		mimeType = "application/octet-stream"
+	}
+	var payment *PaymentRequiredError
+	if err := CheckUpload(ctx, blossom, sha256Hash, size, mimeType, u.Signer); errors.As(err, &payment) && u.PayInvoice != nil {
+		log.Printf("Uploading %s (%s) to %s, which requires payment", path, FormatSize(size), blossom)
+	} else if err != nil {
+		log.Printf("Warning: %s may reject %s (%s): %v", blossom, path, FormatSize(size), err)
+	} else {
+		log.Printf("Uploading %s (%s) to %s", path, FormatSize(size), blossom)
+	}
+	return nil
+}
+
+// resolve uploads local files and downloads remote ones, so that every media
+// has both a public URL and a local copy to inspect.
+func (u *Uploader) resolve(ctx context.Context, media Media) (*resolvedMedia, error) {
+	return u.resolveHashed(ctx, media, nil)
+}
+
+// resolveHashed is resolve for a local file whose hashes may be known.
+func (u *Uploader) resolveHashed(ctx context.Context, media Media, hashes *FileHashes) (*resolvedMedia, error) {
+	if media.SHA256 != "" {
+		if decoded, err := hex.DecodeString(media.SHA256); err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("invalid expected sha256 %q", media.SHA256)
+		}
+	}
+	if media.Path != "" {
+		// large files are refused before hashing them
+		if _, err := u.checkUploadSize(media.Path); err != nil {
+			return nil, err
+		}
+		if hashes == nil {
+			var err error
+			if hashes, err = u.hashFile(ctx, media.Path); err != nil {
+				return nil, fmt.Errorf("hashing %s: %v", media.Path, err)
+			}
+		}
+		// a wrong file is refused before uploading it
+		if err := media.checkHash(hashes.SHA256); err != nil {
+			return nil, err
+		}
+		if err := u.checkDuplicate(ctx, hashes.SHA256); err != nil {
+			return nil, err
+		}
+		descriptor, err := u.upload(ctx, u.blossomServer(), media.Path, hashes.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("uploading %s: %v", media.Path, err)
+		}
+		uploaded := descriptor.Uploaded
+		if uploaded == 0 {
+			uploaded = time.Now().Unix()
+		}
+		return &resolvedMedia{media: media, url: descriptor.URL, path: media.Path, uploaded: uploaded, hashes: hashes, cleanup: func() {}}, nil
+	}
+	if media.URL == "" {
+		return nil, errors.New("either a path or a URL must be provided")
+	}
+	if u.NoLocalCopy {
+		resolved, err := u.resolveRemote(ctx, media)
+		if err == nil {
+			return resolved, nil
+		}
+		log.Printf("Downloading %s, which cannot be streamed: %v", media.URL, err)
+	}
+	path, err := u.download(ctx, media.URL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %v", media.URL, err)
+	}
+	return &resolvedMedia{media: media, url: media.URL, path: path, cleanup: func() { RemoveTemp(path) }}, nil
+}
+
+// download downloads a remote media file with DownloadFile.
+func (u *Uploader) download(ctx context.Context, url string) (string, error) {
+	ctx, end := u.start(ctx, "download", "url", url)
+	path, err := downloadFile(ctx, url, u.URLGuard)
+	end(err)
+	if u.Observer != nil {
+		u.Observer.Downloaded(fileSize(path), err)
+	}
+	return path, err
+}
+
+// mediaInfo measures the media. Downloaded media, which was not hashed
+// beforehand, is hashed and checked for duplicates here.
+func (u *Uploader) mediaInfo(ctx context.Context, media *resolvedMedia, fileType string) (*MediaInfo, error) {
+	if media.mime != "" {
+		return u.remoteMediaInfo(ctx, media, fileType)
+	}
+	info, err := mediaDimensions(ctx, media.path, fileType, u.Previews)
+	if err != nil {
+		return nil, fmt.Errorf("GetMediaDimensions: %v", err)
+	}
+	hashes := media.hashes
+	if hashes == nil {
+		if hashes, err = HashFile(ctx, media.path, false, u.HashProgress); err != nil {
+			return nil, err
+		}
+		if err := media.media.checkHash(hashes.SHA256); err != nil {
+			return nil, err
+		}
+		if err := u.checkDuplicate(ctx, hashes.SHA256); err != nil {
+			return nil, err
+		}
+	}
+	info.Hash = hashes.SHA256
+	info.Size = hashes.Size
+	if err := u.classify(ctx, media.path, info); err != nil {
+		return nil, err
+	}
+	u.archive(hashes.SHA256, media.path, media.url)
+	return info, nil
+}
+
+// MediaArchive keeps copies of media files, see Uploader.Archive.
+type MediaArchive interface {
+	// Stage keeps a copy of the file with the given sha256, served at url.
+	Stage(sha256Hash, path, url string) error
+}
+
+// archive stages the file in Archive, logging failures as archiving is not
+// worth failing the upload for.
+func (u *Uploader) archive(sha256Hash, path, url string) {
+	if u.Archive == nil {
+		return
+	}
+	if err := u.Archive.Stage(sha256Hash, path, url); err != nil {
+		log.Printf("Error archiving %s: %v", path, err)
+	}
+}
+
+// BuildVideoEvent uploads or downloads the video and returns the unsigned
+// NIP-71 event, with proof of work already mined.
+func (u *Uploader) BuildVideoEvent(ctx context.Context, opts VideoOptions) (*nostr.Event, error) {
+	languageTags, err := opts.Languages.Tags()
+	if err != nil {
+		return nil, err
+	}
+	sourceTags, err := opts.Source.Tags()
+	if err != nil {
+		return nil, err
+	}
+	video, err := u.resolve(ctx, opts.Media)
+	if err != nil {
+		return nil, err
+	}
+	defer video.cleanup()
+
+	publishedAt := opts.PublishedAt
+	if publishedAt == "" && video.uploaded != 0 {
+		publishedAt = fmt.Sprintf("%d", video.uploaded)
+	} else if publishedAt == "" {
+		publishedAt = fmt.Sprintf("%d", time.Now().Unix())
+	}
+	if err := ValidateInput(video.url, opts.Title, publishedAt); err != nil {
+		return nil, fmt.Errorf("input validation error: %v", err)
+	}
+
+	info, err := u.mediaInfo(ctx, video, "video")
+	if err != nil {
+		return nil, fmt.Errorf("extracting video information: %v", err)
+	}
+	if err := u.checkFallbacks(ctx, opts.Fallbacks, info.Hash); err != nil {
+		return nil, err
+	}
+	fields := mediaFields(ctx, opts.Media, video, info)
+	title := opts.Title
+	if title == "" {
+		if title, err = RenderTitle(opts.TitleTemplate, fields); err != nil {
+			return nil, err
+		}
+	}
+	fields.Title = title
+	description, err := renderDescription(opts.Description, opts.DescriptionTemplate, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	imeta := events.NewImetaBuilder(video.url).
+		MIME(info.MIME).
+		Hash(info.Hash).
+		Size(info.Size).
+		Dim(info.Width, info.Height).
+		Blurhash(info.Blurhash).
+		Thumbhash(info.Thumbhash).
+		Duration(info.Duration).
+		Bitrate(info.Bitrate).
+		Codec(info.Codec)
+	for _, fallback := range opts.Fallbacks {
+		imeta.Fallback(fallback)
+	}
+	thumbnail := opts.Thumbnail
+	if thumbnail.Path == "" && thumbnail.URL == "" && opts.ThumbnailAt > 0 {
+		if info.Duration > 0 && opts.ThumbnailAt.Seconds() >= info.Duration {
+			return nil, fmt.Errorf("the poster frame at %v is past the end of the video, which lasts %.1fs", opts.ThumbnailAt, info.Duration)
+		}
+		if thumbnail.Path, err = ExtractFrame(ctx, video.path, opts.ThumbnailAt); err != nil {
+			return nil, err
+		}
+		defer RemoveTemp(thumbnail.Path)
+	}
+	if thumbnail.Path != "" || thumbnail.URL != "" {
+		thumbnailURL, err := u.thumbnailURL(ctx, thumbnail)
+		if err != nil {
+			return nil, err
+		}
+		imeta.Image(thumbnailURL)
+	}
+	var renditions []*events.ImetaBuilder
+	if u.TranscodeDVM != "" {
+		transcoded, err := u.transcode(ctx, video.url)
+		if err != nil {
+			return nil, err
+		}
+		for _, rendition := range transcoded.Renditions {
+			renditions = append(renditions, events.ImetaFrom(rendition))
+		}
+		if transcoded.Thumbnail != "" && thumbnail.Path == "" && thumbnail.URL == "" {
+			imeta.Image(transcoded.Thumbnail)
+		}
+	}
+
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+
+	horizontal := opts.Horizontal
+	if opts.Orientation != nil {
+		horizontal = opts.Orientation(info.Width, info.Height)
+	}
+	builder := events.NewVideoEventBuilder().
+		Legacy(opts.Legacy).
+		Horizontal(horizontal).
+		PubKey(pubKey).
+		CreatedAt(opts.CreatedAt).
+		Title(title).
+		PublishedAt(publishedAt).
+		Description(description).
+		Identifier(opts.Identifier).
+		Imeta(imeta)
+	for _, rendition := range renditions {
+		builder.Imeta(rendition)
+	}
+	for _, tag := range append(languageTags, sourceTags...) {
+		builder.Tag(tag)
+	}
+	if opts.ShowNotes != "" {
+		builder.Tag(nostr.Tag{"a", opts.ShowNotes})
+	}
+	for _, tag := range opts.References {
+		builder.Tag(tag)
+	}
+	event, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("creating NIP-71 event: %v", err)
+	}
+	addContentWarning(event, info)
+	u.labelLanguage(event, info.Language)
+	if opts.BothKinds && !opts.Legacy {
+		address, err := LegacyAddress(event)
+		if err != nil {
+			return nil, err
+		}
+		// the legacy copy is published to the same relays once this is signed
+		event.Tags = append(event.Tags, nostr.Tag{"a", address, RelayHint(u.Relays)})
+	}
+
+	if err := mergeTemplate(event, opts.Template); err != nil {
+		return nil, err
+	}
+
+	return u.finish(ctx, event)
+}
+
+// checkFallbacks downloads the fallback URLs of a media file and checks that
+// they serve the file with the given sha256.
+func (u *Uploader) checkFallbacks(ctx context.Context, fallbacks []string, sha256Hash string) error {
+	for _, url := range fallbacks {
+		path, err := u.download(ctx, url)
+		if err != nil {
+			return fmt.Errorf("downloading fallback %s: %v", url, err)
+		}
+		hashes, err := HashFile(ctx, path, false, u.HashProgress)
+		RemoveTemp(path)
+		if err != nil {
+			return fmt.Errorf("hashing fallback %s: %v", url, err)
+		}
+		if hashes.SHA256 != sha256Hash {
+			return fmt.Errorf("fallback %s serves another file: sha256 %s, want %s", url, hashes.SHA256, sha256Hash)
+		}
+	}
+	return nil
+}
+
+// transcode asks TranscodeDVM for renditions of the video, giving up after
+// TranscodeTimeout.
+func (u *Uploader) transcode(ctx context.Context, videoURL string) (*Transcoded, error) {
+	ctx, cancel := withTimeout(ctx, u.TranscodeTimeout)
+	defer cancel()
+	dvmPubKey := u.TranscodeDVM
+	if dvmPubKey == "any" {
+		dvmPubKey = ""
+	}
+	transcoded, err := DelegateTranscode(ctx, videoURL, u.Signer, u.Relays, dvmPubKey, u.PayInvoice)
+	if err != nil {
+		return nil, fmt.Errorf("transcoding %s: %v", videoURL, err)
+	}
+	return transcoded, nil
+}
+
+// thumbnailURL uploads a local thumbnail, or returns the URL of a hosted one.
+func (u *Uploader) thumbnailURL(ctx context.Context, thumbnail Media) (string, error) {
+	if thumbnail.Path == "" {
+		return thumbnail.URL, nil
+	}
+	hashes, err := u.hashFile(ctx, thumbnail.Path)
+	if err != nil {
+		return "", fmt.Errorf("hashing thumbnail %s: %v", thumbnail.Path, err)
+	}
+	descriptor, err := u.upload(ctx, u.blossomServer(), thumbnail.Path, hashes.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("uploading thumbnail %s: %v", thumbnail.Path, err)
+	}
+	u.archive(hashes.SHA256, thumbnail.Path, descriptor.URL)
+	return descriptor.URL, nil
+}
+
+// BuildPictureEvent uploads or downloads every picture and returns the
+// unsigned NIP-68 event, with proof of work already mined.
+func (u *Uploader) BuildPictureEvent(ctx context.Context, opts PictureOptions) (*nostr.Event, error) {
+	if len(opts.Pictures) == 0 {
+		return nil, errors.New("at least one picture must be provided")
+	}
+	languageTags, err := opts.Languages.Tags()
+	if err != nil {
+		return nil, err
+	}
+	sourceTags, err := opts.Source.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+
+	publishedAt := opts.PublishedAt
+	builder := events.NewPictureEventBuilder().
+		PubKey(pubKey).
+		CreatedAt(opts.CreatedAt).
+		Title(opts.Title).
+		Description(opts.Description)
+	pictures := slices.Clone(opts.Pictures)
+	for i, media := range pictures {
+		if media.Path != "" && !opts.KeepMetadata {
+			stripped, err := StripMetadata(media.Path)
+			if err != nil {
+				return nil, err
+			}
+			if stripped != media.Path {
+				defer RemoveTemp(stripped)
+				media.Path = stripped
+			}
+		}
+		if media.Path != "" && opts.Resize.Enabled() {
+			resized, err := ResizeImage(media.Path, opts.Resize)
+			if err != nil {
+				return nil, err
+			}
+			if resized != media.Path {
+				defer RemoveTemp(resized)
+				media.Path = resized
+			}
+		}
+		pictures[i] = media
+	}
+
+	// one authorization covers the upload of every local picture
+	hashes := make([]*FileHashes, len(pictures))
+	infos := make([]*MediaInfo, len(pictures))
+	var uploads []string
+	for i, media := range pictures {
+		if media.Path == "" {
+			continue
+		}
+		if _, err := u.checkUploadSize(media.Path); err != nil {
+			return nil, err
+		}
+		if hashes[i], err = u.hashFile(ctx, media.Path); err != nil {
+			return nil, fmt.Errorf("hashing %s: %v", media.Path, err)
+		}
+		uploads = append(uploads, hashes[i].SHA256)
+	}
+	if len(uploads) > 1 {
+		if err := PrepareAuth(ctx, u.Signer, u.blossomServer(), "upload", "Upload files", uploads); err != nil {
+			return nil, fmt.Errorf("signing upload authorization: %v", err)
+		}
+	}
+
+	for i, media := range pictures {
+		picture, err := u.resolveHashed(ctx, media, hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		defer picture.cleanup()
+		if opts.PublishedAt == "" && picture.uploaded != 0 {
+			publishedAt = fmt.Sprintf("%d", picture.uploaded)
+		}
+
+		info, err := u.mediaInfo(ctx, picture, "image")
+		if err != nil {
+			return nil, fmt.Errorf("extracting image information: %v", err)
+		}
+		infos[i] = info
+		builder.Imeta(events.NewImetaBuilder(picture.url).
+			MIME(info.MIME).
+			Hash(info.Hash).
+			Dim(info.Width, info.Height).
+			Blurhash(info.Blurhash).
+			Thumbhash(info.Thumbhash).
+			Duration(info.Duration))
+	}
+	if publishedAt == "" {
+		publishedAt = fmt.Sprintf("%d", time.Now().Unix())
+	}
+	for _, tag := range append(languageTags, sourceTags...) {
+		builder.Tag(tag)
+	}
+
+	event, err := builder.PublishedAt(publishedAt).Build()
+	if err != nil {
+		return nil, fmt.Errorf("creating NIP-68 event: %v", err)
+	}
+	addContentWarning(event, infos...)
+
+	if err := mergeTemplate(event, opts.Template); err != nil {
+		return nil, err
+	}
+
+	return u.finish(ctx, event)
+}
+
+// BuildFileEvent uploads or downloads the file and returns the unsigned
+// NIP-94 event, with proof of work already mined.
+func (u *Uploader) BuildFileEvent(ctx context.Context, opts FileOptions) (*nostr.Event, error) {
+	languageTags, err := opts.Languages.Tags()
+	if err != nil {
+		return nil, err
+	}
+	sourceTags, err := opts.Source.Tags()
+	if err != nil {
+		return nil, err
+	}
+	file, err := u.resolve(ctx, opts.Media)
+	if err != nil {
+		return nil, err
+	}
+	defer file.cleanup()
+
+	info, err := u.mediaInfo(ctx, file, "file")
+	if err != nil {
+		return nil, fmt.Errorf("extracting file information: %v", err)
+	}
+	description, err := renderDescription(opts.Description, opts.DescriptionTemplate, mediaFields(ctx, opts.Media, file, info))
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+
+	builder := events.NewFileEventBuilder(events.NewImetaBuilder(file.url).
+		MIME(info.MIME).
+		Alt(opts.Alt).
+		Hash(info.Hash).
+		Size(info.Size).
+		Dim(info.Width, info.Height).
+		Blurhash(info.Blurhash).
+		Thumbhash(info.Thumbhash).
+		Duration(info.Duration).
+		Bitrate(info.Bitrate).
+		Codec(info.Codec)).
+		PubKey(pubKey).
+		CreatedAt(opts.CreatedAt).
+		Description(description).
+		Summary(opts.Summary)
+	for _, tag := range append(languageTags, sourceTags...) {
+		builder.Tag(tag)
+	}
+	event, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("creating NIP-94 event: %v", err)
+	}
+	addContentWarning(event, info)
+	u.labelLanguage(event, info.Language)
+
+	if err := mergeTemplate(event, opts.Template); err != nil {
+		return nil, err
+	}
+
+	return u.finish(ctx, event)
+}
+
+// BuildAudioEvent uploads or downloads the audio file, and its cover art,
+// and returns the unsigned NIP-94 event, with proof of work already mined.
+func (u *Uploader) BuildAudioEvent(ctx context.Context, opts AudioOptions) (*nostr.Event, error) {
+	languageTags, err := opts.Languages.Tags()
+	if err != nil {
+		return nil, err
+	}
+	sourceTags, err := opts.Source.Tags()
+	if err != nil {
+		return nil, err
+	}
+	audio, err := u.resolve(ctx, opts.Media)
+	if err != nil {
+		return nil, err
+	}
+	defer audio.cleanup()
+
+	info, err := u.mediaInfo(ctx, audio, "audio")
+	if err != nil {
+		return nil, fmt.Errorf("extracting audio information: %v", err)
+	}
+	description, err := renderDescription(opts.Description, opts.DescriptionTemplate, mediaFields(ctx, opts.Media, audio, info))
+	if err != nil {
+		return nil, err
+	}
+
+	imeta := events.NewImetaBuilder(audio.url).
+		MIME(info.MIME).
+		Alt(opts.Alt).
+		Hash(info.Hash).
+		Size(info.Size).
+		Duration(info.Duration).
+		Bitrate(info.Bitrate).
+		Codec(info.Codec)
+	cover := opts.Cover
+	if cover.Path == "" && cover.URL == "" && info.Cover {
+		if cover.Path, err = ExtractCoverArt(ctx, audio.path); err != nil {
+			log.Printf("%v, publishing without preview image", err)
+		} else {
+			defer RemoveTemp(cover.Path)
+		}
+	}
+	if cover.Path != "" || cover.URL != "" {
+		coverURL, err := u.thumbnailURL(ctx, cover)
+		if err != nil {
+			return nil, err
+		}
+		imeta.Image(coverURL)
+	}
+
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+
+	builder := events.NewFileEventBuilder(imeta).
+		PubKey(pubKey).
+		CreatedAt(opts.CreatedAt).
+		Description(description).
+		Summary(opts.Summary)
+	for _, tag := range append(languageTags, sourceTags...) {
+		builder.Tag(tag)
+	}
+	if opts.ShowNotes != "" {
+		builder.Tag(nostr.Tag{"a", opts.ShowNotes})
+	}
+	for _, tag := range opts.References {
+		builder.Tag(tag)
+	}
+	event, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("creating NIP-94 event: %v", err)
+	}
+	addContentWarning(event, info)
+	u.labelLanguage(event, info.Language)
+
+	if err := mergeTemplate(event, opts.Template); err != nil {
+		return nil, err
+	}
+
+	return u.finish(ctx, event)
+}
+
+// BuildDeletionEvent returns an unsigned NIP-09 deletion request for the
+// referenced events, given as "e" or "a" tags, with proof of work mined.
+func (u *Uploader) BuildDeletionEvent(ctx context.Context, references nostr.Tags, reason string) (*nostr.Event, error) {
+	if len(references) == 0 {
+		return nil, errors.New("at least one event must be referenced")
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	event := &nostr.Event{
+		Kind:      nostr.KindDeletion,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Tags:      references,
+		Content:   reason,
+	}
+	return event, u.Pow(ctx, event)
+}
+
+// BuildCommentEvent returns an unsigned NIP-22 comment on a video or other
+// event, with proof of work mined. The comment is top level: the root and
+// the parent are both the commented event. relay, when set, is published as
+// the hint of where the commented event can be found.
+func (u *Uploader) BuildCommentEvent(ctx context.Context, root *nostr.Event, content, relay string) (*nostr.Event, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("the comment is empty")
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	kind := strconv.Itoa(root.Kind)
+	event := &nostr.Event{
+		Kind:      nostr.KindComment,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+	}
+	if nostr.IsAddressableKind(root.Kind) {
+		address := fmt.Sprintf("%d:%s:%s", root.Kind, root.PubKey, root.Tags.GetD())
+		event.Tags = append(event.Tags, nostr.Tag{"A", address, relay}, nostr.Tag{"a", address, relay})
+	}
+	event.Tags = append(event.Tags,
+		nostr.Tag{"E", root.ID, relay, root.PubKey},
+		nostr.Tag{"K", kind},
+		nostr.Tag{"P", root.PubKey, relay},
+		nostr.Tag{"e", root.ID, relay, root.PubKey},
+		nostr.Tag{"k", kind},
+		nostr.Tag{"p", root.PubKey, relay},
+	)
+	ExtractHashtags(event)
+	return event, u.Pow(ctx, event)
+}
+
+// BuildRepostEvent returns an unsigned NIP-18 repost of a video or other
+// event, with proof of work mined: a kind 6 repost for notes and a kind 16
+// generic repost for the other kinds. The content is the reposted event,
+// unless it is protected (NIP-70) and must not be spread by others. relay,
+// when set, is the hint of where the reposted event can be found.
+func (u *Uploader) BuildRepostEvent(ctx context.Context, original *nostr.Event, relay string) (*nostr.Event, error) {
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	event := &nostr.Event{
+		Kind:      nostr.KindGenericRepost,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"e", original.ID, relay}, {"p", original.PubKey, relay}},
+	}
+	if original.Kind == nostr.KindTextNote {
+		event.Kind = nostr.KindRepost
+	} else {
+		event.Tags = append(event.Tags, nostr.Tag{"k", strconv.Itoa(original.Kind)})
+	}
+	if nostr.IsAddressableKind(original.Kind) {
+		address := fmt.Sprintf("%d:%s:%s", original.Kind, original.PubKey, original.Tags.GetD())
+		event.Tags = append(event.Tags, nostr.Tag{"a", address, relay})
+	}
+	if original.Tags.GetFirst([]string{"-"}) == nil {
+		event.Content = original.String()
+	}
+	return event, u.Pow(ctx, event)
+}
+
+// BuildQuoteEvent returns an unsigned kind 1 note quoting a video or other
+// event, with proof of work mined. The nostr: reference of the quoted event
+// is appended to content and the q tag of NIP-18 points at it. relay, when
+// set, is the hint of where the quoted event can be found.
+func (u *Uploader) BuildQuoteEvent(ctx context.Context, original *nostr.Event, content, relay string) (*nostr.Event, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("the quote is empty")
+	}
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	var hints []string
+	if relay != "" {
+		hints = []string{relay}
+	}
+	nevent, naddr, err := EncodeEvent(original, hints)
+	if err != nil {
+		return nil, fmt.Errorf("encoding quoted event: %v", err)
+	}
+	// addressable events are quoted by address, which names their author
+	reference, quote := nevent, nostr.Tag{"q", original.ID, relay, original.PubKey}
+	if naddr != "" {
+		reference = naddr
+		quote = nostr.Tag{"q", fmt.Sprintf("%d:%s:%s", original.Kind, original.PubKey, original.Tags.GetD()), relay}
+	}
+	event := &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		PubKey:    pubKey,
+		CreatedAt: nostr.Now(),
+		Content:   strings.TrimSpace(content) + "\n\nnostr:" + reference,
+		Tags: nostr.Tags{
+			quote,
+			{"k", strconv.Itoa(original.Kind)},
+			{"p", original.PubKey, relay},
+		},
+	}
+	ExtractHashtags(event)
+	return event, u.Pow(ctx, event)
+}
+
+// CheckRelays logs the warnings of CheckRelayInfo when enabled.
+func (u *Uploader) CheckRelays(ctx context.Context, event *nostr.Event) {
+	if !u.CheckRelayInfo {
+		return
+	}
+	for _, warning := range CheckRelayInfo(ctx, event, u.Relays) {
+		log.Printf("Warning: %s", warning)
+	}
+}
+
+// EffectiveDifficulty is the proof of work mined for events: Difficulty, or
+// more when one of the relays requires it.
+func (u *Uploader) EffectiveDifficulty() int {
+	return max(u.Difficulty, RequiredDifficulty(u.Relays))
+}
+
+// Pow checks the relays and mines the proof of work for EffectiveDifficulty,
+// locally or through PowDVM, giving up after PowTimeout.
+func (u *Uploader) Pow(ctx context.Context, event *nostr.Event) error {
+	u.CheckRelays(ctx, event)
+	if u.PowTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.PowTimeout)
+		defer cancel()
+	}
+	difficulty := u.EffectiveDifficulty()
+	ctx, end := u.start(ctx, "pow", "difficulty", strconv.Itoa(difficulty))
+	start := time.Now()
+	var err error
+	switch u.PowDVM {
+	case "":
+		err = MinePow(ctx, event, difficulty, u.PowProgress)
+	case "any":
+		err = DelegatePow(ctx, event, difficulty, u.Signer, u.Relays, "", u.PayInvoice)
+	default:
+		err = DelegatePow(ctx, event, difficulty, u.Signer, u.Relays, u.PowDVM, u.PayInvoice)
+	}
+	end(err)
+	if u.Observer != nil && difficulty > 0 {
+		u.Observer.Mined(difficulty, time.Since(start), err)
+	}
+	if err != nil {
+		return fmt.Errorf("calculating proof of work: %v", err)
+	}
+	return nil
+}
+
+// finish selects the imeta fields, adds the hashtag tags, merges the
+// existing event with UpdateExisting, labels the language, adds the emoji,
+// extra and client tags, has the event confirmed and mines the proof of work.
+func (u *Uploader) finish(ctx context.Context, event *nostr.Event) (*nostr.Event, error) {
+	if err := u.selectImetaFields(event); err != nil {
+		return nil, err
+	}
+	// if description contains any hashtags, add them as "t" tags
+	ExtractHashtags(event)
+	for _, hashtag := range u.Hashtags {
+		hashtag = strings.TrimPrefix(hashtag, "#")
+		if !event.Tags.ContainsAny("t", []string{hashtag}) {
+			event.Tags = append(event.Tags, nostr.Tag{"t", hashtag})
+		}
+	}
+	// the hashtags of the new description are kept with the old one, and
+	// the fallbacks added go through the imeta fields again
+	if u.UpdateExisting {
+		if err := u.updateExisting(ctx, event); err != nil {
+			return nil, err
+		}
+		if err := u.selectImetaFields(event); err != nil {
+			return nil, err
+		}
+	}
+	// the language of the audio, labelled by the builders, wins over the
+	// one of the text
+	u.labelLanguage(event, DetectLanguage(firstTagValue(event.Tags, "title")+"\n"+event.Content))
+	u.addEmojiTags(event)
+	for _, tag := range u.ExtraTags {
+		event.Tags = append(event.Tags, slices.Clone(tag))
+	}
+	if u.Client != "" && event.Tags.GetFirst([]string{"client"}) == nil {
+		client := u.Client
+		if u.ClientVersion != "" {
+			client += " " + u.ClientVersion
+		}
+		event.Tags = append(event.Tags, nostr.Tag{"client", client})
+	}
+	if u.Confirm != nil {
+		if err := u.Confirm(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, u.Pow(ctx, event)
+}
+
+// Sign signs the event with the uploader's signer.
+func (u *Uploader) Sign(ctx context.Context, event *nostr.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, SignTimeout)
+	defer cancel()
+	if err := u.Signer.SignEvent(ctx, event); err != nil {
+		return fmt.Errorf("signing event: %v", err)
+	}
+	return nil
+}
+
+// ForSigner returns a copy of the uploader signing and authenticating with
+// signer, without the relay connections of Pool, which are authenticated as
+// the uploader's signer.
+func (u *Uploader) ForSigner(signer nostr.Keyer) *Uploader {
+	other := *u
+	other.Signer = signer
+	other.Pool = nil
+	return &other
+}
+
+// CrossPost returns a copy of the event authored and signed by the
+// uploader's signer, publishing the same media under another identity
+// without uploading them again. The proof of work is mined again.
+func (u *Uploader) CrossPost(ctx context.Context, event *nostr.Event) (*nostr.Event, error) {
+	pubKey, err := u.Signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %v", err)
+	}
+	copied := &nostr.Event{
+		PubKey:    pubKey,
+		CreatedAt: event.CreatedAt,
+		Kind:      event.Kind,
+		Content:   event.Content,
+	}
+	for _, tag := range event.Tags {
+		if len(tag) > 0 && tag[0] != "nonce" {
+			copied.Tags = append(copied.Tags, slices.Clone(tag))
+		}
+	}
+	if err := u.Pow(ctx, copied); err != nil {
+		return nil, err
+	}
+	if err := u.Sign(ctx, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// Publish sends the signed event to the uploader's relays, through Pool when
+// set, and records its media in MediaIndex once a relay accepted it. When
+// every relay rejected the event for lack of proof of work, the event is
+// mined again for the difficulty they require, signed and published again.
+func (u *Uploader) Publish(ctx context.Context, event *nostr.Event) []PublishResult {
+	results := u.publishOnce(ctx, event)
+	if required := u.remineDifficulty(ctx, event, results); required > 0 {
+		log.Printf("Relays require proof of work %d, mining the event again", required)
+		if err := u.remine(ctx, event); err != nil {
+			log.Printf("Error mining the event again: %v", err)
+		} else {
+			results = u.publishOnce(ctx, event)
+		}
+	}
+	u.indexPublished(event, AcceptedRelays(results))
+	return results
+}
+
+func (u *Uploader) publishOnce(ctx context.Context, event *nostr.Event) []PublishResult {
+	ctx, end := u.start(ctx, "publish", "event", event.ID, "kind", strconv.Itoa(event.Kind))
+	var results []PublishResult
+	if u.Pool != nil {
+		results = u.Pool.Publish(ctx, event, u.Relays)
+	} else {
+		results = PublishEvent(ctx, event, u.Signer, u.Relays)
+	}
+	if u.Observer != nil {
+		u.Observer.Published(results)
+	}
+	if len(AcceptedRelays(results)) == 0 && len(results) > 0 {
+		end(errors.New("no relay accepted the event"))
+	} else {
+		end(nil)
+	}
+	return results
+}
+
+// remineDifficulty returns the difficulty to mine the event again for, or 0
+// when a relay accepted it, no relay asked for more proof of work, or the
+// relays ask for more than MaxRemineDifficulty. Mining an event changes its
+// id, so it is never done once a relay has the event, nor for the events of
+// other authors, which the signer cannot sign again.
+func (u *Uploader) remineDifficulty(ctx context.Context, event *nostr.Event, results []PublishResult) int {
+	if len(AcceptedRelays(results)) > 0 {
+		return 0
+	}
+	powRejected := false
+	for _, result := range results {
+		powRejected = powRejected || result.Reason == ReasonPow
+	}
+	required := u.EffectiveDifficulty()
+	if !powRejected || required <= nip13.Difficulty(event.ID) {
+		return 0
+	}
+	if pubKey, err := u.Signer.GetPublicKey(ctx); err != nil || pubKey != event.PubKey {
+		return 0
+	}
+	if required > MaxRemineDifficulty {
+		log.Printf("Relays require proof of work %d, above %d; not mining the event again", required, MaxRemineDifficulty)
+		return 0
+	}
+	return required
+}
+
+// remine replaces the nonce tag of the event with one for
+// EffectiveDifficulty and signs it again.
+func (u *Uploader) remine(ctx context.Context, event *nostr.Event) error {
+	event.Tags = slices.DeleteFunc(event.Tags, func(tag nostr.Tag) bool {
+		return len(tag) >= 1 && tag[0] == "nonce"
+	})
+	if err := u.Pow(ctx, event); err != nil {
+		return err
+	}
+	return u.Sign(ctx, event)
+}
@@ -0,0 +1,555 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/girino/nip71-video-uploader/internal/testserver"
+	"github.com/girino/nip71-video-uploader/pkg/events"
+	"github.com/girino/nip71-video-uploader/pkg/imeta"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// newTestUploader returns an uploader with a new key, uploading to a fake
+// Blossom server and publishing to a mock relay.
+func newTestUploader(t *testing.T) (*Uploader, *testserver.Blossom, *testserver.Relay) {
+	t.Helper()
+	signer, err := NewSigner(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blossom := testserver.NewBlossom(t)
+	relay := testserver.NewRelay(t)
+	return &Uploader{
+		Signer:     signer,
+		Blossom:    blossom.URL,
+		Relays:     []string{relay.WSURL},
+		Difficulty: 8,
+	}, blossom, relay
+}
+
+// writePNG writes a gradient image of the given size.
+func writePNG(t testing.TB, width, height int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{uint8(255 * x / width), uint8(255 * y / height), 128, 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("picture-%dx%d.png", width, height))
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// imetaTags parses the imeta tags of the event.
+func imetaTags(t *testing.T, event *nostr.Event) []imeta.Imeta {
+	t.Helper()
+	var files []imeta.Imeta
+	for _, tag := range event.Tags {
+		if tag[0] == "imeta" {
+			file, err := imeta.Parse(tag)
+			if err != nil {
+				t.Fatalf("parsing %v: %v", tag, err)
+			}
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func TestBuildPictureEvent(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, relay := newTestUploader(t)
+	uploader.Hashtags = []string{"#cats", "pets"}
+	uploader.Client = "nostrmedia"
+	uploader.ClientVersion = "v1.2.3"
+
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{
+		Pictures:    []Media{{Path: writePNG(t, 64, 32)}, {Path: writePNG(t, 16, 16)}},
+		Title:       "Gradients",
+		Description: "Two gradients #art",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Kind != events.KindPicture {
+		t.Errorf("kind %d, want %d", event.Kind, events.KindPicture)
+	}
+	files := imetaTags(t, event)
+	if len(files) != 2 {
+		t.Fatalf("%d imeta tags, want 2", len(files))
+	}
+	for i, want := range []imeta.Dim{{Width: 64, Height: 32}, {Width: 16, Height: 16}} {
+		file := files[i]
+		if !strings.HasPrefix(file.URL, blossom.URL+"/"+file.Hash) {
+			t.Errorf("picture %d: url %s is not the uploaded blob %s", i, file.URL, file.Hash)
+		}
+		blob, ok := blossom.Blob(file.Hash)
+		if !ok {
+			t.Fatalf("picture %d: blob %s was not uploaded", i, file.Hash)
+		}
+		if hash := sha256.Sum256(blob.Data); hex.EncodeToString(hash[:]) != file.Hash {
+			t.Errorf("picture %d: x field does not match the uploaded data", i)
+		}
+		if file.MIME != "image/png" || file.Dim != want || file.Blurhash == "" {
+			t.Errorf("picture %d: got %+v, want image/png, %v and a blurhash", i, file, want)
+		}
+	}
+	for _, tag := range []nostr.Tag{{"title", "Gradients"}, {"t", "art"}, {"t", "cats"}, {"t", "pets"}, {"client", "nostrmedia v1.2.3"}} {
+		if !slices.ContainsFunc(event.Tags, func(got nostr.Tag) bool { return slices.Equal(got, tag) }) {
+			t.Errorf("missing tag %v in %v", tag, event.Tags)
+		}
+	}
+	if difficulty := nip13.Difficulty(event.GetID()); difficulty < uploader.Difficulty {
+		t.Errorf("difficulty %d, want at least %d", difficulty, uploader.Difficulty)
+	}
+
+	if err := uploader.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	results := uploader.Publish(ctx, event)
+	if accepted := AcceptedRelays(results); len(accepted) != 1 {
+		t.Fatalf("accepted by %v, results %+v", accepted, results)
+	}
+	stored := relay.Events()
+	if len(stored) != 1 || stored[0].ID != event.ID {
+		t.Errorf("relay stored %v, want %s", stored, event.ID)
+	}
+}
+
+func TestBuildFileEventFromURL(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	data := []byte("%PDF-1.4\n%âãÏÓ\n1 0 obj\n<< >>\nendobj\ntrailer\n<< >>\n%%EOF\n")
+	url := blossom.Put(data, "application/pdf")
+
+	event, err := uploader.BuildFileEvent(ctx, FileOptions{
+		Media:       Media{URL: url},
+		Description: "A paper",
+		Summary:     "Summary",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(data)
+	want := map[string]string{
+		"url":     url,
+		"m":       "application/pdf",
+		"x":       hex.EncodeToString(hash[:]),
+		"size":    fmt.Sprint(len(data)),
+		"summary": "Summary",
+	}
+	if event.Kind != events.KindFileMetadata {
+		t.Errorf("kind %d, want %d", event.Kind, events.KindFileMetadata)
+	}
+	for name, value := range want {
+		if tag := event.Tags.GetFirst([]string{name, ""}); tag == nil || (*tag)[1] != value {
+			t.Errorf("tag %s = %v, want %q", name, tag, value)
+		}
+	}
+	if event.Content != "A paper" {
+		t.Errorf("content %q", event.Content)
+	}
+	if blossom.Uploads() != 0 {
+		t.Errorf("remote file uploaded %d times", blossom.Uploads())
+	}
+}
+
+func TestExpectedHash(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	data := []byte("%PDF-1.4\n%%EOF\n")
+	hash := sha256.Sum256(data)
+	url := blossom.Put(data, "application/pdf")
+
+	if _, err := uploader.BuildFileEvent(ctx, FileOptions{Media: Media{URL: url, SHA256: hex.EncodeToString(hash[:])}}); err != nil {
+		t.Errorf("matching hash: %v", err)
+	}
+	wrong := strings.Repeat("0", 64)
+	if _, err := uploader.BuildFileEvent(ctx, FileOptions{Media: Media{URL: url, SHA256: wrong}}); err == nil || !strings.Contains(err.Error(), wrong) {
+		t.Errorf("download with another hash: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "paper.pdf")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploader.BuildFileEvent(ctx, FileOptions{Media: Media{Path: path, SHA256: wrong}}); err == nil {
+		t.Error("file with another hash was accepted")
+	}
+	if blossom.Uploads() != 0 {
+		t.Errorf("file with another hash uploaded %d times", blossom.Uploads())
+	}
+}
+
+func TestVideoOrientation(t *testing.T) {
+	ffprobe := FFprobe
+	FFprobe = "nostrmedia-test-no-ffprobe"
+	t.Cleanup(func() { FFprobe = ffprobe })
+	ctx := context.Background()
+	uploader, _, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	uploader.Previews = Previews{NoBlurhash: true}
+
+	ftyp := isoBox("ftyp", []byte("isom"), u32s(0x200))
+	mvhd := isoBox("mvhd", u32s(0, 0, 0, 1000, 5000), make([]byte, 80))
+	// a phone held upright stores landscape frames rotated a quarter turn
+	rotated := filepath.Join(t.TempDir(), "upright.mp4")
+	data := append(ftyp, isoBox("moov", mvhd, trakBox(tkhdBox(0, 0, 0x10000, -0x10000, 0, 1920, 1080), "vide"))...)
+	if err := os.WriteFile(rotated, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{
+		rotated:                    events.KindShortVideo,
+		writeMP4(t, 1920, 1080, 5): events.KindVideo,
+	} {
+		var width, height int
+		event, err := uploader.BuildVideoEvent(ctx, VideoOptions{
+			Media:      Media{Path: path},
+			Horizontal: want == events.KindShortVideo,
+			Orientation: func(w, h int) bool {
+				width, height = w, h
+				return w > h
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Kind != want {
+			t.Errorf("%dx%d video got kind %d, want %d", width, height, event.Kind, want)
+		}
+	}
+}
+
+func TestBuildRepostAndQuote(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	video := &nostr.Event{Kind: events.KindVideo, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"title", "Trailer"}}, Content: "Watch it"}
+	if err := video.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	relay := "wss://relay.example.com"
+
+	repost, err := uploader.BuildRepostEvent(ctx, video, relay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repost.Kind != nostr.KindGenericRepost || repost.Content != video.String() {
+		t.Errorf("repost kind %d, content %q", repost.Kind, repost.Content)
+	}
+	for _, want := range []nostr.Tag{{"e", video.ID, relay}, {"p", video.PubKey, relay}, {"k", fmt.Sprint(events.KindVideo)}} {
+		if tag := repost.Tags.GetFirst(want[:2]); tag == nil || !slices.Equal(*tag, want) {
+			t.Errorf("repost tag %v, want %v", tag, want)
+		}
+	}
+
+	quote, err := uploader.BuildQuoteEvent(ctx, video, "Great #video", relay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Kind != nostr.KindTextNote || !strings.HasPrefix(quote.Content, "Great #video\n\nnostr:nevent1") {
+		t.Errorf("quote kind %d, content %q", quote.Kind, quote.Content)
+	}
+	if tag := quote.Tags.GetFirst([]string{"q", video.ID}); tag == nil || !slices.Equal(*tag, nostr.Tag{"q", video.ID, relay, video.PubKey}) {
+		t.Errorf("quote tag %v", tag)
+	}
+	if quote.Tags.GetFirst([]string{"t", "video"}) == nil {
+		t.Errorf("quote hashtags %v", quote.Tags)
+	}
+}
+
+func TestCheckFallbacks(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	data := []byte("the same video on two CDNs")
+	hash := sha256.Sum256(data)
+	mirror := blossom.Put(data, "video/mp4")
+	other := blossom.Put([]byte("another video"), "video/mp4")
+
+	if err := uploader.checkFallbacks(ctx, []string{mirror}, hex.EncodeToString(hash[:])); err != nil {
+		t.Errorf("matching fallback: %v", err)
+	}
+	if err := uploader.checkFallbacks(ctx, []string{mirror, other}, hex.EncodeToString(hash[:])); err == nil || !strings.Contains(err.Error(), other) {
+		t.Errorf("mismatching fallback: %v", err)
+	}
+}
+
+func TestPublishRemines(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, relay := newTestUploader(t)
+	uploader.Difficulty = 0
+	relay.Reject = func(event *nostr.Event) string {
+		if nip13.Difficulty(event.ID) < 10 {
+			return "pow: difficulty 10 required"
+		}
+		return ""
+	}
+
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{Pictures: []Media{{Path: writePNG(t, 8, 8)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	results := uploader.Publish(ctx, event)
+	if len(AcceptedRelays(results)) != 1 {
+		t.Fatalf("results %+v", results)
+	}
+	if difficulty := nip13.Difficulty(event.ID); difficulty < 10 {
+		t.Errorf("difficulty %d after mining again, want at least 10", difficulty)
+	}
+	if stored := relay.Events(); len(stored) != 1 || stored[0].ID != event.ID {
+		t.Errorf("relay stored %v, want %s", stored, event.ID)
+	}
+}
+
+func TestUploadAuthorization(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	path := writePNG(t, 4, 4)
+
+	descriptor, err := UploadFile(ctx, blossom.URL, path, uploader.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, ok := blossom.Blob(descriptor.SHA256)
+	pubKey, _ := uploader.Signer.GetPublicKey(ctx)
+	if !ok || blob.Owner != pubKey {
+		t.Errorf("blob %s owned by %q, want %s", descriptor.SHA256, blob.Owner, pubKey)
+	}
+
+	listed, err := ListBlobs(ctx, blossom.URL, pubKey, uploader.Signer)
+	if err != nil || len(listed) != 1 || listed[0].SHA256 != descriptor.SHA256 {
+		t.Errorf("listed %v, %v", listed, err)
+	}
+	if err := DeleteBlob(ctx, blossom.URL, descriptor.SHA256, uploader.Signer); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := blossom.Blob(descriptor.SHA256); ok {
+		t.Error("blob still stored after deleting it")
+	}
+
+	blossom.MaxSize = 10
+	if err := CheckUpload(ctx, blossom.URL, descriptor.SHA256, 100, "image/png", uploader.Signer); err == nil {
+		t.Error("upload check accepted a blob above the size limit")
+	}
+}
+
+// recordingObserver records the stages an Uploader reports.
+type recordingObserver struct {
+	mu     sync.Mutex
+	stages []string
+	events []string
+}
+
+func (o *recordingObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) Start(ctx context.Context, name string, attrs ...string) (context.Context, func(error)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stages = append(o.stages, name)
+	return ctx, func(error) {}
+}
+
+func (o *recordingObserver) Uploaded(server string, size int64, err error) {
+	o.record(fmt.Sprintf("uploaded %d %v", size, err))
+}
+
+func (o *recordingObserver) Downloaded(size int64, err error) {
+	o.record(fmt.Sprintf("downloaded %d %v", size, err))
+}
+
+func (o *recordingObserver) Mined(difficulty int, elapsed time.Duration, err error) {
+	o.record(fmt.Sprintf("mined %d %v", difficulty, err))
+}
+
+func (o *recordingObserver) Published(results []PublishResult) {
+	o.record(fmt.Sprintf("published %d", len(AcceptedRelays(results))))
+}
+
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, _ := newTestUploader(t)
+	observer := &recordingObserver{}
+	uploader.Observer = observer
+
+	path := writePNG(t, 8, 8)
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{Pictures: []Media{{Path: path}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	uploader.Publish(ctx, event)
+
+	info, _ := os.Stat(path)
+	want := []string{fmt.Sprintf("uploaded %d <nil>", info.Size()), "mined 8 <nil>", "published 1"}
+	if !slices.Equal(observer.events, want) {
+		t.Errorf("observed %q, want %q", observer.events, want)
+	}
+	if stages := []string{"upload", "pow", "publish"}; !slices.Equal(observer.stages, stages) {
+		t.Errorf("stages %q, want %q", observer.stages, stages)
+	}
+}
+
+func TestUpdateExisting(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	picture := writePNG(t, 32, 32)
+
+	existing, err := uploader.BuildPictureEvent(ctx, PictureOptions{
+		Pictures:    []Media{{Path: picture}},
+		Title:       "Curated title",
+		Description: "Curated description #art",
+		PublishedAt: "1700000000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.Sign(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+	if accepted := AcceptedRelays(uploader.Publish(ctx, existing)); len(accepted) != 1 {
+		t.Fatalf("accepted by %v", accepted)
+	}
+
+	// the same picture uploaded to another server
+	mirror := testserver.NewBlossom(t)
+	uploader.Blossom = mirror.URL
+	uploader.UpdateExisting = true
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{
+		Pictures:    []Media{{Path: picture}},
+		Description: "#new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []nostr.Tag{{"title", "Curated title"}, {"published_at", "1700000000"}, {"t", "art"}, {"t", "new"}} {
+		if !slices.ContainsFunc(event.Tags, func(got nostr.Tag) bool { return slices.Equal(got, tag) }) {
+			t.Errorf("missing tag %v in %v", tag, event.Tags)
+		}
+	}
+	if event.Content != "Curated description #art" {
+		t.Errorf("content %q", event.Content)
+	}
+	files := imetaTags(t, event)
+	if len(files) != 1 || !strings.HasPrefix(files[0].URL, mirror.URL) ||
+		len(files[0].Fallbacks) != 1 || !strings.HasPrefix(files[0].Fallbacks[0], blossom.URL) {
+		t.Errorf("media %+v, want the mirror with the first upload as fallback", files)
+	}
+}
+
+func TestCrossPost(t *testing.T) {
+	ctx := context.Background()
+	uploader, blossom, relay := newTestUploader(t)
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{
+		Pictures: []Media{{Path: writePNG(t, 16, 16)}},
+		Title:    "Shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewSigner(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := uploader.ForSigner(signer)
+	copied, err := other.CrossPost(ctx, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, _ := signer.GetPublicKey(ctx)
+	if copied.PubKey != pubKey || copied.ID == event.ID {
+		t.Errorf("copy by %s with id %s", copied.PubKey, copied.ID)
+	}
+	if ok, err := copied.CheckSignature(); !ok || err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+	if difficulty := nip13.Difficulty(copied.ID); difficulty < uploader.Difficulty {
+		t.Errorf("difficulty %d", difficulty)
+	}
+	if files := imetaTags(t, copied); len(files) != 1 || files[0].URL != imetaTags(t, event)[0].URL {
+		t.Errorf("media %+v", files)
+	}
+	if blossom.Uploads() != 1 {
+		t.Errorf("%d uploads, want 1", blossom.Uploads())
+	}
+	if accepted := AcceptedRelays(other.Publish(ctx, copied)); len(accepted) != 1 {
+		t.Errorf("accepted by %v", accepted)
+	}
+	if stored := relay.Events(); len(stored) != 1 || stored[0].PubKey != pubKey {
+		t.Errorf("relay stored %v", stored)
+	}
+}
+
+func TestEmojis(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	for _, value := range []string{":brand:=https://example.com/brand.png", "wave=https://example.com/wave.gif", "unused=https://example.com/unused.png"} {
+		emoji, err := ParseEmoji(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploader.Emojis = append(uploader.Emojis, emoji)
+	}
+	for _, value := range []string{"brand", "bad-code=https://example.com/x.png", "brand=ftp://example.com/x.png"} {
+		if _, err := ParseEmoji(value); err == nil {
+			t.Errorf("ParseEmoji(%q) succeeded", value)
+		}
+	}
+
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{
+		Pictures:    []Media{{Path: writePNG(t, 16, 16)}},
+		Title:       "Hello :wave:",
+		Description: "Brought to you by :brand: and :brand:",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nostr.Tags{{"emoji", "brand", "https://example.com/brand.png"}, {"emoji", "wave", "https://example.com/wave.gif"}}
+	if got := event.Tags.GetAll([]string{"emoji"}); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("emoji tags %v, want %v", got, want)
+	}
+}
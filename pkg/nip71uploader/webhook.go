@@ -0,0 +1,106 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Webhook statuses.
+const (
+	WebhookPublished = "published"
+	WebhookFailed    = "failed"
+)
+
+// WebhookPayload is posted as JSON to a webhook once a job is done.
+type WebhookPayload struct {
+	// Status is WebhookPublished or WebhookFailed.
+	Status string `json:"status"`
+	// Job identifies the job, such as the id of a serve job or the key of a
+	// batch entry.
+	Job     string `json:"job,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+	Kind    int    `json:"kind,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Nevent  string `json:"nevent,omitempty"`
+	Naddr   string `json:"naddr,omitempty"`
+	// Relays are the relays that accepted the event.
+	Relays  []string        `json:"relays,omitempty"`
+	Results []PublishResult `json:"results,omitempty"`
+	Media   []string        `json:"media,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	// Content is a one line summary, which Discord and Slack compatible
+	// webhooks post as the message.
+	Content string `json:"content"`
+}
+
+// NewWebhookPayload describes the outcome of publishing the event, which
+// is nil when the job failed before building it. The job failed when err
+// is not nil.
+func NewWebhookPayload(job string, event *nostr.Event, results []PublishResult, err error) WebhookPayload {
+	payload := WebhookPayload{Status: WebhookPublished, Job: job, Results: results, Relays: AcceptedRelays(results)}
+	if event != nil {
+		payload.EventID = event.ID
+		payload.Kind = event.Kind
+		if title := event.Tags.GetFirst([]string{"title", ""}); title != nil {
+			payload.Title = title.Value()
+		}
+		for _, media := range eventMediaURLs(event) {
+			payload.Media = append(payload.Media, media[0])
+		}
+		if event.Sig != "" && err == nil {
+			payload.Nevent, payload.Naddr, _ = EncodeEvent(event, payload.Relays)
+		}
+	}
+	name := payload.Title
+	if name == "" {
+		name = job
+	}
+	if err != nil {
+		payload.Status = WebhookFailed
+		payload.Error = err.Error()
+		payload.Content = fmt.Sprintf("Failed to publish %s: %v", name, err)
+		return payload
+	}
+	reference := payload.Naddr
+	if reference == "" {
+		reference = payload.Nevent
+	}
+	payload.Content = fmt.Sprintf("Published %s to %d relays: nostr:%s", name, len(payload.Relays), reference)
+	return payload
+}
+
+// PostWebhook posts the payload to the webhook URL, within RequestTimeout.
+func PostWebhook(ctx context.Context, url string, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPostWebhook(t *testing.T) {
+	ctx := context.Background()
+	uploader, _, _ := newTestUploader(t)
+	uploader.Difficulty = 0
+	event, err := uploader.BuildPictureEvent(ctx, PictureOptions{Pictures: []Media{{Path: writePNG(t, 8, 8)}}, Title: "Gradient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	results := uploader.Publish(ctx, event)
+
+	var received []WebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	if err := PostWebhook(ctx, webhook.URL, NewWebhookPayload("job", event, results, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := PostWebhook(ctx, webhook.URL, NewWebhookPayload("job", nil, nil, errors.New("upload refused"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("received %d payloads", len(received))
+	}
+	published, failed := received[0], received[1]
+	if published.Status != WebhookPublished || published.EventID != event.ID || published.Title != "Gradient" ||
+		!strings.HasPrefix(published.Nevent, "nevent1") || !slices.Equal(published.Relays, uploader.Relays) || len(published.Media) != 1 {
+		t.Errorf("published payload %+v", published)
+	}
+	if failed.Status != WebhookFailed || failed.Error != "upload refused" || !strings.Contains(failed.Content, "upload refused") {
+		t.Errorf("failed payload %+v", failed)
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer rejecting.Close()
+	if err := PostWebhook(ctx, rejecting.URL, published); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("rejected webhook returned %v", err)
+	}
+}
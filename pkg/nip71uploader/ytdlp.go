@@ -0,0 +1,154 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nip71uploader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportedVideo is a video downloaded from another platform with yt-dlp,
+// along with its metadata. Cleanup removes the downloaded files.
+type ImportedVideo struct {
+	// Path is the downloaded video file.
+	Path string
+	// Thumbnail is the downloaded thumbnail, empty when there is none.
+	Thumbnail   string
+	Title       string
+	Description string
+	// URL is the page of the video on the platform, and Author the name of
+	// its channel.
+	URL    string
+	Author string
+	// Tags are the platform tags, lowercased and without spaces.
+	Tags []string
+	// PublishedAt is the original upload time in unix seconds, 0 if unknown.
+	PublishedAt int64
+	Width       int
+	Height      int
+
+	dir string
+}
+
+// Cleanup removes the downloaded files.
+func (v *ImportedVideo) Cleanup() {
+	RemoveTemp(v.dir)
+}
+
+// ytdlpInfo holds the fields used from the .info.json written by yt-dlp.
+type ytdlpInfo struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Timestamp   int64    `json:"timestamp"`
+	UploadDate  string   `json:"upload_date"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	WebpageURL  string   `json:"webpage_url"`
+	Uploader    string   `json:"uploader"`
+}
+
+// ImportVideo downloads the best quality of a YouTube, Vimeo, PeerTube or
+// other yt-dlp supported video, with its metadata and thumbnail. yt-dlp must
+// be in the PATH, and ffmpeg, to merge the video and audio streams, found as
+// FFmpeg.
+func ImportVideo(ctx context.Context, videoURL string) (*ImportedVideo, error) {
+	dir, err := mkdirTemp("import-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %v", err)
+	}
+	video := &ImportedVideo{dir: dir}
+
+	args := []string{
+		"--no-playlist",
+		"-f", "bv*[ext=mp4]+ba[ext=m4a]/b[ext=mp4]/bv*+ba/b",
+		"--merge-output-format", "mp4",
+		"--write-info-json",
+		"--write-thumbnail", "--convert-thumbnails", "jpg",
+		"-o", filepath.Join(dir, "video.%(ext)s"),
+	}
+	// yt-dlp finds ffmpeg in the PATH, but not where it was configured or
+	// downloaded to
+	if ffmpeg, err := ffmpegBinary(ctx); err == nil {
+		args = append(args, "--ffmpeg-location", ffmpeg)
+	}
+	// sites serve yt-dlp by its own browser-like User-Agent, so only the
+	// proxy is passed on
+	if proxy != nil {
+		args = append(args, "--proxy", ytdlpProxy(proxy))
+	}
+	cmd := exec.CommandContext(ctx, "yt-dlp", append(args, videoURL)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		video.Cleanup()
+		return nil, fmt.Errorf("running yt-dlp: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "video.info.json"))
+	if err != nil {
+		video.Cleanup()
+		return nil, fmt.Errorf("reading yt-dlp metadata: %v", err)
+	}
+	var info ytdlpInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		video.Cleanup()
+		return nil, fmt.Errorf("decoding yt-dlp metadata: %v", err)
+	}
+	video.Title = info.Title
+	video.Description = info.Description
+	video.URL = info.WebpageURL
+	if video.URL == "" {
+		video.URL = videoURL
+	}
+	video.Author = info.Uploader
+	for _, tag := range info.Tags {
+		// platform tags may contain spaces, which hashtags cannot
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), ""))
+		if tag != "" {
+			video.Tags = append(video.Tags, tag)
+		}
+	}
+	video.Width, video.Height = info.Width, info.Height
+	video.PublishedAt = info.Timestamp
+	if video.PublishedAt == 0 && info.UploadDate != "" {
+		if date, err := time.Parse("20060102", info.UploadDate); err == nil {
+			video.PublishedAt = date.Unix()
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "video.*"))
+	for _, file := range files {
+		switch {
+		case strings.HasSuffix(file, ".info.json"):
+		case strings.HasSuffix(file, ".jpg"):
+			video.Thumbnail = file
+		default:
+			video.Path = file
+		}
+	}
+	if video.Path == "" {
+		video.Cleanup()
+		return nil, fmt.Errorf("yt-dlp did not download a video")
+	}
+	return video, nil
+}
+
+// ytdlpProxy returns the proxy URL for yt-dlp, which resolves host names
+// locally with socks5 and leaves them to the proxy with socks5h only.
+func ytdlpProxy(proxyURL *url.URL) string {
+	converted := *proxyURL
+	if converted.Scheme == "socks5" {
+		converted.Scheme = "socks5h"
+	}
+	return converted.String()
+}
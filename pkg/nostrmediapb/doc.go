@@ -0,0 +1,9 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package nostrmediapb holds the gRPC service of the upload pipeline,
+// generated from nostrmedia.proto.
+package nostrmediapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative nostrmedia.proto
@@ -0,0 +1,248 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: nostrmedia.proto
+
+package nostrmediapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Uploader_UploadVideo_FullMethodName    = "/nostrmedia.v1.Uploader/UploadVideo"
+	Uploader_UploadPictures_FullMethodName = "/nostrmedia.v1.Uploader/UploadPictures"
+	Uploader_PublishEvent_FullMethodName   = "/nostrmedia.v1.Uploader/PublishEvent"
+	Uploader_GetJobStatus_FullMethodName   = "/nostrmedia.v1.Uploader/GetJobStatus"
+)
+
+// UploaderClient is the client API for Uploader service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Uploader runs the upload pipeline of the serve command: media is uploaded
+// to Blossom and published asynchronously as a job.
+type UploaderClient interface {
+	// UploadVideo receives the metadata in the first message and the video
+	// file in chunks in the following ones, or only the metadata when it has
+	// a url. It returns the pending job publishing the NIP-71 event.
+	UploadVideo(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadVideoRequest, Job], error)
+	// UploadPictures receives the metadata in the first message, then for
+	// each picture a PictureFile message followed by its chunks. It returns
+	// the pending job publishing the NIP-68 event.
+	UploadPictures(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadPicturesRequest, Job], error)
+	// PublishEvent publishes an already signed event to the relays.
+	PublishEvent(ctx context.Context, in *PublishEventRequest, opts ...grpc.CallOption) (*PublishEventResponse, error)
+	// GetJobStatus returns the current state of a job.
+	GetJobStatus(ctx context.Context, in *GetJobStatusRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type uploaderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUploaderClient(cc grpc.ClientConnInterface) UploaderClient {
+	return &uploaderClient{cc}
+}
+
+func (c *uploaderClient) UploadVideo(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadVideoRequest, Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Uploader_ServiceDesc.Streams[0], Uploader_UploadVideo_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadVideoRequest, Job]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadVideoClient = grpc.ClientStreamingClient[UploadVideoRequest, Job]
+
+func (c *uploaderClient) UploadPictures(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadPicturesRequest, Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Uploader_ServiceDesc.Streams[1], Uploader_UploadPictures_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadPicturesRequest, Job]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadPicturesClient = grpc.ClientStreamingClient[UploadPicturesRequest, Job]
+
+func (c *uploaderClient) PublishEvent(ctx context.Context, in *PublishEventRequest, opts ...grpc.CallOption) (*PublishEventResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PublishEventResponse)
+	err := c.cc.Invoke(ctx, Uploader_PublishEvent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uploaderClient) GetJobStatus(ctx context.Context, in *GetJobStatusRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Uploader_GetJobStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploaderServer is the server API for Uploader service.
+// All implementations must embed UnimplementedUploaderServer
+// for forward compatibility.
+//
+// Uploader runs the upload pipeline of the serve command: media is uploaded
+// to Blossom and published asynchronously as a job.
+type UploaderServer interface {
+	// UploadVideo receives the metadata in the first message and the video
+	// file in chunks in the following ones, or only the metadata when it has
+	// a url. It returns the pending job publishing the NIP-71 event.
+	UploadVideo(grpc.ClientStreamingServer[UploadVideoRequest, Job]) error
+	// UploadPictures receives the metadata in the first message, then for
+	// each picture a PictureFile message followed by its chunks. It returns
+	// the pending job publishing the NIP-68 event.
+	UploadPictures(grpc.ClientStreamingServer[UploadPicturesRequest, Job]) error
+	// PublishEvent publishes an already signed event to the relays.
+	PublishEvent(context.Context, *PublishEventRequest) (*PublishEventResponse, error)
+	// GetJobStatus returns the current state of a job.
+	GetJobStatus(context.Context, *GetJobStatusRequest) (*Job, error)
+	mustEmbedUnimplementedUploaderServer()
+}
+
+// UnimplementedUploaderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUploaderServer struct{}
+
+func (UnimplementedUploaderServer) UploadVideo(grpc.ClientStreamingServer[UploadVideoRequest, Job]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadVideo not implemented")
+}
+func (UnimplementedUploaderServer) UploadPictures(grpc.ClientStreamingServer[UploadPicturesRequest, Job]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadPictures not implemented")
+}
+func (UnimplementedUploaderServer) PublishEvent(context.Context, *PublishEventRequest) (*PublishEventResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishEvent not implemented")
+}
+func (UnimplementedUploaderServer) GetJobStatus(context.Context, *GetJobStatusRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJobStatus not implemented")
+}
+func (UnimplementedUploaderServer) mustEmbedUnimplementedUploaderServer() {}
+func (UnimplementedUploaderServer) testEmbeddedByValue()                  {}
+
+// UnsafeUploaderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UploaderServer will
+// result in compilation errors.
+type UnsafeUploaderServer interface {
+	mustEmbedUnimplementedUploaderServer()
+}
+
+func RegisterUploaderServer(s grpc.ServiceRegistrar, srv UploaderServer) {
+	// If the following call pancis, it indicates UnimplementedUploaderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Uploader_ServiceDesc, srv)
+}
+
+func _Uploader_UploadVideo_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UploaderServer).UploadVideo(&grpc.GenericServerStream[UploadVideoRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadVideoServer = grpc.ClientStreamingServer[UploadVideoRequest, Job]
+
+func _Uploader_UploadPictures_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UploaderServer).UploadPictures(&grpc.GenericServerStream[UploadPicturesRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadPicturesServer = grpc.ClientStreamingServer[UploadPicturesRequest, Job]
+
+func _Uploader_PublishEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).PublishEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_PublishEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).PublishEvent(ctx, req.(*PublishEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Uploader_GetJobStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).GetJobStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_GetJobStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).GetJobStatus(ctx, req.(*GetJobStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Uploader_ServiceDesc is the grpc.ServiceDesc for Uploader service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Uploader_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nostrmedia.v1.Uploader",
+	HandlerType: (*UploaderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PublishEvent",
+			Handler:    _Uploader_PublishEvent_Handler,
+		},
+		{
+			MethodName: "GetJobStatus",
+			Handler:    _Uploader_GetJobStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadVideo",
+			Handler:       _Uploader_UploadVideo_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "UploadPictures",
+			Handler:       _Uploader_UploadPictures_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "nostrmedia.proto",
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nwc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// msatsPerUnit is the value in msats of one unit of each BOLT11 amount
+// multiplier, or of one bitcoin without multiplier.
+var msatsPerUnit = map[byte]int64{
+	'm': 100_000_000,
+	'u': 100_000,
+	'n': 100,
+	0:   100_000_000_000,
+}
+
+// InvoiceAmount returns the amount of a BOLT11 invoice in msats, read from
+// its human readable part, or 0 when the invoice leaves it to the payer.
+func InvoiceAmount(invoice string) (int64, error) {
+	invoice = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(invoice), "lightning:"))
+	separator := strings.LastIndexByte(invoice, '1')
+	if !strings.HasPrefix(invoice, "ln") || separator < 0 {
+		return 0, fmt.Errorf("invalid lightning invoice %q", invoice)
+	}
+	// ln, the currency letters, then the amount and its multiplier
+	hrp := strings.TrimLeft(invoice[2:separator], "abcdefghijklmnopqrstuvwxyz")
+	if hrp == "" {
+		return 0, nil
+	}
+	if hrp[len(hrp)-1] == 'p' {
+		// pico bitcoins are tenths of msats
+		pico, err := strconv.ParseInt(hrp[:len(hrp)-1], 10, 64)
+		if err != nil || pico <= 0 || pico%10 != 0 {
+			return 0, fmt.Errorf("invalid invoice amount %q", hrp)
+		}
+		return pico / 10, nil
+	}
+	var multiplier byte
+	if last := hrp[len(hrp)-1]; last < '0' || last > '9' {
+		multiplier, hrp = last, hrp[:len(hrp)-1]
+	}
+	perUnit, ok := msatsPerUnit[multiplier]
+	amount, err := strconv.ParseInt(hrp, 10, 64)
+	if !ok || err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid invoice amount %q", hrp)
+	}
+	// a wrapped product would pass any spending cap
+	if amount > math.MaxInt64/perUnit {
+		return 0, fmt.Errorf("invoice amount %q is too large", hrp)
+	}
+	return amount * perUnit, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nwc
+
+import "testing"
+
+func TestInvoiceAmount(t *testing.T) {
+	tests := []struct {
+		invoice string
+		want    int64
+	}{
+		{"lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqf", 250_000_000},
+		{"lnbc20m1pvjluezpp5qqqsyqcyq5rqwzqf", 2_000_000_000},
+		{"lnbc50n1pvjluezpp5qqqsyqcyq5rqwzqf", 5_000},
+		{"lnbc10p1pvjluezpp5qqqsyqcyq5rqwzqf", 1},
+		{"lnbc21pvjluezpp5qqqsyqcyq5rqwzqf", 200_000_000_000},
+		{"lntb100u1pvjluezpp5qqqsyqcyq5rqwzqf", 10_000_000},
+		{"lightning:LNBC2500U1PVJLUEZPP5QQQSYQCYQ5RQWZQF", 250_000_000},
+		// no amount, left to the payer
+		{"lnbc1pvjluezpp5qqqsyqcyq5rqwzqf", 0},
+	}
+	for _, test := range tests {
+		got, err := InvoiceAmount(test.invoice)
+		if err != nil || got != test.want {
+			t.Errorf("InvoiceAmount(%s) = %d, %v, want %d", test.invoice, got, err, test.want)
+		}
+	}
+
+	for _, invoice := range []string{
+		"lnbc99999999999999m1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc92233720368548u1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc9223372036854775807n1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc999999999999999999999m1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc0u1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc-5m1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc15p1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc0p1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc25x1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"bc2500u1pvjluezpp5qqqsyqcyq5rqwzqf",
+		"lnbc2500u",
+	} {
+		if got, err := InvoiceAmount(invoice); err == nil {
+			t.Errorf("InvoiceAmount(%s) = %d, want an error", invoice, got)
+		}
+	}
+}
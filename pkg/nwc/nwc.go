@@ -0,0 +1,254 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+// Package nwc pays lightning invoices through a Nostr Wallet Connect
+// (NIP-47) wallet service.
+package nwc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+// Kinds of the NIP-47 requests and responses
+const (
+	KindRequest  = 23194
+	KindResponse = 23195
+)
+
+// Wallet is a connection to a wallet service, as given by a
+// nostr+walletconnect:// URI.
+type Wallet struct {
+	// PubKey is the pubkey of the wallet service.
+	PubKey string
+	// Relays carry the requests and responses.
+	Relays []string
+	// secret is the private key of the connection, which signs the requests.
+	secret string
+}
+
+// Parse reads a nostr+walletconnect://<pubkey>?relay=...&secret=... URI.
+func Parse(uri string) (*Wallet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wallet connect URI: %v", err)
+	}
+	if u.Scheme != "nostr+walletconnect" && u.Scheme != "nostrwalletconnect" {
+		return nil, fmt.Errorf("invalid wallet connect URI scheme %q", u.Scheme)
+	}
+	// the pubkey is the host, or the opaque part without "//"
+	pubKey := u.Host
+	if pubKey == "" {
+		pubKey = strings.TrimPrefix(u.Opaque, "//")
+	}
+	if !nostr.IsValidPublicKey(pubKey) {
+		return nil, fmt.Errorf("invalid wallet pubkey %q", pubKey)
+	}
+	query := u.Query()
+	wallet := &Wallet{PubKey: pubKey, Relays: query["relay"], secret: query.Get("secret")}
+	if len(wallet.Relays) == 0 {
+		return nil, errors.New("wallet connect URI has no relay")
+	}
+	if _, err := nostr.GetPublicKey(wallet.secret); err != nil || len(wallet.secret) != 64 {
+		return nil, errors.New("wallet connect URI has no valid secret")
+	}
+	return wallet, nil
+}
+
+// request is the encrypted content of a request event.
+type request struct {
+	Method string         `json:"method"`
+	Params map[string]any `json:"params"`
+}
+
+// response is the encrypted content of a response event.
+type response struct {
+	ResultType string `json:"result_type"`
+	Error      *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// WalletError is an error response of the wallet service, with its NIP-47
+// code such as PAYMENT_FAILED or INSUFFICIENT_BALANCE.
+type WalletError struct {
+	Method  string
+	Code    string
+	Message string
+}
+
+func (e *WalletError) Error() string {
+	return fmt.Sprintf("wallet refused %s: %s %s", e.Method, e.Code, e.Message)
+}
+
+// notPaidCodes are the NIP-47 error codes telling for sure that an invoice
+// was not paid. INTERNAL and OTHER say nothing about the payment.
+var notPaidCodes = map[string]bool{
+	"PAYMENT_FAILED":       true,
+	"INSUFFICIENT_BALANCE": true,
+	"QUOTA_EXCEEDED":       true,
+	"RATE_LIMITED":         true,
+	"RESTRICTED":           true,
+	"UNAUTHORIZED":         true,
+	"NOT_IMPLEMENTED":      true,
+}
+
+// notPaid reports whether err from PayInvoice means the invoice was not
+// paid. A timeout or a lost relay connection may come after the wallet paid.
+func notPaid(err error) bool {
+	var walletErr *WalletError
+	return errors.As(err, &walletErr) && notPaidCodes[walletErr.Code]
+}
+
+// PayInvoice pays a bolt11 invoice and returns its preimage.
+func (w *Wallet) PayInvoice(ctx context.Context, invoice string) (string, error) {
+	var result struct {
+		Preimage string `json:"preimage"`
+	}
+	if err := w.call(ctx, "pay_invoice", map[string]any{"invoice": invoice}, &result); err != nil {
+		return "", err
+	}
+	if result.Preimage == "" {
+		return "", errors.New("wallet returned no preimage")
+	}
+	return result.Preimage, nil
+}
+
+// call sends a request to the wallet service and decodes the result of its
+// response, waiting for it until ctx is done.
+func (w *Wallet) call(ctx context.Context, method string, params map[string]any, result any) error {
+	key, err := nip04.ComputeSharedSecret(w.PubKey, w.secret)
+	if err != nil {
+		return fmt.Errorf("computing shared secret: %v", err)
+	}
+	content, err := json.Marshal(request{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	encrypted, err := nip04.Encrypt(string(content), key)
+	if err != nil {
+		return fmt.Errorf("encrypting request: %v", err)
+	}
+	event := nostr.Event{
+		Kind:      KindRequest,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", w.PubKey}},
+		Content:   encrypted,
+	}
+	if err := event.Sign(w.secret); err != nil {
+		return fmt.Errorf("signing request: %v", err)
+	}
+
+	// subscribe before publishing so a fast wallet is not missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	replies := pool.SubMany(ctx, w.Relays, nostr.Filters{{
+		Kinds:   []int{KindResponse},
+		Authors: []string{w.PubKey},
+		Tags:    nostr.TagMap{"e": []string{event.ID}},
+	}})
+	published := false
+	for status := range pool.PublishMany(ctx, w.Relays, event) {
+		published = published || status.Error == nil
+	}
+	if !published {
+		return fmt.Errorf("no wallet relay accepted the %s request", method)
+	}
+
+	for reply := range replies {
+		decrypted, err := nip04.Decrypt(reply.Content, key)
+		if err != nil {
+			return fmt.Errorf("decrypting wallet response: %v", err)
+		}
+		var resp response
+		if err := json.Unmarshal([]byte(decrypted), &resp); err != nil {
+			return fmt.Errorf("decoding wallet response: %v", err)
+		}
+		if resp.Error != nil {
+			return &WalletError{Method: method, Code: resp.Error.Code, Message: resp.Error.Message}
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("decoding %s result: %v", method, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("waiting for the wallet: %v", ctx.Err())
+}
+
+// Budget pays invoices through a wallet as long as their total stays within
+// a cap, for a whole run. It is safe for concurrent use.
+type Budget struct {
+	wallet payer
+	max    int64
+
+	mu    sync.Mutex
+	spent int64
+}
+
+// payer pays invoices, as Wallet does.
+type payer interface {
+	PayInvoice(ctx context.Context, invoice string) (string, error)
+}
+
+// NewBudget pays through wallet up to max msats in total, 0 for no limit.
+func NewBudget(wallet *Wallet, max int64) *Budget {
+	return &Budget{wallet: wallet, max: max}
+}
+
+// PayInvoice pays the invoice unless it would exceed the cap, and returns
+// its preimage. Invoices without an amount are refused when there is a cap.
+// A failed payment keeps counting against the cap unless the wallet said it
+// did not pay.
+func (b *Budget) PayInvoice(ctx context.Context, invoice string) (string, error) {
+	amount, err := InvoiceAmount(invoice)
+	if err != nil {
+		return "", err
+	}
+	// the amount is reserved before paying so that concurrent payments
+	// cannot exceed the cap together
+	b.mu.Lock()
+	if b.max > 0 && amount == 0 {
+		b.mu.Unlock()
+		return "", errors.New("invoice has no amount, refusing to pay it with a spending cap")
+	}
+	// compared to what is left, as spent+amount could overflow
+	if b.max > 0 && amount > b.max-b.spent {
+		b.mu.Unlock()
+		return "", fmt.Errorf("paying %d sats would exceed the spending cap of %d sats, %d sats spent already",
+			amount/1000, b.max/1000, b.spent/1000)
+	}
+	b.spent += amount
+	b.mu.Unlock()
+
+	preimage, err := b.wallet.PayInvoice(ctx, invoice)
+	if err != nil && notPaid(err) {
+		b.mu.Lock()
+		b.spent -= amount
+		b.mu.Unlock()
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v (the %d sats stay counted as spent, as the wallet may have paid)", err, amount/1000)
+	}
+	return preimage, nil
+}
+
+// Spent returns the msats paid so far, counting the failed payments the
+// wallet may have made.
+func (b *Budget) Spent() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent
+}
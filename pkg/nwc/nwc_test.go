@@ -0,0 +1,109 @@
+// Copyright (c) 2023 Girino Vey!
+// This file is part of the go-cli-utility project, which is licensed under the MIT License.
+// See the LICENSE file in the project root for more information.
+
+package nwc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 1000 sats each
+const testInvoice = "lnbc10u1pvjluezpp5qqqsyqcyq5rqwzqf"
+
+// fakeWallet pays every invoice after delay, or fails with err.
+type fakeWallet struct {
+	delay time.Duration
+	err   error
+	paid  atomic.Int32
+}
+
+func (w *fakeWallet) PayInvoice(ctx context.Context, invoice string) (string, error) {
+	time.Sleep(w.delay)
+	if w.err != nil {
+		return "", w.err
+	}
+	w.paid.Add(1)
+	return "preimage", nil
+}
+
+func TestBudgetCap(t *testing.T) {
+	ctx := context.Background()
+	wallet := &fakeWallet{}
+	budget := &Budget{wallet: wallet, max: 2_500_000}
+	for i := 0; i < 2; i++ {
+		if _, err := budget.PayInvoice(ctx, testInvoice); err != nil {
+			t.Fatalf("payment %d: %v", i, err)
+		}
+	}
+	if _, err := budget.PayInvoice(ctx, testInvoice); err == nil {
+		t.Error("paid beyond the cap")
+	}
+	if _, err := budget.PayInvoice(ctx, "lnbc1pvjluezpp5qqqsyqcyq5rqwzqf"); err == nil {
+		t.Error("paid an invoice without amount with a cap")
+	}
+	if spent := budget.Spent(); spent != 2_000_000 || wallet.paid.Load() != 2 {
+		t.Errorf("spent %d msats in %d payments, want 2000000 in 2", spent, wallet.paid.Load())
+	}
+
+	// spent+amount would wrap around to a negative total
+	huge := &Budget{wallet: wallet, max: math.MaxInt64, spent: math.MaxInt64 - 500}
+	if _, err := huge.PayInvoice(ctx, testInvoice); err == nil {
+		t.Error("paid beyond a cap close to the largest amount")
+	}
+
+	unlimited := &Budget{wallet: wallet}
+	if _, err := unlimited.PayInvoice(ctx, "lnbc1pvjluezpp5qqqsyqcyq5rqwzqf"); err != nil {
+		t.Errorf("no cap: %v", err)
+	}
+}
+
+func TestBudgetConcurrent(t *testing.T) {
+	ctx := context.Background()
+	wallet := &fakeWallet{delay: 10 * time.Millisecond}
+	budget := &Budget{wallet: wallet, max: 5_000_000}
+	var wg sync.WaitGroup
+	var paid atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := budget.PayInvoice(ctx, testInvoice); err == nil {
+				paid.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if paid.Load() != 5 || wallet.paid.Load() != 5 || budget.Spent() != 5_000_000 {
+		t.Errorf("%d payments succeeded, %d made, %d msats spent, want 5 within the cap", paid.Load(), wallet.paid.Load(), budget.Spent())
+	}
+}
+
+func TestBudgetFailures(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		err   error
+		spent int64
+	}{
+		{"payment failed", &WalletError{Method: "pay_invoice", Code: "PAYMENT_FAILED"}, 0},
+		{"insufficient balance", &WalletError{Method: "pay_invoice", Code: "INSUFFICIENT_BALANCE"}, 0},
+		{"internal error", &WalletError{Method: "pay_invoice", Code: "INTERNAL"}, 1_000_000},
+		{"timeout", errors.New("waiting for the wallet: context deadline exceeded"), 1_000_000},
+	}
+	for _, test := range tests {
+		budget := &Budget{wallet: &fakeWallet{err: test.err}, max: 10_000_000}
+		if _, err := budget.PayInvoice(ctx, testInvoice); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+		if spent := budget.Spent(); spent != test.spent {
+			t.Errorf("%s: spent %d msats, want %d", test.name, spent, test.spent)
+		}
+	}
+}